@@ -0,0 +1,336 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type (
+	// adminHandler is the REST admin API of an orchestrator
+	//
+	//   GET  /routes                      registered routes and their versions
+	//   GET  /routes/{id}?version=n       route graph, the latest version by default
+	//   POST /routes/{id}/executions      start an execution {"gid": "", "version": 0, "variables": {}}
+	//   GET  /executions?status=ABORTED   executions, all of them without status
+	//   GET  /executions/{gid}            execution status, state and context
+	//   POST /executions/{gid}/cancel     cancel a running execution
+	//   POST /executions/{gid}/resume     resume an interrupted execution from the caretaker
+	//   POST /executions/{gid}/redrive    execute an aborted execution again from its failed state
+	//   POST /executions/{gid}/signals/{name}  deliver a signal, the JSON object body is the signal payload
+	//   GET  /executions/{gid}/queries/{name}  run a registered query on the execution
+	adminHandler struct {
+		o *orchestrator
+	}
+
+	routeInfo struct {
+		Id       string `json:"id"`
+		Versions []int  `json:"versions"`
+		Latest   int    `json:"latest"`
+	}
+
+	routeGraphInfo struct {
+		Id      string      `json:"id"`
+		Version int         `json:"version"`
+		Graph   *RouteGraph `json:"graph"`
+	}
+
+	startRequest struct {
+		Gid       string                 `json:"gid"`
+		Version   int                    `json:"version"`
+		Variables map[string]interface{} `json:"variables"`
+	}
+
+	startResponse struct {
+		Gid       string `json:"gid"`
+		Duplicate bool   `json:"duplicate,omitempty"`
+	}
+
+	queryResponse struct {
+		Result interface{} `json:"result"`
+	}
+
+	errorResponse struct {
+		Error string `json:"error"`
+	}
+)
+
+// NewAdminHandler return the REST admin API of the orchestrator, the executions started, resumed or
+// re-driven through it run in background
+func NewAdminHandler(o *orchestrator) http.Handler {
+	return &adminHandler{o: o}
+}
+
+func (ah *adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case len(parts) == 1 && parts[0] == "routes" && r.Method == http.MethodGet:
+		ah.routes(w)
+	case len(parts) == 2 && parts[0] == "routes" && r.Method == http.MethodGet:
+		ah.route(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "routes" && parts[2] == "executions" && r.Method == http.MethodPost:
+		ah.start(w, r, parts[1])
+	case len(parts) == 1 && parts[0] == "executions" && r.Method == http.MethodGet:
+		ah.executions(w, r)
+	case len(parts) == 2 && parts[0] == "executions" && r.Method == http.MethodGet:
+		ah.execution(w, parts[1])
+	case len(parts) == 3 && parts[0] == "executions" && r.Method == http.MethodPost:
+		ah.command(w, parts[1], parts[2])
+	case len(parts) == 4 && parts[0] == "executions" && parts[2] == "signals" && r.Method == http.MethodPost:
+		ah.signal(w, r, parts[1], parts[3])
+	case len(parts) == 4 && parts[0] == "executions" && parts[2] == "queries" && r.Method == http.MethodGet:
+		ah.query(w, parts[1], parts[3])
+	case len(parts) == 1 && parts[0] == "pool" && r.Method == http.MethodGet:
+		ah.poolStats(w)
+	case len(parts) == 1 && parts[0] == "breakers" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, ah.o.Breakers().Metrics())
+	default:
+		writeError(w, http.StatusNotFound, errors.New(fmt.Sprintf("%s %s not found", r.Method, r.URL.Path)))
+	}
+}
+
+func (ah *adminHandler) routes(w http.ResponseWriter) {
+	ah.o.lock.RLock()
+	result := make([]routeInfo, 0, len(ah.o.routes))
+	for id, rv := range ah.o.routes {
+		if id == DefaultRecoveryRouteId {
+			continue
+		}
+
+		ri := routeInfo{Id: id, Latest: latestVersion(rv)}
+		for v := range rv {
+			ri.Versions = append(ri.Versions, v)
+		}
+		sort.Ints(ri.Versions)
+
+		result = append(result, ri)
+	}
+	ah.o.lock.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Id < result[j].Id
+	})
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (ah *adminHandler) route(w http.ResponseWriter, r *http.Request, id string) {
+	version := 0
+	if v := r.URL.Query().Get("version"); v != "" {
+		var err error
+		if version, err = strconv.Atoi(v); err != nil {
+			writeError(w, http.StatusBadRequest, errors.New(fmt.Sprintf("invalid version %s", v)))
+			return
+		}
+	}
+
+	ah.o.lock.RLock()
+	rv := ah.o.routes[id]
+	if version == 0 {
+		version = latestVersion(rv)
+	}
+	route := rv[version]
+	ah.o.lock.RUnlock()
+
+	if route == nil || id == DefaultRecoveryRouteId {
+		writeError(w, http.StatusNotFound, errors.New(fmt.Sprintf("route %s version %d not found", id, version)))
+		return
+	}
+
+	g, err := NewRouteGraph(route)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, routeGraphInfo{Id: id, Version: version, Graph: g})
+}
+
+func (ah *adminHandler) start(w http.ResponseWriter, r *http.Request, id string) {
+	var req startRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx, err := NewContext()
+	if req.Gid != "" {
+		ctx, err = NewContextWithGid(req.Gid)
+	}
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	for k, v := range req.Variables {
+		if err := ctx.SetVariable(k, v); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	ah.o.lock.RLock()
+	rv := ah.o.routes[id]
+	found := rv != nil && id != DefaultRecoveryRouteId && (req.Version == 0 || rv[req.Version] != nil)
+	ah.o.lock.RUnlock()
+
+	if !found {
+		writeError(w, http.StatusNotFound, errors.New(fmt.Sprintf("route %s version %d not found", id, req.Version)))
+		return
+	}
+
+	rr, err := ah.o.prepare(id, req.Version, ctx)
+	if errors.Is(err, ErrDuplicateExecution) {
+		writeJSON(w, http.StatusOK, startResponse{Gid: ctx.GetGid(), Duplicate: true})
+		return
+	}
+
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+
+	if _, err := ah.o.submit(rr, ctx, NormalPriority); err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, startResponse{Gid: ctx.GetGid()})
+}
+
+func (ah *adminHandler) executions(w http.ResponseWriter, r *http.Request) {
+	result, err := ah.o.Executions(ExecutionStatus(r.URL.Query().Get("status")))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if result == nil {
+		result = []*ExecutionInfo{}
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (ah *adminHandler) execution(w http.ResponseWriter, gid string) {
+	info, err := ah.o.Execution(gid)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, info)
+}
+
+func (ah *adminHandler) command(w http.ResponseWriter, gid string, command string) {
+	var err error
+	switch command {
+	case "cancel":
+		err = ah.o.Cancel(gid)
+	case "resume", "redrive":
+		status := Running
+		if command == "redrive" {
+			status = Aborted
+		}
+
+		var rr *routeRunner
+		if rr, err = ah.o.prepareFromMemento(gid, status); err == nil {
+			_, err = ah.o.submitResume(rr)
+		}
+	default:
+		writeError(w, http.StatusNotFound, errors.New(fmt.Sprintf("unknown command %s", command)))
+		return
+	}
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, startResponse{Gid: gid})
+}
+
+func (ah *adminHandler) signal(w http.ResponseWriter, r *http.Request, gid string, name string) {
+	var payload map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	rr, err := ah.o.prepareDelivery(gid, name, signalReceived, nil, payload)
+	if err == nil {
+		_, err = ah.o.submitResume(rr)
+	}
+
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, startResponse{Gid: gid})
+}
+
+func (ah *adminHandler) query(w http.ResponseWriter, gid string, name string) {
+	ah.o.lock.RLock()
+	found := ah.o.queries[name] != nil
+	ah.o.lock.RUnlock()
+
+	if !found {
+		writeError(w, http.StatusNotFound, errors.New(fmt.Sprintf("query %s is not registered", name)))
+		return
+	}
+
+	result, err := ah.o.Query(gid, name)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrExecutionNotFound) {
+			status = http.StatusNotFound
+		}
+
+		writeError(w, status, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, queryResponse{Result: result})
+}
+
+func (ah *adminHandler) poolStats(w http.ResponseWriter) {
+	stats, ok := ah.o.PoolStats()
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("worker pool is not started"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// errorStatus a missing execution is not found and a full pool is unavailable, otherwise the execution is not in
+// a state allowing the request
+func errorStatus(err error) int {
+	if errors.Is(err, ErrExecutionNotFound) {
+		return http.StatusNotFound
+	}
+
+	if errors.Is(err, ErrPoolFull) {
+		return http.StatusServiceUnavailable
+	}
+
+	return http.StatusConflict
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
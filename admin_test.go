@@ -0,0 +1,188 @@
+package orchestrator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func adminRequest(t *testing.T, h http.Handler, method string, path string, body interface{}, out interface{}) int {
+	var data []byte
+	if body != nil {
+		data, _ = json.Marshal(body)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, bytes.NewReader(data)))
+
+	if out != nil {
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), out))
+	}
+
+	return rec.Code
+}
+
+func waitForExecution(t *testing.T, o *orchestrator, gid string) *ExecutionInfo {
+	for i := 0; i < 200; i++ {
+		if info, err := o.Execution(gid); err == nil && info.Status != Running {
+			return info
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Fatalf("execution %s is still running", gid)
+	return nil
+}
+
+func TestAdminHandler_Routes(t *testing.T) {
+	orch := NewOrchestrator()
+	_ = orch.Register(NewNonTransactionalRoute("A").AddNextStep("1", doActionTest))
+	_ = orch.RegisterVersion(NewNonTransactionalRoute("A").AddNextStep("1", doActionTest).AddNextStep("2", doActionTest), 2)
+	_ = orch.Register(NewNonTransactionalRoute("B").AddNextStep("1", doActionTest))
+	_ = orch.Initialization(nil)
+	h := NewAdminHandler(orch)
+
+	var routes []routeInfo
+	assert.Equal(t, http.StatusOK, adminRequest(t, h, http.MethodGet, "/routes", nil, &routes))
+	assert.Equal(t, []routeInfo{{Id: "A", Versions: []int{1, 2}, Latest: 2}, {Id: "B", Versions: []int{1}, Latest: 1}}, routes)
+
+	var graph routeGraphInfo
+	assert.Equal(t, http.StatusOK, adminRequest(t, h, http.MethodGet, "/routes/A", nil, &graph))
+	assert.Equal(t, 2, graph.Version)
+	assert.Len(t, graph.Graph.Nodes, 4)
+
+	assert.Equal(t, http.StatusOK, adminRequest(t, h, http.MethodGet, "/routes/A?version=1", nil, &graph))
+	assert.Len(t, graph.Graph.Nodes, 3)
+
+	var e errorResponse
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, h, http.MethodGet, "/routes/A?version=3", nil, &e))
+	assert.Equal(t, "route A version 3 not found", e.Error)
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, h, http.MethodGet, "/routes/"+DefaultRecoveryRouteId, nil, nil))
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, h, http.MethodDelete, "/routes", nil, nil))
+}
+
+func TestAdminHandler_StartAndCancel(t *testing.T) {
+	started, release := make(chan bool), make(chan bool)
+
+	orch := NewOrchestrator()
+	_ = orch.Register(NewNonTransactionalRoute("A").
+		AddNextStep("1", func(ctx *context) error {
+			started <- true
+			<-release
+			return nil
+		}).
+		AddNextStep("2", doActionTest))
+	orch.SetCaretaker(NewMemoryCaretaker())
+	_ = orch.Initialization(nil)
+	h := NewAdminHandler(orch)
+
+	var sr startResponse
+	code := adminRequest(t, h, http.MethodPost, "/routes/A/executions",
+		startRequest{Gid: "order-1", Variables: map[string]interface{}{"amount": 10}}, &sr)
+	assert.Equal(t, http.StatusAccepted, code)
+	assert.Equal(t, "order-1", sr.Gid)
+	<-started
+
+	var info ExecutionInfo
+	assert.Equal(t, http.StatusOK, adminRequest(t, h, http.MethodGet, "/executions/order-1", nil, &info))
+	assert.Equal(t, Running, info.Status)
+	assert.Equal(t, "A_1", info.State)
+	assert.Equal(t, float64(10), info.Variables["amount"])
+
+	// the gid is already running
+	assert.Equal(t, http.StatusConflict, adminRequest(t, h, http.MethodPost, "/routes/A/executions",
+		startRequest{Gid: "order-1"}, nil))
+
+	assert.Equal(t, http.StatusAccepted, adminRequest(t, h, http.MethodPost, "/executions/order-1/cancel", nil, nil))
+	release <- true
+
+	info = *waitForExecution(t, orch, "order-1")
+	assert.Equal(t, Aborted, info.Status)
+	assert.Equal(t, "A_2", info.State)
+
+	assert.Equal(t, http.StatusConflict, adminRequest(t, h, http.MethodPost, "/executions/order-1/cancel", nil, nil))
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, h, http.MethodGet, "/executions/unknown", nil, nil))
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, h, http.MethodPost, "/routes/C/executions", startRequest{}, nil))
+	assert.Equal(t, http.StatusBadRequest, adminRequest(t, h, http.MethodPost, "/routes/A/executions", "[", nil))
+}
+
+func TestAdminHandler_ResumeAndRedrive(t *testing.T) {
+	journal := NewMemoryCaretaker()
+	failures := 1
+
+	orch := NewOrchestrator()
+	orch.SetCaretaker(journal)
+	_ = orch.Register(NewNonTransactionalRoute("A").
+		AddNextStep("1", appendStep("1")).
+		AddNextStep("2", func(ctx *context) error {
+			if failures > 0 {
+				failures--
+				return errors.New("unavailable")
+			}
+
+			return appendStep("2")(ctx)
+		}).
+		AddNextStep("3", appendStep("3")))
+	_ = orch.Initialization(nil)
+	h := NewAdminHandler(orch)
+
+	ctx, _ := NewContextWithGid("dead")
+	result, _ := orch.Exec("A", ctx)
+	assert.Equal(t, Aborted, result.Status)
+
+	var dead []*ExecutionInfo
+	assert.Equal(t, http.StatusOK, adminRequest(t, h, http.MethodGet, "/executions?status=ABORTED", nil, &dead))
+	assert.Len(t, dead, 1)
+	assert.Equal(t, "A_2", dead[0].State)
+	assert.Len(t, dead[0].Errors, 1)
+
+	assert.Equal(t, http.StatusConflict, adminRequest(t, h, http.MethodPost, "/executions/dead/resume", nil, nil))
+	assert.Equal(t, http.StatusAccepted, adminRequest(t, h, http.MethodPost, "/executions/dead/redrive", nil, nil))
+
+	info := waitForExecution(t, orch, "dead")
+	assert.Equal(t, Completed, info.Status)
+	assert.Equal(t, "1;2;3;", info.Variables["STEPS"])
+
+	// an interrupted execution is resumed from its latest memento
+	ctx, _ = NewContextWithGid("interrupted")
+	_, _ = orch.Exec("A", ctx)
+	orch.caretaker = interruptedJournal(journal, "interrupted", "A_3")
+
+	assert.Equal(t, http.StatusAccepted, adminRequest(t, h, http.MethodPost, "/executions/interrupted/resume", nil, nil))
+	info = waitForExecution(t, orch, "interrupted")
+	assert.Equal(t, Completed, info.Status)
+
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, h, http.MethodPost, "/executions/unknown/redrive", nil, nil))
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, h, http.MethodPost, "/executions/dead/unknown", nil, nil))
+}
+
+func TestAdminHandler_Signal(t *testing.T) {
+	orch := NewOrchestrator()
+	orch.SetCaretaker(NewMemoryCaretaker())
+	_ = orch.Register(approvalRoute(0))
+	_ = orch.Initialization(nil)
+	h := NewAdminHandler(orch)
+
+	assert.Equal(t, http.StatusAccepted, adminRequest(t, h, http.MethodPost, "/routes/A/executions", startRequest{Gid: "gid"}, nil))
+	info := waitForExecution(t, orch, "gid")
+	assert.Equal(t, Waiting, info.Status)
+
+	assert.Equal(t, http.StatusConflict, adminRequest(t, h, http.MethodPost, "/executions/gid/signals/payment", nil, nil))
+	assert.Equal(t, http.StatusBadRequest, adminRequest(t, h, http.MethodPost, "/executions/gid/signals/approval", "[", nil))
+	assert.Equal(t, http.StatusAccepted, adminRequest(t, h, http.MethodPost, "/executions/gid/signals/approval",
+		map[string]interface{}{"approved": true}, nil))
+
+	for i := 0; i < 200 && info.Status != Completed; i++ {
+		time.Sleep(5 * time.Millisecond)
+		info, _ = orch.Execution("gid")
+	}
+
+	assert.Equal(t, Completed, info.Status)
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, h, http.MethodPost, "/executions/unknown/signals/approval", nil, nil))
+}
@@ -2,21 +2,68 @@ package orchestrator
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
+	"sort"
+	"sync"
 	"time"
 )
 
 type caretaker interface {
 	persist(id string, memento string) error
 	get(id string) (string, error)
+	ids() ([]string, error)
+
+	// latest return the latest log of each id in the order of the ids
+	latest() ([]logStr, error)
+
+	// effects keep the recorded side effects of the executions
+	effects() effectStore
+
 	shutdown() error
 }
 
 type fileCaretaker struct {
 	caretaker
 	f *os.File
+
+	// index the latest log of each id in the journal up to the offset, the lines appended since are read on demand
+	lock   sync.Mutex
+	index  map[string]logStr
+	order  []string
+	offset int64
+
+	effectStore *fileEffects
+}
+
+type memoryCaretaker struct {
+	caretaker
+	lock    sync.RWMutex
+	journal map[string][]string
+
+	effectStore *memoryEffects
+}
+
+// fileEffects keep the side effects of each execution in its own file of the directory, the file is removed once
+// the execution is finished
+type fileEffects struct {
+	lock sync.Mutex
+	dir  string
+}
+
+// memoryEffects keep the side effects by gid and key
+type memoryEffects struct {
+	lock    sync.Mutex
+	effects map[string]map[string]string
+}
+
+type effectLog struct {
+	Key  string `json:"key"`
+	Data string `json:"data"`
 }
 
 type logStr struct {
@@ -27,6 +74,9 @@ type logStr struct {
 
 var basePath = "."
 
+// maxLogSize is the longest journal line, a memento carries the whole execution context
+const maxLogSize = 16 * 1024 * 1024
+
 func NewFileCareTacker(id string) (*fileCaretaker, error) {
 	fileAddress := fmt.Sprintf("%s/%s.log", basePath, id)
 	af, err := os.OpenFile(fileAddress,
@@ -38,7 +88,9 @@ func NewFileCareTacker(id string) (*fileCaretaker, error) {
 	}
 
 	return &fileCaretaker{
-		f: af,
+		f:           af,
+		index:       make(map[string]logStr),
+		effectStore: &fileEffects{dir: fmt.Sprintf("%s/%s.effects", basePath, id)},
 	}, nil
 }
 
@@ -57,32 +109,266 @@ func (c *fileCaretaker) persist(id string, memento string) error {
 	return wErr
 }
 
-// TODO: improve performance issue
-// open new file descriptor to journal start to find the latest event ID from file head
 func (c *fileCaretaker) get(id string) (string, error) {
-	f, oErr := os.Open(c.f.Name())
-	if oErr != nil {
-		return "", oErr
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := c.scan(); err != nil {
+		return "", err
 	}
 
-	var lastLog logStr
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		var log logStr
-		err := json.Unmarshal(scanner.Bytes(), &log)
+	return c.index[id].Data, nil
+}
+
+// ids return the journal ids in the order they are first persisted
+func (c *fileCaretaker) ids() ([]string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := c.scan(); err != nil {
+		return nil, err
+	}
+
+	return append([]string(nil), c.order...), nil
+}
+
+func (c *fileCaretaker) latest() ([]logStr, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := c.scan(); err != nil {
+		return nil, err
+	}
+
+	logs := make([]logStr, 0, len(c.order))
+	for _, id := range c.order {
+		logs = append(logs, c.index[id])
+	}
+
+	return logs, nil
+}
+
+// scan index the journal lines appended since the latest scan, whoever wrote them. A line which is not complete
+// yet is read by the next scan
+func (c *fileCaretaker) scan() error {
+	f, err := os.Open(c.f.Name())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(c.offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return nil
+		}
+
 		if err != nil {
-			return "", err
+			return err
+		}
+
+		if len(line) > maxLogSize {
+			return bufio.ErrTooLong
 		}
 
-		if log.Id == id {
-			lastLog = log
+		n := int64(len(line))
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var log logStr
+			if err := json.Unmarshal(line, &log); err != nil {
+				return err
+			}
+
+			if _, ok := c.index[log.Id]; !ok {
+				c.order = append(c.order, log.Id)
+			}
+			c.index[log.Id] = log
 		}
+
+		c.offset += n
 	}
+}
 
-	return lastLog.Data, nil
+func (c *fileCaretaker) effects() effectStore {
+	return c.effectStore
 }
 
 func (c *fileCaretaker) shutdown() error {
 	c.f.Sync()
 	return c.f.Close()
 }
+
+// NewMemoryCaretaker keep the mementos in memory, the journal is lost when the process stops
+func NewMemoryCaretaker() *memoryCaretaker {
+	return &memoryCaretaker{
+		journal:     make(map[string][]string),
+		effectStore: &memoryEffects{effects: make(map[string]map[string]string)},
+	}
+}
+
+func (c *memoryCaretaker) persist(id string, memento string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.journal[id] = append(c.journal[id], memento)
+	return nil
+}
+
+func (c *memoryCaretaker) get(id string) (string, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	mementos := c.journal[id]
+	if len(mementos) == 0 {
+		return "", nil
+	}
+
+	return mementos[len(mementos)-1], nil
+}
+
+func (c *memoryCaretaker) ids() ([]string, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	ids := make([]string, 0, len(c.journal))
+	for id := range c.journal {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (c *memoryCaretaker) latest() ([]logStr, error) {
+	ids, err := c.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	logs := make([]logStr, 0, len(ids))
+	for _, id := range ids {
+		mementos := c.journal[id]
+		logs = append(logs, logStr{Id: id, Data: mementos[len(mementos)-1]})
+	}
+
+	return logs, nil
+}
+
+func (c *memoryCaretaker) shutdown() error {
+	return nil
+}
+
+func (c *memoryCaretaker) effects() effectStore {
+	return c.effectStore
+}
+
+// path of the execution file, the gid is escaped to a file name
+func (fe *fileEffects) path(gid string) string {
+	return fmt.Sprintf("%s/%s.log", fe.dir, url.PathEscape(gid))
+}
+
+func (fe *fileEffects) record(gid string, key string, effect string) error {
+	log, err := json.Marshal(effectLog{Key: key, Data: effect})
+	if err != nil {
+		return err
+	}
+
+	fe.lock.Lock()
+	defer fe.lock.Unlock()
+
+	if err := os.MkdirAll(fe.dir, 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(fe.path(gid), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(log, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func (fe *fileEffects) recorded(gid string, key string) (string, error) {
+	fe.lock.Lock()
+	defer fe.lock.Unlock()
+
+	f, err := os.Open(fe.path(gid))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	effect := ""
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, maxLogSize)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var log effectLog
+		if err := json.Unmarshal(scanner.Bytes(), &log); err != nil {
+			return "", err
+		}
+
+		if log.Key == key {
+			effect = log.Data
+		}
+	}
+
+	return effect, scanner.Err()
+}
+
+func (fe *fileEffects) forget(gid string) error {
+	fe.lock.Lock()
+	defer fe.lock.Unlock()
+
+	if err := os.Remove(fe.path(gid)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (me *memoryEffects) record(gid string, key string, effect string) error {
+	me.lock.Lock()
+	defer me.lock.Unlock()
+
+	if me.effects[gid] == nil {
+		me.effects[gid] = make(map[string]string)
+	}
+
+	me.effects[gid][key] = effect
+	return nil
+}
+
+func (me *memoryEffects) recorded(gid string, key string) (string, error) {
+	me.lock.Lock()
+	defer me.lock.Unlock()
+
+	return me.effects[gid][key], nil
+}
+
+func (me *memoryEffects) forget(gid string) error {
+	me.lock.Lock()
+	defer me.lock.Unlock()
+
+	delete(me.effects, gid)
+	return nil
+}
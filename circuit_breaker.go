@@ -0,0 +1,488 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	// BreakerState of a circuit breaker
+	BreakerState string
+
+	// BreakerListener is called on each state change of a breaker
+	BreakerListener func(name string, from BreakerState, to BreakerState)
+
+	// BreakerConfig tell when a circuit breaker opens and how it closes again
+	BreakerConfig struct {
+		// ConsecutiveFailures open the breaker after as many failures in a row, zero disables it
+		ConsecutiveFailures int
+
+		// FailureRate open the breaker when the failure ratio of the window reaches it, from 0 to 1, zero disables it
+		FailureRate float64
+
+		// WindowSize latest calls the failure rate is computed on, default is 20
+		WindowSize int
+
+		// MinimumCalls the failure rate is computed after as many calls in the window, default is the window size
+		MinimumCalls int
+
+		// CoolDown the open breaker fails fast during the cool-down then lets trial calls through, default is 30s
+		CoolDown time.Duration
+
+		// HalfOpenCalls trial calls which must succeed to close the breaker, default is 1
+		HalfOpenCalls int
+
+		// IsFailure default is any error
+		IsFailure func(err error) bool
+
+		Clock Clock
+	}
+
+	// BreakerMetrics is the state and the counters of a circuit breaker
+	BreakerMetrics struct {
+		Name  string       `json:"name"`
+		State BreakerState `json:"state"`
+
+		Calls    int64 `json:"calls"`
+		Failures int64 `json:"failures"`
+		Rejected int64 `json:"rejected"`
+
+		ConsecutiveFailures int     `json:"consecutive_failures"`
+		FailureRate         float64 `json:"failure_rate"`
+
+		OpenedAt *time.Time `json:"opened_at,omitempty"`
+	}
+
+	// CircuitOpenError is returned by the calls rejected by an open circuit breaker
+	CircuitOpenError struct {
+		Name string
+
+		// RetryAt the breaker lets trial calls through
+		RetryAt time.Time
+	}
+
+	// CircuitBreaker fail the calls fast while the guarded service keeps failing
+	CircuitBreaker struct {
+		name     string
+		config   BreakerConfig
+		listener BreakerListener
+
+		lock  sync.Mutex
+		state BreakerState
+
+		// window latest call outcomes of the closed breaker, true is a failure
+		window   []bool
+		next     int
+		filled   int
+		failures int
+
+		consecutive int
+		openedAt    time.Time
+
+		// generation change on each transition, the outcome of a call allowed before is ignored
+		generation int
+
+		// trial calls of the half-open breaker
+		inFlight  int
+		succeeded int
+
+		calls    int64
+		failed   int64
+		rejected int64
+	}
+
+	// BreakerRegistry share the circuit breakers by name
+	BreakerRegistry struct {
+		lock     sync.Mutex
+		breakers map[string]*CircuitBreaker
+		listener BreakerListener
+	}
+
+	breakerTransition struct {
+		from, to BreakerState
+	}
+)
+
+const (
+	BreakerClosed   BreakerState = "CLOSED"
+	BreakerOpen     BreakerState = "OPEN"
+	BreakerHalfOpen BreakerState = "HALF_OPEN"
+)
+
+const (
+	defaultBreakerWindow   = 20
+	defaultBreakerCoolDown = 30 * time.Second
+)
+
+// ErrCircuitOpen is the error a CircuitOpenError is, whatever the breaker
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+func (coe *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker %s is open until %s", coe.Name, coe.RetryAt.Format(time.RFC3339))
+}
+
+func (coe *CircuitOpenError) Unwrap() error {
+	return ErrCircuitOpen
+}
+
+// CircuitOpen is true in the recovery route when the step failed fast on the open breaker, an empty name
+// matches any breaker
+func CircuitOpen(name string) func(ctx context) bool {
+	return func(ctx context) bool {
+		err, ok := ctx.GetVariable(RecoveryErrorHeaderKey).(error)
+		if !ok {
+			return false
+		}
+
+		var coe *CircuitOpenError
+		return errors.As(err, &coe) && (name == "" || coe.Name == name)
+	}
+}
+
+// NewCircuitBreaker create a closed circuit breaker, it needs a consecutive failures or a failure rate threshold
+func NewCircuitBreaker(name string, config BreakerConfig) (*CircuitBreaker, error) {
+	if name == "" {
+		return nil, errors.New("circuit breaker name is empty")
+	}
+
+	if config.ConsecutiveFailures <= 0 && config.FailureRate <= 0 {
+		return nil, errors.New(fmt.Sprintf("circuit breaker %s has no threshold", name))
+	}
+
+	if config.FailureRate > 1 {
+		return nil, errors.New(fmt.Sprintf("circuit breaker %s failure rate %v is above 1", name, config.FailureRate))
+	}
+
+	if config.WindowSize <= 0 {
+		config.WindowSize = defaultBreakerWindow
+	}
+
+	if config.MinimumCalls <= 0 || config.MinimumCalls > config.WindowSize {
+		config.MinimumCalls = config.WindowSize
+	}
+
+	if config.CoolDown <= 0 {
+		config.CoolDown = defaultBreakerCoolDown
+	}
+
+	if config.HalfOpenCalls <= 0 {
+		config.HalfOpenCalls = 1
+	}
+
+	if config.IsFailure == nil {
+		config.IsFailure = func(err error) bool {
+			return err != nil
+		}
+	}
+
+	if config.Clock == nil {
+		config.Clock = systemClock{}
+	}
+
+	return &CircuitBreaker{
+		name:   name,
+		config: config,
+		state:  BreakerClosed,
+		window: make([]bool, config.WindowSize),
+	}, nil
+}
+
+// Name of the breaker
+func (cb *CircuitBreaker) Name() string {
+	return cb.name
+}
+
+// SetListener replace the listener of the breaker state changes
+func (cb *CircuitBreaker) SetListener(l BreakerListener) {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	cb.listener = l
+}
+
+// Execute call the function unless the breaker is open and record its outcome, a panic is recorded as a failure
+// before it's raised again
+func (cb *CircuitBreaker) Execute(fn func() error) (err error) {
+	generation, err := cb.allow()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			cb.record(generation, true)
+			panic(r)
+		}
+	}()
+
+	err = fn()
+	cb.record(generation, cb.config.IsFailure(err))
+
+	return err
+}
+
+// Wrap guard a step action with the breaker
+func (cb *CircuitBreaker) Wrap(action func(ctx *context) error) func(ctx *context) error {
+	return func(ctx *context) error {
+		return cb.Execute(func() error {
+			return action(ctx)
+		})
+	}
+}
+
+// WrapUndo guard a transactional step undo action with the breaker
+func (cb *CircuitBreaker) WrapUndo(undoAction func(ctx context) error) func(ctx context) error {
+	return func(ctx context) error {
+		return cb.Execute(func() error {
+			return undoAction(ctx)
+		})
+	}
+}
+
+// State of the breaker, an open breaker is half-open once its cool-down is passed
+func (cb *CircuitBreaker) State() BreakerState {
+	cb.lock.Lock()
+	t := cb.advance()
+	state := cb.state
+	cb.lock.Unlock()
+
+	cb.notify(t)
+	return state
+}
+
+// Metrics return the state and the counters of the breaker
+func (cb *CircuitBreaker) Metrics() *BreakerMetrics {
+	cb.lock.Lock()
+	t := cb.advance()
+
+	m := &BreakerMetrics{
+		Name:                cb.name,
+		State:               cb.state,
+		Calls:               cb.calls,
+		Failures:            cb.failed,
+		Rejected:            cb.rejected,
+		ConsecutiveFailures: cb.consecutive,
+	}
+
+	if cb.filled > 0 {
+		m.FailureRate = float64(cb.failures) / float64(cb.filled)
+	}
+
+	if cb.state != BreakerClosed {
+		openedAt := cb.openedAt
+		m.OpenedAt = &openedAt
+	}
+	cb.lock.Unlock()
+
+	cb.notify(t)
+	return m
+}
+
+// allow reserve a call or reject it with a CircuitOpenError
+func (cb *CircuitBreaker) allow() (int, error) {
+	cb.lock.Lock()
+	t := cb.advance()
+	generation := cb.generation
+
+	var err error
+	switch {
+	case cb.state == BreakerOpen,
+		cb.state == BreakerHalfOpen && cb.inFlight >= cb.config.HalfOpenCalls:
+		cb.rejected++
+		err = &CircuitOpenError{Name: cb.name, RetryAt: cb.openedAt.Add(cb.config.CoolDown)}
+	case cb.state == BreakerHalfOpen:
+		cb.inFlight++
+		cb.calls++
+	default:
+		cb.calls++
+	}
+	cb.lock.Unlock()
+
+	cb.notify(t)
+	return generation, err
+}
+
+// record the outcome of an allowed call
+func (cb *CircuitBreaker) record(generation int, failure bool) {
+	cb.lock.Lock()
+	if failure {
+		cb.failed++
+	}
+
+	if generation != cb.generation {
+		cb.lock.Unlock()
+		return
+	}
+
+	var t *breakerTransition
+	switch cb.state {
+	case BreakerHalfOpen:
+		cb.inFlight--
+		if failure {
+			t = cb.transit(BreakerOpen)
+			break
+		}
+
+		cb.succeeded++
+		if cb.succeeded >= cb.config.HalfOpenCalls {
+			t = cb.transit(BreakerClosed)
+		}
+	case BreakerClosed:
+		cb.push(failure)
+
+		if cb.tripped() {
+			t = cb.transit(BreakerOpen)
+		}
+	}
+	cb.lock.Unlock()
+
+	cb.notify(t)
+}
+
+// push the call outcome into the sliding window
+func (cb *CircuitBreaker) push(failure bool) {
+	if cb.filled == len(cb.window) {
+		if cb.window[cb.next] {
+			cb.failures--
+		}
+	} else {
+		cb.filled++
+	}
+
+	cb.window[cb.next] = failure
+	cb.next = (cb.next + 1) % len(cb.window)
+
+	if failure {
+		cb.failures++
+		cb.consecutive++
+	} else {
+		cb.consecutive = 0
+	}
+}
+
+func (cb *CircuitBreaker) tripped() bool {
+	if cb.config.ConsecutiveFailures > 0 && cb.consecutive >= cb.config.ConsecutiveFailures {
+		return true
+	}
+
+	return cb.config.FailureRate > 0 && cb.filled >= cb.config.MinimumCalls &&
+		float64(cb.failures)/float64(cb.filled) >= cb.config.FailureRate
+}
+
+// advance an open breaker to half-open once the cool-down is passed
+func (cb *CircuitBreaker) advance() *breakerTransition {
+	if cb.state != BreakerOpen || cb.config.Clock.Now().Before(cb.openedAt.Add(cb.config.CoolDown)) {
+		return nil
+	}
+
+	return cb.transit(BreakerHalfOpen)
+}
+
+// transit change the state, the window is reset when the breaker closes
+func (cb *CircuitBreaker) transit(to BreakerState) *breakerTransition {
+	t := &breakerTransition{from: cb.state, to: to}
+	cb.state = to
+	cb.generation++
+	cb.inFlight = 0
+	cb.succeeded = 0
+
+	switch to {
+	case BreakerOpen:
+		cb.openedAt = cb.config.Clock.Now()
+	case BreakerClosed:
+		cb.window = make([]bool, len(cb.window))
+		cb.next, cb.filled, cb.failures, cb.consecutive = 0, 0, 0, 0
+	}
+
+	return t
+}
+
+// notify the listener out of the lock
+func (cb *CircuitBreaker) notify(t *breakerTransition) {
+	if t == nil {
+		return
+	}
+
+	cb.lock.Lock()
+	l := cb.listener
+	cb.lock.Unlock()
+
+	if l != nil {
+		l(cb.name, t.from, t.to)
+	}
+}
+
+// NewBreakerRegistry create an empty breaker registry
+func NewBreakerRegistry() *BreakerRegistry {
+	return &BreakerRegistry{
+		breakers: make(map[string]*CircuitBreaker),
+	}
+}
+
+// SetListener listen to the state changes of the registered breakers
+func (br *BreakerRegistry) SetListener(l BreakerListener) {
+	br.lock.Lock()
+	defer br.lock.Unlock()
+
+	br.listener = l
+	for _, cb := range br.breakers {
+		cb.SetListener(l)
+	}
+}
+
+// Breaker return the breaker registered with the name, it's created with the config the first time
+func (br *BreakerRegistry) Breaker(name string, config BreakerConfig) (*CircuitBreaker, error) {
+	br.lock.Lock()
+	defer br.lock.Unlock()
+
+	if cb := br.breakers[name]; cb != nil {
+		return cb, nil
+	}
+
+	cb, err := NewCircuitBreaker(name, config)
+	if err != nil {
+		return nil, err
+	}
+
+	cb.listener = br.listener
+	br.breakers[name] = cb
+
+	return cb, nil
+}
+
+// Get return the registered breaker, nil when it's not registered
+func (br *BreakerRegistry) Get(name string) *CircuitBreaker {
+	br.lock.Lock()
+	defer br.lock.Unlock()
+
+	return br.breakers[name]
+}
+
+// Metrics return the metrics of the registered breakers sorted by name
+func (br *BreakerRegistry) Metrics() []*BreakerMetrics {
+	br.lock.Lock()
+	breakers := make([]*CircuitBreaker, 0, len(br.breakers))
+	for _, cb := range br.breakers {
+		breakers = append(breakers, cb)
+	}
+	br.lock.Unlock()
+
+	result := make([]*BreakerMetrics, 0, len(breakers))
+	for _, cb := range breakers {
+		result = append(result, cb.Metrics())
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
+
+// Breakers return the circuit breakers shared by the executions of the orchestrator
+func (o *orchestrator) Breakers() *BreakerRegistry {
+	return o.breakers
+}
@@ -0,0 +1,218 @@
+package orchestrator
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+var errUnavailable = errors.New("unavailable")
+
+func newTestBreaker(t *testing.T, config BreakerConfig) (*CircuitBreaker, *testClock, *[]string) {
+	clock := &testClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	config.Clock = clock
+
+	cb, err := NewCircuitBreaker("payments", config)
+	assert.Nil(t, err)
+
+	var transitions []string
+	cb.SetListener(func(name string, from BreakerState, to BreakerState) {
+		transitions = append(transitions, string(from)+">"+string(to))
+	})
+
+	return cb, clock, &transitions
+}
+
+// calls run the outcomes through the breaker, true is a failure
+func calls(cb *CircuitBreaker, outcomes ...bool) []error {
+	var result []error
+	for _, failure := range outcomes {
+		result = append(result, cb.Execute(func() error {
+			if failure {
+				return errUnavailable
+			}
+
+			return nil
+		}))
+	}
+
+	return result
+}
+
+func TestCircuitBreaker_ConsecutiveFailures(t *testing.T) {
+	cb, clock, transitions := newTestBreaker(t, BreakerConfig{ConsecutiveFailures: 3, CoolDown: time.Minute})
+
+	calls(cb, true, true, false, true, true)
+	assert.Equal(t, BreakerClosed, cb.State())
+
+	calls(cb, true)
+	assert.Equal(t, BreakerOpen, cb.State())
+
+	called := false
+	err := cb.Execute(func() error {
+		called = true
+		return nil
+	})
+	assert.False(t, called)
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+
+	var coe *CircuitOpenError
+	assert.True(t, errors.As(err, &coe))
+	assert.Equal(t, clock.now.Add(time.Minute), coe.RetryAt)
+
+	clock.add(time.Minute)
+	assert.Equal(t, BreakerHalfOpen, cb.State())
+
+	calls(cb, false)
+	assert.Equal(t, BreakerClosed, cb.State())
+	assert.Equal(t, []string{"CLOSED>OPEN", "OPEN>HALF_OPEN", "HALF_OPEN>CLOSED"}, *transitions)
+
+	m := cb.Metrics()
+	assert.Equal(t, int64(7), m.Calls)
+	assert.Equal(t, int64(5), m.Failures)
+	assert.Equal(t, int64(1), m.Rejected)
+	assert.Nil(t, m.OpenedAt)
+}
+
+func TestCircuitBreaker_FailureRate(t *testing.T) {
+	cb, _, _ := newTestBreaker(t, BreakerConfig{FailureRate: 0.5, WindowSize: 4})
+
+	// the rate is computed once the window is filled
+	calls(cb, true, true, true)
+	assert.Equal(t, BreakerClosed, cb.State())
+	assert.Equal(t, 1.0, cb.Metrics().FailureRate)
+
+	// the oldest outcomes slide out of the window
+	cb, _, _ = newTestBreaker(t, BreakerConfig{FailureRate: 0.5, WindowSize: 4})
+	calls(cb, true, false, false, false, false)
+	assert.Equal(t, 0.0, cb.Metrics().FailureRate)
+
+	calls(cb, true, true)
+	assert.Equal(t, BreakerOpen, cb.State())
+
+	cb, _, _ = newTestBreaker(t, BreakerConfig{FailureRate: 0.5, WindowSize: 4, MinimumCalls: 2})
+	calls(cb, false, true)
+	assert.Equal(t, BreakerOpen, cb.State())
+}
+
+func TestCircuitBreaker_HalfOpen(t *testing.T) {
+	cb, clock, transitions := newTestBreaker(t, BreakerConfig{ConsecutiveFailures: 1, CoolDown: time.Minute, HalfOpenCalls: 2})
+
+	calls(cb, true)
+	clock.add(time.Minute)
+
+	// a trial call failing opens the breaker again
+	calls(cb, false, true)
+	assert.Equal(t, BreakerOpen, cb.State())
+
+	clock.add(time.Minute)
+
+	// the trial calls are limited while they run
+	var rejected []error
+	_ = cb.Execute(func() error {
+		_ = cb.Execute(func() error {
+			rejected = calls(cb, false)
+			return nil
+		})
+		return nil
+	})
+	assert.True(t, errors.Is(rejected[0], ErrCircuitOpen))
+	assert.Equal(t, BreakerClosed, cb.State())
+
+	assert.Equal(t, []string{"CLOSED>OPEN", "OPEN>HALF_OPEN", "HALF_OPEN>OPEN", "OPEN>HALF_OPEN", "HALF_OPEN>CLOSED"},
+		*transitions)
+}
+
+func TestCircuitBreaker_Panic(t *testing.T) {
+	cb, clock, _ := newTestBreaker(t, BreakerConfig{ConsecutiveFailures: 1, CoolDown: time.Minute, HalfOpenCalls: 1})
+
+	calls(cb, true)
+	clock.add(time.Minute)
+
+	// a panicking trial call is a failure and releases its half-open slot
+	assert.Panics(t, func() {
+		_ = cb.Execute(func() error { panic("boom") })
+	})
+	assert.Equal(t, BreakerOpen, cb.State())
+	assert.Equal(t, int64(2), cb.Metrics().Failures)
+
+	clock.add(time.Minute)
+	assert.Nil(t, cb.Execute(func() error { return nil }))
+	assert.Equal(t, BreakerClosed, cb.State())
+}
+
+func TestNewCircuitBreaker(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   BreakerConfig
+		expected string
+	}{
+		{"", BreakerConfig{ConsecutiveFailures: 1}, "circuit breaker name is empty"},
+		{"A", BreakerConfig{}, "circuit breaker A has no threshold"},
+		{"A", BreakerConfig{FailureRate: 1.5}, "circuit breaker A failure rate 1.5 is above 1"},
+	}
+
+	for _, test := range tests {
+		_, err := NewCircuitBreaker(test.name, test.config)
+		assert.EqualError(t, err, test.expected)
+	}
+}
+
+func TestCircuitBreaker_Route(t *testing.T) {
+	orch := NewOrchestrator()
+	cb, err := orch.Breakers().Breaker("payments", BreakerConfig{ConsecutiveFailures: 1})
+	assert.Nil(t, err)
+
+	// shared by name
+	same, _ := orch.Breakers().Breaker("payments", BreakerConfig{FailureRate: 1})
+	assert.Equal(t, cb, same)
+
+	var transitions []string
+	orch.Breakers().SetListener(func(name string, from BreakerState, to BreakerState) {
+		transitions = append(transitions, name+":"+string(to))
+	})
+
+	undone := 0
+	_ = orch.Register(NewTransactionalRoute("A").
+		AddNextStep("reserve", appendStep("reserve"), cb.WrapUndo(func(ctx context) error {
+			undone++
+			return nil
+		})).
+		AddNextStep("pay", cb.Wrap(func(ctx *context) error {
+			return errUnavailable
+		}), undoActionTest))
+
+	// the recovery route resumes the execution when the breaker is open
+	recovery := NewNonTransactionalRoute(DefaultRecoveryRouteId).
+		AddNextStep("check", appendStep("check")).
+		When(CircuitOpen("payments")).
+		AddNextStep("fallback", func(ctx *context) error {
+			return ctx.SetVariable(RecoveryDecisionHeaderKey, Resume)
+		}).
+		End().
+		AddNextStep("done", appendStep("done"))
+	_ = orch.Initialization(recovery)
+
+	ctx, _ := NewContext()
+	result, _ := orch.Exec("A", ctx)
+	assert.Equal(t, RolledBack, result.Status)
+	assert.True(t, errors.Is(result.Errors[0].Err, errUnavailable))
+
+	// the undo action fails fast as well
+	assert.Equal(t, 0, undone)
+	assert.True(t, errors.Is(result.Errors[len(result.Errors)-1].Err, ErrCircuitOpen))
+
+	ctx, _ = NewContext()
+	result, _ = orch.Exec("A", ctx)
+	assert.Equal(t, Completed, result.Status)
+	assert.Equal(t, Resume, result.Errors[0].Decision)
+	assert.True(t, errors.Is(result.Errors[0].Err, ErrCircuitOpen))
+	assert.Equal(t, []string{"payments:OPEN"}, transitions)
+
+	var metrics []*BreakerMetrics
+	assert.Equal(t, http.StatusOK, adminRequest(t, NewAdminHandler(orch), http.MethodGet, "/breakers", nil, &metrics))
+	assert.Equal(t, "payments", metrics[0].Name)
+	assert.Equal(t, BreakerOpen, metrics[0].State)
+}
@@ -0,0 +1,513 @@
+// orchestratorctl validate and display declarative routes and inspect the file caretaker journals
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/farmx/orchestrator"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const usage = `usage: orchestratorctl <command> [arguments]
+
+commands:
+  validate <route file>...                        check declarative route files
+  graph [-format dot|mermaid] <route file>        render a route graph
+  inspect <journal>                               list the executions and their latest state
+  history [-context] <journal> <gid>              dump the timeline of an execution
+  replay -route <route file>... <journal> [gid]   replay the executions without running the actions
+  debug -route <route file>... [-break <state>]... <journal> <gid>
+                                                  step through the replay of an execution
+`
+
+type stringsFlag []string
+
+func (sf *stringsFlag) String() string {
+	return strings.Join(*sf, ",")
+}
+
+func (sf *stringsFlag) Set(v string) error {
+	*sf = append(*sf, v)
+	return nil
+}
+
+// stdin the debug commands are read from
+var stdin io.Reader = os.Stdin
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	commands := map[string]func(args []string, stdout io.Writer) error{
+		"validate": validate,
+		"graph":    graph,
+		"inspect":  inspect,
+		"history":  history,
+		"replay":   replay,
+		"debug":    debug,
+	}
+
+	command := commands[args[0]]
+	if command == nil {
+		fmt.Fprintf(stderr, "unknown command %s\n%s", args[0], usage)
+		return 2
+	}
+
+	if err := command(args[1:], stdout); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	return 0
+}
+
+func validate(args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("validate needs a route file")
+	}
+
+	invalid := 0
+	for _, path := range args {
+		rd, err := orchestrator.ReadRouteDefinition(path)
+		if err == nil {
+			err = rd.Validate(nil)
+		}
+
+		if err == nil {
+			fmt.Fprintf(stdout, "%s: ok\n", path)
+			continue
+		}
+
+		invalid++
+		var de *orchestrator.DefinitionError
+		if errors.As(err, &de) {
+			for _, e := range de.Errors {
+				fmt.Fprintf(stdout, "%s: %s\n", path, e)
+			}
+		} else {
+			fmt.Fprintf(stdout, "%s: %v\n", path, err)
+		}
+	}
+
+	if invalid > 0 {
+		return errors.New(fmt.Sprintf("%d invalid route file(s)", invalid))
+	}
+
+	return nil
+}
+
+func graph(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("graph", flag.ContinueOnError)
+	format := fs.String("format", "dot", "output format, dot or mermaid")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return errors.New("graph needs a route file")
+	}
+
+	rd, err := readValidDefinition(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "dot":
+		fmt.Fprint(stdout, rd.Graph().DOT())
+	case "mermaid":
+		fmt.Fprint(stdout, rd.Graph().Mermaid())
+	default:
+		return errors.New(fmt.Sprintf("unknown graph format %s", *format))
+	}
+
+	return nil
+}
+
+func inspect(args []string, stdout io.Writer) error {
+	if len(args) != 1 {
+		return errors.New("inspect needs a journal")
+	}
+
+	entries, err := orchestrator.ReadJournal(args[0])
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "GID\tROUTE\tVERSION\tSTATUS\tSTATE\tUPDATED")
+	for _, e := range orchestrator.LatestJournalEntries(entries) {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n", e.Gid, e.RouteId, e.Version, e.Status, e.State, formatTime(e.Timestamp))
+	}
+
+	return w.Flush()
+}
+
+func history(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	withContext := fs.Bool("context", false, "print the context variables of each entry")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 2 {
+		return errors.New("history needs a journal and a gid")
+	}
+
+	entries, err := orchestrator.ReadJournal(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	entries = orchestrator.JournalHistory(entries, fs.Arg(1))
+	if len(entries) == 0 {
+		return errors.New(fmt.Sprintf("execution %s not found", fs.Arg(1)))
+	}
+
+	// each entry keeps the faults injected so far, only the new ones are printed
+	injected := 0
+	for _, e := range entries {
+		fmt.Fprintf(stdout, "%s %-11s %s\n", formatTime(e.Timestamp), e.Status, e.State)
+		if injected > len(e.Faults) {
+			injected = 0
+		}
+
+		for _, f := range e.Faults[injected:] {
+			fmt.Fprintf(stdout, "    fault: %s injected into %s attempt %d\n", f.Kind, f.State, f.Attempt)
+		}
+		injected = len(e.Faults)
+
+		for _, err := range e.Errors {
+			fmt.Fprintf(stdout, "    error: %s\n", err)
+		}
+
+		if *withContext {
+			data, err := json.Marshal(e.Variables)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(stdout, "    context: %s\n", data)
+		}
+	}
+
+	return nil
+}
+
+func replay(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	var routeFiles stringsFlag
+	fs.Var(&routeFiles, "route", "route file, repeat it for the called routes")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if len(routeFiles) == 0 || fs.NArg() < 1 || fs.NArg() > 2 {
+		return errors.New("replay needs a route file and a journal")
+	}
+
+	routes, all, err := dryRunRoutes(routeFiles)
+	if err != nil {
+		return err
+	}
+
+	entries, err := orchestrator.ReadJournal(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var gids []string
+	if fs.NArg() == 2 {
+		gids = []string{fs.Arg(1)}
+	} else {
+		for _, e := range orchestrator.LatestJournalEntries(entries) {
+			gids = append(gids, e.Gid)
+		}
+	}
+
+	diverged := 0
+	for _, gid := range gids {
+		h := orchestrator.JournalHistory(entries, gid)
+		if len(h) == 0 {
+			return errors.New(fmt.Sprintf("execution %s not found", gid))
+		}
+
+		r := routes[h[0].RouteId]
+		if r == nil {
+			fmt.Fprintf(stdout, "%s: route %s is not given\n", gid, h[0].RouteId)
+			diverged++
+			continue
+		}
+
+		report, err := orchestrator.Replay(h, r, all...)
+		if err != nil {
+			return err
+		}
+
+		if !printReport(stdout, report) {
+			diverged++
+		}
+	}
+
+	if diverged > 0 {
+		return errors.New(fmt.Sprintf("%d execution(s) diverged", diverged))
+	}
+
+	return nil
+}
+
+// debug replay an execution state by state with the commands read from stdin
+func debug(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("debug", flag.ContinueOnError)
+	var routeFiles, breakpoints stringsFlag
+	fs.Var(&routeFiles, "route", "route file, repeat it for the called routes")
+	fs.Var(&breakpoints, "break", "state to pause on, repeat it for each state")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if len(routeFiles) == 0 || fs.NArg() != 2 {
+		return errors.New("debug needs a route file, a journal and a gid")
+	}
+
+	routes, all, err := dryRunRoutes(routeFiles)
+	if err != nil {
+		return err
+	}
+
+	entries, err := orchestrator.ReadJournal(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	h := orchestrator.JournalHistory(entries, fs.Arg(1))
+	if len(h) == 0 {
+		return errors.New(fmt.Sprintf("execution %s not found", fs.Arg(1)))
+	}
+
+	r := routes[h[0].RouteId]
+	if r == nil {
+		return errors.New(fmt.Sprintf("route %s is not given", h[0].RouteId))
+	}
+
+	d, err := orchestrator.NewDebugger(h, r, all...)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	for _, state := range breakpoints {
+		d.SetBreakpoint(state)
+	}
+
+	scanner := bufio.NewScanner(stdin)
+	for {
+		if report, finished := d.Report(); finished {
+			printReport(stdout, report)
+			return nil
+		}
+
+		fmt.Fprint(stdout, "(debug) ")
+		if !scanner.Scan() {
+			fmt.Fprintln(stdout)
+			return scanner.Err()
+		}
+
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "s", "step":
+			printFrame(stdout, d.Step())
+		case "c", "continue":
+			printFrame(stdout, d.Continue())
+		case "p", "print":
+			if err := printVariables(stdout, d.Frame(), fields[1:]); err != nil {
+				return err
+			}
+		case "b", "break":
+			for _, state := range fields[1:] {
+				d.SetBreakpoint(state)
+			}
+			fmt.Fprintf(stdout, "breakpoints: %s\n", strings.Join(d.Breakpoints(), ", "))
+		case "clear":
+			for _, state := range fields[1:] {
+				d.ClearBreakpoint(state)
+			}
+			fmt.Fprintf(stdout, "breakpoints: %s\n", strings.Join(d.Breakpoints(), ", "))
+		case "q", "quit":
+			return nil
+		default:
+			fmt.Fprintf(stdout, "unknown command %s, use step, continue, print [variable], break <state>, "+
+				"clear <state> or quit\n", fields[0])
+		}
+	}
+}
+
+func printFrame(stdout io.Writer, f *orchestrator.DebugFrame) {
+	if f == nil {
+		return
+	}
+
+	fmt.Fprintf(stdout, "step %d: %s", f.Step+1, f.State)
+	if f.Diverged {
+		recorded := f.Recorded
+		if recorded == "" {
+			recorded = "nothing"
+		}
+
+		fmt.Fprintf(stdout, " (recorded %s, diverged)", recorded)
+	}
+	fmt.Fprintln(stdout)
+}
+
+// printVariables print the frame context or the variables of it
+func printVariables(stdout io.Writer, f *orchestrator.DebugFrame, names []string) error {
+	if f == nil {
+		fmt.Fprintln(stdout, "the replay is not paused on a state")
+		return nil
+	}
+
+	var v interface{} = f.Variables
+	if len(names) > 0 {
+		selected := make(map[string]interface{}, len(names))
+		for _, name := range names {
+			selected[name] = f.Variables[name]
+		}
+		v = selected
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "%s\n", data)
+	return nil
+}
+
+// printReport print the replay outcome, false when it diverged
+func printReport(stdout io.Writer, report *orchestrator.ReplayReport) bool {
+	if report.Diverged < 0 {
+		fmt.Fprintf(stdout, "%s: %d states replayed, %s\n", report.Gid, len(report.Replayed), report.Status)
+		printUnverified(stdout, report)
+		return true
+	}
+
+	fmt.Fprintf(stdout, "%s: diverged at step %d, recorded %s, replayed %s\n", report.Gid, report.Diverged+1,
+		stateAt(report.Recorded, report.Diverged), stateAt(report.Replayed, report.Diverged))
+	printUnverified(stdout, report)
+	return false
+}
+
+// printUnverified the named predicates are not run on replay, the branches they took are not verified
+func printUnverified(stdout io.Writer, report *orchestrator.ReplayReport) {
+	for _, state := range report.Unverified {
+		fmt.Fprintf(stdout, "    not verified: the named predicate after %s took the recorded branch\n", state)
+	}
+}
+
+// dryRunRoutes build the routes of the files on the dry run registry, by id and in the order of the files
+func dryRunRoutes(routeFiles []string) (map[string]orchestrator.Route, []orchestrator.Route, error) {
+	var definitions []*orchestrator.RouteDefinition
+	for _, path := range routeFiles {
+		rd, err := readValidDefinition(path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		definitions = append(definitions, rd)
+	}
+
+	registry := dryRunRegistry(definitions)
+	routes := make(map[string]orchestrator.Route)
+	var all []orchestrator.Route
+	for _, rd := range definitions {
+		r, err := rd.Build(registry)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		routes[rd.Id] = r
+		all = append(all, r)
+	}
+
+	return routes, all, nil
+}
+
+func readValidDefinition(path string) (*orchestrator.RouteDefinition, error) {
+	rd, err := orchestrator.ReadRouteDefinition(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := rd.Validate(nil); err != nil {
+		return nil, err
+	}
+
+	return rd, nil
+}
+
+// dryRunRegistry register a function doing nothing for each name of the definitions, the actions are
+// never executed on replay and the replay takes the recorded branch of each named predicate without verifying it,
+// the report tells these branches
+func dryRunRegistry(definitions []*orchestrator.RouteDefinition) *orchestrator.Registry {
+	registry := orchestrator.NewRegistry()
+
+	var register func(steps []orchestrator.StepDefinition)
+	register = func(steps []orchestrator.StepDefinition) {
+		for _, sd := range steps {
+			if sd.Action != "" {
+				registry.RegisterAction(sd.Action, func(ctx *orchestrator.Context) error { return nil })
+			}
+
+			if sd.Undo != "" {
+				registry.RegisterUndoAction(sd.Undo, func(ctx orchestrator.Context) error { return nil })
+			}
+
+			if sd.When != "" {
+				registry.RegisterCondition(sd.When, orchestrator.NotReplayable)
+			}
+
+			register(sd.Then)
+			register(sd.Otherwise)
+		}
+	}
+
+	for _, rd := range definitions {
+		register(rd.Steps)
+	}
+
+	return registry
+}
+
+func stateAt(states []string, i int) string {
+	if i < len(states) {
+		return states[i]
+	}
+
+	return "nothing"
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"github.com/farmx/orchestrator"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const routeYAML = `
+id: ORDER
+steps:
+  - name: price
+    action: price
+  - condition: total > 100
+    then:
+      - name: review
+        action: review
+    otherwise:
+      - name: approve
+        action: approve
+  - name: ship
+    action: ship
+`
+
+func writeFile(t *testing.T, dir string, name string, data string) string {
+	path := filepath.Join(dir, name)
+	assert.Nil(t, ioutil.WriteFile(path, []byte(data), 0644))
+
+	return path
+}
+
+func runCommand(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+
+	return code, stdout.String(), stderr.String()
+}
+
+func TestValidateAndGraph(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "orchestratorctl")
+	defer os.RemoveAll(dir)
+
+	valid := writeFile(t, dir, "order.yaml", routeYAML)
+	invalid := writeFile(t, dir, "invalid.json", `{"id": "R", "steps": [{"name": "1"}]}`)
+
+	code, stdout, _ := runCommand("validate", valid)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, valid+": ok\n", stdout)
+
+	code, stdout, stderr := runCommand("validate", valid, invalid)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stdout, invalid+": steps[0]: step 1 has no action")
+	assert.Equal(t, "1 invalid route file(s)\n", stderr)
+
+	code, stdout, _ = runCommand("graph", "-format", "mermaid", valid)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, `n1 -->|"total > 100"| n2`)
+
+	code, stdout, _ = runCommand("graph", valid)
+	assert.Equal(t, 0, code)
+	assert.True(t, strings.HasPrefix(stdout, `digraph "ORDER" {`))
+
+	code, _, _ = runCommand("unknown")
+	assert.Equal(t, 2, code)
+}
+
+func TestJournalCommands(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "orchestratorctl")
+	defer os.RemoveAll(dir)
+
+	routeFile := writeFile(t, dir, "order.yaml", routeYAML)
+	rd, _ := orchestrator.ReadRouteDefinition(routeFile)
+
+	step := func(ctx *orchestrator.Context) error { return nil }
+	registry := orchestrator.NewRegistry().
+		RegisterAction("price", func(ctx *orchestrator.Context) error { return ctx.SetVariable("total", 150) }).
+		RegisterAction("review", step).
+		RegisterAction("approve", step).
+		RegisterAction("ship", step)
+
+	fc, _ := orchestrator.NewFileCareTacker("orchestratorctl_test")
+	journal := "orchestratorctl_test.log"
+	defer os.Remove(journal)
+
+	orch := orchestrator.NewOrchestrator()
+	orch.SetCaretaker(fc)
+	assert.Nil(t, orch.RegisterDefinition(rd, registry))
+	assert.Nil(t, orch.Initialization(nil))
+
+	ctx, _ := orchestrator.NewContextWithGid("order-1")
+	_, err := orch.Exec("ORDER", ctx)
+	assert.Nil(t, err)
+
+	code, stdout, _ := runCommand("inspect", journal)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "order-1")
+	assert.Contains(t, stdout, "ORDER_ship")
+
+	code, stdout, _ = runCommand("history", "-context", journal, "order-1")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, 4, strings.Count(stdout, "context: "))
+	assert.Contains(t, stdout, "ORDER_review")
+
+	code, stdout, _ = runCommand("replay", "-route", routeFile, journal)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "order-1: 3 states replayed, COMPLETED\n", stdout)
+
+	changed := writeFile(t, dir, "changed.yaml", strings.Replace(routeYAML, "total > 100", "total > 200", 1))
+	code, stdout, _ = runCommand("replay", "-route", changed, journal, "order-1")
+	assert.Equal(t, 1, code)
+	assert.Equal(t, "order-1: diverged at step 2, recorded ORDER_review, replayed ORDER_approve\n", stdout)
+
+	stdin = strings.NewReader("step\nprint\nbreak ORDER_ship\nc\np total\nnext\nc\nc\n")
+	defer func() { stdin = os.Stdin }()
+	code, stdout, _ = runCommand("debug", "-route", changed, "-break", "ORDER_approve", journal, "order-1")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, `(debug) step 1: ORDER_price
+(debug) {}
+(debug) breakpoints: ORDER_approve, ORDER_ship
+(debug) step 2: ORDER_approve (recorded ORDER_review, diverged)
+(debug) {"total":150}
+(debug) unknown command next, use step, continue, print [variable], break <state>, clear <state> or quit
+(debug) step 3: ORDER_ship (recorded ORDER_ship, diverged)
+(debug) order-1: diverged at step 2, recorded ORDER_review, replayed ORDER_approve
+`, stdout)
+
+	code, _, stderr := runCommand("history", journal, "unknown")
+	assert.Equal(t, 1, code)
+	assert.Equal(t, "execution unknown not found\n", stderr)
+}
+
+func TestHistory_InjectedFaults(t *testing.T) {
+	fc, _ := orchestrator.NewFileCareTacker("orchestratorctl_faults_test")
+	journal := "orchestratorctl_faults_test.log"
+	defer os.Remove(journal)
+
+	orch := orchestrator.NewOrchestrator()
+	orch.SetCaretaker(fc)
+	assert.Nil(t, orch.SetFaults(&orchestrator.FaultConfig{Faults: []orchestrator.Fault{
+		{State: "A_call", Kind: orchestrator.FaultError, Message: "unavailable", Attempt: 1},
+	}}))
+	assert.Nil(t, orch.Register(orchestrator.NewNonTransactionalRoute("A").
+		AddNextStep("call", func(ctx *orchestrator.Context) error { return nil }).
+		Retry(orchestrator.RetryPolicy{MaxAttempts: 2}).
+		AddNextStep("fail", func(ctx *orchestrator.Context) error { return errors.New("declined") })))
+	assert.Nil(t, orch.Initialization(nil))
+
+	ctx, _ := orchestrator.NewContextWithGid("gid")
+	_, err := orch.Exec("A", ctx)
+	assert.Nil(t, err)
+
+	code, stdout, _ := runCommand("history", journal, "gid")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, 1, strings.Count(stdout, "    fault: error injected into A_call attempt 1\n"))
+	assert.Contains(t, stdout, "    error: state A_fail: declined (ABORT)\n")
+}
+
+func TestReplay_NamedPredicate(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "orchestratorctl")
+	defer os.RemoveAll(dir)
+
+	routeFile := writeFile(t, dir, "order.yaml", strings.Replace(routeYAML, "condition: total > 100", "when: large", 1))
+	rd, _ := orchestrator.ReadRouteDefinition(routeFile)
+
+	step := func(ctx *orchestrator.Context) error { return nil }
+	registry := orchestrator.NewRegistry().
+		RegisterAction("price", step).
+		RegisterAction("review", step).
+		RegisterAction("approve", step).
+		RegisterAction("ship", step).
+		RegisterPredicate("large", func(ctx orchestrator.Context) bool { return true })
+
+	fc, _ := orchestrator.NewFileCareTacker("orchestratorctl_predicate_test")
+	journal := "orchestratorctl_predicate_test.log"
+	defer os.Remove(journal)
+
+	orch := orchestrator.NewOrchestrator()
+	orch.SetCaretaker(fc)
+	assert.Nil(t, orch.RegisterDefinition(rd, registry))
+	assert.Nil(t, orch.Initialization(nil))
+
+	ctx, _ := orchestrator.NewContextWithGid("order-1")
+	_, err := orch.Exec("ORDER", ctx)
+	assert.Nil(t, err)
+
+	// the predicate isn't available on replay, the recorded branch is taken
+	code, stdout, _ := runCommand("replay", "-route", routeFile, journal)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "order-1: 3 states replayed, COMPLETED\n"+
+		"    not verified: the named predicate after ORDER_price took the recorded branch\n", stdout)
+
+	code, stdout, _ = runCommand("history", journal, "order-1")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "ORDER_review")
+}
@@ -0,0 +1,444 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Message is received by a consumer, the body and the headers become the variables of the execution context
+	Message struct {
+		Body    interface{}
+		Headers map[string]interface{}
+	}
+
+	// Producer send the execution context to the endpoint of a component URI
+	Producer interface {
+		Process(ctx *context) error
+	}
+
+	// Consumer receive the messages of the endpoint of a component URI until it's stopped, a message is
+	// acknowledged when the handler succeeds
+	Consumer interface {
+		Start(handler func(msg *Message) error) error
+		Stop() error
+	}
+
+	// Component create the producers and the consumers of the URIs of its scheme
+	Component interface {
+		CreateProducer(uri *url.URL) (Producer, error)
+		CreateConsumer(uri *url.URL) (Consumer, error)
+	}
+
+	// ComponentRegistry keep the components by URI scheme
+	ComponentRegistry struct {
+		lock       sync.RWMutex
+		components map[string]Component
+	}
+
+	// ProducerFunc define a producer with a function
+	ProducerFunc func(ctx *context) error
+
+	httpComponent struct{}
+
+	// fileComponent `file:///inbox?pattern=*.csv&delay=1s` consume the directory files, the consumed file is moved
+	// to .done or .error; `file:///outbox?fileName=out.csv` write the body to a file named after FILE_NAME or the gid
+	fileComponent struct{}
+
+	fileConsumer struct {
+		dir     string
+		pattern string
+		delay   time.Duration
+
+		lock sync.Mutex
+		stop chan struct{}
+		done chan struct{}
+
+		// stuck handled files which can't be moved by modification time, they're skipped until they change
+		stuck map[string]time.Time
+	}
+
+	// logComponent `log:info` log the body of the context
+	logComponent struct {
+		logger *log.Logger
+	}
+)
+
+const (
+	// BodyHeaderKey keep the body the components produce and consume
+	BodyHeaderKey = "BODY"
+
+	// FileNameHeaderKey keep the name of the consumed file, the file producer writes to it
+	FileNameHeaderKey = "FILE_NAME"
+
+	// HTTPStatusHeaderKey keep the status code of the http producer response
+	HTTPStatusHeaderKey = "HTTP_STATUS"
+
+	// directScheme call a route, `direct:id` is the route id
+	directScheme = "direct:"
+
+	defaultFileDelay = time.Second
+)
+
+func (pf ProducerFunc) Process(ctx *context) error {
+	return pf(ctx)
+}
+
+// NewComponentRegistry create a registry with the http, https, file, log, timer and channel components
+func NewComponentRegistry() *ComponentRegistry {
+	cr := &ComponentRegistry{components: make(map[string]Component)}
+
+	return cr.Register("http", &httpComponent{}).
+		Register("https", &httpComponent{}).
+		Register("file", &fileComponent{}).
+		Register("log", NewLogComponent(nil)).
+		Register("timer", &timerComponent{}).
+		Register("channel", NewChannelComponent())
+}
+
+// Register the component of the scheme, it replaces the registered one
+func (cr *ComponentRegistry) Register(scheme string, c Component) *ComponentRegistry {
+	cr.lock.Lock()
+	defer cr.lock.Unlock()
+
+	cr.components[strings.ToLower(scheme)] = c
+	return cr
+}
+
+// Component return the component of the scheme, nil when it's not registered
+func (cr *ComponentRegistry) Component(scheme string) Component {
+	cr.lock.RLock()
+	defer cr.lock.RUnlock()
+
+	return cr.components[strings.ToLower(scheme)]
+}
+
+// Producer create the producer of the URI
+func (cr *ComponentRegistry) Producer(uri string) (Producer, error) {
+	c, u, err := cr.component(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.CreateProducer(u)
+}
+
+// Consumer create the consumer of the URI
+func (cr *ComponentRegistry) Consumer(uri string) (Consumer, error) {
+	c, u, err := cr.component(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.CreateConsumer(u)
+}
+
+func (cr *ComponentRegistry) component(uri string) (Component, *url.URL, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cr.lock.RLock()
+	c := cr.components[u.Scheme]
+	cr.lock.RUnlock()
+
+	if c == nil {
+		return nil, nil, errors.New(fmt.Sprintf("component %s is not registered", u.Scheme))
+	}
+
+	return c, u, nil
+}
+
+// isComponentURI the URI scheme is a registered component, a route id such as orders:v2 is not a URI
+func (cr *ComponentRegistry) isComponentURI(id string) bool {
+	u, err := url.Parse(id)
+	if err != nil || u.Scheme == "" {
+		return false
+	}
+
+	cr.lock.RLock()
+	defer cr.lock.RUnlock()
+
+	return cr.components[u.Scheme] != nil
+}
+
+// routeIdOf the route id of a direct URI
+func routeIdOf(to string) string {
+	return strings.TrimPrefix(to, directScheme)
+}
+
+// Components return the components the endpoint URIs are resolved with
+func (o *orchestrator) Components() *ComponentRegistry {
+	return o.components
+}
+
+// defineComponentRoute register a route producing to the URI, the URI is the route id
+func (o *orchestrator) defineComponentRoute(uri string) error {
+	p, err := o.components.Producer(uri)
+	if err != nil {
+		return errors.New(fmt.Sprintf("endpoint %s: %v", uri, err))
+	}
+
+	o.routes[uri] = map[int]Route{
+		DefaultRouteVersion: NewNonTransactionalRoute(uri).AddNextStep("produce", p.Process),
+	}
+
+	return nil
+}
+
+func (hc *httpComponent) CreateProducer(uri *url.URL) (Producer, error) {
+	u := *uri
+	query := u.Query()
+
+	method := strings.ToUpper(query.Get("httpMethod"))
+	query.Del("httpMethod")
+	u.RawQuery = query.Encode()
+
+	call := HTTPCall{
+		Method:      method,
+		URL:         u.String(),
+		StatusKey:   HTTPStatusHeaderKey,
+		ResponseKey: BodyHeaderKey,
+	}
+
+	if method != "" && method != http.MethodGet {
+		call.Body = `{{with index . "` + BodyHeaderKey + `"}}{{payload .}}{{end}}`
+	}
+
+	step, err := NewHTTPStep(call)
+	if err != nil {
+		return nil, err
+	}
+
+	return ProducerFunc(step), nil
+}
+
+// fileDir the directory of `file:///inbox` or `file:inbox`
+func fileDir(uri *url.URL) (string, error) {
+	dir := uri.Path
+	if dir == "" {
+		dir = uri.Opaque
+	}
+
+	if dir == "" {
+		return "", errors.New(fmt.Sprintf("file %s has no directory", uri))
+	}
+
+	return dir, nil
+}
+
+func (fc *fileComponent) CreateProducer(uri *url.URL) (Producer, error) {
+	dir, err := fileDir(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	fileName := uri.Query().Get("fileName")
+
+	return ProducerFunc(func(ctx *context) error {
+		name := fileName
+		if name == "" {
+			name, _ = ctx.GetVariable(FileNameHeaderKey).(string)
+		}
+
+		if name == "" {
+			name = ctx.GetGid()
+		}
+
+		path, err := filePath(dir, name)
+		if err != nil {
+			return err
+		}
+
+		var data []byte
+		if body := ctx.GetVariable(BodyHeaderKey); body != nil {
+			if data, err = encodePayload(body); err != nil {
+				return err
+			}
+		}
+
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+
+		return ioutil.WriteFile(path, data, 0644)
+	}), nil
+}
+
+// filePath join the file name to the directory, a name leaving the directory is rejected
+func filePath(dir string, name string) (string, error) {
+	if strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return "", errors.New(fmt.Sprintf("invalid file name %q", name))
+	}
+
+	path := filepath.Join(dir, name)
+	if filepath.Dir(path) != filepath.Clean(dir) {
+		return "", errors.New(fmt.Sprintf("invalid file name %q", name))
+	}
+
+	return path, nil
+}
+
+func (fc *fileComponent) CreateConsumer(uri *url.URL) (Consumer, error) {
+	dir, err := fileDir(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	query := uri.Query()
+	consumer := &fileConsumer{dir: dir, pattern: query.Get("pattern"), delay: defaultFileDelay, stuck: make(map[string]time.Time)}
+	if consumer.pattern == "" {
+		consumer.pattern = "*"
+	}
+
+	if _, err := filepath.Match(consumer.pattern, ""); err != nil {
+		return nil, errors.New(fmt.Sprintf("file %s: invalid pattern %s", uri, consumer.pattern))
+	}
+
+	if d := query.Get("delay"); d != "" {
+		if consumer.delay, err = time.ParseDuration(d); err != nil || consumer.delay <= 0 {
+			return nil, errors.New(fmt.Sprintf("file %s: invalid delay %s", uri, d))
+		}
+	}
+
+	return consumer, nil
+}
+
+// Start poll the directory every delay
+func (fc *fileConsumer) Start(handler func(msg *Message) error) error {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+
+	if fc.stop != nil {
+		return errors.New(fmt.Sprintf("file consumer %s is already started", fc.dir))
+	}
+
+	fc.stop = make(chan struct{})
+	fc.done = make(chan struct{})
+
+	go func(stop chan struct{}, done chan struct{}) {
+		defer close(done)
+
+		ticker := time.NewTicker(fc.delay)
+		defer ticker.Stop()
+
+		for {
+			fc.poll(handler, stop)
+
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}(fc.stop, fc.done)
+
+	return nil
+}
+
+// Stop wait for the file in progress
+func (fc *fileConsumer) Stop() error {
+	fc.lock.Lock()
+	stop, done := fc.stop, fc.done
+	fc.stop = nil
+	fc.lock.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+
+	return nil
+}
+
+// poll hand the matching files over one after another, the handled file is moved to .done or .error; a file which
+// can't be moved is logged and skipped until it changes so it's not handled again
+func (fc *fileConsumer) poll(handler func(msg *Message) error, stop chan struct{}) {
+	files, err := ioutil.ReadDir(fc.dir)
+	if err != nil {
+		return
+	}
+
+	for _, f := range files {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+
+		if ok, _ := filepath.Match(fc.pattern, f.Name()); !ok {
+			continue
+		}
+
+		if modified, ok := fc.stuck[f.Name()]; ok && modified.Equal(f.ModTime()) {
+			continue
+		}
+		delete(fc.stuck, f.Name())
+
+		path := filepath.Join(fc.dir, f.Name())
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		target := ".done"
+		if err := handler(&Message{Body: string(data), Headers: map[string]interface{}{FileNameHeaderKey: f.Name()}}); err != nil {
+			target = ".error"
+		}
+
+		err = os.MkdirAll(filepath.Join(fc.dir, target), 0755)
+		if err == nil {
+			err = os.Rename(path, filepath.Join(fc.dir, target, f.Name()))
+		}
+
+		if err != nil {
+			log.Printf("file consumer %s: %s is handled but not moved to %s: %v", fc.dir, f.Name(), target, err)
+			fc.stuck[f.Name()] = f.ModTime()
+		}
+	}
+}
+
+// NewLogComponent log the bodies with the logger, nil means the standard logger
+func NewLogComponent(logger *log.Logger) *logComponent {
+	if logger == nil {
+		logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
+
+	return &logComponent{logger: logger}
+}
+
+func (lc *logComponent) CreateProducer(uri *url.URL) (Producer, error) {
+	level := uri.Opaque
+	if level == "" {
+		level = uri.Host
+	}
+
+	if level == "" {
+		level = "info"
+	}
+
+	level = strings.ToUpper(level)
+
+	return ProducerFunc(func(ctx *context) error {
+		lc.logger.Printf("%s %s: %v", level, ctx.GetGid(), ctx.GetVariable(BodyHeaderKey))
+		return nil
+	}), nil
+}
+
+func (lc *logComponent) CreateConsumer(uri *url.URL) (Consumer, error) {
+	return nil, errors.New(fmt.Sprintf("%s component has no consumer", uri.Scheme))
+}
@@ -0,0 +1,177 @@
+package orchestrator
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type recordComponent struct {
+	bodies []interface{}
+}
+
+func (rc *recordComponent) CreateProducer(uri *url.URL) (Producer, error) {
+	return ProducerFunc(func(ctx *context) error {
+		rc.bodies = append(rc.bodies, ctx.GetVariable(BodyHeaderKey))
+		return nil
+	}), nil
+}
+
+func (rc *recordComponent) CreateConsumer(uri *url.URL) (Consumer, error) {
+	return nil, errors.New("no consumer")
+}
+
+func TestOrchestrator_ComponentEndpoints(t *testing.T) {
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		received = r.Method + " " + r.URL.RawQuery + " " + string(data)
+		_, _ = w.Write([]byte(`{"id":"P-1"}`))
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	record := &recordComponent{}
+
+	orch := NewOrchestrator()
+	orch.Components().
+		Register("log", NewLogComponent(log.New(&buf, "", 0))).
+		Register("record", record)
+
+	_ = orch.Register(NewNonTransactionalRoute("B").AddNextStep("b", appendStep("b")))
+	assert.Nil(t, orch.Register(NewNonTransactionalRoute("A").
+		AddNextStep("1", appendStep("1")).
+		To("log:warn").
+		To(server.URL+"/payments?httpMethod=POST&currency=EUR").
+		To("record:payments").
+		To("direct:B")))
+	assert.Nil(t, orch.Initialization(nil))
+
+	ctx, _ := NewContextWithGid("gid")
+	_ = ctx.SetVariable(BodyHeaderKey, "pay")
+
+	result, err := orch.Exec("A", ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, Completed, result.Status)
+
+	assert.Equal(t, "WARN gid: pay\n", buf.String())
+	assert.Equal(t, "POST currency=EUR pay", received)
+	assert.Equal(t, []interface{}{map[string]interface{}{"id": "P-1"}}, record.bodies)
+	assert.Equal(t, 200, ctx.GetVariable(HTTPStatusHeaderKey))
+	assert.Equal(t, "1;b;", ctx.GetVariable("STEPS"))
+}
+
+func TestOrchestrator_UnknownComponent(t *testing.T) {
+	orch := NewOrchestrator()
+	_ = orch.Register(NewNonTransactionalRoute("A").AddNextStep("1", appendStep("1")).To("jms:queue"))
+	assert.NotNil(t, orch.Initialization(nil))
+
+	orch = NewOrchestrator()
+	_ = orch.Register(NewNonTransactionalRoute("A").AddNextStep("1", appendStep("1")).To("direct:B"))
+	assert.NotNil(t, orch.Initialization(nil))
+}
+
+func TestOrchestrator_RouteIdWithColon(t *testing.T) {
+	orch := NewOrchestrator()
+	_ = orch.Register(NewNonTransactionalRoute("orders:v2").AddNextStep("2", appendStep("2")))
+	_ = orch.Register(NewNonTransactionalRoute("A").AddNextStep("1", appendStep("1")).To("orders:v2"))
+	assert.Nil(t, orch.Initialization(nil))
+
+	ctx, _ := NewContext()
+	result, _ := orch.Exec("A", ctx)
+	assert.Equal(t, Completed, result.Status)
+	assert.Equal(t, "1;2;", ctx.GetVariable("STEPS"))
+
+	orch = NewOrchestrator()
+	_ = orch.Register(NewNonTransactionalRoute("A").AddNextStep("1", appendStep("1")).To("orders:v3"))
+	assert.EqualError(t, orch.Initialization(nil), "route id orders:v3 not found")
+}
+
+func TestFileComponent(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "component")
+	defer os.RemoveAll(dir)
+
+	orch := NewOrchestrator()
+	_ = orch.Register(NewNonTransactionalRoute("A").
+		AddNextStep("1", appendStep("1")).
+		To("file://" + filepath.Join(dir, "outbox")))
+	_ = orch.Initialization(nil)
+
+	ctx, _ := NewContextWithGid("gid")
+	_ = ctx.SetVariable(BodyHeaderKey, "a;b")
+	_ = ctx.SetVariable(FileNameHeaderKey, "out.csv")
+	_, err := orch.Exec("A", ctx)
+	assert.Nil(t, err)
+
+	data, _ := ioutil.ReadFile(filepath.Join(dir, "outbox", "out.csv"))
+	assert.Equal(t, "a;b", string(data))
+
+	// a map body is written as JSON
+	ctx, _ = NewContextWithGid("gid")
+	_ = ctx.SetVariable(BodyHeaderKey, map[string]interface{}{"a": 1})
+	_ = ctx.SetVariable(FileNameHeaderKey, "out.json")
+	_, _ = orch.Exec("A", ctx)
+
+	data, _ = ioutil.ReadFile(filepath.Join(dir, "outbox", "out.json"))
+	assert.Equal(t, `{"a":1}`, string(data))
+
+	// a file name leaving the directory is rejected
+	for _, name := range []string{"../escaped.txt", "..", "sub/out.txt"} {
+		ctx, _ = NewContextWithGid("gid")
+		_ = ctx.SetVariable(BodyHeaderKey, "escaped")
+		_ = ctx.SetVariable(FileNameHeaderKey, name)
+		result, _ := orch.Exec("A", ctx)
+		assert.Equal(t, Aborted, result.Status, name)
+	}
+
+	_, err = os.Stat(filepath.Join(dir, "escaped.txt"))
+	assert.True(t, os.IsNotExist(err))
+
+	_ = ioutil.WriteFile(filepath.Join(dir, "ok.csv"), []byte("ok"), 0644)
+	_ = ioutil.WriteFile(filepath.Join(dir, "ko.csv"), []byte("ko"), 0644)
+	_ = ioutil.WriteFile(filepath.Join(dir, "skip.txt"), []byte("skip"), 0644)
+
+	consumer, err := orch.Components().Consumer("file://" + dir + "?pattern=*.csv&delay=10ms")
+	assert.Nil(t, err)
+
+	handled := make(chan string, 2)
+	assert.Nil(t, consumer.Start(func(msg *Message) error {
+		handled <- msg.Headers[FileNameHeaderKey].(string)
+		if msg.Body == "ko" {
+			return errors.New("invalid file")
+		}
+
+		return nil
+	}))
+	assert.NotNil(t, consumer.Start(func(msg *Message) error { return nil }))
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-handled:
+		case <-time.After(time.Second):
+			assert.Fail(t, "the files are not consumed")
+		}
+	}
+	assert.Nil(t, consumer.Stop())
+
+	_, err = os.Stat(filepath.Join(dir, ".done", "ok.csv"))
+	assert.Nil(t, err)
+	_, err = os.Stat(filepath.Join(dir, ".error", "ko.csv"))
+	assert.Nil(t, err)
+	_, err = os.Stat(filepath.Join(dir, "skip.txt"))
+	assert.Nil(t, err)
+
+	_, err = orch.Components().Consumer("file://" + dir + "?delay=never")
+	assert.NotNil(t, err)
+	_, err = orch.Components().Consumer("log:info")
+	assert.NotNil(t, err)
+}
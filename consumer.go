@@ -0,0 +1,549 @@
+package orchestrator
+
+import (
+	stdcontext "context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type (
+	// sourcedRoute is a route declaring the consumer URIs which messages start its executions
+	sourcedRoute interface {
+		GetSources() []string
+	}
+
+	routeConsumer struct {
+		routeId  string
+		uri      string
+		consumer Consumer
+	}
+
+	// httpConsumer `http://:8080/orders` serve the path, the request is answered once the execution is finished,
+	// 200 on ack and 500 on nack
+	httpConsumer struct {
+		addr string
+		path string
+
+		lock     sync.Mutex
+		handler  func(msg *Message) error
+		listener net.Listener
+		server   *http.Server
+	}
+
+	// timerComponent `timer:tick?period=1m&delay=0s&repeatCount=0` send an empty message every period, zero
+	// repeat count means forever
+	timerComponent struct{}
+
+	timerConsumer struct {
+		name        string
+		period      time.Duration
+		delay       time.Duration
+		repeatCount int
+
+		lock sync.Mutex
+		stop chan struct{}
+		done chan struct{}
+	}
+
+	// ChannelComponent `channel:orders?size=100` deliver the in-process messages to the consumer of the channel
+	// name, the producer waits for the message to be handled and fails on nack
+	ChannelComponent struct {
+		lock      sync.Mutex
+		consumers map[string]*channelConsumer
+	}
+
+	channelConsumer struct {
+		cc   *ChannelComponent
+		name string
+		size int
+
+		deliveries chan *channelDelivery
+		stop       chan struct{}
+		done       chan struct{}
+	}
+
+	channelDelivery struct {
+		msg    *Message
+		result chan error
+	}
+)
+
+const (
+	// HTTPMethodHeaderKey keep the method of the consumed request
+	HTTPMethodHeaderKey = "HTTP_METHOD"
+
+	// HTTPPathHeaderKey keep the path of the consumed request
+	HTTPPathHeaderKey = "HTTP_PATH"
+
+	// HTTPHeadersHeaderKey keep the first value of each header of the consumed request by name, the untrusted
+	// headers are kept apart from the context variables
+	HTTPHeadersHeaderKey = "HTTP_HEADERS"
+
+	// HTTPQueryHeaderKey keep the first value of each query parameter of the consumed request by name
+	HTTPQueryHeaderKey = "HTTP_QUERY"
+
+	// TimerNameHeaderKey keep the name of the timer
+	TimerNameHeaderKey = "TIMER_NAME"
+
+	// TimerCounterHeaderKey keep the number of the timer message, from 1
+	TimerCounterHeaderKey = "TIMER_COUNTER"
+
+	// TimerFiredTimeHeaderKey keep the time the timer fired
+	TimerFiredTimeHeaderKey = "TIMER_FIRED_TIME"
+
+	defaultChannelSize = 100
+
+	// the consumed requests are read within the timeouts, the response waits for the execution
+	httpReadHeaderTimeout = 10 * time.Second
+	httpReadTimeout       = time.Minute
+
+	// httpMaxBodySize larger request bodies are rejected with 413
+	httpMaxBodySize = 10 << 20
+)
+
+// ErrNoConsumer is returned when a message is sent to a channel nobody consumes
+var ErrNoConsumer = errors.New("channel has no consumer")
+
+// StartConsumers start the consumers of the route sources, each message starts an execution of the latest route
+// version with the message body and headers as variables. The message is acknowledged when the execution is
+// completed or waiting, otherwise it's rejected
+func (o *orchestrator) StartConsumers() error {
+	o.lock.RLock()
+	initialized := o.initialized
+	var sources []*routeConsumer
+	for id, rv := range o.routes {
+		if sr, ok := rv[latestVersion(rv)].(sourcedRoute); ok {
+			for _, uri := range sr.GetSources() {
+				sources = append(sources, &routeConsumer{routeId: id, uri: uri})
+			}
+		}
+	}
+	o.lock.RUnlock()
+
+	if !initialized {
+		return errors.New("orchestrator is not initialized")
+	}
+
+	o.consumersLock.Lock()
+	defer o.consumersLock.Unlock()
+
+	if o.consumers != nil {
+		return errors.New("consumers are already started")
+	}
+
+	started := make([]*routeConsumer, 0, len(sources))
+	for _, rc := range sources {
+		var err error
+		if rc.consumer, err = o.components.Consumer(rc.uri); err == nil {
+			err = rc.consumer.Start(o.consume(rc.routeId))
+		}
+
+		if err != nil {
+			stopConsumers(started)
+			return errors.New(fmt.Sprintf("route %s source %s: %v", rc.routeId, rc.uri, err))
+		}
+
+		started = append(started, rc)
+	}
+
+	o.consumers = started
+	return nil
+}
+
+// StopConsumers stop the consumers and wait for the messages in progress
+func (o *orchestrator) StopConsumers() error {
+	o.consumersLock.Lock()
+	defer o.consumersLock.Unlock()
+
+	err := stopConsumers(o.consumers)
+	o.consumers = nil
+
+	return err
+}
+
+func stopConsumers(consumers []*routeConsumer) error {
+	var result error
+	for _, rc := range consumers {
+		if err := rc.consumer.Stop(); err != nil && result == nil {
+			result = errors.New(fmt.Sprintf("route %s source %s: %v", rc.routeId, rc.uri, err))
+		}
+	}
+
+	return result
+}
+
+// consume start an execution of the route with the message, the outcome acknowledges the message
+func (o *orchestrator) consume(routeId string) func(msg *Message) error {
+	return func(msg *Message) error {
+		ctx, err := NewContext()
+		if err != nil {
+			return err
+		}
+
+		for k, v := range msg.Headers {
+			if err := ctx.SetVariable(k, v); err != nil {
+				return err
+			}
+		}
+
+		if msg.Body != nil {
+			if err := ctx.SetVariable(BodyHeaderKey, msg.Body); err != nil {
+				return err
+			}
+		}
+
+		result, err := o.Exec(routeId, ctx)
+		if err != nil {
+			return err
+		}
+
+		if result.Status == Completed || result.Status == Waiting {
+			return nil
+		}
+
+		if err := result.Err(); err != nil {
+			return err
+		}
+
+		return errors.New(fmt.Sprintf("execution %s %s", result.Gid, result.Status))
+	}
+}
+
+func (hc *httpComponent) CreateConsumer(uri *url.URL) (Consumer, error) {
+	if uri.Scheme != "http" {
+		return nil, errors.New(fmt.Sprintf("%s component has no consumer", uri.Scheme))
+	}
+
+	path := uri.Path
+	if path == "" {
+		path = "/"
+	}
+
+	return &httpConsumer{addr: uri.Host, path: path}, nil
+}
+
+// Start listen on the URI address
+func (hc *httpConsumer) Start(handler func(msg *Message) error) error {
+	hc.lock.Lock()
+	defer hc.lock.Unlock()
+
+	if hc.listener != nil {
+		return errors.New(fmt.Sprintf("http consumer %s is already started", hc.addr))
+	}
+
+	ln, err := net.Listen("tcp", hc.addr)
+	if err != nil {
+		return err
+	}
+
+	hc.handler = handler
+	hc.listener = ln
+	hc.server = &http.Server{
+		Handler:           hc,
+		ReadHeaderTimeout: httpReadHeaderTimeout,
+		ReadTimeout:       httpReadTimeout,
+	}
+
+	go func(server *http.Server) {
+		_ = server.Serve(ln)
+	}(hc.server)
+
+	return nil
+}
+
+// Stop stop accepting the requests and wait for the ones in progress
+func (hc *httpConsumer) Stop() error {
+	hc.lock.Lock()
+	server := hc.server
+	hc.listener, hc.server = nil, nil
+	hc.lock.Unlock()
+
+	if server == nil {
+		return nil
+	}
+
+	return server.Shutdown(stdcontext.Background())
+}
+
+// Addr return the address the consumer listens on, empty when it's stopped
+func (hc *httpConsumer) Addr() string {
+	hc.lock.Lock()
+	defer hc.lock.Unlock()
+
+	if hc.listener == nil {
+		return ""
+	}
+
+	return hc.listener.Addr().String()
+}
+
+// ServeHTTP hand the request over as a message, the JSON body is decoded and the first value of each header and
+// query parameter is kept in the HTTP_HEADERS and HTTP_QUERY maps
+func (hc *httpConsumer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != hc.path {
+		http.NotFound(w, r)
+		return
+	}
+
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, httpMaxBodySize))
+	if err != nil {
+		// the reader stops at the limit
+		status := http.StatusBadRequest
+		if len(data) >= httpMaxBodySize {
+			status = http.StatusRequestEntityTooLarge
+		}
+
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	headers := make(map[string]interface{}, len(r.Header))
+	for k := range r.Header {
+		headers[k] = r.Header.Get(k)
+	}
+
+	query := r.URL.Query()
+	params := make(map[string]interface{}, len(query))
+	for k := range query {
+		params[k] = query.Get(k)
+	}
+
+	msg := &Message{Headers: map[string]interface{}{
+		HTTPMethodHeaderKey:  r.Method,
+		HTTPPathHeaderKey:    r.URL.Path,
+		HTTPHeadersHeaderKey: headers,
+		HTTPQueryHeaderKey:   params,
+	}}
+
+	if len(data) > 0 {
+		var body interface{}
+		if json.Unmarshal(data, &body) != nil {
+			body = string(data)
+		}
+		msg.Body = body
+	}
+
+	hc.lock.Lock()
+	handler := hc.handler
+	hc.lock.Unlock()
+
+	if err := handler(msg); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (tc *timerComponent) CreateProducer(uri *url.URL) (Producer, error) {
+	return nil, errors.New(fmt.Sprintf("%s component has no producer", uri.Scheme))
+}
+
+func (tc *timerComponent) CreateConsumer(uri *url.URL) (Consumer, error) {
+	consumer := &timerConsumer{name: uri.Opaque, period: time.Second}
+	query := uri.Query()
+
+	var err error
+	if p := query.Get("period"); p != "" {
+		if consumer.period, err = time.ParseDuration(p); err != nil || consumer.period <= 0 {
+			return nil, errors.New(fmt.Sprintf("timer %s: invalid period %s", uri, p))
+		}
+	}
+
+	if d := query.Get("delay"); d != "" {
+		if consumer.delay, err = time.ParseDuration(d); err != nil || consumer.delay < 0 {
+			return nil, errors.New(fmt.Sprintf("timer %s: invalid delay %s", uri, d))
+		}
+	}
+
+	if c := query.Get("repeatCount"); c != "" {
+		if consumer.repeatCount, err = strconv.Atoi(c); err != nil || consumer.repeatCount < 0 {
+			return nil, errors.New(fmt.Sprintf("timer %s: invalid repeat count %s", uri, c))
+		}
+	}
+
+	return consumer, nil
+}
+
+// Start fire after the delay then every period, the messages are handed over one after another
+func (tc *timerConsumer) Start(handler func(msg *Message) error) error {
+	tc.lock.Lock()
+	defer tc.lock.Unlock()
+
+	if tc.stop != nil {
+		return errors.New(fmt.Sprintf("timer %s is already started", tc.name))
+	}
+
+	tc.stop = make(chan struct{})
+	tc.done = make(chan struct{})
+
+	go func(stop chan struct{}, done chan struct{}) {
+		defer close(done)
+
+		timer := time.NewTimer(tc.delay)
+		defer timer.Stop()
+
+		for counter := 1; tc.repeatCount == 0 || counter <= tc.repeatCount; counter++ {
+			select {
+			case fired := <-timer.C:
+				_ = handler(&Message{Headers: map[string]interface{}{
+					TimerNameHeaderKey:      tc.name,
+					TimerCounterHeaderKey:   counter,
+					TimerFiredTimeHeaderKey: fired,
+				}})
+				timer.Reset(tc.period)
+			case <-stop:
+				return
+			}
+		}
+	}(tc.stop, tc.done)
+
+	return nil
+}
+
+// Stop wait for the message in progress
+func (tc *timerConsumer) Stop() error {
+	tc.lock.Lock()
+	stop, done := tc.stop, tc.done
+	tc.stop = nil
+	tc.lock.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+
+	return nil
+}
+
+// NewChannelComponent create a component without channel, a channel exists while it's consumed
+func NewChannelComponent() *ChannelComponent {
+	return &ChannelComponent{consumers: make(map[string]*channelConsumer)}
+}
+
+// Send deliver the message to the consumer of the channel and return the handler outcome
+func (cc *ChannelComponent) Send(name string, msg *Message) error {
+	cc.lock.Lock()
+	consumer := cc.consumers[name]
+	cc.lock.Unlock()
+
+	if consumer == nil {
+		return ErrNoConsumer
+	}
+
+	d := &channelDelivery{msg: msg, result: make(chan error, 1)}
+	select {
+	case consumer.deliveries <- d:
+	case <-consumer.stop:
+		return ErrNoConsumer
+	}
+
+	select {
+	case err := <-d.result:
+		return err
+	case <-consumer.done:
+		select {
+		case err := <-d.result:
+			return err
+		default:
+			return ErrNoConsumer
+		}
+	}
+}
+
+// CreateProducer send BODY as the message body and the other variables as its headers
+func (cc *ChannelComponent) CreateProducer(uri *url.URL) (Producer, error) {
+	name := uri.Opaque
+	if name == "" {
+		return nil, errors.New(fmt.Sprintf("channel %s has no name", uri))
+	}
+
+	return ProducerFunc(func(ctx *context) error {
+		values := ctx.values()
+		msg := &Message{Body: values[BodyHeaderKey], Headers: values}
+		delete(values, BodyHeaderKey)
+
+		return cc.Send(name, msg)
+	}), nil
+}
+
+func (cc *ChannelComponent) CreateConsumer(uri *url.URL) (Consumer, error) {
+	consumer := &channelConsumer{cc: cc, name: uri.Opaque, size: defaultChannelSize}
+	if consumer.name == "" {
+		return nil, errors.New(fmt.Sprintf("channel %s has no name", uri))
+	}
+
+	if s := uri.Query().Get("size"); s != "" {
+		var err error
+		if consumer.size, err = strconv.Atoi(s); err != nil || consumer.size < 0 {
+			return nil, errors.New(fmt.Sprintf("channel %s: invalid size %s", uri, s))
+		}
+	}
+
+	return consumer, nil
+}
+
+// Start consume the channel, a channel has one consumer at most
+func (cc *channelConsumer) Start(handler func(msg *Message) error) error {
+	cc.cc.lock.Lock()
+	defer cc.cc.lock.Unlock()
+
+	if cc.cc.consumers[cc.name] != nil {
+		return errors.New(fmt.Sprintf("channel %s is already consumed", cc.name))
+	}
+
+	cc.deliveries = make(chan *channelDelivery, cc.size)
+	cc.stop = make(chan struct{})
+	cc.done = make(chan struct{})
+	cc.cc.consumers[cc.name] = cc
+
+	go func() {
+		for {
+			select {
+			case d := <-cc.deliveries:
+				d.result <- handler(d.msg)
+			case <-cc.stop:
+				cc.reject()
+				close(cc.done)
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop wait for the message in progress, the pending messages are rejected with ErrNoConsumer
+func (cc *channelConsumer) Stop() error {
+	cc.cc.lock.Lock()
+	if cc.cc.consumers[cc.name] != cc {
+		cc.cc.lock.Unlock()
+		return nil
+	}
+	delete(cc.cc.consumers, cc.name)
+	cc.cc.lock.Unlock()
+
+	close(cc.stop)
+	<-cc.done
+
+	return nil
+}
+
+func (cc *channelConsumer) reject() {
+	for {
+		select {
+		case d := <-cc.deliveries:
+			d.result <- ErrNoConsumer
+		default:
+			return
+		}
+	}
+}
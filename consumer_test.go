@@ -0,0 +1,208 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rejectKo fail on the "ko" body and hand the accepted contexts over
+func rejectKo(accepted chan *context) func(ctx *context) error {
+	return func(ctx *context) error {
+		if ctx.GetVariable(BodyHeaderKey) == "ko" {
+			return errors.New("rejected")
+		}
+
+		accepted <- ctx
+		return nil
+	}
+}
+
+func TestOrchestrator_ChannelConsumer(t *testing.T) {
+	accepted := make(chan *context, 10)
+
+	orch := NewOrchestrator()
+	_ = orch.Register(NewNonTransactionalRoute("A").From("channel:orders").AddNextStep("1", rejectKo(accepted)))
+	_ = orch.Register(NewNonTransactionalRoute("B").AddNextStep("1", appendStep("1")).To("channel:orders"))
+	assert.NotNil(t, orch.StartConsumers())
+	_ = orch.Initialization(nil)
+
+	assert.Nil(t, orch.StartConsumers())
+	assert.NotNil(t, orch.StartConsumers())
+
+	channels := orch.Components().Component("channel").(*ChannelComponent)
+	assert.Nil(t, channels.Send("orders", &Message{Body: "ok", Headers: map[string]interface{}{"customer": "C-1"}}))
+	assert.NotNil(t, channels.Send("orders", &Message{Body: "ko"}))
+	assert.Equal(t, ErrNoConsumer, channels.Send("invoices", &Message{}))
+
+	ctx := <-accepted
+	assert.Equal(t, "C-1", ctx.GetVariable("customer"))
+
+	// a route produces to the consumed channel
+	ctx, _ = NewContext()
+	_ = ctx.SetVariable(BodyHeaderKey, "from B")
+	result, err := orch.Exec("B", ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, Completed, result.Status)
+
+	ctx = <-accepted
+	assert.Equal(t, "from B", ctx.GetVariable(BodyHeaderKey))
+	assert.Equal(t, "1;", ctx.GetVariable("STEPS"))
+
+	_ = ctx.SetVariable(BodyHeaderKey, "ko")
+	result, _ = orch.Exec("B", ctx)
+	assert.Equal(t, Aborted, result.Status)
+
+	assert.Nil(t, orch.StopConsumers())
+	assert.Equal(t, ErrNoConsumer, channels.Send("orders", &Message{Body: "ok"}))
+}
+
+func TestOrchestrator_HTTPConsumer(t *testing.T) {
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	accepted := make(chan *context, 10)
+
+	orch := NewOrchestrator()
+	_ = orch.Register(NewTransactionalRoute("A").
+		From("http://"+addr+"/orders").
+		AddNextStep("1", rejectKo(accepted), func(ctx context) error { return nil }))
+	_ = orch.Initialization(nil)
+	assert.Nil(t, orch.StartConsumers())
+
+	tests := []struct {
+		path   string
+		body   string
+		status int
+	}{
+		{"/orders?priority=high&FILE_NAME=../escaped.txt", `{"id":"O-1"}`, http.StatusOK},
+		{"/orders", "ko", http.StatusInternalServerError},
+		{"/invoices", "", http.StatusNotFound},
+		{"/orders", strings.Repeat("a", httpMaxBodySize+1), http.StatusRequestEntityTooLarge},
+	}
+
+	for _, test := range tests {
+		resp, err := http.Post("http://"+addr+test.path, "application/json", strings.NewReader(test.body))
+		assert.Nil(t, err)
+		_, _ = ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		assert.Equal(t, test.status, resp.StatusCode, test.path)
+	}
+
+	ctx := <-accepted
+	assert.Equal(t, map[string]interface{}{"id": "O-1"}, ctx.GetVariable(BodyHeaderKey))
+	assert.Equal(t, "high", ctx.GetVariable(HTTPQueryHeaderKey).(map[string]interface{})["priority"])
+	assert.Equal(t, http.MethodPost, ctx.GetVariable(HTTPMethodHeaderKey))
+	assert.Equal(t, "application/json", ctx.GetVariable(HTTPHeadersHeaderKey).(map[string]interface{})["Content-Type"])
+	assert.Nil(t, ctx.GetVariable("priority"))
+	assert.Nil(t, ctx.GetVariable(FileNameHeaderKey))
+
+	assert.Nil(t, orch.StopConsumers())
+	_, err := http.Post("http://"+addr+"/orders", "application/json", strings.NewReader("{}"))
+	assert.NotNil(t, err)
+}
+
+func TestOrchestrator_TimerConsumer(t *testing.T) {
+	accepted := make(chan *context, 10)
+
+	orch := NewOrchestrator()
+	_ = orch.Register(NewNonTransactionalRoute("A").
+		From("timer:tick?period=5ms&repeatCount=3").
+		AddNextStep("1", rejectKo(accepted)))
+	_ = orch.Initialization(nil)
+	assert.Nil(t, orch.StartConsumers())
+
+	for i := 1; i <= 3; i++ {
+		select {
+		case ctx := <-accepted:
+			assert.Equal(t, "tick", ctx.GetVariable(TimerNameHeaderKey))
+			assert.Equal(t, i, ctx.GetVariable(TimerCounterHeaderKey))
+		case <-time.After(time.Second):
+			assert.Fail(t, "the timer doesn't fire")
+		}
+	}
+
+	assert.Nil(t, orch.StopConsumers())
+	assert.Equal(t, 0, len(accepted))
+
+	for _, uri := range []string{"timer:tick?period=0s", "timer:tick?delay=soon", "timer:tick?repeatCount=-1"} {
+		_, err := orch.Components().Consumer(uri)
+		assert.NotNil(t, err, uri)
+	}
+}
+
+func TestOrchestrator_FileConsumer(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "consumer")
+	defer os.RemoveAll(dir)
+
+	_ = ioutil.WriteFile(filepath.Join(dir, "ok.csv"), []byte("ok"), 0644)
+	_ = ioutil.WriteFile(filepath.Join(dir, "ko.csv"), []byte("ko"), 0644)
+
+	accepted := make(chan *context, 10)
+
+	orch := NewOrchestrator()
+	_ = orch.Register(NewNonTransactionalRoute("A").
+		From(fmt.Sprintf("file://%s?delay=10ms", dir)).
+		AddNextStep("1", rejectKo(accepted)))
+	_ = orch.Initialization(nil)
+	assert.Nil(t, orch.StartConsumers())
+
+	ctx := <-accepted
+	assert.Equal(t, "ok.csv", ctx.GetVariable(FileNameHeaderKey))
+	assert.Nil(t, orch.StopConsumers())
+
+	_, err := os.Stat(filepath.Join(dir, ".done", "ok.csv"))
+	assert.Nil(t, err)
+	_, err = os.Stat(filepath.Join(dir, ".error", "ko.csv"))
+	assert.Nil(t, err)
+}
+
+func TestOrchestrator_FileConsumerNotMoved(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "consumer")
+	defer os.RemoveAll(dir)
+
+	// the handled file can't be moved to .done
+	_ = ioutil.WriteFile(filepath.Join(dir, ".done"), nil, 0644)
+	_ = ioutil.WriteFile(filepath.Join(dir, "ok.csv"), []byte("ok"), 0644)
+
+	accepted := make(chan *context, 10)
+
+	orch := NewOrchestrator()
+	_ = orch.Register(NewNonTransactionalRoute("A").
+		From(fmt.Sprintf("file://%s?delay=5ms", dir)).
+		AddNextStep("1", rejectKo(accepted)))
+	_ = orch.Initialization(nil)
+	assert.Nil(t, orch.StartConsumers())
+
+	<-accepted
+	time.Sleep(50 * time.Millisecond)
+	assert.Nil(t, orch.StopConsumers())
+
+	// it's not consumed again
+	assert.Len(t, accepted, 0)
+	_, err := os.Stat(filepath.Join(dir, "ok.csv"))
+	assert.Nil(t, err)
+}
+
+func TestOrchestrator_InvalidSource(t *testing.T) {
+	orch := NewOrchestrator()
+	_ = orch.Register(NewNonTransactionalRoute("A").From("channel:orders").AddNextStep("1", appendStep("1")))
+	_ = orch.Register(NewNonTransactionalRoute("B").From("log:info").AddNextStep("1", appendStep("1")))
+	_ = orch.Initialization(nil)
+
+	assert.NotNil(t, orch.StartConsumers())
+
+	// the started consumers are stopped
+	channels := orch.Components().Component("channel").(*ChannelComponent)
+	assert.Equal(t, ErrNoConsumer, channels.Send("orders", &Message{}))
+	assert.Nil(t, orch.StopConsumers())
+}
@@ -8,15 +8,27 @@ import (
 
 const DefaultVersion = "v1"
 
+// Context is the execution context given to the step functions, the other packages define them with it
+type Context = context
+
 type context struct {
 	gid       string
-	lock      sync.Mutex
+	lock      *sync.Mutex
 	variables map[string]row
+
+	// grid the variables are written through, nil means they're kept in memory only
+	grid DataGrid
+
+	// idempotencyKey of the step attempt in progress
+	idempotencyKey string
 }
 
 type row struct {
 	version string
 	value   interface{}
+
+	// data of the variable in the grid, the value is kept as long as the grid has the same data
+	data []byte
 }
 
 func NewContext() (*context, error) {
@@ -32,7 +44,7 @@ func NewContextWithGid(gid string) (*context, error) {
 
 	return &context{
 		gid:       gid,
-		lock:      sync.Mutex{},
+		lock:      &sync.Mutex{},
 		variables: make(map[string]row),
 	}, nil
 }
@@ -41,14 +53,21 @@ func (ctx *context) SetVariableWithVersion(key string, lastVersion string, newVe
 	ctx.lock.Lock()
 	defer ctx.lock.Unlock()
 
-	ver := ctx.variables[key].version
-	if ver != "" && ver != lastVersion {
-		return errors.New("invalid data version")
+	// the grid keeps the latest version
+	var data []byte
+	if ctx.grid != nil {
+		var err error
+		if data, err = ctx.writeGrid(key, lastVersion, newVersion, value); err != nil {
+			return err
+		}
+	} else if ver := ctx.variables[key].version; ver != "" && ver != lastVersion {
+		return ErrVersionConflict
 	}
 
 	ctx.variables[key] = row{
 		version: newVersion,
 		value:   value,
+		data:    data,
 	}
 
 	return nil
@@ -59,9 +78,57 @@ func (ctx *context) SetVariable(key string, value interface{}) error {
 }
 
 func (ctx *context) GetVariable(key string) interface{} {
-	return ctx.variables[key].value
+	v, _ := ctx.lookupVariable(key)
+
+	return v
 }
 
 func (ctx *context) GetGid() string {
 	return ctx.gid
 }
+
+// values copy the variable values
+func (ctx *context) values() map[string]interface{} {
+	ctx.lock.Lock()
+	defer ctx.lock.Unlock()
+
+	values := make(map[string]interface{}, len(ctx.variables))
+	for k, r := range ctx.variables {
+		values[k] = r.value
+	}
+
+	return values
+}
+
+func (ctx *context) lookupVariable(key string) (interface{}, bool) {
+	ctx.lock.Lock()
+	defer ctx.lock.Unlock()
+
+	// the grid has the changes of the other nodes, the context keeps the typed value otherwise and it's used when
+	// the grid can't be read
+	if ctx.grid != nil {
+		r, err := ctx.readGrid(key)
+		if err == nil {
+			return r.value, true
+		}
+
+		if errors.Is(err, ErrGridKeyNotFound) {
+			delete(ctx.variables, key)
+			return nil, false
+		}
+	}
+
+	r, ok := ctx.variables[key]
+	return r.value, ok
+}
+
+func (ctx *context) removeVariable(key string) {
+	ctx.lock.Lock()
+	defer ctx.lock.Unlock()
+
+	if ctx.grid != nil {
+		_ = ctx.grid.Delete(ctx.gridPrefix() + key)
+	}
+
+	delete(ctx.variables, key)
+}
@@ -2,6 +2,7 @@ package orchestrator
 
 import (
 	"github.com/stretchr/testify/assert"
+	"sync"
 	"testing"
 )
 
@@ -44,3 +45,25 @@ func TestContext_SetVariable(t *testing.T) {
 	assert.Equal(t, headerValue, ctx.GetVariable(headerKey))
 	assert.Equal(t, headerValue, ctx.GetVariable(headerKey2))
 }
+
+func TestContext_GetVariableConcurrently(t *testing.T) {
+	ctx, _ := NewContext()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			_ = ctx.SetVariable("k", i)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			_ = ctx.GetVariable("k")
+		}
+	}()
+	wg.Wait()
+
+	assert.Equal(t, 999, ctx.GetVariable("k"))
+}
@@ -0,0 +1,264 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// Schedule tell the next run time strictly after a time
+	Schedule interface {
+		Next(after time.Time) time.Time
+	}
+
+	// cronSchedule is a five fields cron expression, minute hour day-of-month month day-of-week
+	cronSchedule struct {
+		expr                          string
+		minute, hour, dom, month, dow uint64
+		domStar, dowStar              bool
+	}
+
+	intervalSchedule struct {
+		interval time.Duration
+	}
+
+	cronField struct {
+		min, max int
+		names    map[string]int
+	}
+)
+
+var (
+	minuteField = cronField{min: 0, max: 59}
+	hourField   = cronField{min: 0, max: 23}
+	domField    = cronField{min: 1, max: 31}
+	monthField  = cronField{min: 1, max: 12, names: map[string]int{
+		"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+		"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+	}}
+	// dowField accepts 7 for Sunday as well
+	dowField = cronField{min: 0, max: 7, names: map[string]int{
+		"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+	}}
+
+	cronMacros = map[string]string{
+		"@yearly":   "0 0 1 1 *",
+		"@annually": "0 0 1 1 *",
+		"@monthly":  "0 0 1 * *",
+		"@weekly":   "0 0 * * 0",
+		"@daily":    "0 0 * * *",
+		"@midnight": "0 0 * * *",
+		"@hourly":   "0 * * * *",
+	}
+)
+
+// cronSearchLimit a schedule which doesn't run within the limit never runs, like the 30th of February
+const cronSearchLimit = 5
+
+// ParseCron parse a cron expression: five fields of numbers, names, ranges, steps and lists, or one of the
+// macros @yearly, @monthly, @weekly, @daily, @hourly and @every <duration>. The times are taken in the
+// location of the time given to Next
+func ParseCron(expr string) (Schedule, error) {
+	spec := strings.TrimSpace(expr)
+
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("cron %s: %v", expr, err))
+		}
+
+		return Every(d)
+	}
+
+	if m, ok := cronMacros[spec]; ok {
+		spec = m
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, errors.New(fmt.Sprintf("cron %s: expected 5 fields, found %d", expr, len(fields)))
+	}
+
+	cs := &cronSchedule{expr: expr}
+	var err error
+	parse := func(f string, cf cronField) uint64 {
+		if err != nil {
+			return 0
+		}
+
+		var bits uint64
+		bits, err = cf.parse(f)
+		if err != nil {
+			err = errors.New(fmt.Sprintf("cron %s: %v", expr, err))
+		}
+
+		return bits
+	}
+
+	cs.minute = parse(fields[0], minuteField)
+	cs.hour = parse(fields[1], hourField)
+	cs.dom = parse(fields[2], domField)
+	cs.month = parse(fields[3], monthField)
+	cs.dow = parse(fields[4], dowField)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sunday is 0 and 7
+	if cs.dow&(1<<7) != 0 {
+		cs.dow |= 1
+	}
+
+	cs.domStar = fields[2] == "*" || fields[2] == "?"
+	cs.dowStar = fields[4] == "*" || fields[4] == "?"
+
+	return cs, nil
+}
+
+// Every run at a fixed interval from the previous run
+func Every(interval time.Duration) (Schedule, error) {
+	if interval <= 0 {
+		return nil, errors.New(fmt.Sprintf("invalid interval %s", interval))
+	}
+
+	return &intervalSchedule{interval: interval}, nil
+}
+
+func (is *intervalSchedule) Next(after time.Time) time.Time {
+	return after.Add(is.interval)
+}
+
+func (is *intervalSchedule) String() string {
+	return "@every " + is.interval.String()
+}
+
+func (cs *cronSchedule) String() string {
+	return cs.expr
+}
+
+// Next the first minute after the time which matches the expression, zero when there is none
+func (cs *cronSchedule) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(cronSearchLimit, 0, 0)
+
+	for t.Before(limit) {
+		if cs.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if !cs.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if cs.hour&(1<<uint(t.Hour())) == 0 {
+			// the hour starts in the schedule location, it's not a whole hour in absolute time in every zone
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if cs.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+// matchDay the day of month and the day of week are both matched when they're both restricted, either one
+// of them otherwise
+func (cs *cronSchedule) matchDay(t time.Time) bool {
+	dom := cs.dom&(1<<uint(t.Day())) != 0
+	dow := cs.dow&(1<<uint(t.Weekday())) != 0
+
+	if cs.domStar || cs.dowStar {
+		return dom && dow
+	}
+
+	return dom || dow
+}
+
+// parse a field list into a bit set of the matching values
+func (cf cronField) parse(field string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		b, err := cf.parsePart(part)
+		if err != nil {
+			return 0, err
+		}
+
+		bits |= b
+	}
+
+	return bits, nil
+}
+
+func (cf cronField) parsePart(part string) (uint64, error) {
+	rng, step := part, 1
+	if i := strings.Index(part, "/"); i >= 0 {
+		s, err := strconv.Atoi(part[i+1:])
+		if err != nil || s < 1 {
+			return 0, errors.New(fmt.Sprintf("invalid step %s", part))
+		}
+
+		rng, step = part[:i], s
+	}
+
+	from, to := cf.min, cf.max
+	switch {
+	case rng == "*" || rng == "?":
+	case strings.Contains(rng, "-"):
+		bounds := strings.SplitN(rng, "-", 2)
+
+		var err error
+		if from, err = cf.value(bounds[0]); err != nil {
+			return 0, err
+		}
+
+		if to, err = cf.value(bounds[1]); err != nil {
+			return 0, err
+		}
+	default:
+		v, err := cf.value(rng)
+		if err != nil {
+			return 0, err
+		}
+
+		// a single value with a step runs from the value to the maximum
+		from, to = v, v
+		if step > 1 || strings.Contains(part, "/") {
+			to = cf.max
+		}
+	}
+
+	if from > to {
+		return 0, errors.New(fmt.Sprintf("invalid range %s", part))
+	}
+
+	var bits uint64
+	for v := from; v <= to; v += step {
+		bits |= 1 << uint(v)
+	}
+
+	return bits, nil
+}
+
+func (cf cronField) value(s string) (int, error) {
+	if v, ok := cf.names[strings.ToUpper(s)]; ok {
+		return v, nil
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < cf.min || v > cf.max {
+		return 0, errors.New(fmt.Sprintf("invalid value %s", s))
+	}
+
+	return v, nil
+}
@@ -0,0 +1,73 @@
+package orchestrator
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseCron_Next(t *testing.T) {
+	// Wednesday
+	after := time.Date(2020, 1, 1, 10, 30, 15, 0, time.UTC)
+
+	tests := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2020, 1, 1, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2020, 1, 1, 10, 45, 0, 0, time.UTC)},
+		{"0 * * * *", time.Date(2020, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{"30 10 * * *", time.Date(2020, 1, 2, 10, 30, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2020, 1, 1, 13, 0, 0, 0, time.UTC)},
+		{"0 0 * * MON-FRI", time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2020, 1, 5, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * 5", time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 FEB *", time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2020, 1, 5, 0, 0, 0, 0, time.UTC)},
+		{"@every 90s", time.Date(2020, 1, 1, 10, 31, 45, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+
+	for _, test := range tests {
+		s, err := ParseCron(test.expr)
+		assert.Nil(t, err, test.expr)
+		assert.Equal(t, test.expected, s.Next(after), test.expr)
+	}
+}
+
+func TestParseCron_NextHalfHourZone(t *testing.T) {
+	for _, loc := range []*time.Location{
+		time.FixedZone("IST", 5*3600+30*60),
+		time.FixedZone("ACWST", 8*3600+45*60),
+	} {
+		after := time.Date(2020, 1, 1, 10, 45, 0, 0, loc)
+
+		s, _ := ParseCron("0 11 * * *")
+		assert.Equal(t, time.Date(2020, 1, 1, 11, 0, 0, 0, loc), s.Next(after), loc.String())
+
+		s, _ = ParseCron("30 * * * *")
+		assert.Equal(t, time.Date(2020, 1, 1, 11, 30, 0, 0, loc), s.Next(after), loc.String())
+	}
+}
+
+func TestParseCron_Invalid(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * JANUARY *",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"@every 0s",
+		"@every soon",
+	}
+
+	for _, test := range tests {
+		_, err := ParseCron(test)
+		assert.NotNil(t, err, test)
+	}
+}
@@ -0,0 +1,828 @@
+package orchestrator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ToolHandler is the Go implementation of a CWL tool, the workflow steps resolve it by their run identifier
+type ToolHandler func(inputs map[string]interface{}) (map[string]interface{}, error)
+
+type (
+	// CWLDiagnostic is a problem found in a CWL document at a line and column
+	CWLDiagnostic struct {
+		Line    int
+		Column  int
+		Path    string
+		Message string
+	}
+
+	// CWLError list every diagnostic of a CWL document
+	CWLError struct {
+		Id          string
+		Diagnostics []CWLDiagnostic
+	}
+
+	cwlWorkflow struct {
+		id      string
+		inputs  map[string]*cwlInput
+		outputs []*cwlOutput
+		steps   []*cwlStep
+
+		// requirements of the workflow by class
+		requirements map[string]bool
+	}
+
+	cwlInput struct {
+		id         string
+		def        interface{}
+		hasDefault bool
+	}
+
+	cwlOutput struct {
+		id     string
+		source string
+		node   *yaml.Node
+		path   string
+	}
+
+	cwlStep struct {
+		id           string
+		handler      ToolHandler
+		in           []*cwlStepInput
+		out          []string
+		when         *Expression
+		scatter      []string
+		crossProduct bool
+		node         *yaml.Node
+		path         string
+
+		// step ids of the sources
+		dependencies []string
+	}
+
+	cwlStepInput struct {
+		id         string
+		source     string
+		def        interface{}
+		hasDefault bool
+		node       *yaml.Node
+		path       string
+	}
+
+	cwlImporter struct {
+		registry    *Registry
+		version     string
+		diagnostics []CWLDiagnostic
+	}
+
+	cwlEntry struct {
+		id   string
+		node *yaml.Node
+		path string
+	}
+)
+
+var (
+	cwlVersions = map[string]bool{"v1.0": true, "v1.1": true, "v1.2": true}
+
+	// InlineJavascriptRequirement is accepted for the expression subset of the when conditions only
+	cwlSupportedRequirements = map[string]bool{
+		"ScatterFeatureRequirement":   true,
+		"InlineJavascriptRequirement": true,
+	}
+)
+
+func (d CWLDiagnostic) String() string {
+	return fmt.Sprintf("%d:%d %s: %s", d.Line, d.Column, d.Path, d.Message)
+}
+
+func (ce *CWLError) Error() string {
+	ds := make([]string, len(ce.Diagnostics))
+	for i, d := range ce.Diagnostics {
+		ds[i] = d.String()
+	}
+
+	return fmt.Sprintf("invalid CWL workflow %s: %s", ce.Id, strings.Join(ds, "; "))
+}
+
+// ImportCWL turn a CWL Workflow document (YAML or JSON) into a non transactional route, the steps run in
+// dependency order and call the tool handlers registered under their run identifier
+func ImportCWL(data []byte, registry *Registry) (Route, error) {
+	return importCWL(data, "", registry)
+}
+
+// ReadCWL import a CWL workflow file, the route id is the file name when the workflow has no id
+func ReadCWL(path string, registry *Registry) (Route, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	base := filepath.Base(path)
+	return importCWL(data, strings.TrimSuffix(base, filepath.Ext(base)), registry)
+}
+
+func importCWL(data []byte, defaultId string, registry *Registry) (Route, error) {
+	var doc yaml.Node
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	if registry == nil {
+		registry = NewRegistry()
+	}
+
+	im := &cwlImporter{registry: registry}
+	wf := im.workflow(&doc, defaultId)
+	if len(im.diagnostics) > 0 {
+		return nil, &CWLError{Id: wf.id, Diagnostics: sortedCWLDiagnostics(im.diagnostics)}
+	}
+
+	return wf.route(), nil
+}
+
+func (im *cwlImporter) fail(n *yaml.Node, path string, format string, args ...interface{}) {
+	im.diagnostics = append(im.diagnostics, CWLDiagnostic{
+		Line:    n.Line,
+		Column:  n.Column,
+		Path:    path,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// fields check the mapping keys and return the values by key
+func (im *cwlImporter) fields(n *yaml.Node, path string, known map[string]bool) map[string]*yaml.Node {
+	result := make(map[string]*yaml.Node)
+	if n.Kind != yaml.MappingNode {
+		im.fail(n, path, "expected a mapping")
+		return result
+	}
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		supported, ok := known[k.Value]
+		switch {
+		case !ok:
+			im.fail(k, path, "unknown field %s", k.Value)
+		case !supported:
+			im.fail(k, path, "%s is not supported", k.Value)
+		default:
+			result[k.Value] = v
+		}
+	}
+
+	return result
+}
+
+// entries read the CWL map or list of identified records
+func (im *cwlImporter) entries(n *yaml.Node, path string) []cwlEntry {
+	var result []cwlEntry
+
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			id := n.Content[i].Value
+			result = append(result, cwlEntry{id: cwlId(id), node: n.Content[i+1], path: path + "." + id})
+		}
+	case yaml.SequenceNode:
+		for i, item := range n.Content {
+			p := fmt.Sprintf("%s[%d]", path, i)
+			id := ""
+			switch item.Kind {
+			case yaml.ScalarNode:
+				id = item.Value
+			case yaml.MappingNode:
+				for j := 0; j+1 < len(item.Content); j += 2 {
+					if item.Content[j].Value == "id" {
+						id = item.Content[j+1].Value
+					}
+				}
+			}
+
+			if id == "" {
+				im.fail(item, p, "id is missing")
+				continue
+			}
+
+			result = append(result, cwlEntry{id: cwlId(id), node: item, path: p})
+		}
+	default:
+		im.fail(n, path, "expected a mapping or a list")
+	}
+
+	return result
+}
+
+func (im *cwlImporter) scalar(n *yaml.Node, path string) string {
+	if n.Kind != yaml.ScalarNode {
+		im.fail(n, path, "expected a scalar")
+		return ""
+	}
+
+	return n.Value
+}
+
+// source read a single source, CWL allows a list of sources which needs MultipleInputFeatureRequirement
+func (im *cwlImporter) source(n *yaml.Node, path string) string {
+	if n.Kind == yaml.SequenceNode {
+		if len(n.Content) != 1 {
+			im.fail(n, path, "multiple sources are not supported")
+			return ""
+		}
+
+		n = n.Content[0]
+	}
+
+	return cwlId(im.scalar(n, path))
+}
+
+func (im *cwlImporter) value(n *yaml.Node, path string) interface{} {
+	var v interface{}
+	if err := n.Decode(&v); err != nil {
+		im.fail(n, path, "%v", err)
+	}
+
+	return v
+}
+
+// requirements check the requirements and add their classes to the required ones
+func (im *cwlImporter) requirements(n *yaml.Node, path string, required map[string]bool) map[string]bool {
+	// the list items are identified by their class
+	var entries []cwlEntry
+	if n.Kind == yaml.SequenceNode {
+		for i, item := range n.Content {
+			e := cwlEntry{node: item, path: fmt.Sprintf("%s[%d]", path, i)}
+			for j := 0; item.Kind == yaml.MappingNode && j+1 < len(item.Content); j += 2 {
+				if item.Content[j].Value == "class" {
+					e.id = item.Content[j+1].Value
+				}
+			}
+			entries = append(entries, e)
+		}
+	} else {
+		entries = im.entries(n, path)
+	}
+
+	classes := make(map[string]bool, len(required)+len(entries))
+	for class := range required {
+		classes[class] = true
+	}
+
+	for _, e := range entries {
+		if !cwlSupportedRequirements[e.id] {
+			im.fail(e.node, e.path, "requirement %s is not supported", e.id)
+		}
+
+		classes[e.id] = true
+	}
+
+	return classes
+}
+
+func (im *cwlImporter) workflow(doc *yaml.Node, defaultId string) *cwlWorkflow {
+	wf := &cwlWorkflow{id: defaultId, inputs: make(map[string]*cwlInput)}
+
+	root := doc
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+
+	fields := im.fields(root, "workflow", map[string]bool{
+		"cwlVersion": true, "class": true, "id": true, "label": true, "doc": true, "inputs": true,
+		"outputs": true, "steps": true, "requirements": true, "hints": true, "$namespaces": true,
+		"$schemas": true, "intent": true, "$graph": false,
+	})
+
+	if n, ok := fields["id"]; ok {
+		wf.id = cwlId(im.scalar(n, "id"))
+	}
+
+	if wf.id == "" {
+		im.fail(root, "id", "workflow id is missing")
+	}
+
+	if n, ok := fields["cwlVersion"]; !ok {
+		im.fail(root, "cwlVersion", "cwlVersion is missing")
+	} else if im.version = im.scalar(n, "cwlVersion"); !cwlVersions[im.version] {
+		im.fail(n, "cwlVersion", "version %s is not supported", im.version)
+	}
+
+	if n, ok := fields["class"]; !ok {
+		im.fail(root, "class", "class is missing")
+	} else if class := im.scalar(n, "class"); class != "Workflow" {
+		im.fail(n, "class", "class %s is not supported, only Workflow documents are imported", class)
+	}
+
+	if n, ok := fields["requirements"]; ok {
+		wf.requirements = im.requirements(n, "requirements", nil)
+	}
+
+	if n, ok := fields["inputs"]; ok {
+		for _, e := range im.entries(n, "inputs") {
+			wf.inputs[e.id] = im.input(e)
+		}
+	}
+
+	if n, ok := fields["steps"]; !ok || len(n.Content) == 0 {
+		im.fail(root, "steps", "workflow has no step")
+	} else {
+		for _, e := range im.entries(n, "steps") {
+			wf.steps = append(wf.steps, im.step(e, wf.requirements))
+		}
+	}
+
+	if n, ok := fields["outputs"]; ok {
+		for _, e := range im.entries(n, "outputs") {
+			wf.outputs = append(wf.outputs, im.output(e))
+		}
+	}
+
+	im.link(wf)
+
+	return wf
+}
+
+func (im *cwlImporter) input(e cwlEntry) *cwlInput {
+	in := &cwlInput{id: e.id}
+	if e.node.Kind != yaml.MappingNode {
+		// type shorthand
+		return in
+	}
+
+	fields := im.fields(e.node, e.path, map[string]bool{
+		"id": true, "type": true, "default": true, "label": true, "doc": true, "format": true,
+		"secondaryFiles": false, "streamable": false, "loadContents": false, "loadListing": false,
+		"inputBinding": false,
+	})
+
+	if n, ok := fields["default"]; ok {
+		in.def, in.hasDefault = im.value(n, e.path+".default"), true
+	}
+
+	return in
+}
+
+func (im *cwlImporter) output(e cwlEntry) *cwlOutput {
+	out := &cwlOutput{id: e.id, node: e.node, path: e.path}
+	fields := im.fields(e.node, e.path, map[string]bool{
+		"id": true, "type": true, "outputSource": true, "label": true, "doc": true, "format": true,
+		"linkMerge": false, "pickValue": false, "secondaryFiles": false, "streamable": false,
+	})
+
+	if n, ok := fields["outputSource"]; ok {
+		out.source = im.source(n, e.path+".outputSource")
+		out.node, out.path = n, e.path+".outputSource"
+	} else {
+		im.fail(e.node, e.path, "output %s has no outputSource", e.id)
+	}
+
+	return out
+}
+
+func (im *cwlImporter) step(e cwlEntry, required map[string]bool) *cwlStep {
+	s := &cwlStep{id: e.id, node: e.node, path: e.path}
+	fields := im.fields(e.node, e.path, map[string]bool{
+		"id": true, "run": true, "in": true, "out": true, "when": true, "scatter": true, "scatterMethod": true,
+		"label": true, "doc": true, "requirements": true, "hints": true,
+	})
+
+	if n, ok := fields["requirements"]; ok {
+		required = im.requirements(n, e.path+".requirements", required)
+	}
+
+	if n, ok := fields["run"]; !ok {
+		im.fail(e.node, e.path, "step %s has no run", e.id)
+	} else if n.Kind != yaml.ScalarNode {
+		im.fail(n, e.path+".run", "embedded process is not supported, run must be a registered tool identifier")
+	} else if h, err := im.registry.tool(cwlId(n.Value)); err != nil {
+		im.fail(n, e.path+".run", "%v", err)
+	} else {
+		s.handler = h
+	}
+
+	if n, ok := fields["in"]; ok {
+		for _, ie := range im.entries(n, e.path+".in") {
+			s.in = append(s.in, im.stepInput(ie))
+		}
+	}
+
+	if n, ok := fields["out"]; ok {
+		if n.Kind != yaml.SequenceNode {
+			im.fail(n, e.path+".out", "expected a list")
+		} else {
+			for _, oe := range im.entries(n, e.path+".out") {
+				s.out = append(s.out, oe.id)
+			}
+		}
+	}
+
+	if n, ok := fields["when"]; ok {
+		s.when = im.when(s, n, e.path+".when", required["InlineJavascriptRequirement"])
+	}
+
+	if n, ok := fields["scatter"]; ok {
+		if !required["ScatterFeatureRequirement"] {
+			im.fail(n, e.path+".scatter", "scatter needs ScatterFeatureRequirement")
+		}
+
+		items := []*yaml.Node{n}
+		if n.Kind == yaml.SequenceNode {
+			items = n.Content
+		}
+
+		for _, item := range items {
+			id := cwlId(im.scalar(item, e.path+".scatter"))
+			if s.input(id) == nil {
+				im.fail(item, e.path+".scatter", "scatter input %s is not a step input", id)
+			}
+			s.scatter = append(s.scatter, id)
+		}
+	}
+
+	if n, ok := fields["scatterMethod"]; ok {
+		switch method := im.scalar(n, e.path+".scatterMethod"); method {
+		case "dotproduct":
+		case "flat_crossproduct":
+			s.crossProduct = true
+		default:
+			im.fail(n, e.path+".scatterMethod", "scatter method %s is not supported", method)
+		}
+
+		if len(s.scatter) == 0 {
+			im.fail(n, e.path+".scatterMethod", "scatterMethod without scatter")
+		}
+	}
+
+	return s
+}
+
+func (im *cwlImporter) stepInput(e cwlEntry) *cwlStepInput {
+	in := &cwlStepInput{id: e.id, node: e.node, path: e.path}
+	if e.node.Kind != yaml.MappingNode {
+		in.source = im.source(e.node, e.path)
+		return in
+	}
+
+	fields := im.fields(e.node, e.path, map[string]bool{
+		"id": true, "source": true, "default": true, "label": true,
+		"valueFrom": false, "linkMerge": false, "pickValue": false, "loadContents": false, "loadListing": false,
+	})
+
+	if n, ok := fields["source"]; ok {
+		in.source = im.source(n, e.path+".source")
+		in.node, in.path = n, e.path+".source"
+	}
+
+	if n, ok := fields["default"]; ok {
+		in.def, in.hasDefault = im.value(n, e.path+".default"), true
+	}
+
+	return in
+}
+
+// when compile a `$(...)` parameter reference, the step inputs are the only variables. The inline javascript
+// isn't run, an expression out of the subset is reported as such
+func (im *cwlImporter) when(s *cwlStep, n *yaml.Node, path string, javascript bool) *Expression {
+	if im.version != "v1.2" {
+		im.fail(n, path, "when needs cwlVersion v1.2")
+	}
+
+	unsupported := func(format string, args ...interface{}) {
+		if javascript {
+			format = "InlineJavascriptRequirement supports the expression subset only: " + format
+		}
+		im.fail(n, path, format, args...)
+	}
+
+	src := strings.TrimSpace(im.scalar(n, path))
+	if !strings.HasPrefix(src, "$(") || !strings.HasSuffix(src, ")") {
+		unsupported("only $(...) expressions are supported")
+		return nil
+	}
+
+	src = strings.NewReplacer("===", "==", "!==", "!=").Replace(src[2 : len(src)-1])
+	variables := make(map[string]ExpressionType)
+	for _, in := range s.in {
+		variables["inputs."+in.id] = AnyType
+	}
+
+	e, err := CompileExpression(src, variables)
+	if err != nil {
+		unsupported("%v", err)
+		return nil
+	}
+
+	if e.Type() != BoolType && e.Type() != AnyType {
+		im.fail(n, path, "condition is %s", e.Type())
+		return nil
+	}
+
+	return e
+}
+
+// link resolve the sources and sort the steps by dependency
+func (im *cwlImporter) link(wf *cwlWorkflow) {
+	steps := make(map[string]*cwlStep)
+	for _, s := range wf.steps {
+		if steps[s.id] != nil {
+			im.fail(s.node, s.path, "duplicate step %s", s.id)
+		}
+		steps[s.id] = s
+	}
+
+	// resolve return the step of the source, nil for a workflow input
+	resolve := func(source string, n *yaml.Node, path string) (*cwlStep, bool) {
+		if source == "" {
+			return nil, true
+		}
+
+		if !strings.Contains(source, "/") {
+			if wf.inputs[source] == nil {
+				im.fail(n, path, "unknown input %s", source)
+				return nil, false
+			}
+
+			return nil, true
+		}
+
+		parts := strings.SplitN(source, "/", 2)
+		s := steps[parts[0]]
+		if s == nil {
+			im.fail(n, path, "unknown step %s", parts[0])
+			return nil, false
+		}
+
+		for _, out := range s.out {
+			if out == parts[1] {
+				return s, true
+			}
+		}
+
+		im.fail(n, path, "step %s has no output %s", parts[0], parts[1])
+		return nil, false
+	}
+
+	for _, s := range wf.steps {
+		for _, in := range s.in {
+			if dep, ok := resolve(in.source, in.node, in.path); ok && dep != nil {
+				s.dependencies = append(s.dependencies, dep.id)
+			}
+		}
+	}
+
+	for _, out := range wf.outputs {
+		resolve(out.source, out.node, out.path)
+	}
+
+	// stable topological sort, the declaration order is kept between independent steps
+	var sorted []*cwlStep
+	done := make(map[string]bool)
+	for len(sorted) < len(wf.steps) {
+		progress := false
+		for _, s := range wf.steps {
+			if done[s.id] {
+				continue
+			}
+
+			ready := true
+			for _, dep := range s.dependencies {
+				ready = ready && done[dep]
+			}
+
+			if ready {
+				sorted = append(sorted, s)
+				done[s.id] = true
+				progress = true
+			}
+		}
+
+		if !progress {
+			for _, s := range wf.steps {
+				if !done[s.id] {
+					im.fail(s.node, s.path, "step %s is part of a dependency cycle", s.id)
+				}
+			}
+
+			return
+		}
+	}
+
+	wf.steps = sorted
+}
+
+func (wf *cwlWorkflow) route() Route {
+	r := NewNonTransactionalRoute(wf.id)
+	for i, s := range wf.steps {
+		action := wf.stepAction(s)
+		if i == len(wf.steps)-1 {
+			stepAction := action
+			action = func(ctx *context) error {
+				if err := stepAction(ctx); err != nil {
+					return err
+				}
+
+				return wf.setOutputs(ctx)
+			}
+		}
+
+		r.AddNextStep(s.id, action)
+	}
+
+	return r
+}
+
+// value of a source, the variables are the workflow input ids and the step outputs as step/output
+func (wf *cwlWorkflow) value(ctx *context, source string) (interface{}, bool) {
+	if v, ok := ctx.lookupVariable(source); ok && v != nil {
+		return v, true
+	}
+
+	if in := wf.inputs[source]; in != nil && in.hasDefault {
+		return in.def, true
+	}
+
+	return nil, false
+}
+
+func (wf *cwlWorkflow) setOutputs(ctx *context) error {
+	for _, out := range wf.outputs {
+		v, _ := wf.value(ctx, out.source)
+		if err := ctx.SetVariable(out.id, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (wf *cwlWorkflow) stepAction(s *cwlStep) func(ctx *context) error {
+	return func(ctx *context) error {
+		inputs := make(map[string]interface{})
+		for _, in := range s.in {
+			v, ok := wf.value(ctx, in.source)
+			if !ok && in.hasDefault {
+				v = in.def
+			}
+			inputs[in.id] = v
+		}
+
+		jobs, err := s.jobs(inputs)
+		if err != nil {
+			return err
+		}
+
+		results := make([]map[string]interface{}, len(jobs))
+		for i, job := range jobs {
+			if results[i], err = s.run(ctx, job); err != nil {
+				return err
+			}
+		}
+
+		for _, out := range s.out {
+			var v interface{}
+			if len(s.scatter) == 0 {
+				v = results[0][out]
+			} else {
+				values := make([]interface{}, len(results))
+				for i, r := range results {
+					values[i] = r[out]
+				}
+				v = values
+			}
+
+			if err := ctx.SetVariable(s.id+"/"+out, v); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// run the step job, a skipped job has no output
+func (s *cwlStep) run(ctx *context, inputs map[string]interface{}) (map[string]interface{}, error) {
+	if s.when != nil {
+		wctx, err := NewContextWithGid(ctx.GetGid())
+		if err != nil {
+			return nil, err
+		}
+
+		if err := wctx.SetVariable("inputs", inputs); err != nil {
+			return nil, err
+		}
+
+		v, err := s.when.Evaluate(*wctx)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("step %s: %v", s.id, err))
+		}
+
+		if b, ok := v.(bool); !ok || !b {
+			return nil, nil
+		}
+	}
+
+	outputs, err := s.handler(inputs)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("step %s: %v", s.id, err))
+	}
+
+	return outputs, nil
+}
+
+// jobs split the inputs of a scattered step, one job per element
+func (s *cwlStep) jobs(inputs map[string]interface{}) ([]map[string]interface{}, error) {
+	if len(s.scatter) == 0 {
+		return []map[string]interface{}{inputs}, nil
+	}
+
+	lists := make([][]interface{}, len(s.scatter))
+	for i, id := range s.scatter {
+		rv := reflect.ValueOf(inputs[id])
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return nil, errors.New(fmt.Sprintf("step %s: scatter input %s is not a list", s.id, id))
+		}
+
+		for j := 0; j < rv.Len(); j++ {
+			lists[i] = append(lists[i], rv.Index(j).Interface())
+		}
+	}
+
+	var combinations [][]int
+	if s.crossProduct {
+		combinations = [][]int{{}}
+		for _, l := range lists {
+			var next [][]int
+			for _, c := range combinations {
+				for j := range l {
+					next = append(next, append(append([]int{}, c...), j))
+				}
+			}
+			combinations = next
+		}
+	} else {
+		for _, l := range lists[1:] {
+			if len(l) != len(lists[0]) {
+				return nil, errors.New(fmt.Sprintf("step %s: dotproduct scatter inputs have different lengths", s.id))
+			}
+		}
+
+		for j := range lists[0] {
+			c := make([]int, len(lists))
+			for i := range c {
+				c[i] = j
+			}
+			combinations = append(combinations, c)
+		}
+	}
+
+	jobs := make([]map[string]interface{}, len(combinations))
+	for k, c := range combinations {
+		job := make(map[string]interface{}, len(inputs))
+		for id, v := range inputs {
+			job[id] = v
+		}
+
+		for i, id := range s.scatter {
+			job[id] = lists[i][c[i]]
+		}
+		jobs[k] = job
+	}
+
+	return jobs, nil
+}
+
+func (s *cwlStep) input(id string) *cwlStepInput {
+	for _, in := range s.in {
+		if in.id == id {
+			return in
+		}
+	}
+
+	return nil
+}
+
+// cwlId strip the fragment prefix of an identifier
+func cwlId(id string) string {
+	return strings.TrimPrefix(id, "#")
+}
+
+// sortedCWLDiagnostics order the diagnostics by position
+func sortedCWLDiagnostics(ds []CWLDiagnostic) []CWLDiagnostic {
+	sort.SliceStable(ds, func(i, j int) bool {
+		if ds[i].Line != ds[j].Line {
+			return ds[i].Line < ds[j].Line
+		}
+
+		return ds[i].Column < ds[j].Column
+	})
+
+	return ds
+}
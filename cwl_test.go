@@ -0,0 +1,237 @@
+package orchestrator
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+const cwlWorkflowYAML = `
+cwlVersion: v1.2
+class: Workflow
+id: '#resize'
+requirements:
+  - class: ScatterFeatureRequirement
+  - class: InlineJavascriptRequirement
+inputs:
+  images: string[]
+  width:
+    type: int
+    default: 100
+outputs:
+  resized:
+    type: string[]
+    outputSource: resize/image
+  archive:
+    type: string
+    outputSource: compress/archive
+steps:
+  compress:
+    run: '#zip'
+    in:
+      files: resize/image
+      enabled:
+        default: false
+    out: [archive]
+    when: $(inputs.enabled === true)
+  resize:
+    run: scale
+    in:
+      image: images
+      width: width
+    out: [image]
+    scatter: image
+`
+
+func cwlTestRegistry(calls *[]string) *Registry {
+	return NewRegistry().
+		RegisterTool("scale", func(inputs map[string]interface{}) (map[string]interface{}, error) {
+			image := inputs["image"].(string)
+			*calls = append(*calls, "scale "+image)
+			return map[string]interface{}{"image": strings.ToUpper(image)}, nil
+		}).
+		RegisterTool("zip", func(inputs map[string]interface{}) (map[string]interface{}, error) {
+			*calls = append(*calls, "zip")
+			return map[string]interface{}{"archive": "images.zip"}, nil
+		})
+}
+
+func TestImportCWL(t *testing.T) {
+	var calls []string
+	r, err := ImportCWL([]byte(cwlWorkflowYAML), cwlTestRegistry(&calls))
+	assert.Nil(t, err)
+	assert.Equal(t, "resize", r.GetRouteId())
+
+	ctx, _ := NewContext()
+	_ = ctx.SetVariable("images", []interface{}{"a.png", "b.png"})
+	result := newRouteRunner(r.GetStartState(), nil, nil).run(ctx)
+
+	assert.Equal(t, Completed, result.Status)
+	// the steps run in dependency order and the condition of compress is false
+	assert.Equal(t, []string{"scale a.png", "scale b.png"}, calls)
+	assert.Equal(t, []interface{}{"A.PNG", "B.PNG"}, ctx.GetVariable("resized"))
+	assert.Nil(t, ctx.GetVariable("archive"))
+}
+
+func TestImportCWL_CrossProduct(t *testing.T) {
+	doc := `{
+  "cwlVersion": "v1.0",
+  "class": "Workflow",
+  "id": "grid",
+  "requirements": {"ScatterFeatureRequirement": {}},
+  "inputs": [{"id": "xs", "type": "int[]"}, {"id": "ys", "type": "int[]"}],
+  "outputs": [{"id": "sums", "type": "int[]", "outputSource": "#add/sum"}],
+  "steps": [{
+    "id": "add",
+    "run": "add",
+    "in": [{"id": "x", "source": "#xs"}, {"id": "y", "source": ["ys"]}],
+    "out": [{"id": "sum"}],
+    "scatter": ["x", "y"],
+    "scatterMethod": "flat_crossproduct"
+  }]
+}`
+
+	registry := NewRegistry().RegisterTool("add", func(inputs map[string]interface{}) (map[string]interface{}, error) {
+		return map[string]interface{}{"sum": inputs["x"].(int) + inputs["y"].(int)}, nil
+	})
+
+	r, err := ImportCWL([]byte(doc), registry)
+	assert.Nil(t, err)
+
+	ctx, _ := NewContext()
+	_ = ctx.SetVariable("xs", []int{1, 2})
+	_ = ctx.SetVariable("ys", []int{10, 20})
+	result := newRouteRunner(r.GetStartState(), nil, nil).run(ctx)
+
+	assert.Equal(t, Completed, result.Status)
+	assert.Equal(t, []interface{}{11, 21, 12, 22}, ctx.GetVariable("sums"))
+}
+
+func TestImportCWL_Diagnostics(t *testing.T) {
+	tests := []struct {
+		name        string
+		doc         string
+		diagnostics []string
+	}{
+		{"command line tool", `
+cwlVersion: v1.2
+class: CommandLineTool
+id: tool
+baseCommand: echo
+`, []string{
+			"2:1 steps: workflow has no step",
+			"3:8 class: class CommandLineTool is not supported, only Workflow documents are imported",
+			"5:1 workflow: unknown field baseCommand",
+		}},
+		{"unsupported features", `
+cwlVersion: v1.1
+class: Workflow
+requirements:
+  SubworkflowFeatureRequirement: {}
+inputs:
+  x: int
+outputs:
+  y:
+    outputSource: [a/out, b/out]
+    pickValue: first_non_null
+steps:
+  a:
+    run:
+      class: ExpressionTool
+    in:
+      x:
+        source: x
+        valueFrom: $(self + 1)
+    out: [out]
+    when: $(inputs.x > 1)
+    scatter: x
+    scatterMethod: nested_crossproduct
+`, []string{
+			"2:1 id: workflow id is missing",
+			"5:34 requirements.SubworkflowFeatureRequirement: requirement SubworkflowFeatureRequirement is not supported",
+			"10:19 outputs.y.outputSource: multiple sources are not supported",
+			"11:5 outputs.y: pickValue is not supported",
+			"15:7 steps.a.run: embedded process is not supported, run must be a registered tool identifier",
+			"19:9 steps.a.in.x: valueFrom is not supported",
+			"21:11 steps.a.when: when needs cwlVersion v1.2",
+			"22:14 steps.a.scatter: scatter needs ScatterFeatureRequirement",
+			"23:20 steps.a.scatterMethod: scatter method nested_crossproduct is not supported",
+		}},
+		{"links", `
+cwlVersion: v1.2
+class: Workflow
+id: links
+inputs: {}
+outputs:
+  - id: out
+    outputSource: missing/out
+steps:
+  - id: a
+    run: scale
+    in:
+      x: b/out
+      y: unknown
+    out: [out]
+    when: $(inputs.z > 1)
+  - id: b
+    run: unregistered
+    in:
+      x: a/out
+      y: a/other
+    out: [out]
+`, []string{
+			"8:19 outputs[0].outputSource: unknown step missing",
+			"10:5 steps[0]: step a is part of a dependency cycle",
+			"14:10 steps[0].in.y: unknown input unknown",
+			"16:11 steps[0].when: expression `inputs.z > 1` at 0: unknown variable inputs.z",
+			"17:5 steps[1]: step b is part of a dependency cycle",
+			"18:10 steps[1].run: tool unregistered is not registered",
+			"21:10 steps[1].in.y: step a has no output other",
+		}},
+		{"inline javascript", `
+cwlVersion: v1.2
+class: Workflow
+id: javascript
+inputs:
+  x: int
+outputs: []
+steps:
+  a:
+    run: scale
+    requirements:
+      - class: InlineJavascriptRequirement
+    in:
+      image: x
+    out: [image]
+    when: ${ return inputs.image > 1; }
+  b:
+    run: scale
+    requirements:
+      InlineJavascriptRequirement: {}
+    in:
+      image: x
+    out: [image]
+    when: $(inputs.image.toFixed(0) > 1)
+`, []string{
+			"16:11 steps.a.when: InlineJavascriptRequirement supports the expression subset only: only $(...) expressions are supported",
+			"24:11 steps.b.when: InlineJavascriptRequirement supports the expression subset only: expression `inputs.image.toFixed(0) > 1` at 20: unexpected (",
+		}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls []string
+			_, err := ImportCWL([]byte(tc.doc), cwlTestRegistry(&calls))
+
+			var ce *CWLError
+			assert.True(t, errors.As(err, &ce))
+
+			var diagnostics []string
+			for _, d := range ce.Diagnostics {
+				diagnostics = append(diagnostics, d.String())
+			}
+			assert.Equal(t, tc.diagnostics, diagnostics)
+		})
+	}
+}
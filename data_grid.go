@@ -0,0 +1,597 @@
+package orchestrator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// DataGrid keep values out of the process heap, the values are serialized so the grid can be a networked one.
+	// The versions follow the context variables: a missing or unversioned entry can be set from any version
+	DataGrid interface {
+		// Get return ErrGridKeyNotFound when the key is missing or expired
+		Get(key string) (*GridEntry, error)
+
+		// Put set the value whatever the current version, a zero ttl means it doesn't expire
+		Put(key string, value []byte, version string, ttl time.Duration) error
+
+		// CompareAndSet set the value when the current version is the last version, ErrVersionConflict otherwise
+		CompareAndSet(key string, lastVersion string, newVersion string, value []byte, ttl time.Duration) error
+
+		Delete(key string) error
+
+		// Keys return the keys starting with the prefix, sorted
+		Keys(prefix string) ([]string, error)
+
+		// Watch send the changes of the keys starting with the prefix until it's cancelled, the channel is
+		// closed when the watcher doesn't keep up
+		Watch(prefix string) (<-chan GridEvent, func(), error)
+
+		Close() error
+	}
+
+	// GridEntry is a value of the grid
+	GridEntry struct {
+		Key     string
+		Value   []byte
+		Version string
+
+		// ExpiresAt zero means the entry doesn't expire
+		ExpiresAt time.Time
+	}
+
+	// GridEventType is the change of a grid entry
+	GridEventType string
+
+	// GridEvent is a change of a watched key, the entry is the new one or the removed one
+	GridEvent struct {
+		Type  GridEventType
+		Entry GridEntry
+	}
+
+	// MemoryGridConfig of the in-process grid
+	MemoryGridConfig struct {
+		// Shards default is 16
+		Shards int
+
+		// WatchBuffer events kept for a watcher, default is 64
+		WatchBuffer int
+
+		// SweepInterval remove the expired entries every interval, zero means they're removed when they're read
+		SweepInterval time.Duration
+
+		Clock Clock
+	}
+
+	// memoryGrid is the in-process grid, the keys are spread over shards locked on their own
+	memoryGrid struct {
+		config MemoryGridConfig
+		shards []*gridShard
+
+		lock     sync.Mutex
+		watchers map[*gridWatcher]bool
+		closed   bool
+		stop     chan struct{}
+	}
+
+	gridShard struct {
+		lock    sync.Mutex
+		entries map[string]GridEntry
+	}
+
+	gridWatcher struct {
+		prefix string
+		events chan GridEvent
+	}
+
+	// gridCaretaker keep the mementos in a grid, another node sharing the grid can resume the executions
+	gridCaretaker struct {
+		caretaker
+		grid DataGrid
+	}
+)
+
+const (
+	GridPut    GridEventType = "PUT"
+	GridDelete GridEventType = "DELETE"
+	GridExpire GridEventType = "EXPIRE"
+)
+
+const (
+	defaultGridShards      = 16
+	defaultGridWatchBuffer = 64
+
+	// contextGridPrefix keep the variables of a context as context/{gid}/{key}
+	contextGridPrefix = "context/"
+
+	mementoGridPrefix = "memento/"
+
+	// effectGridPrefix keep the side effects of an execution as effect/{gid}/{key}
+	effectGridPrefix = "effect/"
+)
+
+var (
+	// ErrGridKeyNotFound is returned for a missing or an expired key
+	ErrGridKeyNotFound = errors.New("grid key not found")
+
+	// ErrVersionConflict is returned when the version of the entry isn't the expected one
+	ErrVersionConflict = errors.New("invalid data version")
+
+	errGridClosed = errors.New("grid is closed")
+)
+
+// NewMemoryGrid create an in-process grid
+func NewMemoryGrid(config MemoryGridConfig) *memoryGrid {
+	if config.Shards <= 0 {
+		config.Shards = defaultGridShards
+	}
+
+	if config.WatchBuffer <= 0 {
+		config.WatchBuffer = defaultGridWatchBuffer
+	}
+
+	if config.Clock == nil {
+		config.Clock = systemClock{}
+	}
+
+	g := &memoryGrid{
+		config:   config,
+		shards:   make([]*gridShard, config.Shards),
+		watchers: make(map[*gridWatcher]bool),
+		stop:     make(chan struct{}),
+	}
+
+	for i := range g.shards {
+		g.shards[i] = &gridShard{entries: make(map[string]GridEntry)}
+	}
+
+	if config.SweepInterval > 0 {
+		go g.sweep(config.SweepInterval)
+	}
+
+	return g
+}
+
+func (g *memoryGrid) shard(key string) *gridShard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+
+	return g.shards[h.Sum32()%uint32(len(g.shards))]
+}
+
+func (g *memoryGrid) Get(key string) (*GridEntry, error) {
+	s := g.shard(key)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	e, ok := g.live(s, key)
+	if !ok {
+		return nil, ErrGridKeyNotFound
+	}
+
+	e.Value = copyBytes(e.Value)
+	return &e, nil
+}
+
+func (g *memoryGrid) Put(key string, value []byte, version string, ttl time.Duration) error {
+	s := g.shard(key)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return g.set(s, key, value, version, ttl)
+}
+
+func (g *memoryGrid) CompareAndSet(key string, lastVersion string, newVersion string, value []byte, ttl time.Duration) error {
+	s := g.shard(key)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if e, ok := g.live(s, key); ok && e.Version != "" && e.Version != lastVersion {
+		return fmt.Errorf("key %s version %s: %w", key, e.Version, ErrVersionConflict)
+	}
+
+	return g.set(s, key, value, newVersion, ttl)
+}
+
+func (g *memoryGrid) Delete(key string) error {
+	s := g.shard(key)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if e, ok := g.live(s, key); ok {
+		delete(s.entries, key)
+		g.notify(GridEvent{Type: GridDelete, Entry: e})
+	}
+
+	return nil
+}
+
+func (g *memoryGrid) Keys(prefix string) ([]string, error) {
+	var keys []string
+	for _, s := range g.shards {
+		s.lock.Lock()
+		for k := range s.entries {
+			if strings.HasPrefix(k, prefix) {
+				if _, ok := g.live(s, k); ok {
+					keys = append(keys, k)
+				}
+			}
+		}
+		s.lock.Unlock()
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (g *memoryGrid) Watch(prefix string) (<-chan GridEvent, func(), error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.closed {
+		return nil, nil, errGridClosed
+	}
+
+	w := &gridWatcher{prefix: prefix, events: make(chan GridEvent, g.config.WatchBuffer)}
+	g.watchers[w] = true
+
+	return w.events, func() {
+		g.lock.Lock()
+		defer g.lock.Unlock()
+
+		g.unwatch(w)
+	}, nil
+}
+
+// Close stop the sweep and close the watchers
+func (g *memoryGrid) Close() error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.closed {
+		return nil
+	}
+
+	g.closed = true
+	close(g.stop)
+	for w := range g.watchers {
+		g.unwatch(w)
+	}
+
+	return nil
+}
+
+// live return the entry unless it's expired, the expired entry is removed
+func (g *memoryGrid) live(s *gridShard, key string) (GridEntry, bool) {
+	e, ok := s.entries[key]
+	if !ok {
+		return e, false
+	}
+
+	if !e.ExpiresAt.IsZero() && !g.config.Clock.Now().Before(e.ExpiresAt) {
+		delete(s.entries, key)
+		g.notify(GridEvent{Type: GridExpire, Entry: e})
+
+		return e, false
+	}
+
+	return e, true
+}
+
+func (g *memoryGrid) set(s *gridShard, key string, value []byte, version string, ttl time.Duration) error {
+	e := GridEntry{Key: key, Value: copyBytes(value), Version: version}
+	if ttl > 0 {
+		e.ExpiresAt = g.config.Clock.Now().Add(ttl)
+	}
+
+	s.entries[key] = e
+	g.notify(GridEvent{Type: GridPut, Entry: e})
+
+	return nil
+}
+
+// notify the watchers of the key, a watcher which buffer is full is closed
+func (g *memoryGrid) notify(event GridEvent) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	for w := range g.watchers {
+		if !strings.HasPrefix(event.Entry.Key, w.prefix) {
+			continue
+		}
+
+		e := event
+		e.Entry.Value = copyBytes(event.Entry.Value)
+
+		select {
+		case w.events <- e:
+		default:
+			g.unwatch(w)
+		}
+	}
+}
+
+func (g *memoryGrid) unwatch(w *gridWatcher) {
+	if g.watchers[w] {
+		delete(g.watchers, w)
+		close(w.events)
+	}
+}
+
+// sweep remove the expired entries every interval on the grid clock
+func (g *memoryGrid) sweep(interval time.Duration) {
+	for {
+		tick, stop := after(g.config.Clock, interval)
+		select {
+		case <-tick:
+		case <-g.stop:
+			stop()
+			return
+		}
+
+		for _, s := range g.shards {
+			s.lock.Lock()
+			for k := range s.entries {
+				g.live(s, k)
+			}
+			s.lock.Unlock()
+		}
+	}
+}
+
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+
+	return append([]byte(nil), b...)
+}
+
+// NewGridCaretaker keep the mementos in the grid
+func NewGridCaretaker(grid DataGrid) *gridCaretaker {
+	return &gridCaretaker{grid: grid}
+}
+
+func (c *gridCaretaker) persist(id string, memento string) error {
+	return c.grid.Put(mementoGridPrefix+id, []byte(memento), "", 0)
+}
+
+func (c *gridCaretaker) get(id string) (string, error) {
+	e, err := c.grid.Get(mementoGridPrefix + id)
+	if errors.Is(err, ErrGridKeyNotFound) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(e.Value), nil
+}
+
+func (c *gridCaretaker) ids() ([]string, error) {
+	keys, err := c.grid.Keys(mementoGridPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(keys))
+	for _, k := range keys {
+		ids = append(ids, strings.TrimPrefix(k, mementoGridPrefix))
+	}
+
+	return ids, nil
+}
+
+func (c *gridCaretaker) latest() ([]logStr, error) {
+	ids, err := c.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	logs := make([]logStr, 0, len(ids))
+	for _, id := range ids {
+		data, err := c.get(id)
+		if err != nil {
+			return nil, err
+		}
+
+		// the entry may be deleted meanwhile
+		if data != "" {
+			logs = append(logs, logStr{Id: id, Data: data})
+		}
+	}
+
+	return logs, nil
+}
+
+func (c *gridCaretaker) effects() effectStore {
+	return c
+}
+
+func (c *gridCaretaker) record(gid string, key string, effect string) error {
+	return c.grid.Put(effectGridPrefix+gid+"/"+key, []byte(effect), "", 0)
+}
+
+func (c *gridCaretaker) recorded(gid string, key string) (string, error) {
+	e, err := c.grid.Get(effectGridPrefix + gid + "/" + key)
+	if errors.Is(err, ErrGridKeyNotFound) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(e.Value), nil
+}
+
+func (c *gridCaretaker) forget(gid string) error {
+	keys, err := c.grid.Keys(effectGridPrefix + gid + "/")
+	if err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		if err := c.grid.Delete(k); err != nil && !errors.Is(err, ErrGridKeyNotFound) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// shutdown the grid is closed by its owner
+func (c *gridCaretaker) shutdown() error {
+	return nil
+}
+
+// SetDataGrid write the variables of the execution contexts through the grid until the executions are finished, the
+// isolated contexts of the called routes stay in memory
+func (o *orchestrator) SetDataGrid(grid DataGrid) {
+	o.grid = grid
+}
+
+// NewContextWithGrid create a context reading and writing its variables through the grid, the variables already
+// in the grid are read when they are missing from the context
+func NewContextWithGrid(gid string, grid DataGrid) (*context, error) {
+	ctx, err := NewContextWithGid(gid)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx.grid = grid
+	return ctx, nil
+}
+
+// LoadContext read a context with all its variables from the grid, the context keeps writing through the grid
+func LoadContext(gid string, grid DataGrid) (*context, error) {
+	ctx, err := NewContextWithGrid(gid, grid)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := grid.Keys(ctx.gridPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	ctx.lock.Lock()
+	defer ctx.lock.Unlock()
+
+	for _, k := range keys {
+		if _, err := ctx.readGrid(strings.TrimPrefix(k, ctx.gridPrefix())); err != nil && !errors.Is(err, ErrGridKeyNotFound) {
+			return nil, err
+		}
+	}
+
+	return ctx, nil
+}
+
+// attach write the context through the grid from now on, the variables are put in the grid
+func (ctx *context) attach(grid DataGrid) error {
+	ctx.lock.Lock()
+	defer ctx.lock.Unlock()
+
+	if ctx.grid != nil {
+		return nil
+	}
+
+	for k, r := range ctx.variables {
+		data, err := marshalVariable(k, r.version, r.value)
+		if err != nil {
+			return err
+		}
+
+		if err := grid.Put(ctx.gridPrefix()+k, data, r.version, 0); err != nil {
+			return err
+		}
+
+		r.data = data
+		ctx.variables[k] = r
+	}
+
+	ctx.grid = grid
+	return nil
+}
+
+// detach stop writing the context through the grid and delete its variables from the grid
+func (ctx *context) detach() error {
+	ctx.lock.Lock()
+	defer ctx.lock.Unlock()
+
+	if ctx.grid == nil {
+		return nil
+	}
+
+	keys, err := ctx.grid.Keys(ctx.gridPrefix())
+	if err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		if err := ctx.grid.Delete(k); err != nil && !errors.Is(err, ErrGridKeyNotFound) {
+			return err
+		}
+	}
+
+	ctx.grid = nil
+	return nil
+}
+
+func (ctx *context) gridPrefix() string {
+	return contextGridPrefix + ctx.gid + "/"
+}
+
+// writeGrid set the variable in the grid on the context version semantic
+func (ctx *context) writeGrid(key string, lastVersion string, newVersion string, value interface{}) ([]byte, error) {
+	data, err := marshalVariable(key, newVersion, value)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, ctx.grid.CompareAndSet(ctx.gridPrefix()+key, lastVersion, newVersion, data, 0)
+}
+
+// readGrid refresh the context variable from the grid, the value is decoded when the grid has other data than the
+// context so the values which don't round trip through JSON are kept until another node changes them; the numbers
+// are restored like in the mementos
+func (ctx *context) readGrid(key string) (row, error) {
+	e, err := ctx.grid.Get(ctx.gridPrefix() + key)
+	if err != nil {
+		return row{}, err
+	}
+
+	if r, ok := ctx.variables[key]; ok && bytes.Equal(r.data, e.Value) {
+		r.version = e.Version
+		ctx.variables[key] = r
+		return r, nil
+	}
+
+	var vm variableMemento
+	if err := json.Unmarshal(e.Value, &vm); err != nil {
+		return row{}, errors.New(fmt.Sprintf("variable %s: %v", key, err))
+	}
+
+	r := row{version: e.Version, value: vm.Value, data: e.Value}
+	ctx.variables[key] = r
+
+	return r, nil
+}
+
+// marshalVariable encode the variable like in the mementos
+func marshalVariable(key string, version string, value interface{}) ([]byte, error) {
+	data, err := json.Marshal(newVariableMemento(version, value))
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("variable %s: %v", key, err))
+	}
+
+	return data, nil
+}
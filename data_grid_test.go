@@ -0,0 +1,241 @@
+package orchestrator
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMemoryGrid_CompareAndSet(t *testing.T) {
+	grid := NewMemoryGrid(MemoryGridConfig{Shards: 4})
+	defer grid.Close()
+
+	_, err := grid.Get("k")
+	assert.True(t, errors.Is(err, ErrGridKeyNotFound))
+
+	tests := []struct {
+		lastVersion string
+		newVersion  string
+		conflict    bool
+	}{
+		// a missing entry is set from any version
+		{"v7", "v1", false},
+		{"v1", "v2", false},
+		{"v1", "v3", true},
+		{"v2", "", false},
+		// an unversioned entry as well
+		{"v9", "v4", false},
+	}
+
+	for i, test := range tests {
+		err := grid.CompareAndSet("k", test.lastVersion, test.newVersion, []byte{byte(i)}, 0)
+		assert.Equal(t, test.conflict, errors.Is(err, ErrVersionConflict), i)
+	}
+
+	e, err := grid.Get("k")
+	assert.Nil(t, err)
+	assert.Equal(t, "v4", e.Version)
+	assert.Equal(t, []byte{4}, e.Value)
+
+	assert.Nil(t, grid.Put("k", []byte("x"), "v1", 0))
+	assert.Nil(t, grid.Put("a/1", nil, "", 0))
+	assert.Nil(t, grid.Put("a/2", nil, "", 0))
+
+	keys, _ := grid.Keys("a/")
+	assert.Equal(t, []string{"a/1", "a/2"}, keys)
+
+	assert.Nil(t, grid.Delete("a/1"))
+	keys, _ = grid.Keys("")
+	assert.Equal(t, []string{"a/2", "k"}, keys)
+}
+
+func TestMemoryGrid_Watch(t *testing.T) {
+	clock := &testClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	grid := NewMemoryGrid(MemoryGridConfig{Clock: clock, WatchBuffer: 4})
+	defer grid.Close()
+
+	events, cancel, err := grid.Watch("a/")
+	assert.Nil(t, err)
+
+	_ = grid.Put("a/1", []byte("1"), "", time.Minute)
+	_ = grid.Put("b/1", []byte("1"), "", 0)
+	_ = grid.Delete("a/2")
+	_ = grid.Put("a/2", []byte("2"), "", 0)
+	_ = grid.Delete("a/2")
+
+	clock.add(time.Minute)
+	_, err = grid.Get("a/1")
+	assert.True(t, errors.Is(err, ErrGridKeyNotFound))
+
+	var received []string
+	for i := 0; i < 4; i++ {
+		e := <-events
+		received = append(received, string(e.Type)+" "+e.Entry.Key)
+	}
+	assert.Equal(t, []string{"PUT a/1", "PUT a/2", "DELETE a/2", "EXPIRE a/1"}, received)
+
+	cancel()
+	_, open := <-events
+	assert.False(t, open)
+
+	// the watcher which doesn't keep up is closed
+	events, _, _ = grid.Watch("")
+	for i := 0; i < 5; i++ {
+		_ = grid.Put("k", nil, "", 0)
+	}
+
+	for range events {
+	}
+}
+
+func TestMemoryGrid_Sweep(t *testing.T) {
+	clock := &testClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	grid := NewMemoryGrid(MemoryGridConfig{Clock: clock, SweepInterval: time.Millisecond})
+
+	_ = grid.Put("k", nil, "", time.Second)
+	events, _, _ := grid.Watch("")
+	clock.add(time.Second)
+
+	select {
+	case e := <-events:
+		assert.Equal(t, GridExpire, e.Type)
+	case <-time.After(time.Second):
+		assert.Fail(t, "the expired entry is not swept")
+	}
+
+	assert.Nil(t, grid.Close())
+	_, open := <-events
+	assert.False(t, open)
+
+	_, _, err := grid.Watch("")
+	assert.NotNil(t, err)
+}
+
+func TestMemoryGrid_SweepOnClock(t *testing.T) {
+	clock := newTimingClock()
+	grid := NewMemoryGrid(MemoryGridConfig{Clock: clock, SweepInterval: time.Minute})
+	defer grid.Close()
+
+	_ = grid.Put("k", nil, "", time.Second)
+	events, _, _ := grid.Watch("")
+
+	// the sweep waits for the interval on the clock
+	clock.armed(t)
+	clock.advance(time.Minute)
+
+	select {
+	case e := <-events:
+		assert.Equal(t, GridExpire, e.Type)
+	case <-time.After(time.Second):
+		assert.Fail(t, "the expired entry is not swept")
+	}
+}
+
+func TestContext_Grid(t *testing.T) {
+	grid := NewMemoryGrid(MemoryGridConfig{})
+	defer grid.Close()
+
+	ctx, _ := NewContextWithGrid("gid", grid)
+	assert.Nil(t, ctx.SetVariable("amount", 10))
+	assert.Nil(t, ctx.SetVariableWithVersion("order", "", "v1", map[string]interface{}{"id": "O-1"}))
+
+	// another node reads the variables from the grid
+	other, err := LoadContext("gid", grid)
+	assert.Nil(t, err)
+	assert.Equal(t, 10, other.GetVariable("amount"))
+	assert.Equal(t, map[string]interface{}{"id": "O-1"}, other.GetVariable("order"))
+
+	// the versions are checked against the grid
+	assert.Nil(t, ctx.SetVariableWithVersion("order", "v1", "v2", "updated"))
+	err = other.SetVariableWithVersion("order", "v1", "v2", "stale")
+	assert.True(t, errors.Is(err, ErrVersionConflict))
+
+	lazy, _ := NewContextWithGrid("gid", grid)
+	assert.Equal(t, "updated", lazy.GetVariable("order"))
+
+	// the writes of another node are read back
+	assert.Nil(t, lazy.SetVariableWithVersion("order", "v2", "v3", "again"))
+	assert.Equal(t, "again", ctx.GetVariable("order"))
+	assert.Equal(t, "again", other.GetVariable("order"))
+
+	ctx.removeVariable("amount")
+	assert.Nil(t, lazy.GetVariable("amount"))
+
+	_, err = grid.Get("context/gid/amount")
+	assert.True(t, errors.Is(err, ErrGridKeyNotFound))
+
+	assert.NotNil(t, ctx.SetVariable("callback", func() {}))
+}
+
+func TestOrchestrator_DataGrid(t *testing.T) {
+	grid := NewMemoryGrid(MemoryGridConfig{})
+	defer grid.Close()
+
+	node := func() *orchestrator {
+		orch := NewOrchestrator()
+		orch.SetCaretaker(NewGridCaretaker(grid))
+		orch.SetDataGrid(grid)
+		_ = orch.Register(approvalRoute(0))
+		_ = orch.Initialization(nil)
+
+		return orch
+	}
+
+	ctx, _ := NewContextWithGid("gid")
+	_ = ctx.SetVariable("customer", "C-1")
+	result, err := node().Exec("A", ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, Waiting, result.Status)
+
+	shared, _ := LoadContext("gid", grid)
+	assert.Equal(t, "C-1", shared.GetVariable("customer"))
+	assert.Equal(t, "1;", shared.GetVariable("STEPS"))
+
+	// another node resumes the execution from the grid
+	result, err = node().Signal("gid", "approval", map[string]interface{}{"approved": true})
+	assert.Nil(t, err)
+	assert.Equal(t, Completed, result.Status)
+
+	final, _ := node().loadMemento("gid")
+	assert.Equal(t, "1;3;", final.Contexts[0].values()["STEPS"])
+	assert.Equal(t, true, final.Contexts[0].values()["approved"])
+
+	// the finished execution leaves the grid
+	keys, err := grid.Keys("context/gid/")
+	assert.Nil(t, err)
+	assert.Empty(t, keys)
+}
+
+func TestOrchestrator_DataGridRecovery(t *testing.T) {
+	grid := NewMemoryGrid(MemoryGridConfig{})
+	defer grid.Close()
+
+	var lines interface{}
+	orch := NewOrchestrator()
+	orch.SetDataGrid(grid)
+	_ = orch.Register(NewTransactionalRoute("A").
+		AddNextStep("1", func(ctx *context) error {
+			return ctx.SetVariable("lines", []string{"L-1"})
+		}, undoActionTest).
+		AddNextStep("2", func(ctx *context) error {
+			lines = ctx.GetVariable("lines")
+			return &CircuitOpenError{Name: "payments"}
+		}, undoActionTest))
+	_ = orch.Initialization(NewNonTransactionalRoute(DefaultRecoveryRouteId).
+		AddNextStep("decide", func(ctx *context) error {
+			if CircuitOpen("payments")(*ctx) {
+				return ctx.SetVariable(RecoveryDecisionHeaderKey, Abort)
+			}
+
+			return ctx.SetVariable(RecoveryDecisionHeaderKey, Rollback)
+		}))
+
+	// the recovery route reads the failure as an error through the grid
+	ctx, _ := NewContextWithGid("gid")
+	result, err := orch.Exec("A", ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, Aborted, result.Status)
+	assert.Equal(t, Abort, result.Errors[0].Decision)
+	assert.Equal(t, []string{"L-1"}, lines)
+}
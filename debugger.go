@@ -0,0 +1,173 @@
+package orchestrator
+
+import "sort"
+
+type (
+	// DebugFrame is the replay paused before a state
+	DebugFrame struct {
+		// Step index of the state in the replay, from 0
+		Step  int
+		State string
+
+		// Recorded state of the journal at the same step, empty beyond the recorded history
+		Recorded string
+
+		// Diverged the replay left the recorded states at this step or before
+		Diverged bool
+
+		// Variables of the state context before the state
+		Variables map[string]interface{}
+	}
+
+	// Debugger replay the history of an execution state by state like Replay, the replay pauses before each
+	// state until it's stepped or continued. Close must be called when the replay is abandoned
+	Debugger struct {
+		runner      *routeRunner
+		ctx         *context
+		breakpoints map[string]bool
+
+		started  bool
+		diverged bool
+		frame    *DebugFrame
+		frames   chan *DebugFrame
+		resume   chan bool
+		done     chan struct{}
+		result   *ExecutionResult
+	}
+)
+
+// NewDebugger create a debugger paused before the replay, the called routes are needed when the route has endpoints
+func NewDebugger(entries []*JournalEntry, route Route, called ...Route) (*Debugger, error) {
+	rr, ctx, err := newReplayRunner(entries, route, called)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Debugger{
+		runner:      rr,
+		ctx:         ctx,
+		breakpoints: make(map[string]bool),
+		frames:      make(chan *DebugFrame),
+		resume:      make(chan bool),
+		done:        make(chan struct{}),
+	}
+	rr.replay.pause = d.pause
+
+	return d, nil
+}
+
+// SetBreakpoint pause Continue before the state
+func (d *Debugger) SetBreakpoint(state string) {
+	d.breakpoints[state] = true
+}
+
+func (d *Debugger) ClearBreakpoint(state string) {
+	delete(d.breakpoints, state)
+}
+
+// Breakpoints return the state names with a breakpoint
+func (d *Debugger) Breakpoints() []string {
+	result := make([]string, 0, len(d.breakpoints))
+	for state := range d.breakpoints {
+		result = append(result, state)
+	}
+
+	sort.Strings(result)
+	return result
+}
+
+// Step execute the state the replay is paused before and pause before the next one, nil when the replay is finished
+func (d *Debugger) Step() *DebugFrame {
+	if d.Finished() {
+		return nil
+	}
+
+	if !d.started {
+		d.started = true
+		go func() {
+			d.result = d.runner.run(d.ctx)
+			close(d.done)
+		}()
+	} else {
+		d.resume <- true
+	}
+
+	select {
+	case d.frame = <-d.frames:
+	case <-d.done:
+		d.frame = nil
+	}
+
+	return d.frame
+}
+
+// Continue step until a state with a breakpoint, nil when the replay is finished
+func (d *Debugger) Continue() *DebugFrame {
+	for f := d.Step(); f != nil; f = d.Step() {
+		if d.breakpoints[f.State] {
+			return f
+		}
+	}
+
+	return nil
+}
+
+// Frame return the frame the replay is paused on, nil before the replay and once it's finished
+func (d *Debugger) Frame() *DebugFrame {
+	return d.frame
+}
+
+// Finished the replay reached the end of the route
+func (d *Debugger) Finished() bool {
+	select {
+	case <-d.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Report return the replay report once the replay is finished
+func (d *Debugger) Report() (*ReplayReport, bool) {
+	if !d.Finished() {
+		return nil, false
+	}
+
+	return d.runner.replay.report(d.result), true
+}
+
+// Close run the replay to the end without pausing
+func (d *Debugger) Close() {
+	if !d.started {
+		d.Step()
+	}
+
+	if !d.Finished() {
+		close(d.resume)
+		<-d.done
+	}
+
+	d.frame = nil
+}
+
+// pause hand the frame over to the debugger and wait to be resumed, the replay doesn't pause once it's closed
+func (d *Debugger) pause(state *State, ctx *context) {
+	jr := d.runner.replay
+	f := &DebugFrame{
+		Step:      len(jr.states),
+		State:     state.name,
+		Variables: ctx.values(),
+	}
+
+	if f.Step < len(jr.recorded) {
+		f.Recorded = jr.recorded[f.Step]
+	}
+
+	d.diverged = d.diverged || f.Recorded != f.State
+	f.Diverged = d.diverged
+
+	d.frames <- f
+	if !<-d.resume {
+		jr.pause = nil
+	}
+}
@@ -0,0 +1,117 @@
+package orchestrator
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+// recordHistory run the route on a file caretaker and read the execution history back
+func recordHistory(t *testing.T, route Route, gid string) []*JournalEntry {
+	fc, _ := NewFileCareTacker("debugger_journal")
+	defer os.Remove(fc.f.Name())
+	defer fc.shutdown()
+
+	orch := NewOrchestrator()
+	orch.SetCaretaker(fc)
+	_ = orch.Register(route)
+	_ = orch.Initialization(nil)
+
+	ctx, _ := NewContextWithGid(gid)
+	_, err := orch.Exec(route.GetRouteId(), ctx)
+	assert.Nil(t, err)
+
+	entries, err := ReadJournal(fc.f.Name())
+	assert.Nil(t, err)
+
+	return JournalHistory(entries, gid)
+}
+
+func TestDebugger(t *testing.T) {
+	history := recordHistory(t, journalTestRoute("amount > 100"), "gid")
+
+	d, err := NewDebugger(history, journalTestRoute("amount > 100"))
+	assert.Nil(t, err)
+	assert.Nil(t, d.Frame())
+
+	f := d.Step()
+	assert.Equal(t, &DebugFrame{Step: 0, State: "R_1", Recorded: "R_1", Variables: map[string]interface{}{}}, f)
+
+	f = d.Step()
+	assert.Equal(t, "R_big", f.State)
+	assert.Equal(t, 150, f.Variables["amount"])
+	assert.Equal(t, f, d.Frame())
+
+	d.SetBreakpoint("R_done")
+	f = d.Continue()
+	assert.Equal(t, "R_done", f.State)
+	assert.Equal(t, "big;", f.Variables["STEPS"])
+	assert.False(t, d.Finished())
+
+	_, finished := d.Report()
+	assert.False(t, finished)
+
+	assert.Nil(t, d.Continue())
+	assert.True(t, d.Finished())
+	assert.Nil(t, d.Step())
+
+	report, finished := d.Report()
+	assert.True(t, finished)
+	assert.Equal(t, -1, report.Diverged)
+	assert.Equal(t, Completed, report.Status)
+
+	// the changed condition takes another branch
+	d, _ = NewDebugger(history, journalTestRoute("amount > 200"))
+	d.SetBreakpoint("R_small")
+	d.SetBreakpoint("R_done")
+	assert.Equal(t, []string{"R_done", "R_small"}, d.Breakpoints())
+	d.ClearBreakpoint("R_done")
+
+	f = d.Continue()
+	assert.Equal(t, &DebugFrame{
+		Step:      1,
+		State:     "R_small",
+		Recorded:  "R_big",
+		Diverged:  true,
+		Variables: map[string]interface{}{"amount": 150},
+	}, f)
+
+	d.Close()
+	assert.True(t, d.Finished())
+	assert.Nil(t, d.Frame())
+
+	report, _ = d.Report()
+	assert.Equal(t, 1, report.Diverged)
+	assert.Equal(t, []string{"R_1", "R_small", "R_done"}, report.Replayed)
+
+	_, err = NewDebugger(nil, journalTestRoute("amount > 100"))
+	assert.NotNil(t, err)
+}
+
+func TestReplay_RecordedFailures(t *testing.T) {
+	failures := 0
+	route := func(fail bool) Route {
+		return NewTransactionalRoute("T").
+			AddNextStep("1", appendStep("1"), func(ctx context) error { return nil }).
+			AddNextStep("2", func(ctx *context) error {
+				if fail {
+					failures++
+					return errors.New("state T_2: declined (card: expired)")
+				}
+
+				return nil
+			}, nil)
+	}
+
+	history := recordHistory(t, route(true), "gid")
+	assert.Equal(t, RolledBack, history[len(history)-1].Status)
+
+	// the recorded failure is replayed and the execution rolls back again without running the actions
+	report, err := Replay(history, route(false))
+	assert.Nil(t, err)
+	assert.Equal(t, RolledBack, report.Status)
+	assert.Equal(t, -1, report.Diverged)
+	assert.Equal(t, []string{"T_1", "T_2", "T_1"}, report.Replayed)
+	assert.Equal(t, 1, failures)
+}
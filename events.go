@@ -0,0 +1,58 @@
+package orchestrator
+
+import "time"
+
+// EventType is the kind of lifecycle event of an execution
+type EventType string
+
+const (
+	EventStarted      EventType = "STARTED"
+	EventResumed      EventType = "RESUMED"
+	EventStateEntered EventType = "STATE_ENTERED"
+	EventStepFailed   EventType = "STEP_FAILED"
+	EventWaiting      EventType = "WAITING"
+	EventFinished     EventType = "FINISHED"
+)
+
+type (
+	// ExecutionEvent is a lifecycle event of an execution
+	ExecutionEvent struct {
+		Type    EventType
+		Gid     string
+		RouteId string
+
+		// State entered, failed or the execution is waiting or finished on
+		State string
+
+		// RollingBack the state is entered to be undone
+		RollingBack bool
+
+		// Err the failure of a failed step with its decision
+		Err *StepError
+
+		// Result the outcome of a waiting or finished execution
+		Result *ExecutionResult
+
+		Time time.Time
+	}
+
+	// ExecutionListener is called in the execution goroutine on each lifecycle event, it's called by the
+	// concurrent executions at the same time
+	ExecutionListener func(e *ExecutionEvent)
+)
+
+// SetListener listen to the lifecycle events of the executions started or resumed from now on
+func (o *orchestrator) SetListener(l ExecutionListener) {
+	o.listener = l
+}
+
+func (rr *routeRunner) emit(e *ExecutionEvent) {
+	if rr.listener == nil {
+		return
+	}
+
+	e.Gid = rr.gid
+	e.RouteId = rr.routeId
+	e.Time = rr.clock.Now()
+	rr.listener(e)
+}
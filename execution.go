@@ -0,0 +1,438 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrCancelled is the error of a cancelled execution, the execution is aborted before its next step
+	ErrCancelled = errors.New("execution cancelled")
+
+	// ErrExecutionNotFound is returned for an execution which is neither running nor persisted
+	ErrExecutionNotFound = errors.New("execution not found")
+)
+
+type (
+	// ExecutionInfo is the view of a running or a persisted execution
+	ExecutionInfo struct {
+		Gid     string          `json:"gid"`
+		RouteId string          `json:"route_id"`
+		Version int             `json:"version"`
+		Status  ExecutionStatus `json:"status"`
+
+		// State executed or to execute when the execution is running, otherwise the latest executed state
+		State string `json:"state"`
+
+		// Variables of the execution context
+		Variables map[string]interface{} `json:"variables"`
+		Errors    []string               `json:"errors,omitempty"`
+
+		// Signal the waiting execution waits for, empty on a timer; it wakes up at the deadline, if any
+		Signal   string     `json:"signal,omitempty"`
+		Deadline *time.Time `json:"deadline,omitempty"`
+	}
+
+	// execution is a live execution of the orchestrator
+	execution struct {
+		lock    sync.Mutex
+		gid     string
+		routeId string
+		version int
+
+		// ctx execution context, the isolated contexts of the called routes are not part of it
+		ctx *context
+
+		// snapshot of the execution context serialized before the current step, the queries read it; it's taken
+		// only when queries are registered
+		snapshot []byte
+		queried  func() bool
+
+		state     string
+		status    ExecutionStatus
+		errors    []string
+		cancelled bool
+
+		// failures the step errors as they're returned, the errors describe them
+		failures []*StepError
+
+		// finished time of the finished execution
+		finished time.Time
+		clock    Clock
+
+		// release remove the execution from the live executions once it's finished
+		release func()
+	}
+)
+
+// track register the runner execution, a gid runs once at a time
+func (o *orchestrator) track(rr *routeRunner, ctx *context) error {
+	o.executionsLock.Lock()
+	defer o.executionsLock.Unlock()
+
+	return o.register(rr, ctx)
+}
+
+// trackStart register the runner of a new execution, a gid which isn't finished is rejected and the idempotency
+// guard rejects a gid already started; m is the persisted memento of the gid, nil when there is none
+func (o *orchestrator) trackStart(rr *routeRunner, ctx *context, m *memento) error {
+	if isTriggerId(ctx.gid) {
+		return errors.New(fmt.Sprintf("gid %s is reserved for the trigger records", ctx.gid))
+	}
+
+	o.executionsLock.Lock()
+	defer o.executionsLock.Unlock()
+
+	if o.idempotencyWindow > 0 {
+		result, err := o.existing(ctx.gid, m)
+		if err != nil {
+			return err
+		}
+
+		if result != nil {
+			return &DuplicateError{Result: result}
+		}
+	} else if m != nil && !m.Status.isFinished() {
+		return errors.New(fmt.Sprintf("execution %s is %s", ctx.gid, m.Status))
+	}
+
+	return o.register(rr, ctx)
+}
+
+func (o *orchestrator) register(rr *routeRunner, ctx *context) error {
+	if e := o.executions[ctx.gid]; e != nil {
+		if status := e.currentStatus(); !status.isFinished() {
+			return errors.New(fmt.Sprintf("execution %s is %s", ctx.gid, status))
+		}
+	}
+
+	if o.grid != nil {
+		if err := ctx.attach(o.grid); err != nil {
+			return err
+		}
+	}
+
+	e := &execution{
+		gid:     ctx.gid,
+		routeId: rr.routeId,
+		version: rr.versions[rr.routeId],
+		ctx:     ctx,
+		queried: o.queried,
+		status:  Running,
+		clock:   o.clock,
+	}
+
+	// a persisted execution is read back from the caretaker once it's finished, otherwise the idempotency guard
+	// keeps it for the window
+	persisted := o.caretaker != nil
+	e.release = func() {
+		e.lock.Lock()
+		finished := e.status.isFinished()
+		e.lock.Unlock()
+
+		// the grid keeps the contexts of the executions in progress only
+		if finished && o.grid != nil {
+			_ = ctx.detach()
+		}
+
+		o.executionsLock.Lock()
+		defer o.executionsLock.Unlock()
+
+		if o.executions[e.gid] != e {
+			return
+		}
+
+		if !persisted && o.idempotencyWindow > 0 && finished {
+			o.retained = append(o.retained, e)
+			return
+		}
+
+		delete(o.executions, e.gid)
+	}
+
+	o.evict()
+	o.executions[ctx.gid] = e
+	rr.execution = e
+
+	return nil
+}
+
+// evict the retained executions finished before the idempotency window
+func (o *orchestrator) evict() {
+	now := o.clock.Now()
+
+	n := 0
+	for _, e := range o.retained {
+		e.lock.Lock()
+		expired := now.Sub(e.finished) >= o.idempotencyWindow
+		e.lock.Unlock()
+
+		if !expired {
+			break
+		}
+
+		if o.executions[e.gid] == e {
+			delete(o.executions, e.gid)
+		}
+		n++
+	}
+
+	o.retained = o.retained[n:]
+}
+
+// Execution return a running execution or the latest memento of a persisted one
+func (o *orchestrator) Execution(gid string) (*ExecutionInfo, error) {
+	o.executionsLock.Lock()
+	e := o.executions[gid]
+	o.executionsLock.Unlock()
+
+	if e != nil {
+		return e.info(), nil
+	}
+
+	if o.caretaker == nil {
+		return nil, fmt.Errorf("execution %s: %w", gid, ErrExecutionNotFound)
+	}
+
+	m, err := o.loadMemento(gid)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.info(), nil
+}
+
+// Executions list the running and the persisted executions with a status, an empty status lists all of them
+func (o *orchestrator) Executions(status ExecutionStatus) ([]*ExecutionInfo, error) {
+	infos := make(map[string]*ExecutionInfo)
+	if o.caretaker != nil {
+		logs, err := o.caretaker.latest()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, log := range logs {
+			if isTriggerId(log.Id) {
+				continue
+			}
+
+			m, err := unmarshalMemento(log.Data)
+			if err != nil {
+				return nil, err
+			}
+
+			infos[log.Id] = m.info()
+		}
+	}
+
+	// the running executions are ahead of their mementos
+	o.executionsLock.Lock()
+	live := make([]*execution, 0, len(o.executions))
+	for _, e := range o.executions {
+		live = append(live, e)
+	}
+	o.executionsLock.Unlock()
+
+	for _, e := range live {
+		infos[e.gid] = e.info()
+	}
+
+	sorted := make([]string, 0, len(infos))
+	for gid := range infos {
+		sorted = append(sorted, gid)
+	}
+	sort.Strings(sorted)
+
+	var result []*ExecutionInfo
+	for _, gid := range sorted {
+		if info := infos[gid]; status == "" || info.Status == status {
+			result = append(result, info)
+		}
+	}
+
+	return result, nil
+}
+
+// Cancel abort a running execution before its next step, the running step is not interrupted
+func (o *orchestrator) Cancel(gid string) error {
+	o.executionsLock.Lock()
+	e := o.executions[gid]
+	o.executionsLock.Unlock()
+
+	if e == nil {
+		if o.caretaker == nil {
+			return fmt.Errorf("execution %s: %w", gid, ErrExecutionNotFound)
+		}
+
+		m, err := o.loadMemento(gid)
+		if err != nil {
+			return err
+		}
+
+		return errors.New(fmt.Sprintf("execution %s is %s", gid, m.Status))
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.status != Running {
+		return errors.New(fmt.Sprintf("execution %s is %s", gid, e.status))
+	}
+
+	e.cancelled = true
+	return nil
+}
+
+// Redrive execute an aborted execution again from the state it stopped on, on the route versions it started with
+func (o *orchestrator) Redrive(gid string) (*ExecutionResult, error) {
+	rr, err := o.prepareFromMemento(gid, Aborted)
+	if err != nil {
+		return nil, err
+	}
+
+	return o.resumeRunner(rr)
+}
+
+// prepareFromMemento create the runner of a persisted execution in the expected status and track it
+func (o *orchestrator) prepareFromMemento(gid string, status ExecutionStatus) (*routeRunner, error) {
+	m, err := o.loadMemento(gid)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.Status != status {
+		return nil, errors.New(fmt.Sprintf("execution %s is %s", gid, m.Status))
+	}
+
+	rr, err := o.runnerFromMemento(m)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := o.track(rr, rr.rootContext()); err != nil {
+		return nil, err
+	}
+
+	return rr, nil
+}
+
+// runnerFromMemento create a runner on the memento route versions and restore it
+func (o *orchestrator) runnerFromMemento(m *memento) (*routeRunner, error) {
+	rr, err := o.newRunner(m.RouteId, m.Routes)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := rr.restore(m); err != nil {
+		return nil, err
+	}
+
+	return rr, nil
+}
+
+// currentStatus of the execution
+func (e *execution) currentStatus() ExecutionStatus {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return e.status
+}
+
+func (e *execution) info() *ExecutionInfo {
+	cm := newContextMemento(e.ctx)
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	info := &ExecutionInfo{
+		Gid:       e.gid,
+		RouteId:   e.routeId,
+		Version:   e.version,
+		Status:    e.status,
+		State:     e.state,
+		Variables: cm.values(),
+		Errors:    e.errors,
+	}
+
+	return info
+}
+
+// step record the state the execution is about to execute, false when the execution is cancelled
+func (e *execution) step(state string) bool {
+	snapshot := e.takeSnapshot()
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.state = state
+	e.snapshot = snapshot
+	return !e.cancelled
+}
+
+func (e *execution) finish(result *ExecutionResult) {
+	snapshot := e.takeSnapshot()
+
+	e.lock.Lock()
+	e.snapshot = snapshot
+	e.state = result.State
+	e.status = result.Status
+	if result.Status.isFinished() {
+		e.finished = e.clock.Now()
+	}
+	for _, se := range result.Errors {
+		e.errors = append(e.errors, se.Error())
+	}
+	e.failures = append(e.failures, result.Errors...)
+	e.lock.Unlock()
+
+	if e.release != nil {
+		e.release()
+	}
+}
+
+// takeSnapshot serialize the context like in the mementos so the queries read a copy of their own, nil when there
+// is no query to read it
+func (e *execution) takeSnapshot() []byte {
+	if e.queried == nil || !e.queried() {
+		return nil
+	}
+
+	data, err := json.Marshal(newContextMemento(e.ctx))
+	if err != nil {
+		return nil
+	}
+
+	return data
+}
+
+func (m *memento) info() *ExecutionInfo {
+	info := &ExecutionInfo{
+		Gid:      m.Gid,
+		RouteId:  m.RouteId,
+		Version:  m.Version,
+		Status:   m.Status,
+		State:    m.State,
+		Errors:   m.Errors,
+		Signal:   m.Signal,
+		Deadline: m.Deadline,
+	}
+
+	if len(m.Contexts) > 0 {
+		info.Variables = m.Contexts[0].values()
+	}
+
+	return info
+}
+
+func (cm contextMemento) values() map[string]interface{} {
+	values := make(map[string]interface{}, len(cm.Variables))
+	for k, v := range cm.Variables {
+		values[k] = v.Value
+	}
+
+	return values
+}
@@ -0,0 +1,109 @@
+package orchestrator
+
+import (
+	"fmt"
+	"strings"
+)
+
+type (
+	// ExecutionStatus is the final status of a route execution
+	ExecutionStatus string
+
+	// RecoveryDecision tells the route runner what to do after a step failed
+	RecoveryDecision string
+)
+
+const (
+	// Completed the execution reached the end of the route
+	Completed ExecutionStatus = "COMPLETED"
+	// RolledBack the execution compensated the visited transactional steps
+	RolledBack ExecutionStatus = "ROLLED_BACK"
+	// Aborted the execution stopped on a failed step, or rolled back to a passed pivot
+	Aborted ExecutionStatus = "ABORTED"
+
+	// Resume continue with the failed state transitions as if the step succeeded
+	Resume RecoveryDecision = "RESUME"
+	// Rollback switch the execution to rollback and call the undo actions of the visited steps
+	Rollback RecoveryDecision = "ROLLBACK"
+	// Abort stop the execution
+	Abort RecoveryDecision = "ABORT"
+)
+
+// The recovery route reads the failure from these context variables and can set RecoveryDecisionHeaderKey
+// to one of Resume, Rollback or Abort. The variables are removed when the recovery is finished.
+const (
+	RecoveryErrorHeaderKey    = "RECOVERY_ERROR"
+	RecoveryStateHeaderKey    = "RECOVERY_STATE"
+	RecoveryDecisionHeaderKey = "RECOVERY_DECISION"
+)
+
+type (
+	// StepError keep a failed step and how the failure has been handled
+	StepError struct {
+		// State name of the failed state
+		State string
+
+		// Err returned by the state action
+		Err error
+
+		// Decision taken after the recovery route
+		Decision RecoveryDecision
+
+		// RecoveryErr returned by the recovery route, if any
+		RecoveryErr error
+	}
+
+	// ExecutionResult aggregate the outcome of a route execution
+	ExecutionResult struct {
+		Gid    string
+		Status ExecutionStatus
+
+		// State latest executed state name
+		State string
+
+		// Errors recorded failures in the order they happened
+		Errors []*StepError
+
+		// Duplicate the gid was already started, the result is the one of the existing execution
+		Duplicate bool
+	}
+)
+
+func (se *StepError) Error() string {
+	msg := fmt.Sprintf("state %s: %v (%s)", se.State, se.Err, se.Decision)
+	if se.RecoveryErr != nil {
+		msg = fmt.Sprintf("%s, recovery failed: %v", msg, se.RecoveryErr)
+	}
+
+	return msg
+}
+
+func (se *StepError) Unwrap() error {
+	return se.Err
+}
+
+// Err return an error describing all recorded failures, nil if there is no failure
+func (er *ExecutionResult) Err() error {
+	if len(er.Errors) == 0 {
+		return nil
+	}
+
+	msgs := make([]string, 0, len(er.Errors))
+	for _, se := range er.Errors {
+		msgs = append(msgs, se.Error())
+	}
+
+	return fmt.Errorf("execution %s %s: %s", er.Gid, er.Status, strings.Join(msgs, "; "))
+}
+
+// decision the recovery decision leading to the result status
+func (er *ExecutionResult) decision() RecoveryDecision {
+	switch er.Status {
+	case RolledBack:
+		return Rollback
+	case Aborted:
+		return Abort
+	}
+
+	return Resume
+}
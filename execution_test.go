@@ -0,0 +1,97 @@
+package orchestrator
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestOrchestrator_Executions(t *testing.T) {
+	orch := NewOrchestrator()
+	_ = orch.Register(NewNonTransactionalRoute("A").
+		AddNextStep("1", appendStep("1")).
+		AddNextStep("2", func(ctx *context) error {
+			return errors.New("unavailable")
+		}))
+	_ = orch.Initialization(nil)
+
+	clock := &testClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	orch.SetClock(clock)
+
+	// without caretaker a finished execution is released
+	ctx, _ := NewContextWithGid("c")
+	_, _ = orch.Exec("A", ctx)
+	_, err := orch.Execution("c")
+	assert.True(t, errors.Is(err, ErrExecutionNotFound))
+
+	// unless the idempotency window keeps it
+	orch.SetIdempotencyWindow(time.Hour)
+	for _, gid := range []string{"b", "a"} {
+		ctx, _ := NewContextWithGid(gid)
+		_, _ = orch.Exec("A", ctx)
+	}
+
+	infos, err := orch.Executions(Aborted)
+	assert.Nil(t, err)
+	assert.Len(t, infos, 2)
+	assert.Equal(t, "a", infos[0].Gid)
+	assert.Equal(t, "A_2", infos[0].State)
+	assert.Equal(t, "1;", infos[0].Variables["STEPS"])
+	assert.Equal(t, []string{"state A_2: unavailable (ABORT)"}, infos[0].Errors)
+
+	infos, err = orch.Executions(Completed)
+	assert.Nil(t, err)
+	assert.Len(t, infos, 0)
+
+	_, err = orch.Execution("c")
+	assert.True(t, errors.Is(err, ErrExecutionNotFound))
+	assert.NotNil(t, orch.Cancel("a"))
+
+	// redrive needs the caretaker mementos
+	_, err = orch.Redrive("a")
+	assert.NotNil(t, err)
+
+	// the next registration evicts the executions finished before the window
+	clock.add(time.Hour)
+	ctx, _ = NewContextWithGid("d")
+	_, _ = orch.Exec("A", ctx)
+
+	infos, err = orch.Executions(Aborted)
+	assert.Nil(t, err)
+	assert.Len(t, infos, 1)
+	assert.Equal(t, "d", infos[0].Gid)
+	assert.Len(t, orch.executions, 1)
+}
+
+func TestOrchestrator_Redrive(t *testing.T) {
+	failures := 1
+
+	orch := NewOrchestrator()
+	orch.SetCaretaker(NewMemoryCaretaker())
+	_ = orch.Register(NewNonTransactionalRoute("A").
+		AddNextStep("1", appendStep("1")).
+		AddNextStep("2", func(ctx *context) error {
+			if failures > 0 {
+				failures--
+				return errors.New("unavailable")
+			}
+
+			return appendStep("2")(ctx)
+		}))
+	_ = orch.Initialization(nil)
+
+	ctx, _ := NewContextWithGid("gid")
+	result, _ := orch.Exec("A", ctx)
+	assert.Equal(t, Aborted, result.Status)
+
+	result, err := orch.Redrive("gid")
+	assert.Nil(t, err)
+	assert.Equal(t, Completed, result.Status)
+	info, _ := orch.Execution("gid")
+	assert.Equal(t, "1;2;", info.Variables["STEPS"])
+
+	// a completed execution is not re-driven
+	_, err = orch.Redrive("gid")
+	assert.NotNil(t, err)
+}
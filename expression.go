@@ -0,0 +1,676 @@
+package orchestrator
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ExpressionType is the static type of an expression or a declared variable
+type ExpressionType string
+
+const (
+	BoolType   ExpressionType = "bool"
+	NumberType ExpressionType = "number"
+	StringType ExpressionType = "string"
+	NilType    ExpressionType = "nil"
+
+	// AnyType is checked when the expression is evaluated
+	AnyType ExpressionType = "any"
+)
+
+type (
+	// Expression is a compiled predicate expression like `order.total > 100 && customer.tier == "gold"`,
+	// the identifiers are context variables and a dotted identifier which is not a variable is a path into
+	// a variable map or struct
+	Expression struct {
+		src  string
+		root exprNode
+		typ  ExpressionType
+	}
+
+	// ExpressionError is a compile or evaluation error with the position in the expression source
+	ExpressionError struct {
+		Src string
+		Pos int
+		Msg string
+	}
+
+	exprNode interface {
+		pos() int
+		check(c *exprChecker) (ExpressionType, error)
+		eval(ctx *context) (interface{}, error)
+	}
+
+	exprChecker struct {
+		src       string
+		variables map[string]ExpressionType
+	}
+
+	literalNode struct {
+		at    int
+		value interface{}
+	}
+
+	variableNode struct {
+		at   int
+		name string
+	}
+
+	unaryNode struct {
+		at      int
+		op      string
+		operand exprNode
+	}
+
+	binaryNode struct {
+		at          int
+		op          string
+		left, right exprNode
+	}
+
+	exprToken struct {
+		kind  exprTokenKind
+		text  string
+		value interface{}
+		pos   int
+	}
+
+	exprTokenKind int
+
+	exprParser struct {
+		src    string
+		tokens []exprToken
+		i      int
+	}
+)
+
+const (
+	tokenEOF exprTokenKind = iota
+	tokenLiteral
+	tokenIdent
+	tokenOperator
+)
+
+func (ee *ExpressionError) Error() string {
+	return fmt.Sprintf("expression `%s` at %d: %s", ee.Src, ee.Pos, ee.Msg)
+}
+
+// CompileExpression parse and type check an expression, the variables declare the context variable types;
+// when they are defined an unknown variable is a compile error, otherwise the variables are checked on evaluation
+func CompileExpression(src string, variables map[string]ExpressionType) (*Expression, error) {
+	tokens, err := tokenizeExpression(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{src: src, tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, &ExpressionError{Src: src, Pos: t.pos, Msg: fmt.Sprintf("unexpected %s", t.text)}
+	}
+
+	typ, err := root.check(&exprChecker{src: src, variables: variables})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Expression{src: src, root: root, typ: typ}, nil
+}
+
+// MustCompileExpression compile an expression and panic when it's invalid
+func MustCompileExpression(src string, variables map[string]ExpressionType) *Expression {
+	e, err := CompileExpression(src, variables)
+	if err != nil {
+		panic(err)
+	}
+
+	return e
+}
+
+// Expr compile a boolean expression to a condition, it panics when the expression is invalid
+func Expr(src string) func(ctx context) (bool, error) {
+	return MustCompileExpression(src, nil).Condition()
+}
+
+func (e *Expression) String() string {
+	return e.src
+}
+
+// Type of the expression result
+func (e *Expression) Type() ExpressionType {
+	return e.typ
+}
+
+// Evaluate the expression against the context variables
+func (e *Expression) Evaluate(ctx context) (interface{}, error) {
+	v, err := e.root.eval(&ctx)
+	if ee, ok := err.(*ExpressionError); ok {
+		ee.Src = e.src
+	}
+
+	return v, err
+}
+
+// Condition return the expression as a transition condition, an evaluation error or a non boolean result is
+// returned and fails the step leaving the state; it panics when the expression can't be a boolean
+func (e *Expression) Condition() func(ctx context) (bool, error) {
+	if e.typ != BoolType && e.typ != AnyType {
+		panic(&ExpressionError{Src: e.src, Msg: fmt.Sprintf("condition expression is %s", e.typ)})
+	}
+
+	return func(ctx context) (bool, error) {
+		v, err := e.Evaluate(ctx)
+		if err != nil {
+			return false, err
+		}
+
+		b, ok := v.(bool)
+		if !ok {
+			return false, &ExpressionError{Src: e.src, Msg: fmt.Sprintf("condition is %s", typeOf(v))}
+		}
+
+		return b, nil
+	}
+}
+
+func tokenizeExpression(src string) ([]exprToken, error) {
+	var tokens []exprToken
+	rs := []rune(src)
+
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(rs) && (unicode.IsDigit(rs[i]) || rs[i] == '.') {
+				i++
+			}
+
+			n, err := strconv.ParseFloat(string(rs[start:i]), 64)
+			if err != nil {
+				return nil, &ExpressionError{Src: src, Pos: start, Msg: fmt.Sprintf("invalid number %s", string(rs[start:i]))}
+			}
+
+			tokens = append(tokens, exprToken{kind: tokenLiteral, text: string(rs[start:i]), value: n, pos: start})
+		case r == '"' || r == '\'':
+			start := i
+			var sb strings.Builder
+			for i++; i < len(rs) && rs[i] != r; i++ {
+				if rs[i] == '\\' && i+1 < len(rs) {
+					i++
+				}
+				sb.WriteRune(rs[i])
+			}
+
+			if i >= len(rs) {
+				return nil, &ExpressionError{Src: src, Pos: start, Msg: "unterminated string"}
+			}
+
+			i++
+			tokens = append(tokens, exprToken{kind: tokenLiteral, text: string(rs[start:i]), value: sb.String(), pos: start})
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(rs) && (unicode.IsLetter(rs[i]) || unicode.IsDigit(rs[i]) || rs[i] == '_' || rs[i] == '.') {
+				i++
+			}
+
+			text := string(rs[start:i])
+			switch text {
+			case "true", "false":
+				tokens = append(tokens, exprToken{kind: tokenLiteral, text: text, value: text == "true", pos: start})
+			case "nil", "null":
+				tokens = append(tokens, exprToken{kind: tokenLiteral, text: text, value: nil, pos: start})
+			default:
+				if strings.HasSuffix(text, ".") || strings.Contains(text, "..") {
+					return nil, &ExpressionError{Src: src, Pos: start, Msg: fmt.Sprintf("invalid identifier %s", text)}
+				}
+
+				tokens = append(tokens, exprToken{kind: tokenIdent, text: text, pos: start})
+			}
+		default:
+			op := ""
+			if i+1 < len(rs) {
+				switch two := string(rs[i : i+2]); two {
+				case "&&", "||", "==", "!=", "<=", ">=":
+					op = two
+				}
+			}
+
+			if op == "" && strings.ContainsRune("!<>+-*/%()", r) {
+				op = string(r)
+			}
+
+			if op == "" {
+				return nil, &ExpressionError{Src: src, Pos: i, Msg: fmt.Sprintf("unexpected character %q", r)}
+			}
+
+			tokens = append(tokens, exprToken{kind: tokenOperator, text: op, pos: i})
+			i += len([]rune(op))
+		}
+	}
+
+	return append(tokens, exprToken{kind: tokenEOF, text: "end of expression", pos: len(rs)}), nil
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.i]
+}
+
+func (p *exprParser) accept(ops ...string) (exprToken, bool) {
+	t := p.peek()
+	if t.kind != tokenOperator {
+		return t, false
+	}
+
+	for _, op := range ops {
+		if t.text == op {
+			p.i++
+			return t, true
+		}
+	}
+
+	return t, false
+}
+
+func (p *exprParser) binary(next func() (exprNode, error), ops ...string) (exprNode, error) {
+	left, err := next()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t, ok := p.accept(ops...)
+		if !ok {
+			return left, nil
+		}
+
+		right, err := next()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &binaryNode{at: t.pos, op: t.text, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	return p.binary(p.parseAnd, "||")
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	return p.binary(p.parseEquality, "&&")
+}
+
+func (p *exprParser) parseEquality() (exprNode, error) {
+	return p.binary(p.parseComparison, "==", "!=")
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	return p.binary(p.parseAdditive, "<", "<=", ">", ">=")
+}
+
+func (p *exprParser) parseAdditive() (exprNode, error) {
+	return p.binary(p.parseMultiplicative, "+", "-")
+}
+
+func (p *exprParser) parseMultiplicative() (exprNode, error) {
+	return p.binary(p.parseUnary, "*", "/", "%")
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if t, ok := p.accept("!", "-"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		return &unaryNode{at: t.pos, op: t.text, operand: operand}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokenLiteral:
+		p.i++
+		return &literalNode{at: t.pos, value: t.value}, nil
+	case tokenIdent:
+		p.i++
+		return &variableNode{at: t.pos, name: t.text}, nil
+	}
+
+	if _, ok := p.accept("("); ok {
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := p.accept(")"); !ok {
+			return nil, &ExpressionError{Src: p.src, Pos: p.peek().pos, Msg: "missing )"}
+		}
+
+		return n, nil
+	}
+
+	return nil, &ExpressionError{Src: p.src, Pos: t.pos, Msg: fmt.Sprintf("unexpected %s", t.text)}
+}
+
+func (n *literalNode) pos() int {
+	return n.at
+}
+
+func (n *literalNode) check(c *exprChecker) (ExpressionType, error) {
+	return typeOf(n.value), nil
+}
+
+func (n *literalNode) eval(ctx *context) (interface{}, error) {
+	return n.value, nil
+}
+
+func (n *variableNode) pos() int {
+	return n.at
+}
+
+func (n *variableNode) check(c *exprChecker) (ExpressionType, error) {
+	if c.variables == nil {
+		return AnyType, nil
+	}
+
+	if t, ok := c.variables[n.name]; ok {
+		return t, nil
+	}
+
+	// a path into a declared variable
+	for name := n.name; strings.Contains(name, "."); {
+		name = name[:strings.LastIndex(name, ".")]
+		if _, ok := c.variables[name]; ok {
+			return AnyType, nil
+		}
+	}
+
+	return "", &ExpressionError{Src: c.src, Pos: n.at, Msg: fmt.Sprintf("unknown variable %s", n.name)}
+}
+
+func (n *variableNode) eval(ctx *context) (interface{}, error) {
+	if v, ok := ctx.lookupVariable(n.name); ok {
+		return normalizeValue(v), nil
+	}
+
+	parts := strings.Split(n.name, ".")
+	for i := len(parts) - 1; i > 0; i-- {
+		v, ok := ctx.lookupVariable(strings.Join(parts[:i], "."))
+		if !ok {
+			continue
+		}
+
+		for _, field := range parts[i:] {
+			if v, ok = fieldOf(v, field); !ok {
+				return nil, &ExpressionError{Pos: n.at, Msg: fmt.Sprintf("unknown variable %s", n.name)}
+			}
+		}
+
+		return normalizeValue(v), nil
+	}
+
+	return nil, &ExpressionError{Pos: n.at, Msg: fmt.Sprintf("unknown variable %s", n.name)}
+}
+
+func (n *unaryNode) pos() int {
+	return n.at
+}
+
+func (n *unaryNode) check(c *exprChecker) (ExpressionType, error) {
+	t, err := n.operand.check(c)
+	if err != nil {
+		return "", err
+	}
+
+	want := BoolType
+	if n.op == "-" {
+		want = NumberType
+	}
+
+	if t != want && t != AnyType {
+		return "", &ExpressionError{Src: c.src, Pos: n.at, Msg: fmt.Sprintf("type mismatch: %s%s", n.op, t)}
+	}
+
+	return want, nil
+}
+
+func (n *unaryNode) eval(ctx *context) (interface{}, error) {
+	v, err := n.operand.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	switch tv := v.(type) {
+	case bool:
+		if n.op == "!" {
+			return !tv, nil
+		}
+	case float64:
+		if n.op == "-" {
+			return -tv, nil
+		}
+	}
+
+	return nil, &ExpressionError{Pos: n.at, Msg: fmt.Sprintf("type mismatch: %s%s", n.op, typeOf(v))}
+}
+
+func (n *binaryNode) pos() int {
+	return n.at
+}
+
+func (n *binaryNode) check(c *exprChecker) (ExpressionType, error) {
+	lt, err := n.left.check(c)
+	if err != nil {
+		return "", err
+	}
+
+	rt, err := n.right.check(c)
+	if err != nil {
+		return "", err
+	}
+
+	t, ok := binaryType(n.op, lt, rt)
+	if !ok {
+		return "", &ExpressionError{Src: c.src, Pos: n.at, Msg: fmt.Sprintf("type mismatch: %s %s %s", lt, n.op, rt)}
+	}
+
+	return t, nil
+}
+
+func (n *binaryNode) eval(ctx *context) (interface{}, error) {
+	l, err := n.left.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// short circuit
+	if lb, ok := l.(bool); ok && ((n.op == "&&" && !lb) || (n.op == "||" && lb)) {
+		return lb, nil
+	}
+
+	r, err := n.right.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := binaryType(n.op, typeOf(l), typeOf(r)); !ok {
+		return nil, &ExpressionError{Pos: n.at, Msg: fmt.Sprintf("type mismatch: %s %s %s", typeOf(l), n.op, typeOf(r))}
+	}
+
+	switch n.op {
+	case "&&", "||":
+		return r.(bool), nil
+	case "==":
+		return reflect.DeepEqual(l, r), nil
+	case "!=":
+		return !reflect.DeepEqual(l, r), nil
+	}
+
+	if ls, ok := l.(string); ok {
+		rs := r.(string)
+		switch n.op {
+		case "+":
+			return ls + rs, nil
+		case "<":
+			return ls < rs, nil
+		case "<=":
+			return ls <= rs, nil
+		case ">":
+			return ls > rs, nil
+		case ">=":
+			return ls >= rs, nil
+		}
+	}
+
+	lf, rf := l.(float64), r.(float64)
+	switch n.op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/", "%":
+		if rf == 0 {
+			return nil, &ExpressionError{Pos: n.at, Msg: "division by zero"}
+		}
+
+		if n.op == "%" {
+			return math.Mod(lf, rf), nil
+		}
+
+		return lf / rf, nil
+	case "<":
+		return lf < rf, nil
+	case "<=":
+		return lf <= rf, nil
+	case ">":
+		return lf > rf, nil
+	}
+
+	return lf >= rf, nil
+}
+
+// binaryType the result type of a binary operator, false when the operand types don't match
+func binaryType(op string, l, r ExpressionType) (ExpressionType, bool) {
+	is := func(t ExpressionType, types ...ExpressionType) bool {
+		if t == AnyType {
+			return true
+		}
+
+		for _, tt := range types {
+			if t == tt {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	same := l == r || l == AnyType || r == AnyType
+
+	switch op {
+	case "&&", "||":
+		return BoolType, is(l, BoolType) && is(r, BoolType)
+	case "==", "!=":
+		return BoolType, same || l == NilType || r == NilType
+	case "<", "<=", ">", ">=":
+		return BoolType, same && is(l, NumberType, StringType) && is(r, NumberType, StringType)
+	case "+":
+		if l == StringType || r == StringType {
+			return StringType, same
+		}
+
+		if l == AnyType && r == AnyType {
+			return AnyType, true
+		}
+
+		return NumberType, is(l, NumberType, StringType) && is(r, NumberType, StringType) && same
+	}
+
+	return NumberType, is(l, NumberType) && is(r, NumberType)
+}
+
+func typeOf(v interface{}) ExpressionType {
+	switch v.(type) {
+	case nil:
+		return NilType
+	case bool:
+		return BoolType
+	case float64:
+		return NumberType
+	case string:
+		return StringType
+	}
+
+	return AnyType
+}
+
+// normalizeValue convert the numbers to float64
+func normalizeValue(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.String:
+		return rv.String()
+	case reflect.Bool:
+		return rv.Bool()
+	}
+
+	return v
+}
+
+// fieldOf read a map key or an exported struct field
+func fieldOf(v interface{}, field string) (interface{}, bool) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil, false
+		}
+
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+
+		fv := rv.MapIndex(reflect.ValueOf(field).Convert(rv.Type().Key()))
+		if !fv.IsValid() {
+			return nil, false
+		}
+
+		return fv.Interface(), true
+	case reflect.Struct:
+		fv := rv.FieldByName(field)
+		if !fv.IsValid() || !fv.CanInterface() {
+			return nil, false
+		}
+
+		return fv.Interface(), true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,200 @@
+package orchestrator
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type testCustomer struct {
+	Tier string
+}
+
+func expressionTestContext() *context {
+	ctx, _ := NewContext()
+	_ = ctx.SetVariable("order", map[string]interface{}{"total": 150, "items": map[string]interface{}{"count": 3}})
+	_ = ctx.SetVariable("customer", &testCustomer{Tier: "gold"})
+	_ = ctx.SetVariable("retries", 2)
+	_ = ctx.SetVariable("region.code", "EU")
+	_ = ctx.SetVariable("enabled", true)
+	_ = ctx.SetVariable("items", map[string]interface{}{"count": 3})
+
+	return ctx
+}
+
+func TestExpression_Evaluate(t *testing.T) {
+	tests := []struct {
+		src    string
+		result interface{}
+	}{
+		{`order.total > 100 && customer.Tier == "gold"`, true},
+		{`order.total > 100 && customer.Tier == 'silver'`, false},
+		{`order.items.count * 2 + 1`, float64(7)},
+		{`-retries % 3`, float64(-2)},
+		{`(retries + 1) / 2 >= 1.5`, true},
+		{`region.code + "-1"`, "EU-1"},
+		{`!enabled || missing.value == 1`, nil},
+		{`enabled || missing.value == 1`, true},
+		{`customer != nil && order.total != 150`, false},
+		{`"a" < "b"`, true},
+		{`order == order.items`, false},
+		{`order.items == items`, true},
+		{`order != items`, true},
+	}
+
+	ctx := expressionTestContext()
+	for _, tc := range tests {
+		t.Run(tc.src, func(t *testing.T) {
+			e, err := CompileExpression(tc.src, nil)
+			assert.Nil(t, err)
+
+			v, err := e.Evaluate(*ctx)
+			if tc.result == nil {
+				var ee *ExpressionError
+				assert.True(t, errors.As(err, &ee))
+				assert.Equal(t, tc.src, ee.Src)
+				assert.Contains(t, ee.Msg, "unknown variable missing.value")
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tc.result, v)
+		})
+	}
+}
+
+func TestCompileExpression_Errors(t *testing.T) {
+	variables := map[string]ExpressionType{
+		"order":    AnyType,
+		"retries":  NumberType,
+		"enabled":  BoolType,
+		"customer": StringType,
+	}
+
+	tests := []struct {
+		src string
+		msg string
+	}{
+		{`order.total >`, "unexpected end of expression"},
+		{`(retries > 1`, "missing )"},
+		{`retries > 1)`, "unexpected )"},
+		{`retries = 1`, "unexpected character '='"},
+		{`"gold`, "unterminated string"},
+		{`1.2.3 > 1`, "invalid number 1.2.3"},
+		{`total > 100`, "unknown variable total"},
+		{`retries == "3"`, "type mismatch: number == string"},
+		{`enabled && retries`, "type mismatch: bool && number"},
+		{`!customer`, "type mismatch: !string"},
+		{`customer - 1`, "type mismatch: string - number"},
+		{`enabled < true`, "type mismatch: bool < bool"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.src, func(t *testing.T) {
+			_, err := CompileExpression(tc.src, variables)
+
+			var ee *ExpressionError
+			assert.True(t, errors.As(err, &ee))
+			assert.Equal(t, tc.msg, ee.Msg)
+		})
+	}
+}
+
+func TestExpression_EvaluateTypeMismatch(t *testing.T) {
+	e, err := CompileExpression(`order.total == customer.Tier || order.total / 0 > 1`, nil)
+	assert.Nil(t, err)
+
+	_, err = e.Evaluate(*expressionTestContext())
+	assert.EqualError(t, err, "expression `order.total == customer.Tier || order.total / 0 > 1` at 12: "+
+		"type mismatch: number == string")
+
+	// the condition returns the failure outside of a route
+	ok, err := e.Condition()(*expressionTestContext())
+	assert.False(t, ok)
+	assert.EqualError(t, err, "expression `order.total == customer.Tier || order.total / 0 > 1` at 12: "+
+		"type mismatch: number == string")
+
+	assert.Panics(t, func() { Expr(`1 +`) })
+	assert.Panics(t, func() { Expr(`1 + 2`) })
+}
+
+func TestWhenExpression(t *testing.T) {
+	r := NewNonTransactionalRoute("R").
+		AddNextStep("1", doActionTest).
+		WhenExpression(MustCompileExpression(`retries > 1`, nil)).
+		AddNextStep("2", doActionTest).
+		Otherwise().
+		AddNextStep("3", doActionTest).
+		End().
+		AddNextStep("4", doActionTest)
+
+	ctx := expressionTestContext()
+	result := newRouteRunner(r.GetStartState(), nil, nil).run(ctx)
+	assert.Equal(t, Completed, result.Status)
+	assert.Equal(t, "R_4", result.State)
+	assert.Equal(t, 3, ctx.GetVariable("HK"))
+
+	rd, err := NewRouteDefinition(r, testRegistry())
+	assert.Nil(t, err)
+	assert.Equal(t, "retries > 1", rd.Steps[1].Condition)
+
+	data, err := rd.Marshal(YAMLFormat)
+	assert.Nil(t, err)
+	parsed, err := ParseRouteDefinition(data, YAMLFormat)
+	assert.Nil(t, err)
+	assert.Nil(t, parsed.Validate(testRegistry()))
+
+	parsed.Steps[1].Condition = "retries >"
+	assert.NotNil(t, parsed.Validate(testRegistry()))
+
+	parsed.Steps[1].Condition = "retries + 1"
+	_, err = parsed.Build(testRegistry())
+	assert.EqualError(t, err, "invalid route definition R: steps[1]: expression `retries + 1` at 0: condition is number")
+
+	// the declared variables are checked when the definition is loaded
+	parsed.Variables = map[string]ExpressionType{"retries": NumberType, "enabled": "flag"}
+	parsed.Steps[1].Condition = "retry > 1"
+	assert.EqualError(t, parsed.Validate(testRegistry()), "invalid route definition R: variable enabled has an "+
+		"unknown type flag; steps[1]: expression `retry > 1` at 0: unknown variable retry")
+
+	parsed.Variables["enabled"] = BoolType
+	parsed.Steps[1].Condition = `retries == "2"`
+	assert.EqualError(t, parsed.Validate(testRegistry()), "invalid route definition R: steps[1]: expression "+
+		"`retries == \"2\"` at 8: type mismatch: number == string")
+}
+
+func TestWhenExpression_Failure(t *testing.T) {
+	undone := 0
+	undo := func(ctx context) error {
+		undone++
+		return nil
+	}
+
+	tr := NewTransactionalRoute("T").
+		AddNextStep("1", doActionTest, undo).
+		AddNextStep("2", doActionTest, undo).
+		WhenExpression(MustCompileExpression(`missing > 1`, nil)).
+		AddNextStep("3", doActionTest, undo).
+		End().
+		AddNextStep("4", doActionTest, undo)
+
+	// the state leaving on the failed condition is undone with the previous ones
+	ctx := expressionTestContext()
+	result := newRouteRunner(tr.GetStartState(), nil, nil).run(ctx)
+	assert.Equal(t, RolledBack, result.Status)
+	assert.Equal(t, 2, undone)
+	assert.Equal(t, "T_2", result.Errors[0].State)
+	assert.EqualError(t, result.Errors[0].Err, "expression `missing > 1` at 0: unknown variable missing")
+
+	ntr := NewNonTransactionalRoute("R").
+		AddNextStep("1", doActionTest).
+		WhenExpression(MustCompileExpression(`order`, nil)).
+		AddNextStep("2", doActionTest).
+		End().
+		AddNextStep("3", doActionTest)
+
+	result = newRouteRunner(ntr.GetStartState(), nil, nil).run(expressionTestContext())
+	assert.Equal(t, Aborted, result.Status)
+	assert.Equal(t, Abort, result.Errors[0].Decision)
+	assert.EqualError(t, result.Errors[0].Err, "expression `order` at 0: condition is any")
+}
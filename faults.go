@@ -0,0 +1,269 @@
+package orchestrator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// FaultKind is the failure injected into a step attempt
+type FaultKind string
+
+const (
+	FaultError   FaultKind = "error"
+	FaultLatency FaultKind = "latency"
+	FaultPanic   FaultKind = "panic"
+	FaultTimeout FaultKind = "timeout"
+)
+
+type (
+	// FaultConfig is the fault injection configuration of an orchestrator, the first fault matching an attempt
+	// is injected into it
+	FaultConfig struct {
+		// Seed of the injection probabilities, zero means a random seed
+		Seed   int64   `json:"seed,omitempty" yaml:"seed,omitempty"`
+		Faults []Fault `json:"faults" yaml:"faults"`
+	}
+
+	// Fault inject a failure into the attempts of a state or of every state of a route
+	Fault struct {
+		Route string    `json:"route,omitempty" yaml:"route,omitempty"`
+		State string    `json:"state,omitempty" yaml:"state,omitempty"`
+		Kind  FaultKind `json:"kind" yaml:"kind"`
+
+		// Message of the injected error or panic
+		Message string `json:"message,omitempty" yaml:"message,omitempty"`
+
+		// Latency added to the attempt, the attempt times out when it reaches the state timeout
+		Latency string `json:"latency,omitempty" yaml:"latency,omitempty"`
+
+		// Attempt the fault is injected into, counted from 1 in the state retries; zero means every attempt
+		Attempt int `json:"attempt,omitempty" yaml:"attempt,omitempty"`
+
+		// Probability of the injection into a matching attempt, zero means it's always injected
+		Probability float64 `json:"probability,omitempty" yaml:"probability,omitempty"`
+
+		// Rollback the fault is injected into the undo attempts instead of the do attempts
+		Rollback bool `json:"rollback,omitempty" yaml:"rollback,omitempty"`
+	}
+
+	// InjectedFault is a fault injected into a step attempt, they are recorded in the execution mementos
+	InjectedFault struct {
+		State   string    `json:"state"`
+		Attempt int       `json:"attempt"`
+		Kind    FaultKind `json:"kind"`
+	}
+
+	// InjectedError is the failure of a step attempt caused by an injected fault
+	InjectedError struct {
+		Fault InjectedFault
+		Err   error
+	}
+
+	faultInjector struct {
+		faults  []Fault
+		latency []time.Duration
+
+		lock sync.Mutex
+		rand *rand.Rand
+	}
+)
+
+func (ie *InjectedError) Error() string {
+	return fmt.Sprintf("injected %s: %v", ie.Fault.Kind, ie.Err)
+}
+
+func (ie *InjectedError) Unwrap() error {
+	return ie.Err
+}
+
+// IsInjected the failure is caused by an injected fault
+func IsInjected(err error) bool {
+	var ie *InjectedError
+	return errors.As(err, &ie)
+}
+
+// FaultInjected is true in the recovery route when the step failed on an injected fault
+func FaultInjected() func(ctx context) bool {
+	return func(ctx context) bool {
+		err, ok := ctx.GetVariable(RecoveryErrorHeaderKey).(error)
+		return ok && IsInjected(err)
+	}
+}
+
+// ParseFaultConfig decode a fault injection configuration, unknown fields are rejected
+func ParseFaultConfig(data []byte, format DefinitionFormat) (*FaultConfig, error) {
+	fc := &FaultConfig{}
+
+	switch format {
+	case JSONFormat:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(fc); err != nil {
+			return nil, err
+		}
+	case YAMLFormat:
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(fc); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New(fmt.Sprintf("unknown fault config format %s", format))
+	}
+
+	return fc, nil
+}
+
+// ReadFaultConfig read a fault injection configuration file, the format is taken from the file extension
+func ReadFaultConfig(path string) (*FaultConfig, error) {
+	format, err := definitionFormatOf(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseFaultConfig(data, format)
+}
+
+// SetFaults inject the configured faults into the executions started or resumed from now on, nil stops the
+// injection
+func (o *orchestrator) SetFaults(fc *FaultConfig) error {
+	var fi *faultInjector
+	if fc != nil {
+		var err error
+		if fi, err = newFaultInjector(fc); err != nil {
+			return err
+		}
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	o.faults = fi
+	return nil
+}
+
+func newFaultInjector(fc *FaultConfig) (*faultInjector, error) {
+	seed := fc.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	fi := &faultInjector{
+		faults:  fc.Faults,
+		latency: make([]time.Duration, len(fc.Faults)),
+		rand:    rand.New(rand.NewSource(seed)),
+	}
+
+	for i, f := range fc.Faults {
+		if f.Route == "" && f.State == "" {
+			return nil, errors.New(fmt.Sprintf("fault %d: route or state is required", i))
+		}
+
+		switch f.Kind {
+		case FaultError, FaultPanic, FaultTimeout:
+		case FaultLatency:
+			d, err := time.ParseDuration(f.Latency)
+			if err != nil || d <= 0 {
+				return nil, errors.New(fmt.Sprintf("fault %d: invalid latency %q", i, f.Latency))
+			}
+
+			fi.latency[i] = d
+		default:
+			return nil, errors.New(fmt.Sprintf("fault %d: unknown kind %q", i, f.Kind))
+		}
+
+		if f.Attempt < 0 {
+			return nil, errors.New(fmt.Sprintf("fault %d: invalid attempt %d", i, f.Attempt))
+		}
+
+		if f.Probability < 0 || f.Probability > 1 {
+			return nil, errors.New(fmt.Sprintf("fault %d: invalid probability %v", i, f.Probability))
+		}
+	}
+
+	return fi, nil
+}
+
+// match return the index of the fault injected into the attempt, -1 when there is none
+func (fi *faultInjector) match(routeId string, state string, attempt int, rollingBack bool) int {
+	fi.lock.Lock()
+	defer fi.lock.Unlock()
+
+	for i, f := range fi.faults {
+		if (f.Route != "" && f.Route != routeId) || (f.State != "" && f.State != state) ||
+			(f.Attempt > 0 && f.Attempt != attempt) || f.Rollback != rollingBack {
+			continue
+		}
+
+		if f.Probability > 0 && fi.rand.Float64() >= f.Probability {
+			continue
+		}
+
+		return i
+	}
+
+	return -1
+}
+
+// inject the matching fault into the attempt, false when the action is executed; it's executed after an
+// injected latency shorter than the state timeout
+func (rr *routeRunner) inject(state *State, attempt int, rollingBack bool) (bool, error) {
+	i := rr.faults.match(rr.currentRouteId(), state.name, attempt, rollingBack)
+	if i < 0 {
+		return false, nil
+	}
+
+	f := rr.faults.faults[i]
+	injected := InjectedFault{State: state.name, Attempt: attempt, Kind: f.Kind}
+	rr.injected = append(rr.injected, injected)
+
+	message := f.Message
+	if message == "" {
+		message = "fault"
+	}
+
+	timeout := fmt.Errorf("state %s: %w", state.name, ErrStepTimeout)
+
+	var err error
+	switch f.Kind {
+	case FaultError:
+		err = errors.New(message)
+	case FaultPanic:
+		err = recoverPanic(state.name, func() error { panic(message) })
+	case FaultTimeout:
+		err = timeout
+	case FaultLatency:
+		latency := rr.faults.latency[i]
+		if state.actionTimeout <= 0 || latency < state.actionTimeout {
+			sleep(rr.clock, latency)
+			return false, nil
+		}
+
+		sleep(rr.clock, state.actionTimeout)
+		err = timeout
+	}
+
+	return true, &InjectedError{Fault: injected, Err: err}
+}
+
+// currentRouteId the route of the current state, it's the called route inside a call
+func (rr *routeRunner) currentRouteId() string {
+	if len(rr.callStack) > 0 {
+		frame := rr.callStack[len(rr.callStack)-1]
+		return frame.state.calls[frame.call].To
+	}
+
+	return rr.routeId
+}
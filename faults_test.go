@@ -0,0 +1,237 @@
+package orchestrator
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// sleepingClock record the sleeps instead of waiting
+type sleepingClock struct {
+	testClock
+	sleeps []time.Duration
+}
+
+func (sc *sleepingClock) Sleep(d time.Duration) {
+	sc.sleeps = append(sc.sleeps, d)
+	sc.add(d)
+}
+
+func faultsOrchestrator(t *testing.T, journal caretaker, fc *FaultConfig, routes ...Route) *orchestrator {
+	orch := NewOrchestrator()
+	if journal != nil {
+		orch.SetCaretaker(journal)
+	}
+
+	assert.Nil(t, orch.SetFaults(fc))
+	for _, r := range routes {
+		assert.Nil(t, orch.Register(r))
+	}
+
+	return orch
+}
+
+func TestFaultInjection_Rollback(t *testing.T) {
+	journal := NewMemoryCaretaker()
+
+	undone := 0
+	undo := func(ctx context) error {
+		undone++
+		return nil
+	}
+
+	orch := faultsOrchestrator(t, journal, &FaultConfig{Faults: []Fault{
+		{State: "T_ship", Kind: FaultError, Message: "no carrier"},
+	}}, NewTransactionalRoute("T").
+		AddNextStep("reserve", appendStep("reserve"), undo).
+		AddNextStep("charge", appendStep("charge"), undo).
+		AddNextStep("ship", appendStep("ship"), undo))
+	_ = orch.Initialization(nil)
+
+	ctx, _ := NewContextWithGid("gid")
+	result, _ := orch.Exec("T", ctx)
+	assert.Equal(t, RolledBack, result.Status)
+	assert.Equal(t, 2, undone)
+	assert.Equal(t, "reserve;charge;", ctx.GetVariable("STEPS"))
+	assert.True(t, IsInjected(result.Errors[0]))
+	assert.Equal(t, "state T_ship: injected error: no carrier (ROLLBACK)", result.Errors[0].Error())
+
+	// the injected faults are kept in the execution history
+	data, _ := journal.get("gid")
+	m, _ := unmarshalMemento(data)
+	assert.Equal(t, []InjectedFault{{State: "T_ship", Attempt: 1, Kind: FaultError}}, m.Faults)
+
+	// a failed undo action is injected on rollback
+	undone = 0
+	_ = orch.SetFaults(&FaultConfig{Faults: []Fault{
+		{State: "T_ship", Kind: FaultError},
+		{Route: "T", Kind: FaultPanic, Message: "boom", Rollback: true},
+	}})
+
+	ctx, _ = NewContext()
+	result, _ = orch.Exec("T", ctx)
+	assert.Equal(t, Aborted, result.Status)
+	assert.Equal(t, 0, undone)
+	assert.True(t, errors.Is(result.Errors[1], ErrStepPanic))
+	assert.True(t, IsInjected(result.Errors[1]))
+
+	_ = orch.SetFaults(nil)
+	ctx, _ = NewContext()
+	result, _ = orch.Exec("T", ctx)
+	assert.Equal(t, Completed, result.Status)
+}
+
+func TestFaultInjection_Retry(t *testing.T) {
+	clock := &sleepingClock{testClock: testClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}}
+
+	calls := 0
+	orch := faultsOrchestrator(t, nil, &FaultConfig{Faults: []Fault{
+		{State: "A_call", Kind: FaultTimeout, Attempt: 1},
+		{State: "A_call", Kind: FaultLatency, Latency: "2s", Attempt: 2},
+	}}, NewNonTransactionalRoute("A").
+		AddNextStep("call", func(ctx *context) error {
+			calls++
+			return nil
+		}).Retry(RetryPolicy{MaxAttempts: 2, Interval: time.Second}))
+	orch.SetClock(clock)
+	_ = orch.Initialization(nil)
+
+	ctx, _ := NewContext()
+	result, _ := orch.Exec("A", ctx)
+	assert.Equal(t, Completed, result.Status)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, clock.sleeps)
+
+	// a latency reaching the step timeout times the attempt out
+	orch = faultsOrchestrator(t, nil, &FaultConfig{Faults: []Fault{
+		{Route: "A", Kind: FaultLatency, Latency: "1h"},
+	}}, NewNonTransactionalRoute("A").
+		AddNextStep("call", func(ctx *context) error {
+			calls++
+			return nil
+		}).Timeout(time.Minute))
+	orch.SetClock(clock)
+	_ = orch.Initialization(nil)
+
+	ctx, _ = NewContext()
+	result, _ = orch.Exec("A", ctx)
+	assert.Equal(t, Aborted, result.Status)
+	assert.Equal(t, 1, calls)
+	assert.True(t, errors.Is(result.Errors[0], ErrStepTimeout))
+	assert.Equal(t, time.Minute, clock.sleeps[2])
+}
+
+func TestFaultInjection_Recovery(t *testing.T) {
+	orch := faultsOrchestrator(t, nil, &FaultConfig{Faults: []Fault{
+		{Route: "B", Kind: FaultError},
+	}}, NewNonTransactionalRoute("A").
+		AddNextStep("1", appendStep("1")).To("B").
+		AddNextStep("2", appendStep("2")),
+		NewNonTransactionalRoute("B").AddNextStep("1", appendStep("B1")))
+
+	// the recovery route resumes the injected failures only
+	_ = orch.Initialization(NewNonTransactionalRoute(DefaultRecoveryRouteId).
+		AddNextStep("check", appendStep("check")).
+		When(FaultInjected()).
+		AddNextStep("resume", func(ctx *context) error {
+			return ctx.SetVariable(RecoveryDecisionHeaderKey, Resume)
+		}).
+		End().
+		AddNextStep("done", appendStep("done")))
+
+	ctx, _ := NewContext()
+	result, _ := orch.Exec("A", ctx)
+	assert.Equal(t, Completed, result.Status)
+	assert.Equal(t, "1;check;done;2;", ctx.GetVariable("STEPS"))
+	assert.Equal(t, "B_1", result.Errors[0].State)
+	assert.Equal(t, Resume, result.Errors[0].Decision)
+}
+
+func TestFaultInjection_Probability(t *testing.T) {
+	injected := func() []int {
+		fi, err := newFaultInjector(&FaultConfig{Seed: 42, Faults: []Fault{
+			{State: "A_1", Kind: FaultError, Probability: 0.3},
+		}})
+		assert.Nil(t, err)
+
+		var result []int
+		for i := 0; i < 100; i++ {
+			if fi.match("A", "A_1", 1, false) >= 0 {
+				result = append(result, i)
+			}
+		}
+
+		return result
+	}
+
+	first := injected()
+	assert.InDelta(t, 30, len(first), 15)
+	assert.Equal(t, first, injected())
+}
+
+func TestFaultInjection_SetWhileRunning(t *testing.T) {
+	orch := faultsOrchestrator(t, nil, nil, NewNonTransactionalRoute("A").
+		AddNextStep("1", appendStep("1")))
+	_ = orch.Initialization(nil)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			_ = orch.SetFaults(&FaultConfig{Seed: 1, Faults: []Fault{{State: "A_1", Kind: FaultError}}})
+			_ = orch.SetFaults(nil)
+		}
+	}()
+
+	for i := 0; i < 50; i++ {
+		ctx, _ := NewContext()
+		_, _ = orch.Exec("A", ctx)
+	}
+	<-done
+}
+
+func TestReadFaultConfig(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "faults")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "faults.yaml")
+	_ = ioutil.WriteFile(path, []byte(`
+seed: 7
+faults:
+  - route: ORDER
+    kind: latency
+    latency: 200ms
+    probability: 0.1
+  - state: ORDER_charge
+    kind: error
+    message: declined
+    attempt: 2
+`), 0644)
+
+	fc, err := ReadFaultConfig(path)
+	assert.Nil(t, err)
+	assert.Equal(t, &FaultConfig{Seed: 7, Faults: []Fault{
+		{Route: "ORDER", Kind: FaultLatency, Latency: "200ms", Probability: 0.1},
+		{State: "ORDER_charge", Kind: FaultError, Message: "declined", Attempt: 2},
+	}}, fc)
+	assert.Nil(t, NewOrchestrator().SetFaults(fc))
+
+	_, err = ParseFaultConfig([]byte(`{"faults": [{"state": "A_1", "kind": "error", "rate": 1}]}`), JSONFormat)
+	assert.NotNil(t, err)
+
+	tests := []Fault{
+		{Kind: FaultError},
+		{State: "A_1", Kind: "crash"},
+		{State: "A_1", Kind: FaultLatency},
+		{State: "A_1", Kind: FaultError, Attempt: -1},
+		{State: "A_1", Kind: FaultError, Probability: 1.5},
+	}
+
+	for _, test := range tests {
+		assert.NotNil(t, NewOrchestrator().SetFaults(&FaultConfig{Faults: []Fault{test}}))
+	}
+}
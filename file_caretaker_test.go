@@ -1,6 +1,9 @@
 package orchestrator
 
-import "testing"
+import (
+	"os"
+	"testing"
+)
 
 func TestWriteAndRead(t *testing.T) {
 	fc, _ := NewFileCareTacker("sample")
@@ -13,3 +16,78 @@ func TestWriteAndRead(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestIds(t *testing.T) {
+	fc, _ := NewFileCareTacker("sample_ids")
+	defer os.Remove(fc.f.Name())
+	defer fc.shutdown()
+
+	fc.persist("b", "1")
+	fc.persist("a", "1")
+	fc.persist("b", "2")
+
+	ids, err := fc.ids()
+	if err != nil || len(ids) != 2 || ids[0] != "b" || ids[1] != "a" {
+		t.Fail()
+	}
+}
+
+func TestLatest(t *testing.T) {
+	fc, _ := NewFileCareTacker("sample_latest")
+	defer os.Remove(fc.f.Name())
+	defer fc.shutdown()
+
+	fc.persist("b", "1")
+	fc.persist("a", "1")
+
+	logs, err := fc.latest()
+	if err != nil || len(logs) != 2 || logs[0].Data != "1" || logs[1].Data != "1" {
+		t.Fail()
+	}
+
+	// the lines another caretaker appends to the journal are read as well
+	other, _ := NewFileCareTacker("sample_latest")
+	defer other.shutdown()
+
+	other.persist("b", "2")
+	fc.persist("c", "1")
+
+	logs, err = fc.latest()
+	if err != nil || len(logs) != 3 || logs[0].Id != "b" || logs[0].Data != "2" || logs[2].Id != "c" {
+		t.Fail()
+	}
+
+	if data, err := fc.get("b"); err != nil || data != "2" {
+		t.Fail()
+	}
+}
+
+func TestEffects(t *testing.T) {
+	fc, _ := NewFileCareTacker("sample_effects")
+	defer os.Remove(fc.f.Name())
+	defer os.RemoveAll(fc.effectStore.dir)
+	defer fc.shutdown()
+
+	fc.effects().record("a/1", "a/1/A_call/1", "1")
+	fc.effects().record("a/1", "a/1/A_call/2", "2")
+	fc.effects().record("b", "b/A_call/1", "3")
+
+	// the effects are not executions
+	if ids, err := fc.ids(); err != nil || len(ids) != 0 {
+		t.Fail()
+	}
+
+	if data, err := fc.effects().recorded("a/1", "a/1/A_call/2"); err != nil || data != "2" {
+		t.Fail()
+	}
+
+	fc.effects().forget("a/1")
+
+	if data, err := fc.effects().recorded("a/1", "a/1/A_call/1"); err != nil || data != "" {
+		t.Fail()
+	}
+
+	if data, err := fc.effects().recorded("b", "b/A_call/1"); err != nil || data != "3" {
+		t.Fail()
+	}
+}
@@ -5,4 +5,5 @@ go 1.15
 require (
 	github.com/google/uuid v1.2.0
 	github.com/stretchr/testify v1.7.0
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,404 @@
+package orchestrator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+type (
+	// BackoffStrategy tell how long to wait before a retry, the first retry is attempt 1
+	BackoffStrategy interface {
+		Backoff(attempt int) time.Duration
+	}
+
+	// BackoffFunc define a strategy with a function
+	BackoffFunc func(attempt int) time.Duration
+
+	// FixedBackoff wait the same interval before each retry
+	FixedBackoff struct {
+		Interval time.Duration
+	}
+
+	// ExponentialBackoff multiply the wait by the multiplier after each retry, up to the maximum
+	ExponentialBackoff struct {
+		Initial time.Duration
+
+		// Max zero means no maximum
+		Max time.Duration
+
+		// Multiplier default is 2
+		Multiplier float64
+
+		// Jitter shorten each wait by a random part of it, from 0 to 1
+		Jitter float64
+	}
+
+	// StatusClass tell how the HTTP step handles a response status code
+	StatusClass string
+
+	// HTTPCall define an HTTP step, the URL, the header values and the body are templates executed against the
+	// context variables like `{{.ORDER_ID}}`, `{{json .ORDER}}` encodes a variable as JSON. The values inserted in
+	// the URL are escaped as a path segment or a query value, `{{raw .BASE_URL}}` inserts a value as it is
+	HTTPCall struct {
+		Method  string
+		URL     string
+		Headers map[string]string
+		Body    string
+
+		// StatusKey context variable receiving the response status code
+		StatusKey string
+
+		// ResponseKey context variable receiving the response body, decoded when it's JSON
+		ResponseKey string
+
+		// ResponseVariables context variable -> dotted path in the JSON response body
+		ResponseVariables map[string]string
+
+		// Classify default is DefaultStatusClass
+		Classify func(status int) StatusClass
+
+		// MaxAttempts total number of attempts on a retryable failure, default is 3
+		MaxAttempts int
+
+		// Backoff default is an exponential backoff from 100ms to 5s
+		Backoff BackoffStrategy
+
+		// Timeout of each attempt, it's ignored with a client
+		Timeout time.Duration
+		Client  *http.Client
+
+		// Clock the backoffs wait on when it's a Sleeper, default is the real time
+		Clock Clock
+	}
+
+	// HTTPError is a response which status code isn't a success
+	HTTPError struct {
+		Method     string
+		URL        string
+		StatusCode int
+		Body       string
+		Retryable  bool
+	}
+
+	httpStep struct {
+		call    HTTPCall
+		url     *template.Template
+		headers map[string]*template.Template
+		body    *template.Template
+	}
+)
+
+const (
+	StatusSuccess   StatusClass = "SUCCESS"
+	StatusRetryable StatusClass = "RETRYABLE"
+	StatusFatal     StatusClass = "FATAL"
+)
+
+const defaultHTTPAttempts = 3
+
+var defaultBackoff = &ExponentialBackoff{Initial: 100 * time.Millisecond, Max: 5 * time.Second}
+
+// templateFuncs json encodes a value, payload encodes a string or bytes as they are and any other value as JSON,
+// query escapes a value for a URL path segment or query value and raw keeps a URL value unescaped
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"payload": func(v interface{}) (string, error) {
+		data, err := encodePayload(v)
+		return string(data), err
+	},
+	"query": func(v interface{}) string {
+		return strings.Replace(url.QueryEscape(fmt.Sprint(v)), "+", "%20", -1)
+	},
+	"raw": func(v interface{}) string {
+		return fmt.Sprint(v)
+	},
+}
+
+// encodePayload encode a string or bytes as they are and any other value as JSON
+func encodePayload(v interface{}) ([]byte, error) {
+	switch p := v.(type) {
+	case string:
+		return []byte(p), nil
+	case []byte:
+		return p, nil
+	}
+
+	return json.Marshal(v)
+}
+
+func (f BackoffFunc) Backoff(attempt int) time.Duration {
+	return f(attempt)
+}
+
+func (fb *FixedBackoff) Backoff(attempt int) time.Duration {
+	return fb.Interval
+}
+
+func (eb *ExponentialBackoff) Backoff(attempt int) time.Duration {
+	multiplier := eb.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+
+	d := float64(eb.Initial) * math.Pow(multiplier, float64(attempt-1))
+	if eb.Max > 0 && d > float64(eb.Max) {
+		d = float64(eb.Max)
+	}
+
+	if eb.Jitter > 0 {
+		d -= d * math.Min(eb.Jitter, 1) * rand.Float64()
+	}
+
+	// the wait overflows a duration after enough retries without maximum
+	if d >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+
+	return time.Duration(d)
+}
+
+// DefaultStatusClass a 2xx status is a success, the timeouts, the throttling and the server errors are retryable
+func DefaultStatusClass(status int) StatusClass {
+	switch {
+	case status >= 200 && status < 300:
+		return StatusSuccess
+	case status == http.StatusRequestTimeout, status == http.StatusTooManyRequests, status >= 500:
+		return StatusRetryable
+	}
+
+	return StatusFatal
+}
+
+func (he *HTTPError) Error() string {
+	return fmt.Sprintf("%s %s: %d %s", he.Method, he.URL, he.StatusCode, http.StatusText(he.StatusCode))
+}
+
+// NewHTTPStep create a step action calling the HTTP endpoint, the retryable failures are attempted again after the
+// backoff and the step fails with the latest failure
+func NewHTTPStep(call HTTPCall) (func(ctx *context) error, error) {
+	if call.URL == "" {
+		return nil, errors.New("http step URL is empty")
+	}
+
+	if call.Method == "" {
+		call.Method = http.MethodGet
+	}
+
+	if call.Classify == nil {
+		call.Classify = DefaultStatusClass
+	}
+
+	if call.MaxAttempts <= 0 {
+		call.MaxAttempts = defaultHTTPAttempts
+	}
+
+	if call.Backoff == nil {
+		call.Backoff = defaultBackoff
+	}
+
+	if call.Client == nil {
+		call.Client = &http.Client{Timeout: call.Timeout}
+	}
+
+	hs := &httpStep{call: call, headers: make(map[string]*template.Template, len(call.Headers))}
+
+	var err error
+	if hs.url, err = parseTemplate("url", call.URL); err != nil {
+		return nil, err
+	}
+	escapeURLActions(hs.url.Tree.Root)
+
+	if hs.body, err = parseTemplate("body", call.Body); err != nil {
+		return nil, err
+	}
+
+	for k, v := range call.Headers {
+		if hs.headers[k], err = parseTemplate(k, v); err != nil {
+			return nil, err
+		}
+	}
+
+	return hs.action, nil
+}
+
+func parseTemplate(name string, text string) (*template.Template, error) {
+	t, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("http step %s: %v", name, err))
+	}
+
+	return t, nil
+}
+
+// escapeURLActions pipe the values printed in the URL to query unless they're already escaped or raw, a value
+// like `1/refund?force=true` can't change the request target
+func escapeURLActions(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+
+		for _, child := range n.Nodes {
+			escapeURLActions(child)
+		}
+	case *parse.IfNode:
+		escapeURLActions(n.List)
+		escapeURLActions(n.ElseList)
+	case *parse.RangeNode:
+		escapeURLActions(n.List)
+		escapeURLActions(n.ElseList)
+	case *parse.WithNode:
+		escapeURLActions(n.List)
+		escapeURLActions(n.ElseList)
+	case *parse.ActionNode:
+		// a variable declaration prints nothing
+		if len(n.Pipe.Decl) > 0 {
+			return
+		}
+
+		cmds := n.Pipe.Cmds
+		if last, ok := cmds[len(cmds)-1].Args[0].(*parse.IdentifierNode); ok && (last.Ident == "query" || last.Ident == "raw") {
+			return
+		}
+
+		n.Pipe.Cmds = append(cmds, &parse.CommandNode{
+			NodeType: parse.NodeCommand,
+			Pos:      n.Pos,
+			Args:     []parse.Node{parse.NewIdentifier("query").SetTree(nil).SetPos(n.Pos)},
+		})
+	}
+}
+
+func (hs *httpStep) action(ctx *context) error {
+	data := ctx.values()
+
+	url, err := execTemplate(hs.url, data)
+	if err != nil {
+		return err
+	}
+
+	body, err := execTemplate(hs.body, data)
+	if err != nil {
+		return err
+	}
+
+	headers := make(map[string]string, len(hs.headers))
+	for k, t := range hs.headers {
+		if headers[k], err = execTemplate(t, data); err != nil {
+			return err
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		var retryable bool
+		retryable, err = hs.do(ctx, url, headers, body)
+		if err == nil || !retryable || attempt >= hs.call.MaxAttempts {
+			return err
+		}
+
+		sleep(hs.call.Clock, hs.call.Backoff.Backoff(attempt))
+	}
+}
+
+func execTemplate(t *template.Template, data map[string]interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// do send the request and map the response into the context, a transport failure is retryable
+func (hs *httpStep) do(ctx *context, url string, headers map[string]string, body string) (bool, error) {
+	req, err := http.NewRequest(hs.call.Method, url, strings.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := hs.call.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return true, err
+	}
+
+	if hs.call.StatusKey != "" {
+		if err := ctx.SetVariable(hs.call.StatusKey, resp.StatusCode); err != nil {
+			return false, err
+		}
+	}
+
+	class := hs.call.Classify(resp.StatusCode)
+	if class != StatusSuccess {
+		return class == StatusRetryable, &HTTPError{
+			Method:     hs.call.Method,
+			URL:        url,
+			StatusCode: resp.StatusCode,
+			Body:       string(data),
+			Retryable:  class == StatusRetryable,
+		}
+	}
+
+	return false, hs.mapResponse(ctx, data)
+}
+
+func (hs *httpStep) mapResponse(ctx *context, data []byte) error {
+	var value interface{} = string(data)
+
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err == nil {
+		value = decoded
+	} else if len(hs.call.ResponseVariables) > 0 {
+		return errors.New(fmt.Sprintf("response is not JSON: %v", err))
+	}
+
+	if hs.call.ResponseKey != "" {
+		if err := ctx.SetVariable(hs.call.ResponseKey, value); err != nil {
+			return err
+		}
+	}
+
+	for key, path := range hs.call.ResponseVariables {
+		v := value
+		for _, field := range strings.Split(path, ".") {
+			var ok bool
+			if v, ok = fieldOf(v, field); !ok {
+				return errors.New(fmt.Sprintf("response field %s not found", path))
+			}
+		}
+
+		if err := ctx.SetVariable(key, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
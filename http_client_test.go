@@ -0,0 +1,213 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// statusServer answer the statuses in turn, the latest one is repeated
+func statusServer(statuses ...int) (*httptest.Server, *int) {
+	var lock sync.Mutex
+	calls := 0
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		status := statuses[len(statuses)-1]
+		if calls < len(statuses) {
+			status = statuses[calls]
+		}
+		calls++
+		lock.Unlock()
+
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"status":"done"}`))
+	})), &calls
+}
+
+func TestNewHTTPStep(t *testing.T) {
+	var method, path, token, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		method, path, token, body = r.Method, r.URL.Path, r.Header.Get("Authorization"), string(data)
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"payment": map[string]interface{}{"id": "P-1", "amount": 42},
+		})
+	}))
+	defer server.Close()
+
+	step, err := NewHTTPStep(HTTPCall{
+		Method:            http.MethodPost,
+		URL:               server.URL + "/orders/{{.ORDER_ID}}/payments",
+		Headers:           map[string]string{"Authorization": "Bearer {{.TOKEN}}"},
+		Body:              `{"items":{{json .ITEMS}}}`,
+		StatusKey:         "STATUS",
+		ResponseKey:       "RESPONSE",
+		ResponseVariables: map[string]string{"PAYMENT_ID": "payment.id"},
+	})
+	assert.Nil(t, err)
+
+	orch := NewOrchestrator()
+	_ = orch.Register(NewNonTransactionalRoute("A").AddNextStep("pay", step))
+	_ = orch.Initialization(nil)
+
+	ctx, _ := NewContext()
+	_ = ctx.SetVariable("ORDER_ID", "O-1")
+	_ = ctx.SetVariable("TOKEN", "secret")
+	_ = ctx.SetVariable("ITEMS", []string{"a", "b"})
+
+	result, err := orch.Exec("A", ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, Completed, result.Status)
+
+	assert.Equal(t, http.MethodPost, method)
+	assert.Equal(t, "/orders/O-1/payments", path)
+	assert.Equal(t, "Bearer secret", token)
+	assert.Equal(t, `{"items":["a","b"]}`, body)
+
+	assert.Equal(t, http.StatusOK, ctx.GetVariable("STATUS"))
+	assert.Equal(t, "P-1", ctx.GetVariable("PAYMENT_ID"))
+	assert.Equal(t, map[string]interface{}{"id": "P-1", "amount": float64(42)},
+		ctx.GetVariable("RESPONSE").(map[string]interface{})["payment"])
+}
+
+func TestNewHTTPStep_URLEscaping(t *testing.T) {
+	var target string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target = r.URL.EscapedPath() + "?" + r.URL.RawQuery
+	}))
+	defer server.Close()
+
+	step, err := NewHTTPStep(HTTPCall{
+		URL: `{{raw .BASE}}/orders/{{.ORDER_ID}}?note={{.NOTE}}&tags={{json .TAGS}}{{if .FORCE}}&force={{query .FORCE}}{{end}}`,
+	})
+	assert.Nil(t, err)
+
+	ctx, _ := NewContext()
+	_ = ctx.SetVariable("BASE", server.URL)
+	_ = ctx.SetVariable("ORDER_ID", "1/refund?force=true")
+	_ = ctx.SetVariable("NOTE", "a b&c=d")
+	_ = ctx.SetVariable("TAGS", []string{"x"})
+	_ = ctx.SetVariable("FORCE", true)
+	assert.Nil(t, step(ctx))
+
+	// the values can't change the request target
+	assert.Equal(t, "/orders/1%2Frefund%3Fforce%3Dtrue?note=a%20b%26c%3Dd&tags=%5B%22x%22%5D&force=true", target)
+}
+
+func TestNewHTTPStep_Statuses(t *testing.T) {
+	notFoundIsDone := func(status int) StatusClass {
+		if status == http.StatusNotFound {
+			return StatusSuccess
+		}
+
+		return DefaultStatusClass(status)
+	}
+
+	tests := []struct {
+		name      string
+		statuses  []int
+		classify  func(status int) StatusClass
+		calls     int
+		status    int
+		retryable bool
+	}{
+		{"retried until success", []int{503, 429, 200}, nil, 3, 0, false},
+		{"retries exhausted", []int{500}, nil, 3, 500, true},
+		{"fatal", []int{400, 200}, nil, 1, 400, false},
+		{"custom classification", []int{404}, notFoundIsDone, 1, 0, false},
+	}
+
+	for _, test := range tests {
+		server, calls := statusServer(test.statuses...)
+
+		step, _ := NewHTTPStep(HTTPCall{
+			URL:      server.URL,
+			Classify: test.classify,
+			Backoff:  &FixedBackoff{Interval: time.Millisecond},
+		})
+
+		ctx, _ := NewContext()
+		err := step(ctx)
+		server.Close()
+
+		assert.Equal(t, test.calls, *calls, test.name)
+		if test.status == 0 {
+			assert.Nil(t, err, test.name)
+			continue
+		}
+
+		var he *HTTPError
+		assert.True(t, errors.As(err, &he), test.name)
+		assert.Equal(t, test.status, he.StatusCode, test.name)
+		assert.Equal(t, test.retryable, he.Retryable, test.name)
+		assert.Equal(t, `{"status":"done"}`, he.Body, test.name)
+	}
+}
+
+func TestNewHTTPStep_Errors(t *testing.T) {
+	_, err := NewHTTPStep(HTTPCall{})
+	assert.EqualError(t, err, "http step URL is empty")
+
+	_, err = NewHTTPStep(HTTPCall{URL: "http://localhost/{{.ID"})
+	assert.NotNil(t, err)
+
+	var attempts []int
+	step, _ := NewHTTPStep(HTTPCall{
+		URL:         "http://localhost:1/{{.ID}}",
+		MaxAttempts: 2,
+		Backoff: BackoffFunc(func(attempt int) time.Duration {
+			attempts = append(attempts, attempt)
+			return 0
+		}),
+	})
+
+	// the missing variable is not retried
+	ctx, _ := NewContext()
+	assert.NotNil(t, step(ctx))
+	assert.Empty(t, attempts)
+
+	// the transport failure is
+	_ = ctx.SetVariable("ID", 1)
+	assert.NotNil(t, step(ctx))
+	assert.Equal(t, []int{1}, attempts)
+}
+
+func TestBackoffStrategy(t *testing.T) {
+	tests := []struct {
+		strategy BackoffStrategy
+		expected []time.Duration
+	}{
+		{&FixedBackoff{Interval: time.Second}, []time.Duration{time.Second, time.Second, time.Second}},
+		{&ExponentialBackoff{Initial: time.Second}, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}},
+		{&ExponentialBackoff{Initial: time.Second, Multiplier: 3, Max: 5 * time.Second},
+			[]time.Duration{time.Second, 3 * time.Second, 5 * time.Second}},
+		{BackoffFunc(func(attempt int) time.Duration { return time.Duration(attempt) * time.Minute }),
+			[]time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute}},
+	}
+
+	for _, test := range tests {
+		for i, expected := range test.expected {
+			assert.Equal(t, expected, test.strategy.Backoff(i+1))
+		}
+	}
+
+	// without maximum the wait stops growing at the longest duration
+	unbounded := &ExponentialBackoff{Initial: 100 * time.Millisecond}
+	assert.Equal(t, time.Duration(math.MaxInt64), unbounded.Backoff(40))
+	assert.Equal(t, time.Duration(math.MaxInt64), unbounded.Backoff(2000))
+
+	jitter := &ExponentialBackoff{Initial: time.Second, Jitter: 0.5}
+	for i := 0; i < 10; i++ {
+		d := jitter.Backoff(2)
+		assert.True(t, d > time.Second && d <= 2*time.Second, d)
+	}
+}
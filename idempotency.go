@@ -0,0 +1,96 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrDuplicateExecution is the error of a start with the gid of a running or waiting execution, or of an execution
+// finished within the idempotency window
+var ErrDuplicateExecution = errors.New("duplicate execution")
+
+// DuplicateError keep the outcome of the existing execution
+type DuplicateError struct {
+	Result *ExecutionResult
+}
+
+func (de *DuplicateError) Error() string {
+	return fmt.Sprintf("execution %s is %s", de.Result.Gid, de.Result.Status)
+}
+
+func (de *DuplicateError) Unwrap() error {
+	return ErrDuplicateExecution
+}
+
+// SetIdempotencyWindow guard the starts by gid, Exec returns the result of the existing execution instead of
+// running the route again while it's running or waiting and for the retention after it's finished. The finished
+// executions are read back from the caretaker, the guard survives a restart on the same caretaker and the start of
+// an execution a stopped process left running resumes it
+func (o *orchestrator) SetIdempotencyWindow(retention time.Duration) {
+	o.executionsLock.Lock()
+	defer o.executionsLock.Unlock()
+
+	o.idempotencyWindow = retention
+}
+
+// guarded tells whether the idempotency guard is on
+func (o *orchestrator) guarded() bool {
+	o.executionsLock.Lock()
+	defer o.executionsLock.Unlock()
+
+	return o.idempotencyWindow > 0
+}
+
+// persistedMemento read the persisted memento of the gid a start checks, nil when there is none
+func (o *orchestrator) persistedMemento(gid string) (*memento, error) {
+	if o.caretaker == nil {
+		return nil, nil
+	}
+
+	m, err := o.loadMemento(gid)
+	if errors.Is(err, ErrExecutionNotFound) {
+		return nil, nil
+	}
+
+	return m, err
+}
+
+// existing return the outcome of the execution of the gid which can't be started again, nil when it can. A running
+// memento without live execution is left by a stopped process, the execution can be resumed
+func (o *orchestrator) existing(gid string, m *memento) (*ExecutionResult, error) {
+	now := o.clock.Now()
+
+	if e := o.executions[gid]; e != nil {
+		e.lock.Lock()
+		defer e.lock.Unlock()
+
+		if !e.status.isFinished() || now.Sub(e.finished) < o.idempotencyWindow {
+			return &ExecutionResult{
+				Gid:       gid,
+				Status:    e.status,
+				State:     e.state,
+				Errors:    append([]*StepError(nil), e.failures...),
+				Duplicate: true,
+			}, nil
+		}
+
+		return nil, nil
+	}
+
+	if m == nil || m.Status == Running {
+		return nil, nil
+	}
+
+	if m.Status.isFinished() && (m.Finished == nil || now.Sub(*m.Finished) >= o.idempotencyWindow) {
+		return nil, nil
+	}
+
+	return &ExecutionResult{
+		Gid:       gid,
+		Status:    m.Status,
+		State:     m.State,
+		Errors:    stepErrors(m.Failures),
+		Duplicate: true,
+	}, nil
+}
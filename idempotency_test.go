@@ -0,0 +1,214 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestOrchestrator_IdempotentStart(t *testing.T) {
+	for _, journal := range []caretaker{nil, NewMemoryCaretaker()} {
+		clock := &testClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+		orch := NewOrchestrator()
+		if journal != nil {
+			orch.SetCaretaker(journal)
+		}
+		orch.SetClock(clock)
+		orch.SetIdempotencyWindow(time.Hour)
+		_ = orch.Register(NewNonTransactionalRoute("A").AddNextStep("1", appendStep("1")))
+		_ = orch.Initialization(nil)
+
+		ctx, _ := NewContextWithGid("order-1")
+		result, err := orch.Exec("A", ctx)
+		assert.Nil(t, err)
+		assert.False(t, result.Duplicate)
+
+		// the route doesn't run again within the window
+		clock.add(59 * time.Minute)
+		ctx, _ = NewContextWithGid("order-1")
+		result, err = orch.Exec("A", ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, &ExecutionResult{Gid: "order-1", Status: Completed, State: "A_1", Duplicate: true}, result)
+		assert.Nil(t, ctx.GetVariable("STEPS"))
+
+		clock.add(time.Minute)
+		result, err = orch.Exec("A", ctx)
+		assert.Nil(t, err)
+		assert.False(t, result.Duplicate)
+		assert.Equal(t, "1;", ctx.GetVariable("STEPS"))
+	}
+}
+
+func TestOrchestrator_IdempotentStartAcrossRestart(t *testing.T) {
+	journal := NewMemoryCaretaker()
+
+	node := func() *orchestrator {
+		orch := NewOrchestrator()
+		orch.SetCaretaker(journal)
+		orch.SetIdempotencyWindow(time.Hour)
+		_ = orch.Register(approvalRoute(0))
+		_ = orch.Initialization(nil)
+
+		return orch
+	}
+
+	ctx, _ := NewContextWithGid("gid")
+	result, _ := node().Exec("A", ctx)
+	assert.Equal(t, Waiting, result.Status)
+
+	// the waiting execution is returned after a restart
+	orch := node()
+	ctx, _ = NewContextWithGid("gid")
+	result, err := orch.Exec("A", ctx)
+	assert.Nil(t, err)
+	assert.True(t, result.Duplicate)
+	assert.Equal(t, Waiting, result.Status)
+
+	finished, _ := orch.Signal("gid", "approval", map[string]interface{}{"approved": false})
+	assert.Equal(t, Aborted, finished.Status)
+
+	result, err = node().Exec("A", ctx)
+	assert.Nil(t, err)
+	assert.True(t, result.Duplicate)
+	assert.Equal(t, Aborted, result.Status)
+	assert.Equal(t, finished.Err().Error(), result.Err().Error())
+	assert.Nil(t, ctx.GetVariable("STEPS"))
+
+	var sr startResponse
+	assert.Equal(t, http.StatusOK, adminRequest(t, NewAdminHandler(orch), http.MethodPost, "/routes/A/executions",
+		startRequest{Gid: "gid"}, &sr))
+	assert.Equal(t, startResponse{Gid: "gid", Duplicate: true}, sr)
+}
+
+func TestOrchestrator_IdempotentRunningStart(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+
+	orch := NewOrchestrator()
+	orch.SetIdempotencyWindow(time.Hour)
+	_ = orch.Register(NewNonTransactionalRoute("A").AddNextStep("1", func(ctx *context) error {
+		close(started)
+		<-release
+		return nil
+	}))
+	_ = orch.Initialization(nil)
+
+	done := make(chan *ExecutionResult)
+	go func() {
+		ctx, _ := NewContextWithGid("gid")
+		result, _ := orch.Exec("A", ctx)
+		done <- result
+	}()
+	<-started
+
+	ctx, _ := NewContextWithGid("gid")
+	result, err := orch.Exec("A", ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, &ExecutionResult{Gid: "gid", Status: Running, State: "A_1", Duplicate: true}, result)
+
+	_, err = orch.prepare("A", 0, ctx)
+	assert.True(t, errors.Is(err, ErrDuplicateExecution))
+
+	close(release)
+	assert.False(t, (<-done).Duplicate)
+}
+
+func TestOrchestrator_IdempotentStaleStart(t *testing.T) {
+	journal := NewMemoryCaretaker()
+	route := NewNonTransactionalRoute("A").
+		AddNextStep("1", appendStep("1")).
+		AddNextStep("2", appendStep("2"))
+
+	orch := NewOrchestrator()
+	orch.SetCaretaker(journal)
+	_ = orch.Register(route)
+	_ = orch.Initialization(nil)
+
+	ctx, _ := NewContextWithGid("gid")
+	_, _ = orch.Exec("A", ctx)
+
+	// the process stopped after the checkpoint of A_2
+	crashed := NewMemoryCaretaker()
+	for _, data := range journal.journal["gid"] {
+		_ = crashed.persist("gid", data)
+		if m, _ := unmarshalMemento(data); m.State == "A_2" {
+			break
+		}
+	}
+
+	orch = NewOrchestrator()
+	orch.SetCaretaker(crashed)
+	orch.SetIdempotencyWindow(time.Hour)
+	_ = orch.Register(route)
+	_ = orch.Initialization(nil)
+
+	// the execution left running is resumed instead of being a duplicate for good
+	ctx, _ = NewContextWithGid("gid")
+	result, err := orch.Exec("A", ctx)
+	assert.Nil(t, err)
+	assert.False(t, result.Duplicate)
+	assert.Equal(t, Completed, result.Status)
+	assert.Equal(t, "A_2", result.State)
+
+	final, _ := orch.loadMemento("gid")
+	assert.Equal(t, "1;2;", final.Contexts[0].Variables["STEPS"].Value)
+
+	result, err = orch.Exec("A", ctx)
+	assert.Nil(t, err)
+	assert.True(t, result.Duplicate)
+	assert.Equal(t, Completed, result.Status)
+}
+
+func TestStepErrorMemento(t *testing.T) {
+	tests := []*StepError{
+		{State: "A_1", Err: errors.New("payment (declined)"), Decision: Rollback},
+		{State: "A_2", Err: errors.New("state B: timeout (ABORT)"), Decision: Abort, RecoveryErr: errors.New("recovery (failed)")},
+		{State: "", Err: errors.New(""), Decision: Resume},
+	}
+
+	for _, test := range tests {
+		data, _ := json.Marshal(newStepErrorMemento(test))
+
+		var sem stepErrorMemento
+		assert.Nil(t, json.Unmarshal(data, &sem))
+		assert.Equal(t, test, sem.stepError())
+	}
+}
+
+func TestOrchestrator_StartWaitingGid(t *testing.T) {
+	journal := NewMemoryCaretaker()
+	orch := newTimerOrchestrator(journal, systemClock{}, reminderRoute(72*time.Hour))
+
+	ctx, _ := NewContextWithGid("gid")
+	result, _ := orch.Exec("A", ctx)
+	assert.Equal(t, Waiting, result.Status)
+
+	// the waiting execution isn't replaced while the guard is off
+	ctx, _ = NewContextWithGid("gid")
+	_, err := orch.Exec("A", ctx)
+	assert.EqualError(t, err, "execution gid is WAITING")
+
+	info, _ := orch.Execution("gid")
+	assert.Equal(t, Waiting, info.Status)
+}
+
+func TestOrchestrator_IdempotentStartErrors(t *testing.T) {
+	orch := NewOrchestrator()
+	orch.SetIdempotencyWindow(time.Hour)
+	_ = orch.Register(NewNonTransactionalRoute("A").AddNextStep("1", func(ctx *context) error {
+		return errUnavailable
+	}))
+	_ = orch.Initialization(nil)
+
+	ctx, _ := NewContextWithGid("order-1")
+	_, _ = orch.Exec("A", ctx)
+
+	// the retained execution returns the failures as they're returned
+	ctx, _ = NewContextWithGid("order-1")
+	result, _ := orch.Exec("A", ctx)
+	assert.True(t, result.Duplicate)
+	assert.True(t, errors.Is(result.Errors[0].Err, errUnavailable))
+}
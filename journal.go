@@ -0,0 +1,308 @@
+package orchestrator
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// ErrNotReplayable is the failure of a NotReplayable condition evaluated outside a replay
+var ErrNotReplayable = errors.New("condition is not replayable")
+
+type (
+	// JournalEntry is an execution memento read from a caretaker journal
+	JournalEntry struct {
+		Timestamp time.Time
+		Gid       string
+		RouteId   string
+		Version   int
+
+		// State to execute when the status is Running, otherwise the latest executed state
+		State  string
+		Status ExecutionStatus
+
+		// Variables of the execution context
+		Variables map[string]interface{}
+		Errors    []string
+
+		// Faults injected into the step attempts so far, the failures they caused are told apart with them
+		Faults []InjectedFault
+
+		memento *memento
+	}
+
+	// ReplayReport compare a recorded execution with its replay
+	ReplayReport struct {
+		Gid      string
+		Recorded []string
+		Replayed []string
+		Status   ExecutionStatus
+
+		// Diverged index of the first state which differs, -1 when the replay takes the recorded states
+		Diverged int
+
+		// Unverified states the replay left on the recorded branch, their condition isn't replayable so the branch
+		// isn't checked against the route
+		Unverified []string
+	}
+
+	// journalReplay replace the state actions by the context changes and the failures recorded in the journal
+	journalReplay struct {
+		gid      string
+		entries  []*JournalEntry
+		next     int
+		recorded []string
+		states   []string
+
+		// unverified states left on the recorded branch
+		unverified []string
+
+		// failures recorded and not replayed yet, failure is the one of the latest executed state
+		failures []*StepError
+		failure  *StepError
+
+		// pause is called before each state, nil means the replay doesn't pause
+		pause func(state *State, ctx *context)
+	}
+)
+
+// ReadJournal read the entries of a file caretaker journal in the order they are persisted
+func ReadJournal(path string) ([]*JournalEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseJournal(f)
+}
+
+// ParseJournal decode the JSON lines of a file caretaker journal
+func ParseJournal(r io.Reader) ([]*JournalEntry, error) {
+	var entries []*JournalEntry
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLogSize)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var log logStr
+		if err := json.Unmarshal(scanner.Bytes(), &log); err != nil {
+			return nil, err
+		}
+
+		if isTriggerId(log.Id) {
+			continue
+		}
+
+		m, err := unmarshalMemento(log.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		e := &JournalEntry{
+			Gid:     m.Gid,
+			RouteId: m.RouteId,
+			Version: m.Version,
+			State:   m.State,
+			Status:  m.Status,
+			Errors:  m.Errors,
+			Faults:  m.Faults,
+			memento: m,
+		}
+
+		// the timestamp is informative, an unknown format is ignored
+		e.Timestamp, _ = time.Parse(time.RFC3339, log.Timestamp)
+
+		if len(m.Contexts) > 0 {
+			e.Variables = m.Contexts[0].values()
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, scanner.Err()
+}
+
+// JournalHistory return the entries of an execution
+func JournalHistory(entries []*JournalEntry, gid string) []*JournalEntry {
+	var result []*JournalEntry
+	for _, e := range entries {
+		if e.Gid == gid {
+			result = append(result, e)
+		}
+	}
+
+	return result
+}
+
+// LatestJournalEntries return the latest entry of each execution in the order the executions are started
+func LatestJournalEntries(entries []*JournalEntry) []*JournalEntry {
+	var result []*JournalEntry
+	index := make(map[string]int)
+	for _, e := range entries {
+		if i, ok := index[e.Gid]; ok {
+			result[i] = e
+			continue
+		}
+
+		index[e.Gid] = len(result)
+		result = append(result, e)
+	}
+
+	return result
+}
+
+// Replay run the history of an execution again without executing the step actions, each action is replaced by
+// the context changes and the failure the journal recorded for the state so the conditions take the recorded
+// branches unless the route differs; nothing is persisted. The called routes are needed when the route has endpoints
+func Replay(entries []*JournalEntry, route Route, called ...Route) (*ReplayReport, error) {
+	rr, ctx, err := newReplayRunner(entries, route, called)
+	if err != nil {
+		return nil, err
+	}
+
+	result := rr.run(ctx)
+	return rr.replay.report(result), nil
+}
+
+// newReplayRunner create the runner replaying the history from the context of its first entry
+func newReplayRunner(entries []*JournalEntry, route Route, called []Route) (*routeRunner, *context, error) {
+	if len(entries) == 0 {
+		return nil, nil, errors.New("journal has no entry")
+	}
+
+	routes := map[string]Route{route.GetRouteId(): route}
+	for _, r := range called {
+		routes[r.GetRouteId()] = r
+	}
+
+	first := entries[0].memento
+	if len(first.Contexts) == 0 {
+		return nil, nil, errors.New("journal entry has no context")
+	}
+
+	ctx, err := first.Contexts[0].restore()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	replay := &journalReplay{entries: entries, gid: first.Gid}
+	for _, e := range entries {
+		if e.Status == Running {
+			replay.recorded = append(replay.recorded, e.State)
+		}
+	}
+
+	// the latest entry with failures has them all
+	for i := len(entries) - 1; i >= 0 && replay.failures == nil; i-- {
+		replay.failures = stepErrors(entries[i].memento.Failures)
+	}
+
+	rr := newRouteRunner(route.GetStartState(), nil, routes)
+	rr.replay = replay
+	rr.statemachine.recorded = replay.recordedNext
+
+	return rr, ctx, nil
+}
+
+// NotReplayable stand for a condition function which isn't available on replay, the replay takes the branch the
+// execution took and the condition fails outside a replay
+func NotReplayable(ctx context) (bool, error) {
+	return false, ErrNotReplayable
+}
+
+// recordedNext the recorded state after the replayed ones, empty once the history is replayed
+func (jr *journalReplay) recordedNext() string {
+	if len(jr.states) < len(jr.recorded) {
+		if len(jr.states) > 0 {
+			jr.unverified = append(jr.unverified, jr.states[len(jr.states)-1])
+		}
+
+		return jr.recorded[len(jr.states)]
+	}
+
+	return ""
+}
+
+// report compare the recorded states with the replayed ones
+func (jr *journalReplay) report(result *ExecutionResult) *ReplayReport {
+	report := &ReplayReport{
+		Gid:        jr.gid,
+		Recorded:   jr.recorded,
+		Replayed:   jr.states,
+		Status:     result.Status,
+		Diverged:   -1,
+		Unverified: jr.unverified,
+	}
+
+	for i := 0; i < len(report.Recorded) || i < len(report.Replayed); i++ {
+		if i >= len(report.Recorded) || i >= len(report.Replayed) || report.Recorded[i] != report.Replayed[i] {
+			report.Diverged = i
+			break
+		}
+	}
+
+	return report
+}
+
+// execute restore the state context as it's recorded after the state and return the recorded failure of the
+// state, the context is left as is when the state is not in the journal
+func (jr *journalReplay) execute(ctx *context, state *State) error {
+	if jr.pause != nil {
+		jr.pause(state, ctx)
+	}
+
+	jr.states = append(jr.states, state.name)
+	jr.restore(ctx, state)
+
+	if len(jr.failures) > 0 && jr.failures[0].State == state.name {
+		jr.failure, jr.failures = jr.failures[0], jr.failures[1:]
+		return jr.failure.Err
+	}
+
+	return nil
+}
+
+// recordedFailure return the recorded failure of the latest executed state once, its decision is replayed
+func (jr *journalReplay) recordedFailure() *StepError {
+	se := jr.failure
+	jr.failure = nil
+
+	return se
+}
+
+func (jr *journalReplay) restore(ctx *context, state *State) {
+	for i := jr.next; i < len(jr.entries); i++ {
+		e := jr.entries[i]
+		if e.Status != Running || e.State != state.name {
+			continue
+		}
+
+		jr.next = i + 1
+		for _, after := range jr.entries[i+1:] {
+			for _, cm := range after.memento.Contexts {
+				if cm.Gid != ctx.gid {
+					continue
+				}
+
+				restored, err := cm.restore()
+				if err != nil {
+					return
+				}
+
+				ctx.lock.Lock()
+				ctx.variables = restored.variables
+				ctx.lock.Unlock()
+				return
+			}
+		}
+
+		return
+	}
+}
@@ -0,0 +1,97 @@
+package orchestrator
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func journalTestRoute(condition string) Route {
+	return NewNonTransactionalRoute("R").
+		AddNextStep("1", func(ctx *context) error {
+			return ctx.SetVariable("amount", 150)
+		}).
+		WhenExpression(MustCompileExpression(condition, nil)).
+		AddNextStep("big", appendStep("big")).
+		Otherwise().
+		AddNextStep("small", appendStep("small")).
+		End().
+		AddNextStep("done", appendStep("done"))
+}
+
+func TestReadJournal(t *testing.T) {
+	fc, _ := NewFileCareTacker("sample_journal")
+	defer os.Remove(fc.f.Name())
+	defer fc.shutdown()
+
+	orch := NewOrchestrator()
+	orch.SetCaretaker(fc)
+	_ = orch.Register(journalTestRoute("amount > 100"))
+	_ = orch.Initialization(nil)
+
+	for _, gid := range []string{"first", "second"} {
+		ctx, _ := NewContextWithGid(gid)
+		_, err := orch.Exec("R", ctx)
+		assert.Nil(t, err)
+	}
+
+	entries, err := ReadJournal(fc.f.Name())
+	assert.Nil(t, err)
+
+	latest := LatestJournalEntries(entries)
+	assert.Len(t, latest, 2)
+	assert.Equal(t, "first", latest[0].Gid)
+	assert.Equal(t, Completed, latest[0].Status)
+	assert.Equal(t, "R_done", latest[0].State)
+	assert.Equal(t, 150, latest[0].Variables["amount"])
+	assert.False(t, latest[0].Timestamp.IsZero())
+
+	history := JournalHistory(entries, "second")
+	var states []string
+	for _, e := range history {
+		states = append(states, e.State)
+	}
+	assert.Equal(t, []string{"R_1", "R_big", "R_done", "R_done"}, states)
+
+	// the recorded context leads the replay, the actions are not executed
+	report, err := Replay(history, journalTestRoute("amount > 100"))
+	assert.Nil(t, err)
+	assert.Equal(t, -1, report.Diverged)
+	assert.Equal(t, Completed, report.Status)
+	assert.Equal(t, []string{"R_1", "R_big", "R_done"}, report.Replayed)
+
+	report, err = Replay(history, journalTestRoute("amount > 200"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, report.Diverged)
+	assert.Equal(t, []string{"R_1", "R_small", "R_done"}, report.Replayed)
+
+	_, err = Replay(nil, journalTestRoute("amount > 100"))
+	assert.NotNil(t, err)
+
+	// a condition which isn't replayable takes the recorded branch
+	notReplayable := NewNonTransactionalRoute("R").
+		AddNextStep("1", appendStep("1")).
+		WhenCondition(NotReplayable).
+		AddNextStep("small", appendStep("small")).
+		Otherwise().
+		AddNextStep("big", appendStep("big")).
+		End().
+		AddNextStep("done", appendStep("done"))
+
+	report, err = Replay(history, notReplayable)
+	assert.Nil(t, err)
+	assert.Equal(t, -1, report.Diverged)
+	assert.Equal(t, []string{"R_1", "R_big", "R_done"}, report.Replayed)
+	assert.Equal(t, []string{"R_1"}, report.Unverified)
+
+	// and fails outside a replay
+	orch = NewOrchestrator()
+	_ = orch.Register(notReplayable)
+	_ = orch.Initialization(nil)
+
+	ctx, _ := NewContext()
+	result, _ := orch.Exec("R", ctx)
+	assert.Equal(t, Aborted, result.Status)
+	assert.True(t, errors.Is(result.Errors[0].Err, ErrNotReplayable))
+}
@@ -0,0 +1,485 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Running the execution is in progress, it can be resumed from its latest memento
+const Running ExecutionStatus = "RUNNING"
+
+type (
+	// memento is the persisted snapshot of an execution, the caretaker keeps one after each step
+	// context variables are persisted as JSON, the numbers nested in the values are restored as float64
+	memento struct {
+		Gid     string `json:"gid"`
+		RouteId string `json:"route_id"`
+		Version int    `json:"version"`
+
+		// Routes version of each route the execution runs on
+		Routes map[string]int `json:"routes"`
+
+		// State to execute when the status is Running, otherwise the latest executed state
+		State  string          `json:"state"`
+		Status ExecutionStatus `json:"status"`
+
+		// Contexts of the execution, the first one is the execution context and the rest are isolated contexts
+		Contexts []contextMemento `json:"contexts"`
+
+		// Context index of the State context
+		Context int `json:"context"`
+
+		// Stack endpoint states waiting for their called route
+		Stack []frameMemento `json:"stack,omitempty"`
+
+		// Called finished calls which are compensated on rollback
+		Called []frameMemento `json:"called,omitempty"`
+
+		// Attempts started action attempts by state
+		Attempts map[string]int `json:"attempts,omitempty"`
+
+		Errors []string `json:"errors,omitempty"`
+
+		// Failures the step errors the Errors describe, they're restored from it
+		Failures []stepErrorMemento `json:"failures,omitempty"`
+
+		// Faults injected into the step attempts so far
+		Faults []InjectedFault `json:"faults,omitempty"`
+
+		// Signal the Waiting execution waits for, empty on a timer; it wakes up at the deadline, if any
+		Signal   string     `json:"signal,omitempty"`
+		Deadline *time.Time `json:"deadline,omitempty"`
+
+		// Finished time of the finished execution
+		Finished *time.Time `json:"finished,omitempty"`
+	}
+
+	// stepErrorMemento keep a step error field by field, the failures keep their message only so they're restored as
+	// plain errors which don't match their type nor the errors they wrapped
+	stepErrorMemento struct {
+		State         string           `json:"state"`
+		Error         string           `json:"error"`
+		Decision      RecoveryDecision `json:"decision"`
+		RecoveryError string           `json:"recoveryError,omitempty"`
+	}
+
+	contextMemento struct {
+		Gid       string                     `json:"gid"`
+		Variables map[string]variableMemento `json:"variables"`
+	}
+
+	variableMemento struct {
+		Version string      `json:"version"`
+		Value   interface{} `json:"value"`
+
+		// Type of a number value other than a float64, it's restored with it
+		Type string `json:"type,omitempty"`
+	}
+
+	frameMemento struct {
+		State     string `json:"state"`
+		Call      int    `json:"call"`
+		Ctx       int    `json:"ctx"`
+		CalleeCtx int    `json:"callee_ctx"`
+		Last      string `json:"last,omitempty"`
+	}
+)
+
+// isFinished the execution reached a final status and can't be resumed
+func (s ExecutionStatus) isFinished() bool {
+	return s == Completed || s == RolledBack || s == Aborted
+}
+
+func newStepErrorMemento(se *StepError) stepErrorMemento {
+	sem := stepErrorMemento{State: se.State, Decision: se.Decision}
+	if se.Err != nil {
+		sem.Error = se.Err.Error()
+	}
+
+	if se.RecoveryErr != nil {
+		sem.RecoveryError = se.RecoveryErr.Error()
+	}
+
+	return sem
+}
+
+func (sem stepErrorMemento) stepError() *StepError {
+	se := &StepError{State: sem.State, Err: errors.New(sem.Error), Decision: sem.Decision}
+	if sem.RecoveryError != "" {
+		se.RecoveryErr = errors.New(sem.RecoveryError)
+	}
+
+	return se
+}
+
+// stepErrors restore the step errors of the mementos
+func stepErrors(failures []stepErrorMemento) []*StepError {
+	var result []*StepError
+	for _, sem := range failures {
+		result = append(result, sem.stepError())
+	}
+
+	return result
+}
+
+func (m *memento) marshal() (string, error) {
+	b, err := json.Marshal(m)
+	return string(b), err
+}
+
+func unmarshalMemento(data string) (*memento, error) {
+	if data == "" {
+		return nil, errors.New("memento not found")
+	}
+
+	m := &memento{}
+	if err := json.Unmarshal([]byte(data), m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// createMemento take a snapshot of the runner
+func (rr *routeRunner) createMemento(status ExecutionStatus, errs []*StepError) *memento {
+	m := &memento{
+		Gid:      rr.gid,
+		RouteId:  rr.routeId,
+		Version:  rr.versions[rr.routeId],
+		Routes:   rr.versions,
+		State:    rr.statemachine.state.name,
+		Status:   status,
+		Attempts: rr.attempts,
+		Faults:   rr.injected,
+	}
+
+	index := make(map[*context]int)
+	ctxIndex := func(ctx *context) int {
+		if i, ok := index[ctx]; ok {
+			return i
+		}
+
+		index[ctx] = len(m.Contexts)
+		m.Contexts = append(m.Contexts, newContextMemento(ctx))
+		return index[ctx]
+	}
+
+	frame := func(f *callFrame) frameMemento {
+		fm := frameMemento{
+			State:     f.state.name,
+			Call:      f.call,
+			Ctx:       ctxIndex(f.ctx),
+			CalleeCtx: ctxIndex(f.calleeCtx),
+		}
+
+		if f.last != nil {
+			fm.Last = f.last.name
+		}
+
+		return fm
+	}
+
+	if len(rr.callStack) > 0 {
+		ctxIndex(rr.callStack[0].ctx)
+	}
+
+	m.Context = ctxIndex(rr.statemachine.context)
+	for _, f := range rr.callStack {
+		m.Stack = append(m.Stack, frame(f))
+	}
+
+	for _, calls := range rr.called {
+		for _, f := range calls {
+			m.Called = append(m.Called, frame(f))
+		}
+	}
+
+	for _, se := range errs {
+		m.Errors = append(m.Errors, se.Error())
+		m.Failures = append(m.Failures, newStepErrorMemento(se))
+	}
+
+	if status.isFinished() {
+		finished := rr.clock.Now()
+		m.Finished = &finished
+	}
+
+	if status == Waiting && rr.statemachine.state.wait != nil {
+		m.Signal = rr.statemachine.state.wait.signal
+		if !rr.deadline.IsZero() {
+			deadline := rr.deadline
+			m.Deadline = &deadline
+		}
+	}
+
+	return m
+}
+
+// restore the runner from a memento, the execution continues from the memento state
+func (rr *routeRunner) restore(m *memento) error {
+	states := indexStates(rr.routes)
+
+	state := func(name string) (*State, error) {
+		if s := states[name]; s != nil {
+			return s, nil
+		}
+
+		return nil, errors.New(fmt.Sprintf("state %s not found in route %s version %d", name, m.RouteId, m.Version))
+	}
+
+	if len(m.Contexts) == 0 {
+		return errors.New("memento has no context")
+	}
+
+	contexts := make([]*context, 0, len(m.Contexts))
+	for _, cm := range m.Contexts {
+		ctx, err := cm.restore()
+		if err != nil {
+			return err
+		}
+
+		contexts = append(contexts, ctx)
+	}
+
+	frame := func(fm frameMemento) (*callFrame, error) {
+		s, err := state(fm.State)
+		if err != nil {
+			return nil, err
+		}
+
+		if fm.Ctx >= len(contexts) || fm.CalleeCtx >= len(contexts) {
+			return nil, errors.New("invalid frame context")
+		}
+
+		f := &callFrame{
+			state:     s,
+			call:      fm.Call,
+			ctx:       contexts[fm.Ctx],
+			calleeCtx: contexts[fm.CalleeCtx],
+		}
+
+		if fm.Last != "" {
+			if f.last, err = state(fm.Last); err != nil {
+				return nil, err
+			}
+		}
+
+		return f, nil
+	}
+
+	for _, fm := range m.Stack {
+		f, err := frame(fm)
+		if err != nil {
+			return err
+		}
+
+		if f.call >= len(f.state.calls) {
+			return errors.New(fmt.Sprintf("state %s has no call %d", f.state.name, f.call))
+		}
+
+		rr.callStack = append(rr.callStack, f)
+	}
+
+	for _, fm := range m.Called {
+		f, err := frame(fm)
+		if err != nil {
+			return err
+		}
+
+		rr.called[f.state] = append(rr.called[f.state], f)
+	}
+
+	s, err := state(m.State)
+	if err != nil {
+		return err
+	}
+
+	if m.Context >= len(contexts) {
+		return errors.New("invalid memento context")
+	}
+
+	for name, attempts := range m.Attempts {
+		rr.attempts[name] = attempts
+	}
+
+	rr.injected = m.Faults
+	rr.gid = m.Gid
+	rr.statemachine.init(s, contexts[m.Context])
+	return nil
+}
+
+func newContextMemento(ctx *context) contextMemento {
+	ctx.lock.Lock()
+	defer ctx.lock.Unlock()
+
+	cm := contextMemento{
+		Gid:       ctx.gid,
+		Variables: make(map[string]variableMemento, len(ctx.variables)),
+	}
+
+	for k, r := range ctx.variables {
+		cm.Variables[k] = newVariableMemento(r.version, r.value)
+	}
+
+	return cm
+}
+
+func (cm contextMemento) restore() (*context, error) {
+	ctx, err := NewContextWithGid(cm.Gid)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range cm.Variables {
+		ctx.variables[k] = row{
+			version: v.Version,
+			value:   v.Value,
+		}
+	}
+
+	return ctx, nil
+}
+
+func newVariableMemento(version string, value interface{}) variableMemento {
+	return variableMemento{
+		Version: version,
+		Value:   value,
+		Type:    numberType(value),
+	}
+}
+
+func (vm *variableMemento) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Version string          `json:"version"`
+		Value   json.RawMessage `json:"value"`
+		Type    string          `json:"type"`
+	}
+
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	vm.Version, vm.Type, vm.Value = raw.Version, raw.Type, nil
+	if len(raw.Value) == 0 {
+		return nil
+	}
+
+	if vm.Type == "" {
+		return json.Unmarshal(raw.Value, &vm.Value)
+	}
+
+	value, err := parseNumber(vm.Type, string(raw.Value))
+	if err != nil {
+		return err
+	}
+
+	vm.Value = value
+	return nil
+}
+
+// numberType the type of a number which isn't restored as is from JSON, empty for the other values
+func numberType(value interface{}) string {
+	switch value.(type) {
+	case int:
+		return "int"
+	case int8:
+		return "int8"
+	case int16:
+		return "int16"
+	case int32:
+		return "int32"
+	case int64:
+		return "int64"
+	case uint:
+		return "uint"
+	case uint8:
+		return "uint8"
+	case uint16:
+		return "uint16"
+	case uint32:
+		return "uint32"
+	case uint64:
+		return "uint64"
+	case float32:
+		return "float32"
+	}
+
+	return ""
+}
+
+// parseNumber read a JSON number back to its type, the integers don't go through a float64
+func parseNumber(t string, s string) (interface{}, error) {
+	switch t {
+	case "int", "int8", "int16", "int32", "int64":
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		switch t {
+		case "int":
+			return int(i), nil
+		case "int8":
+			return int8(i), nil
+		case "int16":
+			return int16(i), nil
+		case "int32":
+			return int32(i), nil
+		}
+
+		return i, nil
+	case "uint", "uint8", "uint16", "uint32", "uint64":
+		u, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		switch t {
+		case "uint":
+			return uint(u), nil
+		case "uint8":
+			return uint8(u), nil
+		case "uint16":
+			return uint16(u), nil
+		case "uint32":
+			return uint32(u), nil
+		}
+
+		return u, nil
+	case "float32":
+		f, err := strconv.ParseFloat(s, 32)
+		if err != nil {
+			return nil, err
+		}
+
+		return float32(f), nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("unknown number type %s", t))
+}
+
+// indexStates walk the route graphs and index their states by name
+func indexStates(routes map[string]Route) map[string]*State {
+	states := make(map[string]*State)
+
+	var walk func(s *State)
+	walk = func(s *State) {
+		if s == nil || states[s.name] != nil {
+			return
+		}
+
+		states[s.name] = s
+		for _, t := range s.transitions {
+			walk(t.to)
+		}
+	}
+
+	for _, r := range routes {
+		walk(r.GetStartState())
+	}
+
+	return states
+}
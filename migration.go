@@ -0,0 +1,203 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+)
+
+type (
+	// MigrationPlan move the unfinished executions of a route version to another version of the route
+	MigrationPlan struct {
+		RouteId     string
+		FromVersion int
+		ToVersion   int
+
+		// StateMapping old state name -> new state name, a state which is not mapped keeps its name
+		StateMapping map[string]string
+
+		// Transform optional context transformation, it's called for each context of a migrated execution
+		Transform func(ctx *context) error
+
+		// DryRun report the migration without persisting the migrated executions
+		DryRun bool
+	}
+
+	// MigrationIssue an execution which can't be migrated
+	MigrationIssue struct {
+		Gid string
+
+		// States which are not found in the new version after the mapping
+		States []string
+
+		Err error
+	}
+
+	MigrationReport struct {
+		// Migrated executions, in dry run mode the executions which would be migrated
+		Migrated []string
+
+		// Unmapped executions are not migrated
+		Unmapped []*MigrationIssue
+	}
+)
+
+func (mi *MigrationIssue) Error() string {
+	if len(mi.States) > 0 {
+		return fmt.Sprintf("execution %s: states %v can't be mapped", mi.Gid, mi.States)
+	}
+
+	return fmt.Sprintf("execution %s: %v", mi.Gid, mi.Err)
+}
+
+// Migrate move the unfinished executions stored by the caretaker from a route version to another one, the waiting
+// executions and the running ones left by a stopped process are migrated while the executions run by the orchestrator
+// are reported as unmapped
+func (o *orchestrator) Migrate(plan MigrationPlan) (*MigrationReport, error) {
+	if o.caretaker == nil {
+		return nil, errors.New("caretaker is not defined")
+	}
+
+	o.lock.RLock()
+	target := o.routes[plan.RouteId][plan.ToVersion]
+	o.lock.RUnlock()
+
+	if target == nil {
+		return nil, errors.New(fmt.Sprintf("route %s version %d not found", plan.RouteId, plan.ToVersion))
+	}
+
+	logs, err := o.caretaker.latest()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &MigrationReport{}
+	for _, log := range logs {
+		if isTriggerId(log.Id) {
+			continue
+		}
+
+		m, err := unmarshalMemento(log.Data)
+		if err != nil || (m.Status != Waiting && m.Status != Running) || m.RouteId != plan.RouteId || m.Version != plan.FromVersion {
+			continue
+		}
+
+		if o.live(m.Gid) {
+			report.Unmapped = append(report.Unmapped, &MigrationIssue{Gid: m.Gid, Err: errors.New("execution is running")})
+			continue
+		}
+
+		mm, issue := o.migrate(m, plan)
+		if issue != nil {
+			report.Unmapped = append(report.Unmapped, issue)
+			continue
+		}
+
+		if !plan.DryRun {
+			data, err := mm.marshal()
+			if err == nil {
+				err = o.caretaker.persist(mm.Gid, data)
+			}
+
+			if err != nil {
+				report.Unmapped = append(report.Unmapped, &MigrationIssue{Gid: m.Gid, Err: err})
+				continue
+			}
+		}
+
+		report.Migrated = append(report.Migrated, m.Gid)
+	}
+
+	return report, nil
+}
+
+// live tells whether the orchestrator runs the execution, the retained finished executions are not running
+func (o *orchestrator) live(gid string) bool {
+	o.executionsLock.Lock()
+	e := o.executions[gid]
+	o.executionsLock.Unlock()
+
+	return e != nil && !e.currentStatus().isFinished()
+}
+
+// migrate map an execution memento to the plan target version
+func (o *orchestrator) migrate(m *memento, plan MigrationPlan) (*memento, *MigrationIssue) {
+	pinned := make(map[string]int, len(m.Routes))
+	for id, v := range m.Routes {
+		pinned[id] = v
+	}
+	pinned[plan.RouteId] = plan.ToVersion
+
+	rh, err := o.newRunner(plan.RouteId, pinned)
+	if err != nil {
+		return nil, &MigrationIssue{Gid: m.Gid, Err: err}
+	}
+
+	mm := *m
+	mm.Version = plan.ToVersion
+	mm.Routes = rh.versions
+	mm.Stack = append([]frameMemento(nil), m.Stack...)
+	mm.Called = append([]frameMemento(nil), m.Called...)
+	mm.Contexts = append([]contextMemento(nil), m.Contexts...)
+
+	states := indexStates(rh.routes)
+	issue := &MigrationIssue{Gid: m.Gid}
+	mapState := func(name string) string {
+		if name == "" {
+			return name
+		}
+
+		if to, ok := plan.StateMapping[name]; ok {
+			name = to
+		}
+
+		if states[name] == nil {
+			issue.States = append(issue.States, name)
+		}
+
+		return name
+	}
+
+	mm.State = mapState(m.State)
+	if len(m.Attempts) > 0 {
+		mm.Attempts = make(map[string]int, len(m.Attempts))
+		for name, attempts := range m.Attempts {
+			if to, ok := plan.StateMapping[name]; ok {
+				name = to
+			}
+			mm.Attempts[name] = attempts
+		}
+	}
+
+	for _, frames := range [][]frameMemento{mm.Stack, mm.Called} {
+		for i := range frames {
+			frames[i].State = mapState(frames[i].State)
+			frames[i].Last = mapState(frames[i].Last)
+		}
+	}
+
+	if len(issue.States) > 0 {
+		return nil, issue
+	}
+
+	if plan.Transform != nil {
+		for i, cm := range mm.Contexts {
+			ctx, err := cm.restore()
+			if err == nil {
+				err = plan.Transform(ctx)
+			}
+
+			if err != nil {
+				return nil, &MigrationIssue{Gid: m.Gid, Err: err}
+			}
+
+			mm.Contexts[i] = newContextMemento(ctx)
+		}
+	}
+
+	// the migrated execution must be resumable on the new version
+	if err := rh.restore(&mm); err != nil {
+		return nil, &MigrationIssue{Gid: m.Gid, Err: err}
+	}
+
+	return &mm, nil
+}
@@ -0,0 +1,135 @@
+package orchestrator
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// interruptedJournal keep the mementos of an execution until the checkpoint of the state, as if the process stopped
+func interruptedJournal(journal *memoryCaretaker, gid string, state string) *memoryCaretaker {
+	interrupted := NewMemoryCaretaker()
+	for _, data := range journal.journal[gid] {
+		_ = interrupted.persist(gid, data)
+		if m, _ := unmarshalMemento(data); m.State == state {
+			break
+		}
+	}
+
+	return interrupted
+}
+
+func TestOrchestrator_Migrate(t *testing.T) {
+	journal := NewMemoryCaretaker()
+
+	orch := NewOrchestrator()
+	orch.SetCaretaker(journal)
+	_ = orch.Register(NewNonTransactionalRoute("A").
+		AddNextStep("1", appendStep("1")).
+		AddNextStep("2", appendStep("2")).
+		AddNextStep("3", appendStep("3")))
+	_ = orch.RegisterVersion(NewNonTransactionalRoute("A").
+		AddNextStep("1", appendStep("1")).
+		AddNextStep("second", appendStep("second")).
+		AddNextStep("third", appendStep("third")), 2)
+	_ = orch.Initialization(nil)
+
+	ctx, _ := NewContextWithGid("parked")
+	_, _ = orch.ExecVersion("A", 1, ctx)
+
+	parked := interruptedJournal(journal, "parked", "A_2")
+	orch.SetCaretaker(parked)
+
+	plan := MigrationPlan{
+		RouteId:     "A",
+		FromVersion: 1,
+		ToVersion:   2,
+		DryRun:      true,
+	}
+
+	report, err := orch.Migrate(plan)
+	assert.Nil(t, err)
+	assert.Empty(t, report.Migrated)
+	assert.Len(t, report.Unmapped, 1)
+	assert.Equal(t, []string{"A_2"}, report.Unmapped[0].States)
+	assert.NotEmpty(t, report.Unmapped[0].Error())
+
+	plan.StateMapping = map[string]string{"A_2": "A_second"}
+	plan.Transform = func(ctx *context) error {
+		return ctx.SetVariable("STEPS", ctx.GetVariable("STEPS").(string)+"migrated;")
+	}
+
+	report, _ = orch.Migrate(plan)
+	assert.Equal(t, []string{"parked"}, report.Migrated)
+	assert.Empty(t, report.Unmapped)
+	assert.Len(t, parked.journal["parked"], 2)
+
+	plan.DryRun = false
+	report, _ = orch.Migrate(plan)
+	assert.Equal(t, []string{"parked"}, report.Migrated)
+
+	m, _ := unmarshalMemento(parked.journal["parked"][2])
+	assert.Equal(t, 2, m.Version)
+	assert.Equal(t, "A_second", m.State)
+
+	// nothing is left on version 1
+	report, _ = orch.Migrate(plan)
+	assert.Empty(t, report.Migrated)
+
+	result, err := orch.Resume("parked")
+	assert.Nil(t, err)
+	assert.Equal(t, Completed, result.Status)
+	assert.Equal(t, "A_third", result.State)
+
+	m, _ = unmarshalMemento(parked.journal["parked"][len(parked.journal["parked"])-1])
+	assert.Equal(t, "1;migrated;second;third;", m.Contexts[0].Variables["STEPS"].Value)
+}
+
+func TestOrchestrator_MigrateUnknownVersion(t *testing.T) {
+	orch := NewOrchestrator()
+	orch.SetCaretaker(NewMemoryCaretaker())
+	_ = orch.Register(NewNonTransactionalRoute("A").AddNextStep("1", appendStep("1")))
+
+	_, err := orch.Migrate(MigrationPlan{RouteId: "A", FromVersion: 1, ToVersion: 2})
+	assert.NotNil(t, err)
+}
+
+func TestOrchestrator_MigrateLiveExecution(t *testing.T) {
+	journal := NewMemoryCaretaker()
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	orch := NewOrchestrator()
+	orch.SetCaretaker(journal)
+	_ = orch.Register(NewNonTransactionalRoute("A").
+		AddNextStep("1", appendStep("1")).
+		AddNextStep("2", func(ctx *context) error {
+			close(started)
+			<-release
+			return nil
+		}))
+	_ = orch.RegisterVersion(NewNonTransactionalRoute("A").
+		AddNextStep("1", appendStep("1")).
+		AddNextStep("2", appendStep("2")), 2)
+	_ = orch.Initialization(nil)
+
+	done := make(chan *ExecutionResult)
+	go func() {
+		ctx, _ := NewContextWithGid("live")
+		result, _ := orch.ExecVersion("A", 1, ctx)
+		done <- result
+	}()
+	<-started
+
+	report, err := orch.Migrate(MigrationPlan{RouteId: "A", FromVersion: 1, ToVersion: 2})
+	assert.Nil(t, err)
+	assert.Empty(t, report.Migrated)
+	assert.Len(t, report.Unmapped, 1)
+	assert.Equal(t, "execution live: execution is running", report.Unmapped[0].Error())
+
+	close(release)
+	result := <-done
+	assert.Equal(t, Completed, result.Status)
+
+	m, _ := unmarshalMemento(journal.journal["live"][len(journal.journal["live"])-1])
+	assert.Equal(t, 1, m.Version)
+}
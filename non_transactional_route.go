@@ -1,6 +1,9 @@
 package orchestrator
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 type (
 	NonTransactionalRoute struct {
@@ -21,11 +24,20 @@ type (
 
 		// endpoint list
 		endpoints []*Endpoint
+
+		// sources consumer URIs starting the route executions
+		sources []string
+
+		// recorder keep the builder calls for the route definition
+		recorder routeRecorder
 	}
 
 	// force to present AddNextStep method only
 	onlyNonTRAddNextStep interface {
 		AddNextStep(name string, doAction func(ctx *context) error) *NonTransactionalRoute
+		WaitForSignal(name string, timeout time.Duration) *NonTransactionalRoute
+		Sleep(name string, duration time.Duration) *NonTransactionalRoute
+		WaitUntil(name string, key string) *NonTransactionalRoute
 	}
 )
 
@@ -39,11 +51,43 @@ func NewNonTransactionalRoute(id string) *NonTransactionalRoute {
 
 // AddNextStep add new step to NonTransactionalRoute
 func (ntr *NonTransactionalRoute) AddNextStep(name string, doAction func(ctx *context) error) *NonTransactionalRoute {
-	s := &State{
+	ntr.recorder.step(&recordedStep{name: name, action: doAction})
+
+	return ntr.addStep(&State{
 		name:   fmt.Sprintf("%s_%s", ntr.id, name),
 		action: doAction,
-	}
+	})
+}
 
+// WaitForSignal add a step parking the execution until the signal is delivered by the orchestrator Signal, the
+// signal payload is merged into the context. The step fails with ErrSignalTimeout when the timeout expires unless
+// it continues on timeout, zero means no timeout
+func (ntr *NonTransactionalRoute) WaitForSignal(name string, timeout time.Duration) *NonTransactionalRoute {
+	return ntr.addWaitStep(name, &stepWait{signal: name, timeout: timeout})
+}
+
+// Sleep add a step parking the execution for the duration, the timer service resumes it
+func (ntr *NonTransactionalRoute) Sleep(name string, duration time.Duration) *NonTransactionalRoute {
+	return ntr.addWaitStep(name, &stepWait{timeout: duration})
+}
+
+// WaitUntil add a step parking the execution until the time kept in the context variable, the step fails when
+// the variable isn't a time
+func (ntr *NonTransactionalRoute) WaitUntil(name string, key string) *NonTransactionalRoute {
+	return ntr.addWaitStep(name, &stepWait{until: key})
+}
+
+func (ntr *NonTransactionalRoute) addWaitStep(name string, sw *stepWait) *NonTransactionalRoute {
+	ntr.recorder.step(&recordedStep{name: name, wait: sw})
+
+	return ntr.addStep(&State{
+		name:   fmt.Sprintf("%s_%s", ntr.id, name),
+		action: sw.action,
+		wait:   sw,
+	})
+}
+
+func (ntr *NonTransactionalRoute) addStep(s *State) *NonTransactionalRoute {
 	switch ntr.routeState {
 	case When:
 		ntr.addNextStepAfterWhen(s)
@@ -73,15 +117,13 @@ func (ntr *NonTransactionalRoute) AddNextStep(name string, doAction func(ctx *co
 }
 
 func (ntr *NonTransactionalRoute) addNextStepAfterWhen(s *State) {
-	ntr.lastState.createTransition(s, Condition, ntr.predicateStateStack.getLast().predicate)
+	ntr.lastState.createConditionTransition(s, Condition, ntr.predicateStateStack.getLast().condition)
 }
 
 func (ntr *NonTransactionalRoute) addNextStepAfterOtherwise(s *State) {
 	ps := ntr.predicateStateStack.getLast()
 
-	ps.state.createTransition(s, Condition, func(ctx context) bool {
-		return !ps.predicate(ctx)
-	})
+	ps.state.createConditionTransition(s, Condition, notCondition(ps.condition))
 }
 
 //        condition       condition
@@ -111,14 +153,41 @@ func (ntr *NonTransactionalRoute) addNextStepAfterEnd(s *State) {
 
 // When to define a condition
 func (ntr *NonTransactionalRoute) When(predicate func(ctx context) bool) onlyNonTRAddNextStep {
+	return ntr.when(predicate, predicateCondition(predicate))
+}
+
+// WhenCondition define a condition which can fail, the failure fails the step the condition follows
+func (ntr *NonTransactionalRoute) WhenCondition(condition func(ctx context) (bool, error)) onlyNonTRAddNextStep {
+	return ntr.when(condition, condition)
+}
+
+// when fn is the function the route definition names
+func (ntr *NonTransactionalRoute) when(fn interface{}, condition func(ctx context) (bool, error)) onlyNonTRAddNextStep {
+	if !ntr.recorder.stepped("When") {
+		return ntr
+	}
+
+	ntr.recorder.when(fn)
 	ntr.routeState = When
-	ntr.predicateStateStack.push(predicate, ntr.lastState)
+	ntr.predicateStateStack.push(condition, ntr.lastState)
+
+	return ntr
+}
+
+// WhenExpression condition with a compiled expression, unlike a closure the expression is written back in the route definition
+func (ntr *NonTransactionalRoute) WhenExpression(e *Expression) onlyNonTRAddNextStep {
+	ntr.WhenCondition(e.Condition())
+	ntr.recorder.lastCondition().expression = e.String()
 
 	return ntr
 }
 
 // Otherwise When condition
 func (ntr *NonTransactionalRoute) Otherwise() onlyNonTRAddNextStep {
+	if !ntr.recorder.otherwise() {
+		return ntr
+	}
+
 	ntr.routeState = Else
 
 	return ntr
@@ -126,16 +195,106 @@ func (ntr *NonTransactionalRoute) Otherwise() onlyNonTRAddNextStep {
 
 // End of condition
 func (ntr *NonTransactionalRoute) End() onlyNonTRAddNextStep {
+	if !ntr.recorder.end() {
+		return ntr
+	}
+
 	ntr.routeState = End
 
 	return ntr
 }
 
+// From declare a consumer URI, each consumed message starts an execution once the orchestrator consumers are started
+func (ntr *NonTransactionalRoute) From(uri string) *NonTransactionalRoute {
+	ntr.sources = append(ntr.sources, uri)
+
+	return ntr
+}
+
+// To call the route or the component URI after the latest added step, the route continues once the call is finished
 func (ntr *NonTransactionalRoute) To(id string) *NonTransactionalRoute {
-	ntr.endpoints = append(ntr.endpoints, &Endpoint{
-		To:    id,
+	if !ntr.recorder.stepped("To " + id) {
+		return ntr
+	}
+
+	e := &Endpoint{
+		To:    routeIdOf(id),
 		State: ntr.lastState,
-	})
+	}
+
+	ntr.endpoints = append(ntr.endpoints, e)
+	ntr.recorder.last.endpoints = append(ntr.recorder.last.endpoints, e)
+	return ntr
+}
+
+// ToIsolated call the route against an isolated context, the inputs are copied to the called route context
+// before the call and the outputs are copied back when it's finished
+func (ntr *NonTransactionalRoute) ToIsolated(id string, inputs map[string]string, outputs map[string]string) *NonTransactionalRoute {
+	if !ntr.recorder.stepped("ToIsolated " + id) {
+		return ntr
+	}
+
+	e := &Endpoint{
+		To:       routeIdOf(id),
+		State:    ntr.lastState,
+		Isolated: true,
+		Inputs:   inputs,
+		Outputs:  outputs,
+	}
+
+	ntr.endpoints = append(ntr.endpoints, e)
+	ntr.recorder.last.endpoints = append(ntr.recorder.last.endpoints, e)
+	return ntr
+}
+
+// Timeout fail the latest added step when its action takes longer than the timeout
+func (ntr *NonTransactionalRoute) Timeout(timeout time.Duration) *NonTransactionalRoute {
+	if !ntr.recorder.stepped("Timeout") {
+		return ntr
+	}
+
+	ntr.lastState.actionTimeout = timeout
+	ntr.recorder.last.timeout = timeout
+
+	return ntr
+}
+
+// ContinueOnTimeout take the next step when the latest added signal step times out instead of failing,
+// SignalTimedOut tells whether the signal arrived
+func (ntr *NonTransactionalRoute) ContinueOnTimeout() *NonTransactionalRoute {
+	if !ntr.recorder.stepped("ContinueOnTimeout") {
+		return ntr
+	}
+
+	if ntr.lastState.wait != nil {
+		ntr.lastState.wait.continueOnTimeout = true
+	}
+
+	return ntr
+}
+
+// Retry execute the latest added step action again according to the retry policy when it fails
+func (ntr *NonTransactionalRoute) Retry(retryPolicy RetryPolicy) *NonTransactionalRoute {
+	if !ntr.recorder.stepped("Retry") {
+		return ntr
+	}
+
+	ntr.lastState.retryPolicy = &retryPolicy
+	ntr.recorder.last.retryPolicy = &retryPolicy
+
+	return ntr
+}
+
+// Recorded record the outcome of the latest added step in the caretaker, the context changes and the failure of an
+// attempt are applied instead of running the action again when the execution is resumed. A recorded failure keeps
+// its message only and the records are deleted once the execution is finished
+func (ntr *NonTransactionalRoute) Recorded() *NonTransactionalRoute {
+	if !ntr.recorder.stepped("Recorded") {
+		return ntr
+	}
+
+	ntr.lastState.recorded = true
+	ntr.recorder.last.recorded = true
 
 	return ntr
 }
@@ -152,6 +311,10 @@ func (ntr *NonTransactionalRoute) GetEndpoints() []*Endpoint {
 	return ntr.endpoints
 }
 
+func (ntr *NonTransactionalRoute) GetSources() []string {
+	return ntr.sources
+}
+
 func (ntr *NonTransactionalRoute) getEachTransitionLatestState(state *State) []*State {
 	var result []*State
 	for _, t := range state.transitions {
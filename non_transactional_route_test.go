@@ -3,6 +3,7 @@ package orchestrator
 import (
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestDefineUnconditionalRoute(t *testing.T) {
@@ -106,3 +107,22 @@ func TestDefineRoute(t *testing.T) {
 
 	assert.Equal(t, 4, rh.statemachine.context.GetVariable("HK"))
 }
+
+func TestDefineRoute_BuilderErrors(t *testing.T) {
+	tests := []struct {
+		route    Route
+		expected string
+	}{
+		{NewNonTransactionalRoute("A").To("B").AddNextStep("1", doActionTest), "route id A: To B before the first step"},
+		{NewNonTransactionalRoute("A").Retry(RetryPolicy{MaxAttempts: 2}), "route id A: Retry before the first step"},
+		{NewNonTransactionalRoute("A").AddNextStep("1", doActionTest).Otherwise().AddNextStep("2", doActionTest),
+			"route id A: Otherwise without When"},
+		{NewTransactionalRoute("A").Timeout(time.Second).Recorded(), "route id A: Timeout before the first step"},
+		{NewTransactionalRoute("A").AddNextStep("1", doActionTest, nil).End().AddNextStep("2", doActionTest, nil),
+			"route id A: End without When"},
+	}
+
+	for _, test := range tests {
+		assert.EqualError(t, NewOrchestrator().Register(test.route), test.expected)
+	}
+}
@@ -3,8 +3,8 @@ package orchestrator
 import (
 	"errors"
 	"fmt"
-	"log"
-	"reflect"
+	"sync"
+	"time"
 )
 
 // Every TransactionalRoute is created from multiple State those are connected with and edge
@@ -15,15 +15,70 @@ import (
 
 const DefaultRecoveryRouteId = "RECOVERY_ROUTE"
 
+// DefaultRouteVersion is the version of a route registered without a version
+const DefaultRouteVersion = 1
+
 type (
 	orchestrator struct {
-		// registered routes
-		routes map[string]Route
+		lock sync.RWMutex
+
+		// registered routes, route id -> version -> route
+		routes map[string]map[int]Route
 
 		// TransactionalRoute handler
 		rh *routeRunner
 
-		ec chan error
+		// caretaker persist the execution mementos, nil means the executions are not persisted
+		caretaker caretaker
+
+		// initialized the hierarchical route transitions are defined
+		initialized bool
+
+		// live executions by gid
+		executions     map[string]*execution
+		executionsLock sync.Mutex
+
+		// retained finished executions in finish order, they're evicted once the idempotency window is over
+		retained []*execution
+
+		// timers of the waiting executions due within the timer service interval, by gid
+		timers     map[string]*wakeUpTimer
+		timersLock sync.Mutex
+
+		// timer service, a zero interval means the service is stopped and every deadline is timed in memory
+		timersInterval time.Duration
+		timersStop     chan struct{}
+
+		clock Clock
+
+		// registered queries by name
+		queries map[string]QueryFunc
+
+		// pool run the started executions, nil means they run in the caller goroutine
+		pool *workerPool
+
+		// breakers shared by the executions
+		breakers *BreakerRegistry
+
+		// grid the execution contexts are written through, nil means they're kept in memory
+		grid DataGrid
+
+		// components the endpoint URIs are resolved with
+		components *ComponentRegistry
+
+		// idempotencyWindow keep the finished executions from running again with the same gid, zero means the
+		// gid of a finished execution can be started again
+		idempotencyWindow time.Duration
+
+		// started consumers of the route sources, nil means they're stopped
+		consumers     []*routeConsumer
+		consumersLock sync.Mutex
+
+		// listener of the execution lifecycle events, nil means they're not emitted
+		listener ExecutionListener
+
+		// faults injected into the step attempts, nil means none is
+		faults *faultInjector
 	}
 
 	defaultRecoveryRoute struct {
@@ -48,65 +103,214 @@ func (drr *defaultRecoveryRoute) GetEndpoints() []*Endpoint {
 	return nil
 }
 
+// Orchestrator is the orchestrator created by NewOrchestrator, the other packages hold it with it
+type Orchestrator = orchestrator
+
 // NewOrchestrator create and init orchestrator
 func NewOrchestrator() *orchestrator {
 	return &orchestrator{
-		routes: make(map[string]Route),
+		routes:     make(map[string]map[int]Route),
+		executions: make(map[string]*execution),
+		timers:     make(map[string]*wakeUpTimer),
+		clock:      systemClock{},
+		queries:    make(map[string]QueryFunc),
+		breakers:   NewBreakerRegistry(),
+		components: NewComponentRegistry(),
 	}
 }
 
+// SetCaretaker persist a memento of each execution before every step, the executions can be resumed from it
+func (o *orchestrator) SetCaretaker(c caretaker) {
+	o.caretaker = c
+}
+
 // Register is for register a route with it's unique identifier
 func (o *orchestrator) Register(r Route) error {
-	if o.routes[r.GetRouteId()] != nil {
-		return errors.New(fmt.Sprintf("duplicate route id %s", r.GetRouteId()))
-	}
+	return o.RegisterVersion(r, DefaultRouteVersion)
+}
+
+// RegisterVersion register a version of a route, the versions of a route are registered side by side
+// new executions run on the latest version and the running ones stay on the version they started with
+func (o *orchestrator) RegisterVersion(r Route, version int) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
 
 	if r.GetRouteId() == DefaultRecoveryRouteId {
 		return errors.New(DefaultRecoveryRouteId + " route id is reserved")
 	}
 
-	o.routes[r.GetRouteId()] = r
+	if err := builderError(r); err != nil {
+		return err
+	}
+
+	if version < 1 {
+		return errors.New(fmt.Sprintf("invalid version %d of route id %s", version, r.GetRouteId()))
+	}
+
+	if o.routes[r.GetRouteId()][version] != nil {
+		return errors.New(fmt.Sprintf("duplicate route id %s version %d", r.GetRouteId(), version))
+	}
+
+	// a route registered after the initialization is attached to the already defined routes
+	if o.initialized {
+		if err := o.defineEndpointCalls(r); err != nil {
+			return err
+		}
+	}
+
+	if o.routes[r.GetRouteId()] == nil {
+		o.routes[r.GetRouteId()] = make(map[int]Route)
+	}
+
+	o.routes[r.GetRouteId()][version] = r
 	return nil
 }
 
 // Initialization define recovery route and define transition between routes (HierarchicalRoute feature)
 func (o *orchestrator) Initialization(recoveryRoute Route) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
 	if err := o.defineRecoveryRoute(recoveryRoute); err != nil {
 		return err
 	}
 
-	return o.defineHierarchicalRouteTransitions()
+	if err := o.defineHierarchicalRouteTransitions(); err != nil {
+		return err
+	}
+
+	o.initialized = true
+	return nil
+}
+
+// Exec start the execution process from the latest version of the route id with a context and return the execution outcome
+func (o *orchestrator) Exec(from string, ctx *context) (*ExecutionResult, error) {
+	return o.ExecVersion(from, 0, ctx)
+}
+
+// ExecVersion start the execution process from a version of the route id, zero means the latest version
+func (o *orchestrator) ExecVersion(from string, version int, ctx *context) (*ExecutionResult, error) {
+	return o.exec(from, version, NormalPriority, ctx)
+}
+
+// prepare create the runner of a new execution and track it
+func (o *orchestrator) prepare(from string, version int, ctx *context) (*routeRunner, error) {
+	rh, err := o.newRunner(from, map[string]int{from: version})
+	if err != nil {
+		return nil, err
+	}
+
+	// the memento is read before the executions are locked, the caretaker may scan its whole journal
+	m, err := o.persistedMemento(ctx.gid)
+	if err != nil {
+		return nil, err
+	}
+
+	// a process stopped while the execution was running, it's resumed instead of started again
+	if m != nil && m.Status == Running && o.guarded() {
+		if rh, err = o.runnerFromMemento(m); err != nil {
+			return nil, err
+		}
+
+		rh.resumes = true
+		ctx = rh.rootContext()
+	}
+
+	if err := o.trackStart(rh, ctx, m); err != nil {
+		return nil, err
+	}
+
+	return rh, nil
 }
 
-// Exec start the execution process from the route id with a context
-func (o *orchestrator) Exec(from string, ctx *context, errCh chan error) {
-	if o.routes[from] == nil {
-		log.Fatalf("route %s not found", from)
+// Resume continue an interrupted execution from its latest memento on the route versions it started with
+func (o *orchestrator) Resume(gid string) (*ExecutionResult, error) {
+	rh, err := o.prepareFromMemento(gid, Running)
+	if err != nil {
+		return nil, err
+	}
+
+	return o.resumeRunner(rh)
+}
+
+func (o *orchestrator) loadMemento(gid string) (*memento, error) {
+	if o.caretaker == nil {
+		return nil, errors.New("caretaker is not defined")
+	}
+
+	if isTriggerId(gid) {
+		return nil, fmt.Errorf("execution %s: %w", gid, ErrExecutionNotFound)
+	}
+
+	data, err := o.caretaker.get(gid)
+	if err != nil {
+		return nil, err
 	}
 
-	o.ec = errCh
-	rh := newRouteRunner(o.routes[from].GetStartState(), o.routes[DefaultRecoveryRouteId].GetStartState())
+	if data == "" {
+		return nil, fmt.Errorf("execution %s: %w", gid, ErrExecutionNotFound)
+	}
 
-	rh.run(ctx, o.ec)
+	return unmarshalMemento(data)
 }
 
+// newRunner create a route runner on the pinned route versions, the other routes are taken on their latest version
+func (o *orchestrator) newRunner(from string, pinned map[string]int) (*routeRunner, error) {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+
+	routes := make(map[string]Route, len(o.routes))
+	versions := make(map[string]int, len(o.routes))
+	for id, rv := range o.routes {
+		v := pinned[id]
+		if v == 0 {
+			v = latestVersion(rv)
+		}
+
+		if rv[v] == nil {
+			return nil, errors.New(fmt.Sprintf("route %s version %d not found", id, v))
+		}
+
+		routes[id] = rv[v]
+		versions[id] = v
+	}
+
+	if routes[from] == nil {
+		return nil, errors.New(fmt.Sprintf("route %s not found", from))
+	}
+
+	var recoveryRootState *State
+	if rr := routes[DefaultRecoveryRouteId]; rr != nil {
+		recoveryRootState = rr.GetStartState()
+	}
+
+	rh := newRouteRunner(routes[from].GetStartState(), recoveryRootState, routes)
+	rh.routeId = from
+	rh.versions = versions
+	rh.caretaker = o.caretaker
+	rh.onWait = o.scheduleWakeUp
+	rh.clock = o.clock
+	rh.listener = o.listener
+	rh.faults = o.faults
+
+	return rh, nil
+}
+
+// defineHierarchicalRouteTransitions attach each endpoint to its state as a call, the endpoint route is called
+// after the state action and the caller route continues when it's finished
 func (o *orchestrator) defineHierarchicalRouteTransitions() error {
-	for _, s := range o.routes {
-		for _, e := range s.GetEndpoints() {
-			if o.routes[e.To] == nil {
-				return errors.New(fmt.Sprintf("route id %s not found", e.To))
+	for _, rv := range o.routes {
+		for _, r := range rv {
+			for _, e := range r.GetEndpoints() {
+				e.State.calls = nil
 			}
+		}
+	}
 
-			e.State.createTransition(o.routes[e.To].GetStartState(), Default,
-				func(ctx context) bool {
-					return true
-				})
-
-			if reflect.TypeOf(o.routes[e.To]) == reflect.TypeOf(&TransactionalRoute{}) {
-				o.routes[e.To].GetStartState().createTransition(e.State, Default,
-					func(ctx context) bool {
-						return ctx.GetVariable(transactionalRouteStatusHeaderKey) == transactionalRouteStatusRollback
-					})
+	for _, rv := range o.routes {
+		for _, r := range rv {
+			if err := o.defineEndpointCalls(r); err != nil {
+				return err
 			}
 		}
 	}
@@ -114,6 +318,28 @@ func (o *orchestrator) defineHierarchicalRouteTransitions() error {
 	return nil
 }
 
+func (o *orchestrator) defineEndpointCalls(r Route) error {
+	for _, e := range r.GetEndpoints() {
+		if o.routes[e.To] != nil {
+			continue
+		}
+
+		if !o.components.isComponentURI(e.To) {
+			return errors.New(fmt.Sprintf("route id %s not found", e.To))
+		}
+
+		if err := o.defineComponentRoute(e.To); err != nil {
+			return err
+		}
+	}
+
+	for _, e := range r.GetEndpoints() {
+		e.State.calls = append(e.State.calls, e)
+	}
+
+	return nil
+}
+
 // "RECOVERY_ROUTE" route id is reserved for recovery route
 func (o *orchestrator) defineRecoveryRoute(route Route) error {
 	r := route
@@ -126,10 +352,25 @@ func (o *orchestrator) defineRecoveryRoute(route Route) error {
 		return errors.New("recovery route id is not 'RECOVERY_ROUTE'")
 	}
 
-	o.routes[DefaultRecoveryRouteId] = r
+	if err := builderError(r); err != nil {
+		return err
+	}
+
+	o.routes[DefaultRecoveryRouteId] = map[int]Route{DefaultRouteVersion: r}
 	return nil
 }
 
 func (o *orchestrator) shutdown() error {
 	return nil
 }
+
+func latestVersion(rv map[int]Route) int {
+	latest := 0
+	for v := range rv {
+		if v > latest {
+			latest = v
+		}
+	}
+
+	return latest
+}
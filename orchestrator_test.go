@@ -60,9 +60,10 @@ func TestOrchestrator_Exec_HandoverBetweenRoutes(t *testing.T) {
 	_ = orch.Register(br)
 
 	_ = orch.Initialization(nil)
-	orch.Exec(aRoute, ctx, nil)
+	_, _ = orch.Exec(aRoute, ctx)
 
-	assert.Equal(t, 2, ctx.GetVariable("A"))
+	// B_ROUTE returns to A_ROUTE which continues with the step 2
+	assert.Equal(t, 3, ctx.GetVariable("A"))
 	assert.Equal(t, 1, ctx.GetVariable("B"))
 }
 
@@ -90,13 +91,6 @@ func TestOrchestrator_Exec_RollbackBetweenTransactionalRoute(t *testing.T) {
 		return nil
 	}
 
-	errChan := make(chan error)
-	go func() {
-		for err := range errChan {
-			assert.NotNil(t, err)
-		}
-	}()
-
 	orch := NewOrchestrator()
 	ar := NewTransactionalRoute(aRoute).AddNextStep("1", daa, uaa).To(bRoute)
 	br := NewTransactionalRoute(bRoute).AddNextStep("1", dab, uab)
@@ -106,5 +100,285 @@ func TestOrchestrator_Exec_RollbackBetweenTransactionalRoute(t *testing.T) {
 	_ = orch.Register(br)
 
 	_ = orch.Initialization(nil)
-	orch.Exec(aRoute, ctx, errChan)
+	result, err := orch.Exec(aRoute, ctx)
+
+	assert.Nil(t, err)
+	assert.Equal(t, RolledBack, result.Status)
+	assert.Len(t, result.Errors, 1)
+	assert.Equal(t, "B_ROUTE_1", result.Errors[0].State)
+	assert.NotNil(t, result.Err())
+}
+
+func TestOrchestrator_Exec_UnknownRoute(t *testing.T) {
+	orch := NewOrchestrator()
+	_ = orch.Initialization(nil)
+
+	ctx, _ := NewContext()
+	_, err := orch.Exec("UNKNOWN_ROUTE", ctx)
+
+	assert.NotNil(t, err)
+}
+
+func TestOrchestrator_Exec_CallAndReturn(t *testing.T) {
+	tests := []struct {
+		name   string
+		routes []Route
+		status ExecutionStatus
+		trace  []string
+	}{
+		{"return to the caller",
+			[]Route{
+				NewTransactionalRoute("A").
+					AddNextStep("1", traceDo("a1", false), traceUndo("a1", false)).To("B").
+					AddNextStep("2", traceDo("a2", false), traceUndo("a2", false)),
+				NewTransactionalRoute("B").
+					AddNextStep("1", traceDo("b1", false), traceUndo("b1", false)).
+					AddNextStep("2", traceDo("b2", false), traceUndo("b2", false)),
+			},
+			Completed, []string{"do_a1", "do_b1", "do_b2", "do_a2"}},
+		{"calls in order",
+			[]Route{
+				NewNonTransactionalRoute("A").
+					AddNextStep("1", traceDo("a1", false)).To("B").To("C").
+					AddNextStep("2", traceDo("a2", false)),
+				NewNonTransactionalRoute("B").AddNextStep("1", traceDo("b1", false)),
+				NewNonTransactionalRoute("C").AddNextStep("1", traceDo("c1", false)).To("B"),
+			},
+			Completed, []string{"do_a1", "do_b1", "do_c1", "do_b1", "do_a2"}},
+		{"caller rollback compensates the called route",
+			[]Route{
+				NewTransactionalRoute("A").
+					AddNextStep("1", traceDo("a1", false), traceUndo("a1", false)).To("B").
+					AddNextStep("2", traceDo("a2", true), traceUndo("a2", false)),
+				NewTransactionalRoute("B").
+					AddNextStep("1", traceDo("b1", false), traceUndo("b1", false)).
+					AddNextStep("2", traceDo("b2", false), traceUndo("b2", false)),
+			},
+			RolledBack, []string{"do_a1", "do_b1", "do_b2", "do_a2", "undo_b2", "undo_b1", "undo_a1"}},
+		{"called route rollback returns to the caller",
+			[]Route{
+				NewTransactionalRoute("A").
+					AddNextStep("1", traceDo("a1", false), traceUndo("a1", false)).To("B").
+					AddNextStep("2", traceDo("a2", false), traceUndo("a2", false)),
+				NewTransactionalRoute("B").
+					AddNextStep("1", traceDo("b1", false), traceUndo("b1", false)).
+					AddNextStep("2", traceDo("b2", true), traceUndo("b2", false)),
+			},
+			RolledBack, []string{"do_a1", "do_b1", "do_b2", "undo_b1", "undo_a1"}},
+		{"non transactional called route is not compensated",
+			[]Route{
+				NewTransactionalRoute("A").
+					AddNextStep("1", traceDo("a1", false), traceUndo("a1", false)).To("B").
+					AddNextStep("2", traceDo("a2", true), traceUndo("a2", false)),
+				NewNonTransactionalRoute("B").AddNextStep("1", traceDo("b1", false)),
+			},
+			RolledBack, []string{"do_a1", "do_b1", "do_a2", "undo_a1"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			orch := NewOrchestrator()
+			for _, r := range tc.routes {
+				assert.Nil(t, orch.Register(r))
+			}
+			assert.Nil(t, orch.Initialization(nil))
+
+			ctx, _ := NewContext()
+			result, err := orch.Exec("A", ctx)
+
+			assert.Nil(t, err)
+			assert.Equal(t, tc.status, result.Status)
+			assert.Equal(t, tc.trace, ctx.GetVariable(traceKey))
+		})
+	}
+}
+
+func TestOrchestrator_Exec_IsolatedCall(t *testing.T) {
+	orch := NewOrchestrator()
+	ar := NewNonTransactionalRoute("A").
+		AddNextStep("1", func(ctx *context) error {
+			return ctx.SetVariable("amount", 10)
+		}).
+		ToIsolated("DOUBLE", map[string]string{"in": "amount"}, map[string]string{"doubled": "out"}).
+		AddNextStep("2", func(ctx *context) error {
+			return ctx.SetVariable("total", ctx.GetVariable("doubled").(int)+1)
+		})
+
+	dr := NewNonTransactionalRoute("DOUBLE").
+		AddNextStep("1", func(ctx *context) error {
+			if ctx.GetVariable("amount") != nil {
+				return errors.New("caller variable is visible")
+			}
+
+			ctx.SetVariable("tmp", ctx.GetVariable("in").(int)*2)
+			return ctx.SetVariable("out", ctx.GetVariable("tmp"))
+		})
+
+	_ = orch.Register(ar)
+	_ = orch.Register(dr)
+	_ = orch.Initialization(nil)
+
+	ctx, _ := NewContext()
+	result, _ := orch.Exec("A", ctx)
+
+	assert.Nil(t, result.Err())
+	assert.Equal(t, 20, ctx.GetVariable("doubled"))
+	assert.Equal(t, 21, ctx.GetVariable("total"))
+	assert.Nil(t, ctx.GetVariable("tmp"))
+	assert.Nil(t, ctx.GetVariable("out"))
+}
+
+func TestOrchestrator_Exec_IsolatedCallRollback(t *testing.T) {
+	orch := NewOrchestrator()
+	ar := NewTransactionalRoute("A").
+		AddNextStep("1", traceDo("a1", false), traceUndo("a1", false)).
+		ToIsolated("B", nil, nil).
+		AddNextStep("2", traceDo("a2", true), traceUndo("a2", false))
+
+	var calleeTrace interface{}
+	br := NewTransactionalRoute("B").
+		AddNextStep("1", traceDo("b1", false), func(ctx context) error {
+			trace(&ctx, "undo_b1")
+			calleeTrace = ctx.GetVariable(traceKey)
+			return nil
+		})
+
+	_ = orch.Register(ar)
+	_ = orch.Register(br)
+	_ = orch.Initialization(nil)
+
+	ctx, _ := NewContext()
+	result, _ := orch.Exec("A", ctx)
+
+	assert.Equal(t, RolledBack, result.Status)
+	assert.Equal(t, []string{"do_a1", "do_a2", "undo_a1"}, ctx.GetVariable(traceKey))
+	assert.Equal(t, []string{"do_b1", "undo_b1"}, calleeTrace)
+}
+
+func appendStep(name string) func(ctx *context) error {
+	return func(ctx *context) error {
+		steps, _ := ctx.GetVariable("STEPS").(string)
+		return ctx.SetVariable("STEPS", steps+name+";")
+	}
+}
+
+func TestOrchestrator_RegisterVersion(t *testing.T) {
+	orch := NewOrchestrator()
+	assert.Nil(t, orch.Register(NewNonTransactionalRoute("A").AddNextStep("1", appendStep("v1"))))
+	assert.Nil(t, orch.RegisterVersion(NewNonTransactionalRoute("A").AddNextStep("1", appendStep("v2")), 2))
+	assert.NotNil(t, orch.RegisterVersion(NewNonTransactionalRoute("A").AddNextStep("1", appendStep("v2")), 2))
+	assert.NotNil(t, orch.RegisterVersion(NewNonTransactionalRoute("A").AddNextStep("1", appendStep("v0")), 0))
+	assert.Nil(t, orch.Initialization(nil))
+
+	// a version registered after the initialization is validated and callable
+	assert.NotNil(t, orch.RegisterVersion(NewNonTransactionalRoute("A").AddNextStep("1", appendStep("v3")).To("UNKNOWN"), 3))
+	assert.Nil(t, orch.Register(NewNonTransactionalRoute("B").AddNextStep("1", appendStep("b"))))
+	assert.Nil(t, orch.RegisterVersion(NewNonTransactionalRoute("A").AddNextStep("1", appendStep("v3")).To("B"), 3))
+
+	latest, _ := NewContext()
+	_, _ = orch.Exec("A", latest)
+	assert.Equal(t, "v3;b;", latest.GetVariable("STEPS"))
+
+	pinned, _ := NewContext()
+	_, _ = orch.ExecVersion("A", 2, pinned)
+	assert.Equal(t, "v2;", pinned.GetVariable("STEPS"))
+
+	_, err := orch.ExecVersion("A", 4, pinned)
+	assert.NotNil(t, err)
+}
+
+func TestOrchestrator_Resume(t *testing.T) {
+	journal := NewMemoryCaretaker()
+
+	orch := NewOrchestrator()
+	orch.SetCaretaker(journal)
+	_ = orch.Register(NewTransactionalRoute("A").
+		AddNextStep("1", appendStep("1"), undoActionTest).To("B").
+		AddNextStep("2", appendStep("2"), undoActionTest))
+	_ = orch.Register(NewTransactionalRoute("B").
+		AddNextStep("1", appendStep("b1"), undoActionTest).
+		AddNextStep("2", appendStep("b2"), undoActionTest))
+	_ = orch.Initialization(nil)
+
+	ctx, _ := NewContextWithGid("resumed")
+	result, _ := orch.Exec("A", ctx)
+	assert.Equal(t, Completed, result.Status)
+
+	final, _ := unmarshalMemento(journal.journal["resumed"][len(journal.journal["resumed"])-1])
+	assert.Equal(t, Completed, final.Status)
+	assert.Equal(t, 1, final.Version)
+
+	// the process stopped after the checkpoint of B_2
+	crashed := NewMemoryCaretaker()
+	for _, data := range journal.journal["resumed"] {
+		_ = crashed.persist("resumed", data)
+		if m, _ := unmarshalMemento(data); m.State == "B_2" {
+			assert.Equal(t, Running, m.Status)
+			assert.Len(t, m.Stack, 1)
+			break
+		}
+	}
+
+	// a new version doesn't change the resumed execution
+	orch.SetCaretaker(crashed)
+	_ = orch.RegisterVersion(NewTransactionalRoute("A").AddNextStep("1", appendStep("v2"), undoActionTest), 2)
+
+	resumed, err := orch.Resume("resumed")
+	assert.Nil(t, err)
+	assert.Equal(t, Completed, resumed.Status)
+	assert.Equal(t, "A_2", resumed.State)
+
+	final, _ = unmarshalMemento(crashed.journal["resumed"][len(crashed.journal["resumed"])-1])
+	assert.Equal(t, 1, final.Version)
+	assert.Equal(t, "1;b1;b2;2;", final.Contexts[final.Context].Variables["STEPS"].Value)
+
+	_, err = orch.Resume("resumed")
+	assert.NotNil(t, err)
+}
+
+func TestOrchestrator_ResumeNumberTypes(t *testing.T) {
+	journal := NewMemoryCaretaker()
+	var count interface{}
+	route := NewNonTransactionalRoute("A").
+		AddNextStep("1", func(ctx *context) error {
+			_ = ctx.SetVariable("count", 2)
+			_ = ctx.SetVariable("big", int64(1<<60+1))
+			_ = ctx.SetVariable("ratio", float32(0.5))
+			return ctx.SetVariable("amount", 1.5)
+		}).
+		AddNextStep("2", func(ctx *context) error {
+			count = ctx.GetVariable("count")
+			return ctx.SetVariable("count", ctx.GetVariable("count").(int)+1)
+		})
+
+	orch := NewOrchestrator()
+	orch.SetCaretaker(journal)
+	_ = orch.Register(route)
+	_ = orch.Initialization(nil)
+
+	ctx, _ := NewContextWithGid("gid")
+	_, _ = orch.Exec("A", ctx)
+
+	// the process stopped after the checkpoint of A_2
+	crashed := NewMemoryCaretaker()
+	for _, data := range journal.journal["gid"] {
+		_ = crashed.persist("gid", data)
+		if m, _ := unmarshalMemento(data); m.State == "A_2" {
+			break
+		}
+	}
+
+	orch.SetCaretaker(crashed)
+	result, err := orch.Resume("gid")
+	assert.Nil(t, err)
+	assert.Equal(t, Completed, result.Status)
+	assert.Equal(t, 2, count)
+
+	final, _ := orch.loadMemento("gid")
+	assert.Equal(t, map[string]interface{}{
+		"count":  3,
+		"big":    int64(1<<60 + 1),
+		"ratio":  float32(0.5),
+		"amount": 1.5,
+	}, final.Contexts[0].values())
 }
@@ -0,0 +1,87 @@
+// Package orchestratortest help the route authors test their routes: mock steps with scripted attempts, a fake
+// clock, a recorder of the execution lifecycle events and the assertions on them
+package orchestratortest
+
+import (
+	"sync"
+	"time"
+)
+
+// FakeClock is a clock which only moves when it's advanced, the retry intervals and backoffs waiting on it
+// advance it at once and the step timeouts expire once it's moved beyond them
+type FakeClock struct {
+	lock   sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	deadline time.Time
+	c        chan time.Time
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.now
+}
+
+func (c *FakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.now = c.now.Add(d)
+	c.expire()
+}
+
+// After return a channel receiving the time once the clock is moved beyond the duration
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	t := &fakeTimer{deadline: c.now.Add(d), c: make(chan time.Time, 1)}
+	c.timers = append(c.timers, t)
+	c.expire()
+
+	return t.c
+}
+
+// Sleep advance the clock instead of waiting, the duration is recorded
+func (c *FakeClock) Sleep(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.sleeps = append(c.sleeps, d)
+	c.now = c.now.Add(d)
+	c.expire()
+}
+
+// Sleeps return the recorded sleeps in order
+func (c *FakeClock) Sleeps() []time.Duration {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return append([]time.Duration(nil), c.sleeps...)
+}
+
+// expire send the time to the timers which deadline is passed
+func (c *FakeClock) expire() {
+	n := 0
+	for _, t := range c.timers {
+		if t.deadline.After(c.now) {
+			c.timers[n] = t
+			n++
+			continue
+		}
+
+		t.c <- c.now
+	}
+
+	c.timers = c.timers[:n]
+}
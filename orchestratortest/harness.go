@@ -0,0 +1,139 @@
+package orchestratortest
+
+import (
+	"github.com/farmx/orchestrator"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// Epoch is the time the fake clock of a harness starts at
+var Epoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Harness run the routes of a test on an orchestrator with a memory caretaker, a fake clock and a recorder of the
+// lifecycle events, its methods fail the test on an unexpected error
+type Harness struct {
+	T            testing.TB
+	Orchestrator *orchestrator.Orchestrator
+	Clock        *FakeClock
+	Recorder     *Recorder
+}
+
+// New register and initialize the routes, the default recovery route is used
+func New(t testing.TB, routes ...orchestrator.Route) *Harness {
+	t.Helper()
+
+	h := &Harness{
+		T:            t,
+		Orchestrator: orchestrator.NewOrchestrator(),
+		Clock:        NewFakeClock(Epoch),
+		Recorder:     NewRecorder(),
+	}
+
+	h.Orchestrator.SetCaretaker(orchestrator.NewMemoryCaretaker())
+	h.Orchestrator.SetClock(h.Clock)
+	h.Orchestrator.SetListener(h.Recorder.Listen)
+
+	for _, r := range routes {
+		if err := h.Orchestrator.Register(r); err != nil {
+			t.Fatalf("register route %s: %v", r.GetRouteId(), err)
+		}
+	}
+
+	if err := h.Orchestrator.Initialization(nil); err != nil {
+		t.Fatalf("initialization: %v", err)
+	}
+
+	return h
+}
+
+// Exec run the route on a new context with the variables and return the outcome and the final context
+func (h *Harness) Exec(routeId string, variables map[string]interface{}) (*orchestrator.ExecutionResult,
+	*orchestrator.Context) {
+	h.T.Helper()
+
+	ctx, err := orchestrator.NewContext()
+	if err != nil {
+		h.T.Fatalf("new context: %v", err)
+	}
+
+	for k, v := range variables {
+		if err := ctx.SetVariable(k, v); err != nil {
+			h.T.Fatalf("set variable %s: %v", k, err)
+		}
+	}
+
+	result, err := h.Orchestrator.Exec(routeId, ctx)
+	if err != nil {
+		h.T.Fatalf("exec route %s: %v", routeId, err)
+	}
+
+	return result, ctx
+}
+
+// Signal deliver the signal to the waiting execution and return its outcome
+func (h *Harness) Signal(gid string, name string, payload map[string]interface{}) *orchestrator.ExecutionResult {
+	h.T.Helper()
+
+	result, err := h.Orchestrator.Signal(gid, name, payload)
+	if err != nil {
+		h.T.Fatalf("signal %s to %s: %v", name, gid, err)
+	}
+
+	return result
+}
+
+// Advance move the fake clock and resume the waiting executions which deadline is passed
+func (h *Harness) Advance(d time.Duration) []*orchestrator.ExecutionResult {
+	h.T.Helper()
+
+	h.Clock.Advance(d)
+	results, err := h.Orchestrator.ResumeDue()
+	if err != nil {
+		h.T.Fatalf("resume due executions: %v", err)
+	}
+
+	return results
+}
+
+// AssertStates check the sequence of states the execution entered, the undone states included
+func (h *Harness) AssertStates(gid string, states ...string) bool {
+	h.T.Helper()
+	return assert.Equal(h.T, states, h.Recorder.States(gid), "visited states of %s", gid)
+}
+
+// AssertRollback check the order the states of the execution were undone in
+func (h *Harness) AssertRollback(gid string, states ...string) bool {
+	h.T.Helper()
+	return assert.Equal(h.T, states, h.Recorder.Rollback(gid), "rollback order of %s", gid)
+}
+
+// AssertEvents check the sequence of lifecycle event types of the execution
+func (h *Harness) AssertEvents(gid string, types ...orchestrator.EventType) bool {
+	h.T.Helper()
+	return assert.Equal(h.T, types, h.Recorder.Types(gid), "lifecycle events of %s", gid)
+}
+
+// AssertCalls check the number of attempts of the step action
+func (h *Harness) AssertCalls(s *Step, calls int) bool {
+	h.T.Helper()
+	return assert.Equal(h.T, calls, s.Calls(), "attempts of %s", s.Name())
+}
+
+// AssertUndoCalls check the number of calls of the step undo action
+func (h *Harness) AssertUndoCalls(s *Step, calls int) bool {
+	h.T.Helper()
+	return assert.Equal(h.T, calls, s.UndoCalls(), "undo calls of %s", s.Name())
+}
+
+// AssertContext check the variables of the final context, the other variables are ignored
+func (h *Harness) AssertContext(ctx *orchestrator.Context, variables map[string]interface{}) bool {
+	h.T.Helper()
+
+	ok := true
+	for k, v := range variables {
+		ok = assert.Equal(h.T, v, ctx.GetVariable(k), "context variable %s", k) && ok
+	}
+
+	return ok
+}
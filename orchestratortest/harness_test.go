@@ -0,0 +1,127 @@
+package orchestratortest
+
+import (
+	"errors"
+	"github.com/farmx/orchestrator"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHarness_Rollback(t *testing.T) {
+	reserve := NewStep("reserve").Set("reserved", true)
+	charge := NewStep("charge").FailTimes(2, errors.New("unavailable")).Set("charged", true)
+	ship := NewStep("ship").Fail(errors.New("no carrier"))
+
+	h := New(t, orchestrator.NewTransactionalRoute("order").
+		AddNextStep("reserve", reserve.Action(), reserve.Undo()).
+		AddNextStep("charge", charge.Action(), charge.Undo()).
+		Retry(orchestrator.RetryPolicy{MaxAttempts: 3, Interval: time.Second}).
+		AddNextStep("ship", ship.Action(), ship.Undo()))
+
+	result, ctx := h.Exec("order", nil)
+	assert.Equal(t, orchestrator.RolledBack, result.Status)
+
+	h.AssertStates(result.Gid, "order_reserve", "order_charge", "order_ship", "order_charge", "order_reserve")
+	h.AssertRollback(result.Gid, "order_charge", "order_reserve")
+	h.AssertEvents(result.Gid, orchestrator.EventStarted, orchestrator.EventStateEntered,
+		orchestrator.EventStateEntered, orchestrator.EventStateEntered, orchestrator.EventStepFailed,
+		orchestrator.EventStateEntered, orchestrator.EventStateEntered, orchestrator.EventFinished)
+	h.AssertCalls(charge, 3)
+	h.AssertUndoCalls(charge, 1)
+	h.AssertUndoCalls(reserve, 1)
+	h.AssertUndoCalls(ship, 0)
+	h.AssertContext(ctx, map[string]interface{}{"reserved": true, "charged": true})
+
+	// the retry intervals are waited on the fake clock
+	assert.Equal(t, []time.Duration{time.Second, time.Second}, h.Clock.Sleeps())
+	assert.Equal(t, Epoch.Add(2*time.Second), h.Clock.Now())
+
+	failures := h.Recorder.Failures(result.Gid)
+	assert.Len(t, failures, 1)
+	assert.Equal(t, orchestrator.Rollback, failures[0].Decision)
+}
+
+func TestHarness_Timeout(t *testing.T) {
+	approve := NewStep("approve").Timeout()
+
+	h := New(t, orchestrator.NewNonTransactionalRoute("A").
+		WaitForSignal("approval", time.Hour).ContinueOnTimeout().
+		AddNextStep("approve", approve.Action()))
+
+	result, _ := h.Exec("A", nil)
+	assert.Equal(t, orchestrator.Waiting, result.Status)
+	assert.Empty(t, h.Advance(59*time.Minute))
+
+	results := h.Advance(time.Minute)
+	assert.Len(t, results, 1)
+	assert.Equal(t, orchestrator.Aborted, results[0].Status)
+	assert.True(t, errors.Is(results[0].Errors[0], orchestrator.ErrStepTimeout))
+
+	// the waiting state is entered again to take its timeout
+	h.AssertStates(result.Gid, "A_approval", "A_approval", "A_approve")
+	h.AssertEvents(result.Gid, orchestrator.EventStarted, orchestrator.EventStateEntered, orchestrator.EventWaiting,
+		orchestrator.EventResumed, orchestrator.EventStateEntered, orchestrator.EventStateEntered,
+		orchestrator.EventStepFailed, orchestrator.EventFinished)
+}
+
+func TestHarness_StepTimeout(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	h := New(t, orchestrator.NewNonTransactionalRoute("A").
+		AddNextStep("slow", func(ctx *orchestrator.Context) error {
+			close(started)
+			<-release
+			return nil
+		}).Timeout(time.Minute))
+
+	ctx, _ := orchestrator.NewContext()
+	results := make(chan *orchestrator.ExecutionResult, 1)
+	go func() {
+		result, _ := h.Orchestrator.Exec("A", ctx)
+		results <- result
+	}()
+
+	// the step timeout is timed on the fake clock
+	<-started
+	h.Clock.Advance(59 * time.Second)
+	select {
+	case <-results:
+		t.Fatal("step timed out before its timeout")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	h.Clock.Advance(time.Second)
+	result := <-results
+	assert.Equal(t, orchestrator.Aborted, result.Status)
+	assert.True(t, errors.Is(result.Errors[0], orchestrator.ErrStepTimeout))
+}
+
+func TestFakeClock_Backoff(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	clock := NewFakeClock(Epoch)
+	action, err := orchestrator.NewHTTPStep(orchestrator.HTTPCall{
+		Method:  http.MethodGet,
+		URL:     server.URL,
+		Backoff: &orchestrator.ExponentialBackoff{Initial: time.Minute, Max: time.Hour},
+		Clock:   clock,
+	})
+	assert.Nil(t, err)
+
+	h := New(t, orchestrator.NewNonTransactionalRoute("A").AddNextStep("call", action))
+	result, _ := h.Exec("A", nil)
+	assert.Equal(t, orchestrator.Completed, result.Status)
+	assert.Equal(t, []time.Duration{time.Minute, 2 * time.Minute}, clock.Sleeps())
+}
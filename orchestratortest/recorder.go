@@ -0,0 +1,89 @@
+package orchestratortest
+
+import (
+	"github.com/farmx/orchestrator"
+	"sync"
+)
+
+// Recorder capture the lifecycle events of the executions, Listen is the listener to set on the orchestrator
+type Recorder struct {
+	lock   sync.Mutex
+	events []*orchestrator.ExecutionEvent
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+func (r *Recorder) Listen(e *orchestrator.ExecutionEvent) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.events = append(r.events, e)
+}
+
+// Events return the recorded events of the execution in order, an empty gid means all of them
+func (r *Recorder) Events(gid string) []*orchestrator.ExecutionEvent {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var result []*orchestrator.ExecutionEvent
+	for _, e := range r.events {
+		if gid == "" || e.Gid == gid {
+			result = append(result, e)
+		}
+	}
+
+	return result
+}
+
+// Types return the recorded event types of the execution in order
+func (r *Recorder) Types(gid string) []orchestrator.EventType {
+	var result []orchestrator.EventType
+	for _, e := range r.Events(gid) {
+		result = append(result, e.Type)
+	}
+
+	return result
+}
+
+// States return the states the execution entered in order, the undone states included
+func (r *Recorder) States(gid string) []string {
+	return r.states(gid, func(e *orchestrator.ExecutionEvent) bool { return true })
+}
+
+// Rollback return the states the execution entered to undo them in order
+func (r *Recorder) Rollback(gid string) []string {
+	return r.states(gid, func(e *orchestrator.ExecutionEvent) bool { return e.RollingBack })
+}
+
+// Failures return the step failures of the execution in order
+func (r *Recorder) Failures(gid string) []*orchestrator.StepError {
+	var result []*orchestrator.StepError
+	for _, e := range r.Events(gid) {
+		if e.Type == orchestrator.EventStepFailed {
+			result = append(result, e.Err)
+		}
+	}
+
+	return result
+}
+
+// Reset drop the recorded events
+func (r *Recorder) Reset() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.events = nil
+}
+
+func (r *Recorder) states(gid string, include func(e *orchestrator.ExecutionEvent) bool) []string {
+	var result []string
+	for _, e := range r.Events(gid) {
+		if e.Type == orchestrator.EventStateEntered && include(e) {
+			result = append(result, e.State)
+		}
+	}
+
+	return result
+}
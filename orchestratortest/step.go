@@ -0,0 +1,159 @@
+package orchestratortest
+
+import (
+	"fmt"
+	"github.com/farmx/orchestrator"
+	"sync"
+)
+
+type (
+	// Attempt is the scripted outcome of a step attempt
+	Attempt struct {
+		Err error
+
+		// Variables set on the context by a successful attempt
+		Variables map[string]interface{}
+	}
+
+	// Step is a mock step, each attempt of its action takes the next scripted outcome and the attempts beyond
+	// the script succeed. The undo action is scripted the same way
+	Step struct {
+		lock sync.Mutex
+		name string
+
+		attempts []Attempt
+		undos    []error
+		set      map[string]interface{}
+
+		calls     int
+		undoCalls int
+	}
+)
+
+func NewStep(name string) *Step {
+	return &Step{
+		name: name,
+		set:  make(map[string]interface{}),
+	}
+}
+
+func (s *Step) Name() string {
+	return s.name
+}
+
+// Succeed script a successful attempt
+func (s *Step) Succeed() *Step {
+	return s.Then(Attempt{})
+}
+
+// Fail script a failed attempt
+func (s *Step) Fail(err error) *Step {
+	return s.Then(Attempt{Err: err})
+}
+
+// FailTimes script n failed attempts
+func (s *Step) FailTimes(n int, err error) *Step {
+	for i := 0; i < n; i++ {
+		s.Fail(err)
+	}
+
+	return s
+}
+
+// Timeout script an attempt failed on the step timeout without waiting for it
+func (s *Step) Timeout() *Step {
+	return s.Then(Attempt{Err: fmt.Errorf("state %s: %w", s.name, orchestrator.ErrStepTimeout)})
+}
+
+// Then script the next attempt
+func (s *Step) Then(a Attempt) *Step {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.attempts = append(s.attempts, a)
+	return s
+}
+
+// Set a context variable on each successful attempt
+func (s *Step) Set(key string, value interface{}) *Step {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.set[key] = value
+	return s
+}
+
+// FailUndo script a failed undo call, the calls beyond the script succeed
+func (s *Step) FailUndo(err error) *Step {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.undos = append(s.undos, err)
+	return s
+}
+
+// Action return the step action to add to a route
+func (s *Step) Action() func(ctx *orchestrator.Context) error {
+	return func(ctx *orchestrator.Context) error {
+		s.lock.Lock()
+		a := Attempt{}
+		if s.calls < len(s.attempts) {
+			a = s.attempts[s.calls]
+		}
+		s.calls++
+
+		variables := make(map[string]interface{}, len(s.set)+len(a.Variables))
+		for k, v := range s.set {
+			variables[k] = v
+		}
+		s.lock.Unlock()
+
+		if a.Err != nil {
+			return a.Err
+		}
+
+		for k, v := range a.Variables {
+			variables[k] = v
+		}
+
+		for k, v := range variables {
+			if err := ctx.SetVariable(k, v); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// Undo return the step undo action to add to a transactional route
+func (s *Step) Undo() func(ctx orchestrator.Context) error {
+	return func(ctx orchestrator.Context) error {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+
+		var err error
+		if s.undoCalls < len(s.undos) {
+			err = s.undos[s.undoCalls]
+		}
+		s.undoCalls++
+
+		return err
+	}
+}
+
+// Calls return the number of attempts of the action
+func (s *Step) Calls() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.calls
+}
+
+// UndoCalls return the number of calls of the undo action
+func (s *Step) UndoCalls() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.undoCalls
+}
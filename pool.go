@@ -0,0 +1,464 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type (
+	// Priority lane of an execution in the worker pool queue, the higher lanes are taken first
+	Priority int
+
+	// AdmissionPolicy tell what to do with an execution submitted while the pool queue is full
+	AdmissionPolicy string
+
+	// PoolConfig of the orchestrator worker pool
+	PoolConfig struct {
+		// Workers run the executions, it's the maximum number of concurrent executions
+		Workers int
+
+		// QueueSize maximum number of executions waiting for a worker
+		QueueSize int
+
+		// Policy default is BlockWhenFull
+		Policy AdmissionPolicy
+
+		// BlockTimeout reject a blocked submission after the timeout, zero means it blocks until it's admitted
+		BlockTimeout time.Duration
+
+		// RouteLimits maximum number of concurrent executions by route id, the executions of a route at its
+		// limit wait in the queue while the other routes go on
+		RouteLimits map[string]int
+
+		// Clock times the block timeout and the queue waits, default is the orchestrator clock
+		Clock Clock
+	}
+
+	// PoolStats is the state of the worker pool
+	PoolStats struct {
+		Workers   int `json:"workers"`
+		Busy      int `json:"busy"`
+		QueueSize int `json:"queue_size"`
+
+		// Queued executions waiting for a worker, by priority lane as well
+		Queued           int            `json:"queued"`
+		QueuedByPriority map[string]int `json:"queued_by_priority"`
+
+		// Running executions by route id
+		Running map[string]int `json:"running"`
+
+		Submitted int64 `json:"submitted"`
+		Rejected  int64 `json:"rejected"`
+		Completed int64 `json:"completed"`
+
+		// AverageWait and MaxWait time spent in the queue by the started executions
+		AverageWait time.Duration `json:"average_wait"`
+		MaxWait     time.Duration `json:"max_wait"`
+	}
+
+	workerPool struct {
+		config PoolConfig
+
+		lock sync.Mutex
+
+		// work wake up the workers when an execution is queued or a route slot is released
+		work *sync.Cond
+
+		// notFull wake up the blocked submissions when the queue shrinks
+		notFull *sync.Cond
+
+		// lanes queued jobs by priority
+		lanes  [HighPriority + 1][]*poolJob
+		queued int
+
+		busy    int
+		running map[string]int
+		stopped bool
+
+		submitted int64
+		rejected  int64
+		completed int64
+		totalWait time.Duration
+		maxWait   time.Duration
+
+		workers sync.WaitGroup
+	}
+
+	poolJob struct {
+		routeId  string
+		run      func()
+		enqueued time.Time
+	}
+)
+
+const (
+	LowPriority Priority = iota
+	NormalPriority
+	HighPriority
+)
+
+const (
+	// BlockWhenFull block the submission until the queue has room
+	BlockWhenFull AdmissionPolicy = "BLOCK"
+	// RejectWhenFull fail the submission with ErrPoolFull
+	RejectWhenFull AdmissionPolicy = "REJECT"
+)
+
+// ErrPoolFull is returned when an execution isn't admitted in the worker pool queue
+var ErrPoolFull = errors.New("worker pool is full")
+
+func (p Priority) String() string {
+	switch p {
+	case LowPriority:
+		return "LOW"
+	case NormalPriority:
+		return "NORMAL"
+	case HighPriority:
+		return "HIGH"
+	}
+
+	return fmt.Sprintf("PRIORITY(%d)", int(p))
+}
+
+// StartPool run the executions started by Exec and the resumed ones on a bounded worker pool, the executions are
+// run in the caller goroutine without pool. A step must not wait for another execution with Exec on the same
+// orchestrator: it holds its worker while the other one waits for a free worker, and the pool deadlocks once every
+// worker does it; call the route with To instead
+func (o *orchestrator) StartPool(config PoolConfig) error {
+	if config.Workers <= 0 {
+		return errors.New("pool workers must be positive")
+	}
+
+	if config.QueueSize <= 0 {
+		return errors.New("pool queue size must be positive")
+	}
+
+	switch config.Policy {
+	case "":
+		config.Policy = BlockWhenFull
+	case BlockWhenFull, RejectWhenFull:
+	default:
+		return errors.New(fmt.Sprintf("unknown admission policy %s", config.Policy))
+	}
+
+	for id, limit := range config.RouteLimits {
+		if limit <= 0 {
+			return errors.New(fmt.Sprintf("route %s limit must be positive", id))
+		}
+	}
+
+	if config.Clock == nil {
+		config.Clock = o.clock
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.pool != nil {
+		return errors.New("pool is already started")
+	}
+
+	o.pool = newWorkerPool(config)
+	return nil
+}
+
+// StopPool stop admitting executions and wait for the queued and running ones, the next executions are run in
+// the caller goroutine
+func (o *orchestrator) StopPool() {
+	o.lock.Lock()
+	p := o.pool
+	o.pool = nil
+	o.lock.Unlock()
+
+	if p != nil {
+		p.stop()
+	}
+}
+
+// PoolStats return the worker pool state, false when the pool isn't started
+func (o *orchestrator) PoolStats() (*PoolStats, bool) {
+	p := o.workerPool()
+	if p == nil {
+		return nil, false
+	}
+
+	return p.stats(), true
+}
+
+// ExecWithPriority start the execution of the latest version of the route id in the priority lane of the worker pool
+func (o *orchestrator) ExecWithPriority(from string, priority Priority, ctx *context) (*ExecutionResult, error) {
+	return o.exec(from, 0, priority, ctx)
+}
+
+func (o *orchestrator) exec(from string, version int, priority Priority, ctx *context) (*ExecutionResult, error) {
+	if priority < LowPriority || priority > HighPriority {
+		return nil, errors.New(fmt.Sprintf("unknown priority %d", int(priority)))
+	}
+
+	rh, err := o.prepare(from, version, ctx)
+	if de := (*DuplicateError)(nil); errors.As(err, &de) {
+		return de.Result, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if o.workerPool() == nil {
+		return rh.start(ctx), nil
+	}
+
+	done, err := o.submit(rh, ctx, priority)
+	if err != nil {
+		return nil, err
+	}
+
+	return <-done, nil
+}
+
+// submit run the prepared execution on the worker pool, or in its own goroutine without pool. The execution is
+// forgotten when it's not admitted
+func (o *orchestrator) submit(rh *routeRunner, ctx *context, priority Priority) (<-chan *ExecutionResult, error) {
+	return o.schedule(rh, priority, func() *ExecutionResult {
+		return rh.start(ctx)
+	})
+}
+
+// submitResume run the restored execution on the worker pool like a new one, so the workers and the route limits
+// apply to the resumed executions as well
+func (o *orchestrator) submitResume(rr *routeRunner) (<-chan *ExecutionResult, error) {
+	return o.schedule(rr, NormalPriority, rr.resume)
+}
+
+// resumeRunner resume the restored execution and wait for its outcome, it runs in the caller goroutine without pool
+func (o *orchestrator) resumeRunner(rr *routeRunner) (*ExecutionResult, error) {
+	if o.workerPool() == nil {
+		return rr.resume(), nil
+	}
+
+	done, err := o.submitResume(rr)
+	if err != nil {
+		return nil, err
+	}
+
+	return <-done, nil
+}
+
+func (o *orchestrator) schedule(rh *routeRunner, priority Priority, execute func() *ExecutionResult) (<-chan *ExecutionResult, error) {
+	done := make(chan *ExecutionResult, 1)
+	run := func() {
+		done <- execute()
+	}
+
+	p := o.workerPool()
+	if p == nil {
+		go run()
+		return done, nil
+	}
+
+	if err := p.submit(&poolJob{routeId: rh.routeId, run: run}, priority); err != nil {
+		o.untrack(rh.execution)
+		return nil, fmt.Errorf("execution %s: %w", rh.execution.gid, err)
+	}
+
+	return done, nil
+}
+
+func (o *orchestrator) workerPool() *workerPool {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+
+	return o.pool
+}
+
+// untrack forget a tracked execution which didn't start
+func (o *orchestrator) untrack(e *execution) {
+	o.executionsLock.Lock()
+	defer o.executionsLock.Unlock()
+
+	if o.executions[e.gid] == e {
+		delete(o.executions, e.gid)
+	}
+}
+
+func newWorkerPool(config PoolConfig) *workerPool {
+	p := &workerPool{
+		config:  config,
+		running: make(map[string]int),
+	}
+
+	p.work = sync.NewCond(&p.lock)
+	p.notFull = sync.NewCond(&p.lock)
+
+	p.workers.Add(config.Workers)
+	for i := 0; i < config.Workers; i++ {
+		go p.worker()
+	}
+
+	return p
+}
+
+// submit queue the job according to the admission policy
+func (p *workerPool) submit(job *poolJob, priority Priority) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var deadline time.Time
+	for !p.stopped && p.queued >= p.config.QueueSize {
+		if p.config.Policy == RejectWhenFull || (!deadline.IsZero() && !p.config.Clock.Now().Before(deadline)) {
+			p.rejected++
+			return ErrPoolFull
+		}
+
+		// the blocked submission is woken up at its deadline
+		if deadline.IsZero() && p.config.BlockTimeout > 0 {
+			deadline = p.config.Clock.Now().Add(p.config.BlockTimeout)
+			defer p.wakeUp(p.config.BlockTimeout)()
+		}
+
+		p.notFull.Wait()
+	}
+
+	if p.stopped {
+		p.rejected++
+		return errors.New("worker pool is stopped")
+	}
+
+	job.enqueued = p.config.Clock.Now()
+	p.lanes[priority] = append(p.lanes[priority], job)
+	p.queued++
+	p.submitted++
+	p.work.Broadcast()
+
+	return nil
+}
+
+// wakeUp wake up the blocked submissions once the duration is passed on the clock, the returned function stops it
+func (p *workerPool) wakeUp(d time.Duration) func() {
+	expired, stop := after(p.config.Clock, d)
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case <-expired:
+		case <-done:
+			return
+		}
+
+		p.lock.Lock()
+		p.notFull.Broadcast()
+		p.lock.Unlock()
+	}()
+
+	return func() {
+		close(done)
+		stop()
+	}
+}
+
+func (p *workerPool) worker() {
+	defer p.workers.Done()
+
+	for {
+		p.lock.Lock()
+		job := p.next()
+		for job == nil {
+			if p.stopped && p.queued == 0 {
+				p.lock.Unlock()
+				return
+			}
+
+			p.work.Wait()
+			job = p.next()
+		}
+
+		wait := p.config.Clock.Now().Sub(job.enqueued)
+		p.totalWait += wait
+		if wait > p.maxWait {
+			p.maxWait = wait
+		}
+
+		p.busy++
+		p.running[job.routeId]++
+		p.lock.Unlock()
+
+		job.run()
+
+		p.lock.Lock()
+		p.busy--
+		p.running[job.routeId]--
+		if p.running[job.routeId] == 0 {
+			delete(p.running, job.routeId)
+		}
+		p.completed++
+
+		// the route slot may release a queued job
+		p.work.Broadcast()
+		p.lock.Unlock()
+	}
+}
+
+// next dequeue the first job of the highest lane which route is under its limit
+func (p *workerPool) next() *poolJob {
+	for priority := HighPriority; priority >= LowPriority; priority-- {
+		lane := p.lanes[priority]
+		for i, job := range lane {
+			if limit, ok := p.config.RouteLimits[job.routeId]; ok && p.running[job.routeId] >= limit {
+				continue
+			}
+
+			p.lanes[priority] = append(lane[:i:i], lane[i+1:]...)
+			p.queued--
+			p.notFull.Broadcast()
+
+			return job
+		}
+	}
+
+	return nil
+}
+
+// stop reject the next submissions and wait for the queued jobs
+func (p *workerPool) stop() {
+	p.lock.Lock()
+	p.stopped = true
+	p.work.Broadcast()
+	p.notFull.Broadcast()
+	p.lock.Unlock()
+
+	p.workers.Wait()
+}
+
+func (p *workerPool) stats() *PoolStats {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	s := &PoolStats{
+		Workers:          p.config.Workers,
+		Busy:             p.busy,
+		QueueSize:        p.config.QueueSize,
+		Queued:           p.queued,
+		QueuedByPriority: make(map[string]int),
+		Running:          make(map[string]int, len(p.running)),
+		Submitted:        p.submitted,
+		Rejected:         p.rejected,
+		Completed:        p.completed,
+		MaxWait:          p.maxWait,
+	}
+
+	for priority, lane := range p.lanes {
+		s.QueuedByPriority[Priority(priority).String()] = len(lane)
+	}
+
+	for id, n := range p.running {
+		s.Running[id] = n
+	}
+
+	if started := p.completed + int64(p.busy); started > 0 {
+		s.AverageWait = p.totalWait / time.Duration(started)
+	}
+
+	return s
+}
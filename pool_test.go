@@ -0,0 +1,305 @@
+package orchestrator
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingRuns record the executed routes, the executions block until release is closed
+type blockingRuns struct {
+	lock    sync.Mutex
+	order   []string
+	current int
+	max     int
+	release chan struct{}
+}
+
+func (br *blockingRuns) route(id string) *NonTransactionalRoute {
+	return NewNonTransactionalRoute(id).
+		AddNextStep("1", func(ctx *context) error {
+			br.lock.Lock()
+			br.order = append(br.order, ctx.GetGid())
+			br.current++
+			if br.current > br.max {
+				br.max = br.current
+			}
+			br.lock.Unlock()
+
+			<-br.release
+
+			br.lock.Lock()
+			br.current--
+			br.lock.Unlock()
+
+			return nil
+		})
+}
+
+func newPoolOrchestrator(t *testing.T, config PoolConfig, routes ...Route) *orchestrator {
+	orch := NewOrchestrator()
+	for _, r := range routes {
+		_ = orch.Register(r)
+	}
+	_ = orch.Initialization(nil)
+
+	assert.Nil(t, orch.StartPool(config))
+	return orch
+}
+
+// waitForPool wait until the pool stats meet the condition
+func waitForPool(t *testing.T, o *orchestrator, condition func(s *PoolStats) bool) *PoolStats {
+	for i := 0; i < 200; i++ {
+		if s, _ := o.PoolStats(); condition(s) {
+			return s
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	s, _ := o.PoolStats()
+	assert.Fail(t, "pool condition not met", "%+v", s)
+	return s
+}
+
+func execAsync(o *orchestrator, wg *sync.WaitGroup, route string, gid string, priority Priority) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ctx, _ := NewContextWithGid(gid)
+		_, _ = o.ExecWithPriority(route, priority, ctx)
+	}()
+}
+
+func TestOrchestrator_PoolWorkers(t *testing.T) {
+	runs := &blockingRuns{release: make(chan struct{})}
+	orch := newPoolOrchestrator(t, PoolConfig{Workers: 2, QueueSize: 10}, runs.route("A"))
+
+	var wg sync.WaitGroup
+	for _, gid := range []string{"1", "2", "3", "4", "5"} {
+		execAsync(orch, &wg, "A", gid, NormalPriority)
+	}
+
+	s := waitForPool(t, orch, func(s *PoolStats) bool {
+		return s.Busy == 2 && s.Queued == 3
+	})
+	assert.Equal(t, map[string]int{"A": 2}, s.Running)
+	assert.Equal(t, 3, s.QueuedByPriority["NORMAL"])
+
+	close(runs.release)
+	wg.Wait()
+	orch.StopPool()
+
+	assert.Equal(t, 2, runs.max)
+	assert.Equal(t, 5, len(runs.order))
+
+	_, ok := orch.PoolStats()
+	assert.False(t, ok)
+}
+
+func TestOrchestrator_PoolRouteLimits(t *testing.T) {
+	runs := &blockingRuns{release: make(chan struct{})}
+	orch := newPoolOrchestrator(t, PoolConfig{Workers: 3, QueueSize: 10, RouteLimits: map[string]int{"A": 1}},
+		runs.route("A"), runs.route("B"))
+
+	var wg sync.WaitGroup
+	execAsync(orch, &wg, "A", "1", NormalPriority)
+	execAsync(orch, &wg, "A", "2", NormalPriority)
+	execAsync(orch, &wg, "B", "3", NormalPriority)
+
+	s := waitForPool(t, orch, func(s *PoolStats) bool {
+		return s.Busy == 2 && s.Queued == 1
+	})
+	assert.Equal(t, map[string]int{"A": 1, "B": 1}, s.Running)
+
+	close(runs.release)
+	wg.Wait()
+	orch.StopPool()
+
+	assert.Equal(t, 3, len(runs.order))
+}
+
+func TestOrchestrator_PoolPriority(t *testing.T) {
+	runs := &blockingRuns{release: make(chan struct{})}
+	orch := newPoolOrchestrator(t, PoolConfig{Workers: 1, QueueSize: 10}, runs.route("A"))
+
+	var wg sync.WaitGroup
+	execAsync(orch, &wg, "A", "first", NormalPriority)
+	waitForPool(t, orch, func(s *PoolStats) bool {
+		return s.Busy == 1
+	})
+
+	for i, p := range []Priority{LowPriority, NormalPriority, HighPriority} {
+		execAsync(orch, &wg, "A", p.String(), p)
+		queued := i + 1
+		waitForPool(t, orch, func(s *PoolStats) bool {
+			return s.Queued == queued
+		})
+	}
+
+	close(runs.release)
+	wg.Wait()
+	orch.StopPool()
+
+	assert.Equal(t, []string{"first", "HIGH", "NORMAL", "LOW"}, runs.order)
+}
+
+func TestOrchestrator_PoolFull(t *testing.T) {
+	tests := []PoolConfig{
+		{Workers: 1, QueueSize: 1, Policy: RejectWhenFull},
+		{Workers: 1, QueueSize: 1, BlockTimeout: 20 * time.Millisecond},
+	}
+
+	for _, config := range tests {
+		runs := &blockingRuns{release: make(chan struct{})}
+		orch := newPoolOrchestrator(t, config, runs.route("A"))
+
+		var wg sync.WaitGroup
+		execAsync(orch, &wg, "A", "1", NormalPriority)
+		waitForPool(t, orch, func(s *PoolStats) bool {
+			return s.Busy == 1
+		})
+
+		execAsync(orch, &wg, "A", "2", NormalPriority)
+		waitForPool(t, orch, func(s *PoolStats) bool {
+			return s.Queued == 1
+		})
+
+		ctx, _ := NewContextWithGid("3")
+		_, err := orch.Exec("A", ctx)
+		assert.True(t, errors.Is(err, ErrPoolFull), config.Policy)
+
+		// the rejected execution is forgotten
+		_, err = orch.Execution("3")
+		assert.True(t, errors.Is(err, ErrExecutionNotFound))
+
+		h := NewAdminHandler(orch)
+		assert.Equal(t, http.StatusServiceUnavailable, adminRequest(t, h, http.MethodPost, "/routes/A/executions",
+			startRequest{Gid: "4"}, nil))
+
+		var s PoolStats
+		assert.Equal(t, http.StatusOK, adminRequest(t, h, http.MethodGet, "/pool", nil, &s))
+		assert.Equal(t, int64(2), s.Rejected)
+		assert.Equal(t, int64(2), s.Submitted)
+
+		close(runs.release)
+		wg.Wait()
+		orch.StopPool()
+	}
+}
+
+func TestOrchestrator_PoolBlockTimeout(t *testing.T) {
+	clock := newTimingClock()
+	runs := &blockingRuns{release: make(chan struct{})}
+	orch := newPoolOrchestrator(t, PoolConfig{Workers: 1, QueueSize: 1, BlockTimeout: time.Hour, Clock: clock},
+		runs.route("A"))
+
+	var wg sync.WaitGroup
+	execAsync(orch, &wg, "A", "1", NormalPriority)
+	waitForPool(t, orch, func(s *PoolStats) bool {
+		return s.Busy == 1
+	})
+
+	execAsync(orch, &wg, "A", "2", NormalPriority)
+	waitForPool(t, orch, func(s *PoolStats) bool {
+		return s.Queued == 1
+	})
+
+	// the blocked submission is rejected once the timeout is passed on the clock
+	rejected := make(chan error)
+	go func() {
+		ctx, _ := NewContextWithGid("3")
+		_, err := orch.Exec("A", ctx)
+		rejected <- err
+	}()
+
+	clock.armed(t)
+	clock.advance(time.Hour)
+	assert.True(t, errors.Is(<-rejected, ErrPoolFull))
+
+	close(runs.release)
+	wg.Wait()
+	orch.StopPool()
+}
+
+func TestOrchestrator_PoolResume(t *testing.T) {
+	runs := &blockingRuns{release: make(chan struct{})}
+	blocking := runs.route("S").GetStartState().action
+
+	orch := NewOrchestrator()
+	orch.SetCaretaker(NewMemoryCaretaker())
+	_ = orch.Register(NewNonTransactionalRoute("S").
+		WaitForSignal("approval", 0).
+		AddNextStep("2", blocking))
+	_ = orch.Initialization(nil)
+
+	for _, gid := range []string{"1", "2", "3"} {
+		ctx, _ := NewContextWithGid(gid)
+		result, _ := orch.Exec("S", ctx)
+		assert.Equal(t, Waiting, result.Status)
+	}
+
+	assert.Nil(t, orch.StartPool(PoolConfig{Workers: 2, QueueSize: 1, Policy: RejectWhenFull,
+		RouteLimits: map[string]int{"S": 1}}))
+
+	// the resumed executions are held by the route limit
+	var wg sync.WaitGroup
+	for i, gid := range []string{"1", "2"} {
+		wg.Add(1)
+		go func(gid string) {
+			defer wg.Done()
+
+			_, _ = orch.Signal(gid, "approval", nil)
+		}(gid)
+
+		queued := i
+		waitForPool(t, orch, func(s *PoolStats) bool {
+			return s.Busy == 1 && s.Queued == queued
+		})
+	}
+
+	s, _ := orch.PoolStats()
+	assert.Equal(t, map[string]int{"S": 1}, s.Running)
+
+	// a resume which isn't admitted leaves the execution waiting
+	_, err := orch.Signal("3", "approval", nil)
+	assert.True(t, errors.Is(err, ErrPoolFull))
+
+	info, _ := orch.Execution("3")
+	assert.Equal(t, Waiting, info.Status)
+
+	close(runs.release)
+	wg.Wait()
+
+	result, err := orch.Signal("3", "approval", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, Completed, result.Status)
+
+	orch.StopPool()
+	assert.Equal(t, 3, len(runs.order))
+}
+
+func TestOrchestrator_StartPool(t *testing.T) {
+	tests := []struct {
+		config   PoolConfig
+		expected string
+	}{
+		{PoolConfig{QueueSize: 1}, "pool workers must be positive"},
+		{PoolConfig{Workers: 1}, "pool queue size must be positive"},
+		{PoolConfig{Workers: 1, QueueSize: 1, Policy: "DROP"}, "unknown admission policy DROP"},
+		{PoolConfig{Workers: 1, QueueSize: 1, RouteLimits: map[string]int{"A": 0}}, "route A limit must be positive"},
+	}
+
+	orch := NewOrchestrator()
+	for _, test := range tests {
+		assert.EqualError(t, orch.StartPool(test.config), test.expected)
+	}
+
+	assert.Nil(t, orch.StartPool(PoolConfig{Workers: 1, QueueSize: 1}))
+	assert.EqualError(t, orch.StartPool(PoolConfig{Workers: 1, QueueSize: 1}), "pool is already started")
+	orch.StopPool()
+}
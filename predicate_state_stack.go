@@ -6,7 +6,7 @@ type (
 	}
 
 	predicateState struct {
-		predicate func(context) bool
+		condition func(context) (bool, error)
 		state     *State
 	}
 )
@@ -15,9 +15,9 @@ func (tss *predicateStateStack) isEmpty() bool {
 	return len(tss.stack) < 1
 }
 
-func (tss *predicateStateStack) push(predicate func(context) bool, state *State) {
+func (tss *predicateStateStack) push(condition func(context) (bool, error), state *State) {
 	tss.stack = append(tss.stack, predicateState{
-		predicate: predicate,
+		condition: condition,
 		state:     state,
 	})
 }
@@ -0,0 +1,95 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// QueryFunc read an execution from a snapshot of its context and the name of its current state, the snapshot is
+// a copy so the query can't change the execution
+type QueryFunc func(ctx context, state string) (interface{}, error)
+
+// RegisterQuery register a query by name, the queries are run on any execution
+func (o *orchestrator) RegisterQuery(name string, query QueryFunc) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.queries[name] != nil {
+		return errors.New(fmt.Sprintf("duplicate query %s", name))
+	}
+
+	o.queries[name] = query
+	return nil
+}
+
+// queried tells whether a query is registered
+func (o *orchestrator) queried() bool {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+
+	return len(o.queries) > 0
+}
+
+// Query run a registered query on an execution, a running execution is read as it was before its current step
+// and a persisted one from its latest memento
+func (o *orchestrator) Query(gid string, name string) (interface{}, error) {
+	o.lock.RLock()
+	query := o.queries[name]
+	o.lock.RUnlock()
+
+	if query == nil {
+		return nil, errors.New(fmt.Sprintf("query %s is not registered", name))
+	}
+
+	ctx, state, err := o.snapshot(gid)
+	if err != nil {
+		return nil, err
+	}
+
+	return query(*ctx, state)
+}
+
+// snapshot of the execution context and state
+func (o *orchestrator) snapshot(gid string) (*context, string, error) {
+	o.executionsLock.Lock()
+	e := o.executions[gid]
+	o.executionsLock.Unlock()
+
+	// the execution may be snapshotted since the query is registered only, its memento is read meanwhile
+	if e != nil {
+		e.lock.Lock()
+		data, state := e.snapshot, e.state
+		e.lock.Unlock()
+
+		if data != nil {
+			var cm contextMemento
+			if err := json.Unmarshal(data, &cm); err != nil {
+				return nil, "", err
+			}
+
+			ctx, err := cm.restore()
+			return ctx, state, err
+		}
+	}
+
+	if o.caretaker == nil {
+		return nil, "", fmt.Errorf("execution %s: %w", gid, ErrExecutionNotFound)
+	}
+
+	m, err := o.loadMemento(gid)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(m.Contexts) == 0 {
+		return nil, "", errors.New("memento has no context")
+	}
+
+	ctx, err := m.Contexts[0].restore()
+	if err != nil {
+		return nil, "", err
+	}
+
+	return ctx, m.State, nil
+}
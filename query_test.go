@@ -0,0 +1,109 @@
+package orchestrator
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func amountQuery(ctx context, state string) (interface{}, error) {
+	return map[string]interface{}{"amount": ctx.GetVariable("amount"), "state": state}, nil
+}
+
+func TestOrchestrator_Query(t *testing.T) {
+	started, release := make(chan bool), make(chan bool)
+
+	orch := NewOrchestrator()
+	orch.SetCaretaker(NewMemoryCaretaker())
+	_ = orch.Register(NewNonTransactionalRoute("A").
+		AddNextStep("1", func(ctx *context) error {
+			_ = ctx.SetVariable("order", map[string]interface{}{"lines": 1})
+			return ctx.SetVariable("amount", 1)
+		}).
+		AddNextStep("2", func(ctx *context) error {
+			started <- true
+			order := ctx.GetVariable("order").(map[string]interface{})
+			for i := 2; i <= 100; i++ {
+				_ = ctx.SetVariable("amount", i)
+				order["lines"] = i
+			}
+
+			<-release
+			return nil
+		}))
+	_ = orch.Initialization(nil)
+
+	assert.Nil(t, orch.RegisterQuery("amount", amountQuery))
+	assert.NotNil(t, orch.RegisterQuery("amount", amountQuery))
+	assert.Nil(t, orch.RegisterQuery("tamper", func(ctx context, state string) (interface{}, error) {
+		return nil, ctx.SetVariable("amount", -1)
+	}))
+	assert.Nil(t, orch.RegisterQuery("lines", func(ctx context, state string) (interface{}, error) {
+		return ctx.GetVariable("order").(map[string]interface{})["lines"], nil
+	}))
+
+	ctx, _ := NewContextWithGid("gid")
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, _ = orch.Exec("A", ctx)
+	}()
+	<-started
+
+	// the running step doesn't show up in the snapshot
+	for i := 0; i < 10; i++ {
+		_, _ = orch.Query("gid", "tamper")
+		result, err := orch.Query("gid", "amount")
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]interface{}{"amount": 1, "state": "A_2"}, result)
+
+		// the values changed in place don't show up either
+		lines, err := orch.Query("gid", "lines")
+		assert.Nil(t, err)
+		assert.Equal(t, float64(1), lines)
+	}
+
+	release <- true
+	wg.Wait()
+
+	// the finished execution is read from the caretaker
+	result, err := orch.Query("gid", "amount")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"amount": 100, "state": "A_2"}, result)
+
+	_, err = orch.Query("gid", "unknown")
+	assert.NotNil(t, err)
+	_, err = orch.Query("unknown", "amount")
+	assert.True(t, errors.Is(err, ErrExecutionNotFound))
+
+	h := NewAdminHandler(orch)
+	var qr queryResponse
+	assert.Equal(t, http.StatusOK, adminRequest(t, h, http.MethodGet, "/executions/gid/queries/amount", nil, &qr))
+	assert.Equal(t, map[string]interface{}{"amount": float64(100), "state": "A_2"}, qr.Result)
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, h, http.MethodGet, "/executions/gid/queries/unknown", nil, nil))
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, h, http.MethodGet, "/executions/unknown/queries/amount", nil, nil))
+}
+
+func TestOrchestrator_QuerySnapshot(t *testing.T) {
+	var snapshot []byte
+	orch := NewOrchestrator()
+	_ = orch.Register(NewNonTransactionalRoute("A").
+		AddNextStep("1", func(ctx *context) error {
+			snapshot = orch.executions[ctx.GetGid()].snapshot
+			return nil
+		}))
+	_ = orch.Initialization(nil)
+
+	// the context isn't copied when there is no query
+	ctx, _ := NewContextWithGid("gid")
+	_, _ = orch.Exec("A", ctx)
+	assert.Nil(t, snapshot)
+
+	_ = orch.RegisterQuery("amount", amountQuery)
+	ctx, _ = NewContextWithGid("other")
+	_, _ = orch.Exec("A", ctx)
+	assert.NotNil(t, snapshot)
+}
@@ -0,0 +1,138 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Registry keep the step functions by name, the declarative route definitions reference them
+type Registry struct {
+	actions     map[string]func(ctx *context) error
+	undoActions map[string]func(ctx context) error
+	predicates  map[string]func(ctx context) bool
+	conditions  map[string]func(ctx context) (bool, error)
+	tools       map[string]ToolHandler
+}
+
+// NewRegistry create an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		actions:     make(map[string]func(ctx *context) error),
+		undoActions: make(map[string]func(ctx context) error),
+		predicates:  make(map[string]func(ctx context) bool),
+		conditions:  make(map[string]func(ctx context) (bool, error)),
+		tools:       make(map[string]ToolHandler),
+	}
+}
+
+// RegisterAction register a step action
+func (r *Registry) RegisterAction(name string, action func(ctx *context) error) *Registry {
+	r.actions[name] = action
+	return r
+}
+
+// RegisterUndoAction register a transactional step undo action
+func (r *Registry) RegisterUndoAction(name string, undoAction func(ctx context) error) *Registry {
+	r.undoActions[name] = undoAction
+	return r
+}
+
+// RegisterPredicate register a condition predicate
+func (r *Registry) RegisterPredicate(name string, predicate func(ctx context) bool) *Registry {
+	r.predicates[name] = predicate
+	return r
+}
+
+// RegisterCondition register a condition which can fail, it's referenced like a predicate
+func (r *Registry) RegisterCondition(name string, condition func(ctx context) (bool, error)) *Registry {
+	r.conditions[name] = condition
+	return r
+}
+
+// RegisterTool register the handler of a CWL tool, the workflow steps reference it by their run identifier
+func (r *Registry) RegisterTool(run string, handler ToolHandler) *Registry {
+	r.tools[run] = handler
+	return r
+}
+
+func (r *Registry) action(name string) (func(ctx *context) error, error) {
+	if a := r.actions[name]; a != nil {
+		return a, nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("action %s is not registered", name))
+}
+
+func (r *Registry) undoAction(name string) (func(ctx context) error, error) {
+	if ua := r.undoActions[name]; ua != nil {
+		return ua, nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("undo action %s is not registered", name))
+}
+
+func (r *Registry) predicate(name string) (func(ctx context) (bool, error), error) {
+	if p := r.predicates[name]; p != nil {
+		return predicateCondition(p), nil
+	}
+
+	if c := r.conditions[name]; c != nil {
+		return c, nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("predicate %s is not registered", name))
+}
+
+func (r *Registry) tool(run string) (ToolHandler, error) {
+	if h := r.tools[run]; h != nil {
+		return h, nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("tool %s is not registered", run))
+}
+
+// nameOf look for the registered name of a function, the closures created by the same function literal
+// can't be told apart so a function registered under different names is ambiguous
+func (r *Registry) nameOf(fn interface{}) (string, error) {
+	if r == nil {
+		return "", errors.New("registry is not defined")
+	}
+
+	ptr := reflect.ValueOf(fn).Pointer()
+
+	var names []string
+	collect := func(name string, registered interface{}) {
+		if reflect.ValueOf(registered).Pointer() == ptr {
+			names = append(names, name)
+		}
+	}
+
+	switch fn.(type) {
+	case func(ctx *context) error:
+		for name, a := range r.actions {
+			collect(name, a)
+		}
+	case func(ctx context) error:
+		for name, ua := range r.undoActions {
+			collect(name, ua)
+		}
+	case func(ctx context) bool:
+		for name, p := range r.predicates {
+			collect(name, p)
+		}
+	case func(ctx context) (bool, error):
+		for name, c := range r.conditions {
+			collect(name, c)
+		}
+	}
+
+	switch len(names) {
+	case 0:
+		return "", errors.New("function is not registered")
+	case 1:
+		return names[0], nil
+	}
+
+	return "", errors.New(fmt.Sprintf("function is registered as %v", names))
+}
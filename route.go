@@ -1,5 +1,7 @@
 package orchestrator
 
+import "time"
+
 type routeState string
 
 const (
@@ -19,11 +21,43 @@ type (
 		GetEndpoints() []*Endpoint
 	}
 
+	// Endpoint call a route after the State action, the execution continues with the State transitions
+	// once the called route is finished
 	Endpoint struct {
 		// route id
 		To string
 
 		// State endpoint
 		State *State
+
+		// Isolated the called route runs against its own context
+		Isolated bool
+
+		// Inputs copy the caller variables to the isolated context, child variable -> caller variable
+		Inputs map[string]string
+
+		// Outputs copy the isolated context variables back to the caller, caller variable -> child variable
+		Outputs map[string]string
+	}
+
+	// RetryPolicy define how many times a failed step is executed again before the failure is recorded
+	RetryPolicy struct {
+		// MaxAttempts the total number of attempts, zero means retry until the step succeeds
+		MaxAttempts int
+
+		// Interval wait between two attempts, it's one second when the step is retried until it succeeds
+		Interval time.Duration
 	}
 )
+
+// defaultRetryInterval keep a step retried until it succeeds from spinning
+const defaultRetryInterval = time.Second
+
+// interval the wait before the next attempt
+func (rp *RetryPolicy) interval() time.Duration {
+	if rp.Interval <= 0 && rp.MaxAttempts <= 0 {
+		return defaultRetryInterval
+	}
+
+	return rp.Interval
+}
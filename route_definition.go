@@ -0,0 +1,835 @@
+package orchestrator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type DefinitionFormat string
+
+const (
+	YAMLFormat DefinitionFormat = "yaml"
+	JSONFormat DefinitionFormat = "json"
+
+	// step kinds of a transactional route definition
+	CompensatableStepKind = "compensatable"
+	PivotStepKind         = "pivot"
+	RetriableStepKind     = "retriable"
+)
+
+type (
+	// RouteDefinition is the declarative form of a route, the functions are referenced by their registered name
+	RouteDefinition struct {
+		Id            string           `json:"id" yaml:"id"`
+		Version       int              `json:"version,omitempty" yaml:"version,omitempty"`
+		Transactional bool             `json:"transactional,omitempty" yaml:"transactional,omitempty"`
+		Steps         []StepDefinition `json:"steps" yaml:"steps"`
+
+		// Variables declare the context variable types, the conditions using an unknown variable or mismatching
+		// a type are rejected when they're declared
+		Variables map[string]ExpressionType `json:"variables,omitempty" yaml:"variables,omitempty"`
+	}
+
+	// StepDefinition is a step, or a condition when When or Condition is defined
+	StepDefinition struct {
+		Name string `json:"name,omitempty" yaml:"name,omitempty"`
+
+		// Kind of a transactional step, compensatable by default
+		Kind    string               `json:"kind,omitempty" yaml:"kind,omitempty"`
+		Action  string               `json:"action,omitempty" yaml:"action,omitempty"`
+		Undo    string               `json:"undo,omitempty" yaml:"undo,omitempty"`
+		Timeout string               `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+		Retry   *RetryDefinition     `json:"retry,omitempty" yaml:"retry,omitempty"`
+		To      []EndpointDefinition `json:"to,omitempty" yaml:"to,omitempty"`
+
+		// Recorded the step outcome is recorded and applied instead of the action when the attempt runs again
+		Recorded bool `json:"recorded,omitempty" yaml:"recorded,omitempty"`
+
+		// Signal the step waits for instead of an action, the timeout is the signal timeout
+		Signal            string `json:"signal,omitempty" yaml:"signal,omitempty"`
+		ContinueOnTimeout bool   `json:"continue_on_timeout,omitempty" yaml:"continue_on_timeout,omitempty"`
+
+		// Sleep duration or Until context variable keeping the wake-up time of a timer step
+		Sleep string `json:"sleep,omitempty" yaml:"sleep,omitempty"`
+		Until string `json:"until,omitempty" yaml:"until,omitempty"`
+
+		// When predicate name or Condition expression of a condition, Then steps are taken when it's true
+		// and Otherwise steps when it's false
+		When      string           `json:"when,omitempty" yaml:"when,omitempty"`
+		Condition string           `json:"condition,omitempty" yaml:"condition,omitempty"`
+		Then      []StepDefinition `json:"then,omitempty" yaml:"then,omitempty"`
+		Otherwise []StepDefinition `json:"otherwise,omitempty" yaml:"otherwise,omitempty"`
+	}
+
+	RetryDefinition struct {
+		MaxAttempts int    `json:"max_attempts,omitempty" yaml:"max_attempts,omitempty"`
+		Interval    string `json:"interval,omitempty" yaml:"interval,omitempty"`
+	}
+
+	EndpointDefinition struct {
+		Route    string            `json:"route" yaml:"route"`
+		Isolated bool              `json:"isolated,omitempty" yaml:"isolated,omitempty"`
+		Inputs   map[string]string `json:"inputs,omitempty" yaml:"inputs,omitempty"`
+		Outputs  map[string]string `json:"outputs,omitempty" yaml:"outputs,omitempty"`
+	}
+
+	// DefinitionError list every problem found in a route definition
+	DefinitionError struct {
+		Id     string
+		Errors []string
+	}
+
+	// definitionBuilder apply the definition steps to a route builder
+	definitionBuilder interface {
+		step(sd *StepDefinition, registry *Registry) error
+		wait(sd *StepDefinition)
+		when(condition func(ctx context) (bool, error))
+		otherwise()
+		end()
+		endpoint(ed EndpointDefinition)
+		timeout(timeout time.Duration)
+		retry(retryPolicy RetryPolicy)
+		recorded()
+		recorder() *routeRecorder
+		route() Route
+	}
+
+	trDefinitionBuilder struct {
+		tr *TransactionalRoute
+	}
+
+	ntrDefinitionBuilder struct {
+		ntr *NonTransactionalRoute
+	}
+)
+
+func (de *DefinitionError) Error() string {
+	return fmt.Sprintf("invalid route definition %s: %s", de.Id, strings.Join(de.Errors, "; "))
+}
+
+// ParseRouteDefinition decode a route definition, unknown fields are rejected
+func ParseRouteDefinition(data []byte, format DefinitionFormat) (*RouteDefinition, error) {
+	rd := &RouteDefinition{}
+
+	switch format {
+	case JSONFormat:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(rd); err != nil {
+			return nil, err
+		}
+	case YAMLFormat:
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(rd); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New(fmt.Sprintf("unknown definition format %s", format))
+	}
+
+	return rd, nil
+}
+
+// ReadRouteDefinition read a route definition file, the format is taken from the file extension
+func ReadRouteDefinition(path string) (*RouteDefinition, error) {
+	format, err := definitionFormatOf(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseRouteDefinition(data, format)
+}
+
+func definitionFormatOf(path string) (DefinitionFormat, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return JSONFormat, nil
+	case ".yaml", ".yml":
+		return YAMLFormat, nil
+	}
+
+	return "", errors.New(fmt.Sprintf("unknown definition file extension %s", path))
+}
+
+// Marshal encode the route definition
+func (rd *RouteDefinition) Marshal(format DefinitionFormat) ([]byte, error) {
+	switch format {
+	case JSONFormat:
+		return json.MarshalIndent(rd, "", "  ")
+	case YAMLFormat:
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(rd); err != nil {
+			return nil, err
+		}
+
+		return buf.Bytes(), enc.Close()
+	}
+
+	return nil, errors.New(fmt.Sprintf("unknown definition format %s", format))
+}
+
+// Validate check the definition structure, the function names are checked against the registry when it's not nil
+func (rd *RouteDefinition) Validate(registry *Registry) error {
+	de := &DefinitionError{Id: rd.Id}
+	if rd.Id == "" {
+		de.Errors = append(de.Errors, "route id is empty")
+	}
+
+	if rd.Id == DefaultRecoveryRouteId {
+		de.Errors = append(de.Errors, DefaultRecoveryRouteId+" route id is reserved")
+	}
+
+	if rd.Version < 0 {
+		de.Errors = append(de.Errors, fmt.Sprintf("invalid version %d", rd.Version))
+	}
+
+	if len(rd.Steps) == 0 {
+		de.Errors = append(de.Errors, "route has no step")
+	}
+
+	for name, t := range rd.Variables {
+		switch t {
+		case BoolType, NumberType, StringType, AnyType:
+		default:
+			de.Errors = append(de.Errors, fmt.Sprintf("variable %s has an unknown type %s", name, t))
+		}
+	}
+
+	names := make(map[string]bool)
+	rd.validateSteps(rd.Steps, "steps", true, registry, names, de)
+
+	if len(de.Errors) > 0 {
+		return de
+	}
+
+	return nil
+}
+
+func (rd *RouteDefinition) validateSteps(steps []StepDefinition, path string, top bool, registry *Registry,
+	names map[string]bool, de *DefinitionError) {
+	fail := func(p string, format string, args ...interface{}) {
+		de.Errors = append(de.Errors, p+": "+fmt.Sprintf(format, args...))
+	}
+
+	for i := range steps {
+		sd := &steps[i]
+		p := fmt.Sprintf("%s[%d]", path, i)
+
+		if sd.isCondition() {
+			// a condition starts from the previous step and the route builder closes it with the next step
+			if i == 0 {
+				fail(p, "condition %s must follow a step", sd.conditionName())
+			}
+
+			if i+1 < len(steps) && steps[i+1].isCondition() {
+				fail(p, "condition %s must be followed by a step", sd.conditionName())
+			}
+
+			if i+1 == len(steps) && !top {
+				fail(p, "condition %s must be followed by a step in a branch", sd.conditionName())
+			}
+
+			if sd.Name != "" || sd.Action != "" || sd.Undo != "" || sd.Kind != "" || sd.Timeout != "" ||
+				sd.Retry != nil || len(sd.To) > 0 || sd.Signal != "" || sd.ContinueOnTimeout || sd.isTimer() || sd.Recorded {
+				fail(p, "condition %s can't define step fields", sd.conditionName())
+			}
+
+			if len(sd.Then) == 0 {
+				fail(p, "condition %s has no step", sd.conditionName())
+			}
+
+			if sd.When != "" && sd.Condition != "" {
+				fail(p, "condition defines both when %s and condition %s", sd.When, sd.Condition)
+			}
+
+			if sd.Condition != "" {
+				if _, err := rd.compileCondition(sd.Condition); err != nil {
+					fail(p, "%v", err)
+				}
+			} else if registry != nil {
+				if _, err := registry.predicate(sd.When); err != nil {
+					fail(p, "%v", err)
+				}
+			}
+
+			rd.validateSteps(sd.Then, p+".then", false, registry, names, de)
+			rd.validateSteps(sd.Otherwise, p+".otherwise", false, registry, names, de)
+			continue
+		}
+
+		if len(sd.Then) > 0 || len(sd.Otherwise) > 0 {
+			fail(p, "step %s defines branches without a condition", sd.Name)
+		}
+
+		switch {
+		case sd.Signal != "":
+			if sd.Name != "" || sd.Action != "" || sd.Undo != "" || sd.Kind != "" || sd.Retry != nil || sd.isTimer() ||
+				sd.Recorded {
+				fail(p, "signal step %s can only define a timeout and endpoints", sd.Signal)
+			}
+
+			if names[sd.Signal] {
+				fail(p, "duplicate step name %s", sd.Signal)
+			}
+			names[sd.Signal] = true
+		case sd.isTimer():
+			if sd.Name == "" {
+				fail(p, "step name is empty")
+			} else if names[sd.Name] {
+				fail(p, "duplicate step name %s", sd.Name)
+			}
+			names[sd.Name] = true
+
+			if sd.Action != "" || sd.Undo != "" || sd.Kind != "" || sd.Retry != nil || sd.Timeout != "" || sd.Recorded {
+				fail(p, "timer step %s can only define endpoints", sd.Name)
+			}
+
+			if sd.Sleep != "" && sd.Until != "" {
+				fail(p, "timer step %s defines both sleep and until", sd.Name)
+			}
+
+			if sd.Sleep != "" {
+				if d, err := time.ParseDuration(sd.Sleep); err != nil || d < 0 {
+					fail(p, "invalid sleep %s", sd.Sleep)
+				}
+			}
+		default:
+			rd.validateStep(sd, p, registry, names, fail)
+		}
+
+		if sd.ContinueOnTimeout && sd.Signal == "" {
+			fail(p, "step %s continues on timeout without a signal", sd.Name)
+		}
+
+		if sd.Timeout != "" {
+			if d, err := time.ParseDuration(sd.Timeout); err != nil || d < 0 {
+				fail(p, "invalid timeout %s", sd.Timeout)
+			}
+		}
+
+		if sd.Retry != nil {
+			if sd.Retry.MaxAttempts < 0 {
+				fail(p, "invalid retry max attempts %d", sd.Retry.MaxAttempts)
+			}
+
+			if sd.Retry.Interval != "" {
+				if d, err := time.ParseDuration(sd.Retry.Interval); err != nil || d < 0 {
+					fail(p, "invalid retry interval %s", sd.Retry.Interval)
+				}
+			}
+		}
+
+		for j, ed := range sd.To {
+			if ed.Route == "" {
+				fail(fmt.Sprintf("%s.to[%d]", p, j), "endpoint route is empty")
+			}
+
+			if !ed.Isolated && (len(ed.Inputs) > 0 || len(ed.Outputs) > 0) {
+				fail(fmt.Sprintf("%s.to[%d]", p, j), "inputs and outputs need an isolated endpoint")
+			}
+		}
+	}
+}
+
+// validateStep check the name, the functions and the kind of a step
+func (rd *RouteDefinition) validateStep(sd *StepDefinition, p string, registry *Registry, names map[string]bool,
+	fail func(p string, format string, args ...interface{})) {
+	if sd.Name == "" {
+		fail(p, "step name is empty")
+	} else if names[sd.Name] {
+		fail(p, "duplicate step name %s", sd.Name)
+	}
+	names[sd.Name] = true
+
+	if sd.Action == "" {
+		fail(p, "step %s has no action", sd.Name)
+	} else if registry != nil {
+		if _, err := registry.action(sd.Action); err != nil {
+			fail(p, "%v", err)
+		}
+	}
+
+	switch {
+	case !rd.Transactional && (sd.Kind != "" || sd.Undo != ""):
+		fail(p, "step %s of a non transactional route can't define a kind or an undo action", sd.Name)
+	case sd.Kind != "" && sd.Kind != CompensatableStepKind && sd.Kind != PivotStepKind && sd.Kind != RetriableStepKind:
+		fail(p, "unknown step kind %s", sd.Kind)
+	case (sd.Kind == PivotStepKind || sd.Kind == RetriableStepKind) && sd.Undo != "":
+		fail(p, "%s step %s can't define an undo action", sd.Kind, sd.Name)
+	case sd.Undo != "" && registry != nil:
+		if _, err := registry.undoAction(sd.Undo); err != nil {
+			fail(p, "%v", err)
+		}
+	}
+
+}
+
+// Build create the route graph with the registered functions
+func (rd *RouteDefinition) Build(registry *Registry) (Route, error) {
+	if registry == nil {
+		return nil, errors.New("registry is not defined")
+	}
+
+	if err := rd.Validate(registry); err != nil {
+		return nil, err
+	}
+
+	var b definitionBuilder = &ntrDefinitionBuilder{ntr: NewNonTransactionalRoute(rd.Id)}
+	if rd.Transactional {
+		b = &trDefinitionBuilder{tr: NewTransactionalRoute(rd.Id)}
+	}
+
+	if err := rd.buildSteps(b, rd.Steps, registry); err != nil {
+		return nil, err
+	}
+
+	return b.route(), nil
+}
+
+func (rd *RouteDefinition) buildSteps(b definitionBuilder, steps []StepDefinition, registry *Registry) error {
+	closeCondition := false
+
+	for i := range steps {
+		sd := &steps[i]
+
+		if sd.isCondition() {
+			if sd.Condition != "" {
+				e, err := rd.compileCondition(sd.Condition)
+				if err != nil {
+					return err
+				}
+
+				b.when(e.Condition())
+				b.recorder().lastCondition().expression = sd.Condition
+			} else {
+				condition, err := registry.predicate(sd.When)
+				if err != nil {
+					return err
+				}
+
+				b.when(condition)
+				b.recorder().lastCondition().predicateName = sd.When
+			}
+
+			if err := rd.buildSteps(b, sd.Then, registry); err != nil {
+				return err
+			}
+
+			if len(sd.Otherwise) > 0 {
+				b.otherwise()
+				if err := rd.buildSteps(b, sd.Otherwise, registry); err != nil {
+					return err
+				}
+			}
+
+			closeCondition = true
+			continue
+		}
+
+		if closeCondition {
+			b.end()
+			closeCondition = false
+		}
+
+		switch {
+		case sd.Signal != "" || sd.isTimer():
+			b.wait(sd)
+		default:
+			if err := b.step(sd, registry); err != nil {
+				return err
+			}
+		}
+
+		for _, ed := range sd.To {
+			b.endpoint(ed)
+		}
+
+		if sd.Timeout != "" && sd.Signal == "" {
+			d, _ := time.ParseDuration(sd.Timeout)
+			b.timeout(d)
+		}
+
+		if sd.Retry != nil && sd.Kind != RetriableStepKind {
+			b.retry(sd.Retry.policy())
+		}
+
+		if sd.Recorded {
+			b.recorded()
+		}
+	}
+
+	return nil
+}
+
+func (sd *StepDefinition) isCondition() bool {
+	return sd.When != "" || sd.Condition != ""
+}
+
+// isTimer the step waits for its sleep duration or until the time kept in a context variable
+func (sd *StepDefinition) isTimer() bool {
+	return sd.Sleep != "" || sd.Until != ""
+}
+
+func (sd *StepDefinition) conditionName() string {
+	if sd.When != "" {
+		return sd.When
+	}
+
+	return "`" + sd.Condition + "`"
+}
+
+// compileCondition compile a condition expression against the declared variables, the variables are only checked
+// when the route runs when none is declared
+func (rd *RouteDefinition) compileCondition(src string) (*Expression, error) {
+	var variables map[string]ExpressionType
+	if len(rd.Variables) > 0 {
+		variables = rd.Variables
+	}
+
+	e, err := CompileExpression(src, variables)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.Type() != BoolType && e.Type() != AnyType {
+		return nil, &ExpressionError{Src: src, Msg: fmt.Sprintf("condition is %s", e.Type())}
+	}
+
+	return e, nil
+}
+
+// stepWait of a signal or a timer step
+func (sd *StepDefinition) stepWait() *stepWait {
+	sw := &stepWait{signal: sd.Signal, until: sd.Until, continueOnTimeout: sd.ContinueOnTimeout}
+	if sd.Signal != "" {
+		sw.timeout, _ = time.ParseDuration(sd.Timeout)
+	} else {
+		sw.timeout, _ = time.ParseDuration(sd.Sleep)
+	}
+
+	return sw
+}
+
+// waitName a signal step is named after its signal
+func (sd *StepDefinition) waitName() string {
+	if sd.Signal != "" {
+		return sd.Signal
+	}
+
+	return sd.Name
+}
+
+// define write the waiting step back to its declarative form
+func (sw *stepWait) define(name string, endpoints []*Endpoint) StepDefinition {
+	sd := StepDefinition{
+		Signal:            sw.signal,
+		ContinueOnTimeout: sw.continueOnTimeout,
+		Until:             sw.until,
+		To:                defineEndpoints(endpoints),
+	}
+
+	switch {
+	case sw.signal != "":
+		if sw.timeout > 0 {
+			sd.Timeout = sw.timeout.String()
+		}
+	case sw.until == "":
+		sd.Name = name
+		sd.Sleep = sw.timeout.String()
+	default:
+		sd.Name = name
+	}
+
+	return sd
+}
+
+func (rtd *RetryDefinition) policy() RetryPolicy {
+	interval, _ := time.ParseDuration(rtd.Interval)
+
+	return RetryPolicy{
+		MaxAttempts: rtd.MaxAttempts,
+		Interval:    interval,
+	}
+}
+
+// NewRouteDefinition write a route back to its declarative form, the functions must be registered
+// unless the route is built from a definition
+func NewRouteDefinition(route Route, registry *Registry) (*RouteDefinition, error) {
+	if err := builderError(route); err != nil {
+		return nil, err
+	}
+
+	rd := &RouteDefinition{Id: route.GetRouteId()}
+
+	var rc *routeRecorder
+	switch r := route.(type) {
+	case *TransactionalRoute:
+		rd.Transactional = true
+		rc = &r.recorder
+	case *NonTransactionalRoute:
+		rc = &r.recorder
+	default:
+		return nil, errors.New(fmt.Sprintf("route %s has no definition", route.GetRouteId()))
+	}
+
+	de := &DefinitionError{Id: rd.Id}
+	rd.Steps = rd.defineSteps(rc.steps, registry, de)
+	if len(de.Errors) > 0 {
+		return nil, de
+	}
+
+	return rd, nil
+}
+
+func (rd *RouteDefinition) defineSteps(steps []*recordedStep, registry *Registry, de *DefinitionError) []StepDefinition {
+	name := func(known string, fn interface{}, what string, step string) string {
+		if known != "" {
+			return known
+		}
+
+		n, err := registry.nameOf(fn)
+		if err != nil {
+			de.Errors = append(de.Errors, fmt.Sprintf("%s of %s: %v", what, step, err))
+		}
+
+		return n
+	}
+
+	var result []StepDefinition
+	for _, rs := range steps {
+		if rs.predicate != nil {
+			sd := StepDefinition{
+				Then:      rd.defineSteps(rs.then, registry, de),
+				Otherwise: rd.defineSteps(rs.otherwise, registry, de),
+			}
+
+			if rs.expression != "" {
+				sd.Condition = rs.expression
+			} else if sd.When = name(rs.predicateName, rs.predicate, "predicate", "condition"); sd.When == "" {
+				// keep the condition without a name, the definition is rejected but the graph shows it
+				sd.When = unnamedPredicate
+			}
+
+			result = append(result, sd)
+			continue
+		}
+
+		if rs.wait != nil {
+			result = append(result, rs.wait.define(rs.name, rs.endpoints))
+			continue
+		}
+
+		sd := StepDefinition{
+			Name:   rs.name,
+			Action: name(rs.actionName, rs.action, "action", rs.name),
+			To:     defineEndpoints(rs.endpoints),
+		}
+
+		if rd.Transactional {
+			switch rs.kind {
+			case pivot:
+				sd.Kind = PivotStepKind
+			case retriable:
+				sd.Kind = RetriableStepKind
+			default:
+				if rs.undoAction != nil {
+					sd.Undo = name(rs.undoActionName, rs.undoAction, "undo action", rs.name)
+				}
+			}
+		}
+
+		if rs.timeout > 0 {
+			sd.Timeout = rs.timeout.String()
+		}
+
+		if rs.retryPolicy != nil {
+			sd.Retry = &RetryDefinition{MaxAttempts: rs.retryPolicy.MaxAttempts}
+			if rs.retryPolicy.Interval > 0 {
+				sd.Retry.Interval = rs.retryPolicy.Interval.String()
+			}
+		}
+
+		sd.Recorded = rs.recorded
+		result = append(result, sd)
+	}
+
+	return result
+}
+
+func defineEndpoints(endpoints []*Endpoint) []EndpointDefinition {
+	var result []EndpointDefinition
+	for _, e := range endpoints {
+		result = append(result, EndpointDefinition{
+			Route:    e.To,
+			Isolated: e.Isolated,
+			Inputs:   e.Inputs,
+			Outputs:  e.Outputs,
+		})
+	}
+
+	return result
+}
+
+// RegisterDefinition build a route definition and register it with the definition version
+func (o *orchestrator) RegisterDefinition(rd *RouteDefinition, registry *Registry) error {
+	r, err := rd.Build(registry)
+	if err != nil {
+		return err
+	}
+
+	version := rd.Version
+	if version == 0 {
+		version = DefaultRouteVersion
+	}
+
+	return o.RegisterVersion(r, version)
+}
+
+func (b *trDefinitionBuilder) step(sd *StepDefinition, registry *Registry) error {
+	action, err := registry.action(sd.Action)
+	if err != nil {
+		return err
+	}
+
+	switch sd.Kind {
+	case PivotStepKind:
+		b.tr.AddPivotStep(sd.Name, action)
+	case RetriableStepKind:
+		var rp RetryPolicy
+		if sd.Retry != nil {
+			rp = sd.Retry.policy()
+		}
+
+		b.tr.AddRetriableStep(sd.Name, action, rp)
+	default:
+		var undoAction func(ctx context) error
+		if sd.Undo != "" {
+			if undoAction, err = registry.undoAction(sd.Undo); err != nil {
+				return err
+			}
+		}
+
+		b.tr.AddNextStep(sd.Name, action, undoAction)
+		b.tr.recorder.last.undoActionName = sd.Undo
+	}
+
+	b.tr.recorder.last.actionName = sd.Action
+	return nil
+}
+
+func (b *trDefinitionBuilder) wait(sd *StepDefinition) {
+	b.tr.addWaitStep(sd.waitName(), sd.stepWait())
+}
+
+func (b *trDefinitionBuilder) when(condition func(ctx context) (bool, error)) {
+	b.tr.WhenCondition(condition)
+}
+
+func (b *trDefinitionBuilder) otherwise() {
+	b.tr.Otherwise()
+}
+
+func (b *trDefinitionBuilder) end() {
+	b.tr.End()
+}
+
+func (b *trDefinitionBuilder) endpoint(ed EndpointDefinition) {
+	if ed.Isolated {
+		b.tr.ToIsolated(ed.Route, ed.Inputs, ed.Outputs)
+		return
+	}
+
+	b.tr.To(ed.Route)
+}
+
+func (b *trDefinitionBuilder) timeout(timeout time.Duration) {
+	b.tr.Timeout(timeout)
+}
+
+func (b *trDefinitionBuilder) retry(retryPolicy RetryPolicy) {
+	b.tr.Retry(retryPolicy)
+}
+
+func (b *trDefinitionBuilder) recorded() {
+	b.tr.Recorded()
+}
+
+func (b *trDefinitionBuilder) recorder() *routeRecorder {
+	return &b.tr.recorder
+}
+
+func (b *trDefinitionBuilder) route() Route {
+	return b.tr
+}
+
+func (b *ntrDefinitionBuilder) step(sd *StepDefinition, registry *Registry) error {
+	action, err := registry.action(sd.Action)
+	if err != nil {
+		return err
+	}
+
+	b.ntr.AddNextStep(sd.Name, action)
+	b.ntr.recorder.last.actionName = sd.Action
+	return nil
+}
+
+func (b *ntrDefinitionBuilder) wait(sd *StepDefinition) {
+	b.ntr.addWaitStep(sd.waitName(), sd.stepWait())
+}
+
+func (b *ntrDefinitionBuilder) when(condition func(ctx context) (bool, error)) {
+	b.ntr.WhenCondition(condition)
+}
+
+func (b *ntrDefinitionBuilder) otherwise() {
+	b.ntr.Otherwise()
+}
+
+func (b *ntrDefinitionBuilder) end() {
+	b.ntr.End()
+}
+
+func (b *ntrDefinitionBuilder) endpoint(ed EndpointDefinition) {
+	if ed.Isolated {
+		b.ntr.ToIsolated(ed.Route, ed.Inputs, ed.Outputs)
+		return
+	}
+
+	b.ntr.To(ed.Route)
+}
+
+func (b *ntrDefinitionBuilder) timeout(timeout time.Duration) {
+	b.ntr.Timeout(timeout)
+}
+
+func (b *ntrDefinitionBuilder) retry(retryPolicy RetryPolicy) {
+	b.ntr.Retry(retryPolicy)
+}
+
+func (b *ntrDefinitionBuilder) recorded() {
+	b.ntr.Recorded()
+}
+
+func (b *ntrDefinitionBuilder) recorder() *routeRecorder {
+	return &b.ntr.recorder
+}
+
+func (b *ntrDefinitionBuilder) route() Route {
+	return b.ntr
+}
@@ -0,0 +1,227 @@
+package orchestrator
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+const orderRouteYAML = `
+id: ORDER
+version: 2
+transactional: true
+steps:
+  - name: reserve
+    action: count
+    undo: undo
+    timeout: 1s
+  - when: isTrue
+    then:
+      - name: charge
+        action: count
+        undo: undo
+        retry:
+          max_attempts: 3
+          interval: 10ms
+      - name: ship
+        kind: pivot
+        action: count
+    otherwise:
+      - name: cancel
+        action: count
+        undo: undo
+  - name: notify
+    kind: retriable
+    action: count
+    retry:
+      max_attempts: 2
+    to:
+      - route: AUDIT
+`
+
+const auditRouteJSON = `{
+  "id": "AUDIT",
+  "steps": [
+    {"name": "log", "action": "count", "to": [{"route": "ARCHIVE", "isolated": true, "inputs": {"in": "HK"}}]}
+  ]
+}`
+
+func testRegistry() *Registry {
+	return NewRegistry().
+		RegisterAction("count", doActionTest).
+		RegisterUndoAction("undo", undoActionTest).
+		RegisterPredicate("isTrue", func(ctx context) bool { return true })
+}
+
+func TestRouteDefinition_Build(t *testing.T) {
+	registry := testRegistry()
+
+	order, err := ParseRouteDefinition([]byte(orderRouteYAML), YAMLFormat)
+	assert.Nil(t, err)
+	audit, err := ParseRouteDefinition([]byte(auditRouteJSON), JSONFormat)
+	assert.Nil(t, err)
+	archive := &RouteDefinition{Id: "ARCHIVE", Steps: []StepDefinition{{Name: "store", Action: "count"}}}
+
+	orch := NewOrchestrator()
+	assert.Nil(t, orch.RegisterDefinition(archive, registry))
+	assert.Nil(t, orch.RegisterDefinition(audit, registry))
+	assert.Nil(t, orch.RegisterDefinition(order, registry))
+	assert.Nil(t, orch.Initialization(nil))
+
+	ctx, _ := NewContext()
+	result, err := orch.ExecVersion("ORDER", 2, ctx)
+
+	assert.Nil(t, err)
+	assert.Equal(t, Completed, result.Status)
+	// reserve, charge, ship, notify, AUDIT log; ARCHIVE runs on an isolated context
+	assert.Equal(t, 5, ctx.GetVariable("HK"))
+	assert.Equal(t, "ARCHIVE_store", result.State)
+
+	tr := orch.routes["ORDER"][2].(*TransactionalRoute)
+	reserve := tr.GetStartState()
+	assert.Equal(t, time.Second, reserve.actionTimeout)
+
+	var charge *State
+	for _, ts := range reserve.transitions {
+		if ts.priority == Condition {
+			charge = ts.to
+		}
+	}
+	assert.Equal(t, &RetryPolicy{MaxAttempts: 3, Interval: 10 * time.Millisecond}, charge.retryPolicy)
+	assert.Equal(t, retriable, tr.lastState.kind)
+}
+
+func TestRouteDefinition_Validate(t *testing.T) {
+	tests := []struct {
+		name       string
+		definition RouteDefinition
+		errors     int
+	}{
+		{"valid", RouteDefinition{Id: "R", Steps: []StepDefinition{{Name: "1", Action: "count"}}}, 0},
+		{"empty route", RouteDefinition{}, 2},
+		{"reserved id", RouteDefinition{Id: DefaultRecoveryRouteId, Steps: []StepDefinition{{Name: "1", Action: "count"}}}, 1},
+		{"unknown functions", RouteDefinition{Id: "R", Transactional: true, Steps: []StepDefinition{
+			{Name: "1", Action: "unknown", Undo: "unknown"},
+			{When: "unknown", Then: []StepDefinition{{Name: "2", Action: "count"}}},
+		}}, 3},
+		{"condition first", RouteDefinition{Id: "R", Steps: []StepDefinition{
+			{When: "isTrue", Then: []StepDefinition{{Name: "1", Action: "count"}}},
+		}}, 1},
+		{"consecutive conditions", RouteDefinition{Id: "R", Steps: []StepDefinition{
+			{Name: "1", Action: "count"},
+			{When: "isTrue", Then: []StepDefinition{{Name: "2", Action: "count"}}},
+			{When: "isTrue", Then: []StepDefinition{{Name: "3", Action: "count"}}},
+		}}, 1},
+		{"condition at the end of a branch", RouteDefinition{Id: "R", Steps: []StepDefinition{
+			{Name: "1", Action: "count"},
+			{When: "isTrue", Then: []StepDefinition{
+				{Name: "2", Action: "count"},
+				{When: "isTrue", Then: []StepDefinition{{Name: "3", Action: "count"}}},
+			}},
+		}}, 1},
+		{"invalid step fields", RouteDefinition{Id: "R", Steps: []StepDefinition{
+			{Name: "1", Action: "count", Undo: "undo", Timeout: "soon", Retry: &RetryDefinition{MaxAttempts: -1, Interval: "x"}},
+			{Name: "1", Action: "count", To: []EndpointDefinition{{}, {Route: "A", Inputs: map[string]string{"a": "b"}}}},
+		}}, 7},
+		{"invalid transactional step", RouteDefinition{Id: "R", Transactional: true, Steps: []StepDefinition{
+			{Name: "1", Action: "count", Kind: "unknown"},
+			{Name: "2", Action: "count", Kind: PivotStepKind, Undo: "undo"},
+		}}, 2},
+		{"invalid signal step", RouteDefinition{Id: "R", Steps: []StepDefinition{
+			{Signal: "approval", Name: "1", Action: "count", Timeout: "1h"},
+			{Signal: "approval"},
+			{Name: "2", Action: "count", ContinueOnTimeout: true},
+		}}, 3},
+		{"invalid timer step", RouteDefinition{Id: "R", Steps: []StepDefinition{
+			{Sleep: "soon", Until: "at", Action: "count"},
+		}}, 4},
+		{"recorded wait steps", RouteDefinition{Id: "R", Steps: []StepDefinition{
+			{Signal: "approval", Recorded: true},
+			{Name: "1", Sleep: "1h", Recorded: true},
+		}}, 2},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.definition.Validate(testRegistry())
+			if tc.errors == 0 {
+				assert.Nil(t, err)
+				return
+			}
+
+			var de *DefinitionError
+			assert.True(t, errors.As(err, &de))
+			assert.Len(t, de.Errors, tc.errors, de.Error())
+		})
+	}
+}
+
+func TestNewRouteDefinition(t *testing.T) {
+	registry := testRegistry()
+	isTrue := registry.predicates["isTrue"]
+
+	r := NewTransactionalRoute("TEST_ROUTE").
+		AddNextStep("1", doActionTest, undoActionTest).Timeout(time.Second).
+		When(isTrue).
+		AddNextStep("condition_1", doActionTest, undoActionTest).
+		AddPivotStep("condition_2", doActionTest).
+		Otherwise().
+		AddNextStep("otherwise_1", doActionTest, nil).ToIsolated("B", map[string]string{"in": "HK"}, nil).
+		End().
+		AddRetriableStep("2", doActionTest, RetryPolicy{MaxAttempts: 2, Interval: time.Millisecond}).Recorded()
+
+	rd, err := NewRouteDefinition(r, registry)
+	assert.Nil(t, err)
+
+	data, err := rd.Marshal(YAMLFormat)
+	assert.Nil(t, err)
+
+	parsed, err := ParseRouteDefinition(data, YAMLFormat)
+	assert.Nil(t, err)
+	assert.Equal(t, rd, parsed)
+	assert.Equal(t, "isTrue", parsed.Steps[1].When)
+	assert.Equal(t, PivotStepKind, parsed.Steps[1].Then[1].Kind)
+	assert.Equal(t, "1s", parsed.Steps[0].Timeout)
+	assert.True(t, parsed.Steps[2].Recorded)
+
+	// a route built from a definition is written back with the same names
+	built, err := parsed.Build(registry)
+	assert.Nil(t, err)
+	rebuilt, err := NewRouteDefinition(built, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, parsed, rebuilt)
+
+	data, err = rd.Marshal(JSONFormat)
+	assert.Nil(t, err)
+	parsed, err = ParseRouteDefinition(data, JSONFormat)
+	assert.Nil(t, err)
+	assert.Equal(t, rd, parsed)
+
+	_, err = NewRouteDefinition(NewNonTransactionalRoute("R").AddNextStep("1", func(ctx *context) error {
+		return nil
+	}), registry)
+	assert.NotNil(t, err)
+}
+
+func TestParseRouteDefinition_UnknownField(t *testing.T) {
+	_, err := ParseRouteDefinition([]byte("id: R\nstep: []\n"), YAMLFormat)
+	assert.NotNil(t, err)
+
+	_, err = ParseRouteDefinition([]byte(`{"id": "R", "step": []}`), JSONFormat)
+	assert.NotNil(t, err)
+}
+
+func TestStepTimeout(t *testing.T) {
+	r := NewNonTransactionalRoute("R").
+		AddNextStep("slow", func(ctx *context) error {
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		}).Timeout(time.Millisecond)
+
+	ctx, _ := NewContext()
+	result := newRouteRunner(r.GetStartState(), nil, nil).run(ctx)
+
+	assert.Equal(t, Aborted, result.Status)
+	assert.True(t, errors.Is(result.Errors[0].Err, ErrStepTimeout))
+}
@@ -0,0 +1,263 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	StartNodeKind = "start"
+	EndNodeKind   = "end"
+	StepNodeKind  = "step"
+
+	// RouteNodeKind is a route called by a step
+	RouteNodeKind = "route"
+
+	// SignalNodeKind is a step waiting for a signal
+	SignalNodeKind = "signal"
+
+	// TimerNodeKind is a step waiting for a duration or a time
+	TimerNodeKind = "timer"
+
+	// unnamedPredicate label of a condition which predicate is not registered
+	unnamedPredicate = "when"
+)
+
+type (
+	// RouteGraph is the step graph of a route for display
+	RouteGraph struct {
+		Id    string      `json:"id"`
+		Nodes []GraphNode `json:"nodes"`
+		Edges []GraphEdge `json:"edges"`
+	}
+
+	GraphNode struct {
+		Id    string `json:"id"`
+		Label string `json:"label"`
+		Kind  string `json:"kind"`
+
+		// StepKind of a transactional step
+		StepKind string `json:"step_kind,omitempty"`
+	}
+
+	// GraphEdge is a transition, the label is the condition of a branch
+	GraphEdge struct {
+		From  string `json:"from"`
+		To    string `json:"to"`
+		Label string `json:"label,omitempty"`
+
+		// Call the edge is a call to another route
+		Call bool `json:"call,omitempty"`
+	}
+
+	// pendingEdge is an edge waiting for its destination
+	pendingEdge struct {
+		from  string
+		label string
+	}
+)
+
+// NewRouteGraph return the graph of a route, the conditions of unregistered predicates are labeled when
+func NewRouteGraph(route Route) (*RouteGraph, error) {
+	rd := &RouteDefinition{Id: route.GetRouteId()}
+
+	var rc *routeRecorder
+	switch r := route.(type) {
+	case *TransactionalRoute:
+		rd.Transactional = true
+		rc = &r.recorder
+	case *NonTransactionalRoute:
+		rc = &r.recorder
+	default:
+		return nil, errors.New(fmt.Sprintf("route %s has no graph", route.GetRouteId()))
+	}
+
+	// the function names are only known when the route is built from a definition
+	rd.Steps = rd.defineSteps(rc.steps, nil, &DefinitionError{})
+
+	return rd.Graph(), nil
+}
+
+// Graph of the route definition steps
+func (rd *RouteDefinition) Graph() *RouteGraph {
+	g := &RouteGraph{Id: rd.Id}
+	start := g.addNode("start", StartNodeKind, "")
+
+	exits := g.addSteps(rd.Steps, []pendingEdge{{from: start}})
+
+	end := g.addNode("end", EndNodeKind, "")
+	g.connect(exits, end)
+
+	return g
+}
+
+func (g *RouteGraph) addNode(label string, kind string, stepKind string) string {
+	id := fmt.Sprintf("n%d", len(g.Nodes))
+	g.Nodes = append(g.Nodes, GraphNode{Id: id, Label: label, Kind: kind, StepKind: stepKind})
+
+	return id
+}
+
+func (g *RouteGraph) connect(pending []pendingEdge, to string) {
+	for _, p := range pending {
+		g.Edges = append(g.Edges, GraphEdge{From: p.from, To: to, Label: p.label})
+	}
+}
+
+// addSteps add the steps after the pending edges and return the edges leaving the last steps
+func (g *RouteGraph) addSteps(steps []StepDefinition, pending []pendingEdge) []pendingEdge {
+	for i := range steps {
+		sd := &steps[i]
+
+		if sd.isCondition() {
+			label := sd.When
+			if sd.Condition != "" {
+				label = sd.Condition
+			}
+
+			exits := g.addSteps(sd.Then, relabel(pending, label))
+			if len(sd.Otherwise) > 0 {
+				exits = append(exits, g.addSteps(sd.Otherwise, relabel(pending, "otherwise"))...)
+			} else {
+				exits = append(exits, relabel(pending, "otherwise")...)
+			}
+
+			pending = exits
+			continue
+		}
+
+		kind := sd.Kind
+		if kind == CompensatableStepKind {
+			kind = ""
+		}
+
+		var id string
+		switch {
+		case sd.Signal != "":
+			id = g.addNode(sd.Signal, SignalNodeKind, "")
+		case sd.isTimer():
+			id = g.addNode(sd.Name, TimerNodeKind, "")
+		default:
+			id = g.addNode(sd.Name, StepNodeKind, kind)
+		}
+
+		g.connect(pending, id)
+
+		for _, ed := range sd.To {
+			to := g.addNode(ed.Route, RouteNodeKind, "")
+			g.Edges = append(g.Edges, GraphEdge{From: id, To: to, Call: true})
+		}
+
+		pending = []pendingEdge{{from: id}}
+	}
+
+	return pending
+}
+
+func relabel(pending []pendingEdge, label string) []pendingEdge {
+	result := make([]pendingEdge, len(pending))
+	for i, p := range pending {
+		result[i] = pendingEdge{from: p.from, label: label}
+	}
+
+	return result
+}
+
+// DOT render the graph in the Graphviz DOT language
+func (g *RouteGraph) DOT() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "digraph %q {\n", g.Id)
+
+	for _, n := range g.Nodes {
+		attrs := fmt.Sprintf("label=%q", n.Label)
+		switch {
+		case n.Kind == StartNodeKind:
+			attrs += ", shape=circle"
+		case n.Kind == EndNodeKind:
+			attrs += ", shape=doublecircle"
+		case n.Kind == RouteNodeKind:
+			attrs += ", shape=component"
+		case n.Kind == SignalNodeKind:
+			attrs += ", shape=box, style=dashed"
+		case n.Kind == TimerNodeKind:
+			attrs += ", shape=box, style=\"rounded,dashed\""
+		case n.StepKind == PivotStepKind:
+			attrs += ", shape=box, peripheries=2"
+		case n.StepKind == RetriableStepKind:
+			attrs += ", shape=box, style=rounded"
+		default:
+			attrs += ", shape=box"
+		}
+
+		fmt.Fprintf(&sb, "  %s [%s];\n", n.Id, attrs)
+	}
+
+	for _, e := range g.Edges {
+		var attrs []string
+		if e.Label != "" {
+			attrs = append(attrs, fmt.Sprintf("label=%q", e.Label))
+		}
+
+		if e.Call {
+			attrs = append(attrs, "style=dashed")
+		}
+
+		if len(attrs) > 0 {
+			fmt.Fprintf(&sb, "  %s -> %s [%s];\n", e.From, e.To, strings.Join(attrs, ", "))
+		} else {
+			fmt.Fprintf(&sb, "  %s -> %s;\n", e.From, e.To)
+		}
+	}
+
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// Mermaid render the graph as a Mermaid flowchart
+func (g *RouteGraph) Mermaid() string {
+	var sb strings.Builder
+	sb.WriteString("flowchart TD\n")
+
+	for _, n := range g.Nodes {
+		label := mermaidLabel(n.Label)
+		switch {
+		case n.Kind == StartNodeKind:
+			fmt.Fprintf(&sb, "  %s((%s))\n", n.Id, label)
+		case n.Kind == EndNodeKind:
+			fmt.Fprintf(&sb, "  %s(((%s)))\n", n.Id, label)
+		case n.Kind == RouteNodeKind:
+			fmt.Fprintf(&sb, "  %s[/%s/]\n", n.Id, label)
+		case n.Kind == SignalNodeKind:
+			fmt.Fprintf(&sb, "  %s>%s]\n", n.Id, label)
+		case n.Kind == TimerNodeKind:
+			fmt.Fprintf(&sb, "  %s([%s])\n", n.Id, label)
+		case n.StepKind == PivotStepKind:
+			fmt.Fprintf(&sb, "  %s[[%s]]\n", n.Id, label)
+		case n.StepKind == RetriableStepKind:
+			fmt.Fprintf(&sb, "  %s(%s)\n", n.Id, label)
+		default:
+			fmt.Fprintf(&sb, "  %s[%s]\n", n.Id, label)
+		}
+	}
+
+	for _, e := range g.Edges {
+		arrow := "-->"
+		if e.Call {
+			arrow = "-.->"
+		}
+
+		if e.Label != "" {
+			fmt.Fprintf(&sb, "  %s %s|%s| %s\n", e.From, arrow, mermaidLabel(e.Label), e.To)
+		} else {
+			fmt.Fprintf(&sb, "  %s %s %s\n", e.From, arrow, e.To)
+		}
+	}
+
+	return sb.String()
+}
+
+// mermaidLabel quote a label, the double quotes are written as an entity
+func mermaidLabel(label string) string {
+	return `"` + strings.ReplaceAll(label, `"`, "#quot;") + `"`
+}
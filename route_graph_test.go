@@ -0,0 +1,56 @@
+package orchestrator
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRouteGraph(t *testing.T) {
+	r := NewTransactionalRoute("R").
+		AddNextStep("1", doActionTest, undoActionTest).
+		WhenExpression(MustCompileExpression(`tier == "gold"`, nil)).
+		AddPivotStep("2", doActionTest).To("B").
+		Otherwise().
+		AddNextStep("3", doActionTest, undoActionTest).
+		End().
+		AddRetriableStep("4", doActionTest, RetryPolicy{})
+
+	g, err := NewRouteGraph(r)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []GraphNode{
+		{Id: "n0", Label: "start", Kind: StartNodeKind},
+		{Id: "n1", Label: "1", Kind: StepNodeKind},
+		{Id: "n2", Label: "2", Kind: StepNodeKind, StepKind: PivotStepKind},
+		{Id: "n3", Label: "B", Kind: RouteNodeKind},
+		{Id: "n4", Label: "3", Kind: StepNodeKind},
+		{Id: "n5", Label: "4", Kind: StepNodeKind, StepKind: RetriableStepKind},
+		{Id: "n6", Label: "end", Kind: EndNodeKind},
+	}, g.Nodes)
+
+	assert.Equal(t, []GraphEdge{
+		{From: "n0", To: "n1"},
+		{From: "n1", To: "n2", Label: `tier == "gold"`},
+		{From: "n2", To: "n3", Call: true},
+		{From: "n1", To: "n4", Label: "otherwise"},
+		{From: "n2", To: "n5"},
+		{From: "n4", To: "n5"},
+		{From: "n5", To: "n6"},
+	}, g.Edges)
+
+	assert.Contains(t, g.DOT(), `n1 -> n2 [label="tier == \"gold\""];`)
+	assert.Contains(t, g.DOT(), `n2 -> n3 [style=dashed];`)
+	assert.Contains(t, g.Mermaid(), `n1 -->|"tier == #quot;gold#quot;"| n2`)
+	assert.Contains(t, g.Mermaid(), `n2[["2"]]`)
+
+	// a closure predicate has no name
+	g, err = NewRouteGraph(NewNonTransactionalRoute("C").
+		AddNextStep("1", doActionTest).
+		When(func(ctx context) bool { return true }).
+		AddNextStep("2", doActionTest).
+		End().
+		AddNextStep("3", doActionTest))
+	assert.Nil(t, err)
+	assert.Equal(t, GraphEdge{From: "n1", To: "n2", Label: "when"}, g.Edges[1])
+	assert.Equal(t, GraphEdge{From: "n1", To: "n3", Label: "otherwise"}, g.Edges[3])
+}
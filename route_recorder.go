@@ -0,0 +1,153 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+type (
+	// routeRecorder keep the builder calls of a route to write it back as a RouteDefinition
+	routeRecorder struct {
+		// steps recorded at the route level
+		steps []*recordedStep
+
+		// current list the next step is added to
+		current *[]*recordedStep
+
+		// open conditions, each one with the list it belongs to
+		conditions []recordedCondition
+
+		// last recorded step
+		last *recordedStep
+
+		// err the first builder call which can't be applied, the route is rejected when it's registered
+		err error
+	}
+
+	recordedCondition struct {
+		step   *recordedStep
+		parent *[]*recordedStep
+	}
+
+	recordedStep struct {
+		name        string
+		kind        stepKind
+		action      func(ctx *context) error
+		undoAction  func(ctx context) error
+		timeout     time.Duration
+		retryPolicy *RetryPolicy
+		recorded    bool
+		endpoints   []*Endpoint
+
+		// names of the registered functions when the route is built from a definition
+		actionName     string
+		undoActionName string
+		predicateName  string
+
+		// source of an expression condition
+		expression string
+
+		// waiting step
+		wait *stepWait
+
+		// condition step, the predicate or the condition function
+		predicate interface{}
+		then      []*recordedStep
+		otherwise []*recordedStep
+	}
+)
+
+func (rc *routeRecorder) step(rs *recordedStep) {
+	if rc.current == nil {
+		rc.current = &rc.steps
+	}
+
+	*rc.current = append(*rc.current, rs)
+	rc.last = rs
+}
+
+func (rc *routeRecorder) when(predicate interface{}) {
+	if rc.current == nil {
+		rc.current = &rc.steps
+	}
+
+	cs := &recordedStep{predicate: predicate}
+	*rc.current = append(*rc.current, cs)
+	rc.conditions = append(rc.conditions, recordedCondition{step: cs, parent: rc.current})
+	rc.current = &cs.then
+}
+
+// otherwise return false when there is no open condition
+func (rc *routeRecorder) otherwise() bool {
+	if !rc.conditional("Otherwise") {
+		return false
+	}
+
+	rc.current = &rc.conditions[len(rc.conditions)-1].step.otherwise
+	return true
+}
+
+// end return false when there is no open condition
+func (rc *routeRecorder) end() bool {
+	if !rc.conditional("End") {
+		return false
+	}
+
+	c := rc.conditions[len(rc.conditions)-1]
+	rc.conditions = rc.conditions[:len(rc.conditions)-1]
+	rc.current = c.parent
+	return true
+}
+
+// stepped tells whether a step is recorded, the call applies to the latest one
+func (rc *routeRecorder) stepped(call string) bool {
+	if rc.last == nil {
+		rc.fail("%s before the first step", call)
+		return false
+	}
+
+	return true
+}
+
+// conditional tells whether a condition is open
+func (rc *routeRecorder) conditional(call string) bool {
+	if len(rc.conditions) == 0 {
+		rc.fail("%s without When", call)
+		return false
+	}
+
+	return true
+}
+
+// fail keep the first builder call which can't be applied
+func (rc *routeRecorder) fail(format string, args ...interface{}) {
+	if rc.err == nil {
+		rc.err = errors.New(fmt.Sprintf(format, args...))
+	}
+}
+
+// builderError the first builder call of the route which can't be applied, nil for the routes which are not built
+// by the route builders
+func builderError(route Route) error {
+	var rc *routeRecorder
+	switch r := route.(type) {
+	case *TransactionalRoute:
+		rc = &r.recorder
+	case *NonTransactionalRoute:
+		rc = &r.recorder
+	default:
+		return nil
+	}
+
+	if rc.err == nil {
+		return nil
+	}
+
+	return errors.New(fmt.Sprintf("route id %s: %v", route.GetRouteId(), rc.err))
+}
+
+// lastCondition the latest recorded condition step
+func (rc *routeRecorder) lastCondition() *recordedStep {
+	return rc.conditions[len(rc.conditions)-1].step
+}
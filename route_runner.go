@@ -1,51 +1,604 @@
 package orchestrator
 
-type routeRunner struct {
-	// runner id
-	id string
+import (
+	"fmt"
+	"time"
+)
 
-	// route root State
-	routeRootState *State
+type (
+	routeRunner struct {
+		// runner id
+		id string
 
-	// recovery route root State
-	recoveryRootState *State
+		// route root State
+		routeRootState *State
 
-	// statemachine ...
-	statemachine *statemachine
-}
+		// recovery route root State
+		recoveryRootState *State
+
+		// statemachine ...
+		statemachine *statemachine
+
+		// routes to resolve the endpoint calls
+		routes map[string]Route
+
+		// callStack endpoint states waiting for their called route
+		callStack []*callFrame
+
+		// called finished calls of each endpoint state, they are compensated before the endpoint state on rollback
+		called map[*State][]*callFrame
+
+		// attempts started action attempts of each state, the idempotency keys are numbered with them
+		attempts map[string]int
+
+		// gid execution id
+		gid string
+
+		// routeId and versions of the executed routes, they are recorded in the memento
+		routeId  string
+		versions map[string]int
+
+		// caretaker keep a memento before each step, nil means the execution is not persisted
+		caretaker caretaker
+
+		// replay replace the actions by the recorded context changes, nil means the actions are executed
+		replay *journalReplay
+
+		// execution live view of the execution, nil when the execution is not tracked
+		execution *execution
+
+		// deadline of the waiting step, zero means no timeout
+		deadline time.Time
+
+		// onWait schedule the wake-up of a parked execution
+		onWait func(gid string, signal string, deadline time.Time)
 
-func newRouteRunner(routeRootState *State, recoveryRootState *State) *routeRunner {
-	return &routeRunner{
+		clock Clock
+
+		// listener of the lifecycle events, nil means they're not emitted
+		listener ExecutionListener
+
+		// faults injected into the step attempts, nil means none is
+		faults *faultInjector
+
+		// injected faults of the execution so far, they're recorded in the memento
+		injected []InjectedFault
+
+		// resumes the runner is restored from the memento of a started execution, it resumes instead of running
+		resumes bool
+	}
+
+	callFrame struct {
+		// state caller endpoint state
+		state *State
+
+		// call index of the endpoint in the state calls
+		call int
+
+		// ctx caller context
+		ctx *context
+
+		// calleeCtx context of the called route, it's the caller context when the call is not isolated
+		calleeCtx *context
+
+		// last state of the called route when the call is finished
+		last *State
+	}
+)
+
+func newRouteRunner(routeRootState *State, recoveryRootState *State, routes map[string]Route) *routeRunner {
+	rr := &routeRunner{
 		routeRootState:    routeRootState,
 		recoveryRootState: recoveryRootState,
 		statemachine:      &statemachine{},
+		routes:            routes,
+		called:            make(map[*State][]*callFrame),
+		attempts:          make(map[string]int),
+		clock:             systemClock{},
 	}
+
+	rr.statemachine.visited = rr.visited
+	rr.statemachine.timeout = rr.timeout
+	return rr
 }
 
-func (rr *routeRunner) run(ctx *context, errCh chan<- error) {
-	var err error
+// timeout time the action timeout on the runner clock
+func (rr *routeRunner) timeout(d time.Duration) (<-chan time.Time, func()) {
+	return after(rr.clock, d)
+}
+
+// visited the state action was attempted in the execution
+func (rr *routeRunner) visited(s *State) bool {
+	return rr.attempts[s.name] > 0
+}
+
+// run execute the route from the root state; each failed step is recorded, the recovery route decides
+// whether the runner resumes, rolls back or aborts and the outcome of the whole execution is returned
+func (rr *routeRunner) run(ctx *context) *ExecutionResult {
+	rr.gid = ctx.GetGid()
+	rr.emit(&ExecutionEvent{Type: EventStarted})
+
+	if rr.routeRootState == nil {
+		result := &ExecutionResult{
+			Gid:    rr.gid,
+			Status: Completed,
+		}
+
+		rr.done(result)
+		return result
+	}
 
 	rr.statemachine.init(rr.routeRootState, ctx)
+	return rr.loop(Completed)
+}
+
+// start run the execution from the root state, or resume it when it's restored
+func (rr *routeRunner) start(ctx *context) *ExecutionResult {
+	if rr.resumes {
+		return rr.resume()
+	}
+
+	return rr.run(ctx)
+}
+
+// resume continue an execution restored from its memento
+func (rr *routeRunner) resume() *ExecutionResult {
+	status := Completed
+	if rollingBack(rr.statemachine.context) {
+		status = RolledBack
+	}
+
+	rr.emit(&ExecutionEvent{Type: EventResumed, State: rr.statemachine.state.name})
+	return rr.loop(status)
+}
+
+func (rr *routeRunner) loop(status ExecutionStatus) *ExecutionResult {
+	result := &ExecutionResult{
+		Gid:    rr.gid,
+		Status: status,
+	}
+
+	for {
+		// the state context is an isolated one inside an isolated call
+		state, sctx := rr.statemachine.state, rr.statemachine.context
+		result.State = state.name
+
+		if rr.execution != nil && !rr.execution.step(state.name) {
+			result.Errors = append(result.Errors, &StepError{State: state.name, Err: ErrCancelled, Decision: Abort})
+			result.Status = Aborted
+			rr.finish(result)
+			return result
+		}
+
+		if err := rr.checkpoint(Running, nil); err != nil {
+			result.Errors = append(result.Errors, &StepError{State: state.name, Err: err, Decision: Abort})
+			result.Status = Aborted
+			rr.done(result)
+			return result
+		}
+
+		rr.emit(&ExecutionEvent{Type: EventStateEntered, State: state.name, RollingBack: rollingBack(sctx)})
+
+		err := rr.execute(sctx, state)
+		if err == errWaiting {
+			var parked bool
+			if parked, err = rr.wait(result, sctx, state); parked {
+				return result
+			}
+		}
+
+		if err != nil {
+			switch rr.fail(result, sctx, state, err).Decision {
+			case Abort:
+				result.Status = Aborted
+				rr.finish(result)
+				return result
+			case Rollback:
+				sctx.SetVariable(transactionalRouteStatusHeaderKey, transactionalRouteStatusRollback)
+				result.Status = RolledBack
+			}
+		}
+
+		next, err := rr.advance()
+		if err != nil {
+			// the failed condition is a failure of the state it leaves, there is no transition to resume on
+			state, sctx = rr.statemachine.state, rr.statemachine.context
+			result.State = state.name
+
+			se := rr.fail(result, sctx, state, err)
+			if se.Decision != Rollback {
+				se.Decision = Abort
+				result.Status = Aborted
+				rr.finish(result)
+				return result
+			}
+
+			// the state is undone before the previous ones
+			sctx.SetVariable(transactionalRouteStatusHeaderKey, transactionalRouteStatusRollback)
+			result.Status = RolledBack
+			rr.compensateCalls(state)
+			continue
+		}
+
+		if !next {
+			break
+		}
+	}
+
+	// the rollback stopped on a passed pivot, the execution can't be rolled back
+	if result.Status == RolledBack && pivotPassed(rr.statemachine.context) {
+		result.Status = Aborted
+	}
+
+	rr.finish(result)
+	return result
+}
+
+// fail evaluate the recovery route for the failed state and record the failure in the result
+func (rr *routeRunner) fail(result *ExecutionResult, ctx *context, state *State, err error) *StepError {
+	se := rr.recover(ctx, state, err)
+	result.Errors = append(result.Errors, se)
+	rr.emit(&ExecutionEvent{Type: EventStepFailed, State: state.name, Err: se})
+
+	return se
+}
+
+// checkpoint persist the runner memento
+func (rr *routeRunner) checkpoint(status ExecutionStatus, errs []*StepError) error {
+	if rr.caretaker == nil {
+		return nil
+	}
+
+	data, err := rr.createMemento(status, errs).marshal()
+	if err != nil {
+		return err
+	}
+
+	return rr.caretaker.persist(rr.gid, data)
+}
+
+// finish persist the execution outcome and forget its side effects once it's finished, a failed checkpoint is
+// recorded in the result
+func (rr *routeRunner) finish(result *ExecutionResult) {
+	err := rr.checkpoint(result.Status, result.Errors)
+	if err == nil && rr.caretaker != nil && result.Status.isFinished() {
+		err = rr.caretaker.effects().forget(rr.gid)
+	}
+
+	if err != nil {
+		result.Errors = append(result.Errors, &StepError{State: result.State, Err: err, Decision: result.decision()})
+	}
+
+	rr.done(result)
+}
+
+// done hand the outcome to the live execution
+func (rr *routeRunner) done(result *ExecutionResult) {
+	if rr.execution != nil {
+		rr.execution.finish(result)
+	}
+
+	e := &ExecutionEvent{Type: EventFinished, State: result.State, Result: result}
+	if result.Status == Waiting {
+		e.Type = EventWaiting
+	}
+
+	rr.emit(e)
+}
+
+// rootContext the execution context, the state context is an isolated one inside an isolated call
+func (rr *routeRunner) rootContext() *context {
+	if len(rr.callStack) > 0 {
+		return rr.callStack[0].ctx
+	}
+
+	return rr.statemachine.context
+}
+
+// advance move the statemachine to the next state to execute, false when the execution is finished; a failed
+// transition condition is returned and the statemachine stays on the state
+func (rr *routeRunner) advance() (bool, error) {
+	sm := rr.statemachine
+	if !rollingBack(sm.context) && len(sm.state.calls) > 0 {
+		return rr.call(sm.state, 0)
+	}
+
+	return rr.transit()
+}
+
+// transit take the current state transition, the control returns to the caller when the called route is finished
+func (rr *routeRunner) transit() (bool, error) {
+	sm := rr.statemachine
+
+	for {
+		next, err := sm.next()
+		if err != nil {
+			return false, err
+		}
 
-	for hasNext := true; hasNext == true; hasNext, err = rr.statemachine.doAction() {
-		mst, mctx := rr.statemachine.getMemento()
+		if next {
+			if rollingBack(sm.context) {
+				rr.compensateCalls(sm.state)
+			}
+
+			return true, nil
+		}
+
+		if len(rr.callStack) == 0 {
+			return false, nil
+		}
+
+		frame := rr.callStack[len(rr.callStack)-1]
+
+		// the rollback stopped on the pivot of the called route, nothing before it is compensated in the callers
+		if rollingBack(sm.context) && pivotPassed(sm.context) &&
+			sm.state != rr.routes[frame.state.calls[frame.call].To].GetStartState() {
+			rr.unwind()
+			return false, nil
+		}
+
+		rr.callStack = rr.callStack[:len(rr.callStack)-1]
+		frame.last = sm.state
+		rr.returnFromCall(frame)
+
+		if rollingBack(frame.ctx) {
+			// a non transactional caller has nothing to undo
+			if !frame.state.transactional {
+				return false, nil
+			}
+
+			rr.compensateCalls(frame.state)
+			return true, nil
+		}
 
-		if errCh != nil && err != nil {
-			errCh <- err
+		rr.called[frame.state] = append(rr.called[frame.state], frame)
+		if frame.call+1 < len(frame.state.calls) {
+			return rr.call(frame.state, frame.call+1)
 		}
+	}
+}
+
+// call enter the start state of the called route
+func (rr *routeRunner) call(state *State, i int) (bool, error) {
+	e := state.calls[i]
+	frame := &callFrame{
+		state:     state,
+		call:      i,
+		ctx:       rr.statemachine.context,
+		calleeCtx: rr.statemachine.context,
+	}
 
-		// call error recovery handler
-		if err != nil && rr.recoveryRootState != nil {
-			rr.statemachine.init(rr.recoveryRootState, &mctx)
+	if e.Isolated {
+		frame.calleeCtx = newIsolatedContext(frame.ctx, e)
+	}
+
+	start := rr.routes[e.To].GetStartState()
+	if start == nil {
+		// an empty route returns immediately
+		if i+1 < len(state.calls) {
+			return rr.call(state, i+1)
+		}
 
-			for rcHasNext := true; rcHasNext == true; rcHasNext, err = rr.statemachine.doAction() {
-				errCh <- err
+		return rr.transit()
+	}
+
+	rr.callStack = append(rr.callStack, frame)
+	rr.statemachine.init(start, frame.calleeCtx)
+	return true, nil
+}
+
+// returnFromCall move the statemachine back to the caller endpoint state
+func (rr *routeRunner) returnFromCall(frame *callFrame) {
+	if frame.calleeCtx != frame.ctx {
+		for _, key := range []string{transactionalRouteStatusHeaderKey, transactionalRoutePivotHeaderKey} {
+			if v := frame.calleeCtx.GetVariable(key); v != nil {
+				frame.ctx.SetVariable(key, v)
 			}
+		}
 
-			rr.statemachine.init(mst, &mctx)
+		if !rollingBack(frame.ctx) {
+			for to, from := range frame.state.calls[frame.call].Outputs {
+				frame.ctx.SetVariable(to, frame.calleeCtx.GetVariable(from))
+			}
 		}
 	}
 
+	rr.statemachine.init(frame.state, frame.ctx)
+}
+
+// unwind return from all the calls to the root route without compensating the callers
+func (rr *routeRunner) unwind() {
+	for len(rr.callStack) > 0 {
+		frame := rr.callStack[len(rr.callStack)-1]
+		rr.callStack = rr.callStack[:len(rr.callStack)-1]
+		frame.last = rr.statemachine.state
+		rr.returnFromCall(frame)
+	}
+}
+
+// compensateCalls enter the latest finished call of the endpoint state to roll it back,
+// the endpoint state itself is undone once all of its calls are compensated
+func (rr *routeRunner) compensateCalls(state *State) {
+	for calls := rr.called[state]; len(calls) > 0; calls = rr.called[state] {
+		frame := calls[len(calls)-1]
+		rr.called[state] = calls[:len(calls)-1]
+
+		// a non transactional route can't be undone
+		if !frame.last.transactional {
+			continue
+		}
+
+		frame.calleeCtx.SetVariable(transactionalRouteStatusHeaderKey, transactionalRouteStatusRollback)
+		rr.callStack = append(rr.callStack, frame)
+		rr.statemachine.init(frame.last, frame.calleeCtx)
+		rr.compensateCalls(frame.last)
+		return
+	}
+}
+
+// execute call the current state action, a failed action is executed again according to the state retry policy
+func (rr *routeRunner) execute(ctx *context, state *State) error {
+	if rr.replay != nil {
+		rr.attempts[state.name]++
+		return rr.replay.execute(ctx, state)
+	}
+
+	rollingBack := ctx.GetVariable(transactionalRouteStatusHeaderKey) == transactionalRouteStatusRollback
+
+	for attempt := 1; ; attempt++ {
+		rr.attempts[state.name]++
+		key := idempotencyKey(rr.gid, state.name, rr.attempts[state.name])
+		ctx.setIdempotencyKey(key)
+
+		err := rr.attempt(ctx, state, key, attempt, rollingBack)
+		ctx.setIdempotencyKey("")
+		if err == errWaiting {
+			return err
+		}
+
+		if err == nil {
+			// from now on nothing is compensated beyond the pivot
+			if state.kind == pivot && !rollingBack {
+				ctx.SetVariable(transactionalRoutePivotHeaderKey, state.name)
+			}
+
+			return nil
+		}
+
+		rp := state.retryPolicy
+		if rollingBack || rp == nil || (rp.MaxAttempts > 0 && attempt >= rp.MaxAttempts) {
+			return err
+		}
+
+		sleep(rr.clock, rp.interval())
+	}
+}
+
+// attempt execute the state action once, an injected fault replaces it
+func (rr *routeRunner) attempt(ctx *context, state *State, key string, attempt int, rollingBack bool) error {
+	if rr.faults != nil {
+		if injected, err := rr.inject(state, attempt, rollingBack); injected {
+			return err
+		}
+	}
+
+	if state.recorded && rr.caretaker != nil {
+		return rr.executeRecorded(ctx, key)
+	}
+
+	return rr.statemachine.execute()
+}
+
+// recover evaluate the recovery route for a failed state and return the recorded failure with its decision
+func (rr *routeRunner) recover(ctx *context, state *State, err error) *StepError {
+	// the replay takes the recorded decision
+	if rr.replay != nil {
+		if se := rr.replay.recordedFailure(); se != nil {
+			return se
+		}
+	}
+
+	rollingBack := ctx.GetVariable(transactionalRouteStatusHeaderKey) == transactionalRouteStatusRollback
+
+	se := &StepError{
+		State:    state.name,
+		Err:      err,
+		Decision: Abort,
+	}
+
+	// a failed undo action can't be compensated, the failed do action of a transactional state can
+	if !rollingBack && state.transactional && state.kind != retriable {
+		se.Decision = Rollback
+	}
+
+	if rr.recoveryRootState != nil {
+		ctx.SetVariable(RecoveryErrorHeaderKey, err)
+		ctx.SetVariable(RecoveryStateHeaderKey, state.name)
+
+		se.RecoveryErr = rr.runRecovery(ctx)
+		if d, ok := toRecoveryDecision(ctx.GetVariable(RecoveryDecisionHeaderKey)); ok {
+			se.Decision = d
+		}
+
+		if se.RecoveryErr != nil {
+			se.Decision = Abort
+		}
+
+		ctx.removeVariable(RecoveryErrorHeaderKey)
+		ctx.removeVariable(RecoveryStateHeaderKey)
+		ctx.removeVariable(RecoveryDecisionHeaderKey)
+	}
+
+	// the execution is already rolling back
+	if se.Decision == Rollback && rollingBack {
+		se.Decision = Resume
+	}
+
+	// a non transactional state has no rollback transition to take and a retriable state is only retried forward
+	if se.Decision == Rollback && (!state.transactional || state.kind == retriable) {
+		se.Decision = Abort
+	}
+
+	return se
+}
+
+// runRecovery execute the recovery route on its own statemachine, the first failed recovery step stops it
+func (rr *routeRunner) runRecovery(ctx *context) error {
+	sm := &statemachine{}
+	sm.init(rr.recoveryRootState, ctx)
+
+	for {
+		if err := sm.execute(); err != nil {
+			return err
+		}
+
+		next, err := sm.next()
+		if !next || err != nil {
+			return err
+		}
+	}
+}
+
+func newIsolatedContext(ctx *context, e *Endpoint) *context {
+	ictx, _ := NewContextWithGid(fmt.Sprintf("%s/%s", ctx.GetGid(), e.To))
+	for to, from := range e.Inputs {
+		ictx.SetVariable(to, ctx.GetVariable(from))
+	}
+
+	// the called route knows the pivot passed by the caller
+	if v := ctx.GetVariable(transactionalRoutePivotHeaderKey); v != nil {
+		ictx.SetVariable(transactionalRoutePivotHeaderKey, v)
+	}
+
+	return ictx
+}
+
+func rollingBack(ctx *context) bool {
+	return ctx.GetVariable(transactionalRouteStatusHeaderKey) == transactionalRouteStatusRollback
+}
+
+// pivotPassed a pivot state is done, nothing before it is compensated
+func pivotPassed(ctx *context) bool {
+	return ctx.GetVariable(transactionalRoutePivotHeaderKey) != nil
+}
+
+func toRecoveryDecision(v interface{}) (RecoveryDecision, bool) {
+	var d RecoveryDecision
+	switch tv := v.(type) {
+	case RecoveryDecision:
+		d = tv
+	case string:
+		d = RecoveryDecision(tv)
+	default:
+		return "", false
+	}
+
+	switch d {
+	case Resume, Rollback, Abort:
+		return d, true
+	}
+
+	return "", false
 }
 
 func (rr *routeRunner) shutdown() {
@@ -0,0 +1,150 @@
+package orchestrator
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const traceKey = "TRACE"
+
+func trace(ctx *context, event string) {
+	t, _ := ctx.GetVariable(traceKey).([]string)
+	ctx.SetVariable(traceKey, append(t, event))
+}
+
+func traceDo(name string, fail bool) func(ctx *context) error {
+	return func(ctx *context) error {
+		trace(ctx, "do_"+name)
+		if fail {
+			return errors.New("do " + name + " failed")
+		}
+
+		return nil
+	}
+}
+
+func traceUndo(name string, fail bool) func(ctx context) error {
+	return func(ctx context) error {
+		trace(&ctx, "undo_"+name)
+		if fail {
+			return errors.New("undo " + name + " failed")
+		}
+
+		return nil
+	}
+}
+
+func TestRouteRunner_Run(t *testing.T) {
+	// recovery route decisions are taken in order, one for each failure
+	type recovery struct {
+		decisions []interface{}
+		fail      bool
+	}
+
+	tests := []struct {
+		name          string
+		transactional bool
+		failStep      string
+		failUndo      string
+		recovery      *recovery
+		status        ExecutionStatus
+		decisions     []RecoveryDecision
+		trace         []string
+	}{
+		{"transactional/no failure", true, "", "", nil, Completed, nil,
+			[]string{"do_1", "do_2", "do_3"}},
+		{"transactional/no recovery route", true, "2", "", nil, RolledBack, []RecoveryDecision{Rollback},
+			[]string{"do_1", "do_2", "undo_1"}},
+		{"transactional/recovery without decision", true, "2", "", &recovery{}, RolledBack, []RecoveryDecision{Rollback},
+			[]string{"do_1", "do_2", "undo_1"}},
+		{"transactional/resume", true, "2", "", &recovery{decisions: []interface{}{Resume}}, Completed, []RecoveryDecision{Resume},
+			[]string{"do_1", "do_2", "do_3"}},
+		{"transactional/rollback", true, "2", "", &recovery{decisions: []interface{}{Rollback}}, RolledBack, []RecoveryDecision{Rollback},
+			[]string{"do_1", "do_2", "undo_1"}},
+		{"transactional/abort", true, "2", "", &recovery{decisions: []interface{}{Abort}}, Aborted, []RecoveryDecision{Abort},
+			[]string{"do_1", "do_2"}},
+		{"transactional/decision as string", true, "2", "", &recovery{decisions: []interface{}{"ABORT"}}, Aborted, []RecoveryDecision{Abort},
+			[]string{"do_1", "do_2"}},
+		{"transactional/recovery failed", true, "2", "", &recovery{decisions: []interface{}{Resume}, fail: true}, Aborted, []RecoveryDecision{Abort},
+			[]string{"do_1", "do_2"}},
+		{"transactional/undo failed", true, "3", "2", nil, Aborted, []RecoveryDecision{Rollback, Abort},
+			[]string{"do_1", "do_2", "do_3", "undo_2"}},
+		{"transactional/undo failed and resumed", true, "3", "2", &recovery{decisions: []interface{}{Rollback, Resume}}, RolledBack, []RecoveryDecision{Rollback, Resume},
+			[]string{"do_1", "do_2", "do_3", "undo_2", "undo_1"}},
+		{"non transactional/no failure", false, "", "", nil, Completed, nil,
+			[]string{"do_1", "do_2", "do_3"}},
+		{"non transactional/no recovery route", false, "2", "", nil, Aborted, []RecoveryDecision{Abort},
+			[]string{"do_1", "do_2"}},
+		{"non transactional/recovery without decision", false, "2", "", &recovery{}, Aborted, []RecoveryDecision{Abort},
+			[]string{"do_1", "do_2"}},
+		{"non transactional/resume", false, "2", "", &recovery{decisions: []interface{}{Resume}}, Completed, []RecoveryDecision{Resume},
+			[]string{"do_1", "do_2", "do_3"}},
+		{"non transactional/rollback", false, "2", "", &recovery{decisions: []interface{}{Rollback}}, Aborted, []RecoveryDecision{Abort},
+			[]string{"do_1", "do_2"}},
+		{"non transactional/abort", false, "2", "", &recovery{decisions: []interface{}{Abort}}, Aborted, []RecoveryDecision{Abort},
+			[]string{"do_1", "do_2"}},
+		{"non transactional/recovery failed", false, "2", "", &recovery{decisions: []interface{}{Resume}, fail: true}, Aborted, []RecoveryDecision{Abort},
+			[]string{"do_1", "do_2"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var root *State
+			if tc.transactional {
+				root = NewTransactionalRoute("TR").
+					AddNextStep("1", traceDo("1", tc.failStep == "1"), traceUndo("1", tc.failUndo == "1")).
+					AddNextStep("2", traceDo("2", tc.failStep == "2"), traceUndo("2", tc.failUndo == "2")).
+					AddNextStep("3", traceDo("3", tc.failStep == "3"), traceUndo("3", tc.failUndo == "3")).
+					GetStartState()
+			} else {
+				root = NewNonTransactionalRoute("NTR").
+					AddNextStep("1", traceDo("1", tc.failStep == "1")).
+					AddNextStep("2", traceDo("2", tc.failStep == "2")).
+					AddNextStep("3", traceDo("3", tc.failStep == "3")).
+					GetStartState()
+			}
+
+			var recoveryRoot *State
+			if tc.recovery != nil {
+				rc := &recovery{decisions: tc.recovery.decisions, fail: tc.recovery.fail}
+				recoveryRoot = NewNonTransactionalRoute(DefaultRecoveryRouteId).
+					AddNextStep("decide", func(ctx *context) error {
+						assert.NotNil(t, ctx.GetVariable(RecoveryErrorHeaderKey))
+						assert.NotNil(t, ctx.GetVariable(RecoveryStateHeaderKey))
+
+						if len(rc.decisions) > 0 {
+							ctx.SetVariable(RecoveryDecisionHeaderKey, rc.decisions[0])
+							rc.decisions = rc.decisions[1:]
+						}
+
+						if rc.fail {
+							return errors.New("recovery failed")
+						}
+
+						return nil
+					}).
+					GetStartState()
+			}
+
+			ctx, _ := NewContext()
+			result := newRouteRunner(root, recoveryRoot, nil).run(ctx)
+
+			assert.Equal(t, tc.status, result.Status)
+			assert.Equal(t, ctx.GetGid(), result.Gid)
+			assert.Equal(t, tc.trace, ctx.GetVariable(traceKey))
+			assert.Nil(t, ctx.GetVariable(RecoveryErrorHeaderKey))
+			assert.Nil(t, ctx.GetVariable(RecoveryDecisionHeaderKey))
+
+			var decisions []RecoveryDecision
+			for _, se := range result.Errors {
+				decisions = append(decisions, se.Decision)
+				assert.NotNil(t, se.Err)
+				assert.Equal(t, tc.recovery != nil && tc.recovery.fail, se.RecoveryErr != nil)
+			}
+
+			assert.Equal(t, tc.decisions, decisions)
+			assert.Equal(t, len(tc.decisions) > 0, result.Err() != nil)
+		})
+	}
+}
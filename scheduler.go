@@ -0,0 +1,438 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// OverlapPolicy tell what to do when a run is due while the previous run of the trigger is not finished
+	OverlapPolicy string
+
+	// CatchUpPolicy tell what to do with the runs missed while the scheduler was down
+	CatchUpPolicy string
+
+	// Trigger start an execution of a route on each run of the schedule
+	Trigger struct {
+		Id      string
+		RouteId string
+
+		Schedule Schedule
+
+		// Context create the context of the run scheduled at the time, nil means an empty context
+		Context func(scheduled time.Time) (*context, error)
+
+		// Overlap default is SkipOverlap
+		Overlap OverlapPolicy
+
+		// CatchUp default is CatchUpOnce
+		CatchUp CatchUpPolicy
+	}
+
+	// TriggerInfo is the state of a scheduled trigger
+	TriggerInfo struct {
+		Id      string     `json:"id"`
+		RouteId string     `json:"route_id"`
+		LastRun *time.Time `json:"last_run,omitempty"`
+		NextRun *time.Time `json:"next_run,omitempty"`
+
+		// Running executions started by the trigger and not finished yet
+		Running int `json:"running"`
+
+		// Queued runs waiting for the running execution
+		Queued int `json:"queued"`
+
+		// LastGid the latest started execution
+		LastGid    string          `json:"last_gid,omitempty"`
+		LastStatus ExecutionStatus `json:"last_status,omitempty"`
+		LastError  string          `json:"last_error,omitempty"`
+	}
+
+	scheduler struct {
+		o *orchestrator
+
+		// caretaker keep the last and next run times by trigger id, nil means the runs missed while the
+		// scheduler was down are lost
+		caretaker caretaker
+
+		lock     sync.Mutex
+		triggers map[string]*scheduledTrigger
+
+		stop chan struct{}
+
+		// runs started executions
+		runs sync.WaitGroup
+	}
+
+	scheduledTrigger struct {
+		Trigger
+
+		lastRun time.Time
+		nextRun time.Time
+
+		running int
+		queue   []time.Time
+
+		lastGid    string
+		lastStatus ExecutionStatus
+		lastError  string
+	}
+
+	// triggerMemento is persisted on each run
+	triggerMemento struct {
+		LastRun *time.Time `json:"last_run,omitempty"`
+		NextRun *time.Time `json:"next_run,omitempty"`
+	}
+)
+
+const (
+	// SkipOverlap drop the run
+	SkipOverlap OverlapPolicy = "SKIP"
+	// QueueOverlap start the run once the previous runs are finished
+	QueueOverlap OverlapPolicy = "QUEUE"
+	// AllowOverlap start the run concurrently
+	AllowOverlap OverlapPolicy = "ALLOW"
+
+	// CatchUpNone drop the missed runs, the trigger runs on its next time after the restart
+	CatchUpNone CatchUpPolicy = "NONE"
+	// CatchUpOnce start one run for all the missed runs
+	CatchUpOnce CatchUpPolicy = "ONCE"
+	// CatchUpAll start every missed run
+	CatchUpAll CatchUpPolicy = "ALL"
+)
+
+// ScheduledTimeHeaderKey keep the time the run is scheduled at in the execution context
+const ScheduledTimeHeaderKey = "SCHEDULED_TIME"
+
+// triggerIdPrefix keep the trigger records apart from the executions when they share the caretaker
+const triggerIdPrefix = "trigger/"
+
+// NewScheduler create a scheduler starting the executions through the orchestrator Exec, the caretaker keeps the
+// trigger run times under the trigger/ ids and may be the one of the executions
+func NewScheduler(o *orchestrator, c caretaker) *scheduler {
+	return &scheduler{
+		o:         o,
+		caretaker: c,
+		triggers:  make(map[string]*scheduledTrigger),
+	}
+}
+
+// Schedule register the trigger, the run times persisted for the trigger id are restored and the missed runs
+// are handled according to the catch-up policy
+func (s *scheduler) Schedule(t Trigger) error {
+	if err := s.validate(&t); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.triggers[t.Id] != nil {
+		return errors.New(fmt.Sprintf("trigger %s is already scheduled", t.Id))
+	}
+
+	st := &scheduledTrigger{Trigger: t}
+	now := s.o.clock.Now()
+
+	if err := s.restore(st); err != nil {
+		return err
+	}
+
+	if st.nextRun.IsZero() || (t.CatchUp == CatchUpNone && st.nextRun.Before(now)) {
+		st.nextRun = t.Schedule.Next(now)
+	}
+
+	if err := s.persist(st); err != nil {
+		return err
+	}
+
+	s.triggers[t.Id] = st
+	return nil
+}
+
+func (s *scheduler) validate(t *Trigger) error {
+	if t.Id == "" {
+		return errors.New("trigger id is empty")
+	}
+
+	if t.Schedule == nil {
+		return errors.New(fmt.Sprintf("trigger %s: schedule is not defined", t.Id))
+	}
+
+	s.o.lock.RLock()
+	_, ok := s.o.routes[t.RouteId]
+	s.o.lock.RUnlock()
+
+	if !ok {
+		return errors.New(fmt.Sprintf("trigger %s: route %s not found", t.Id, t.RouteId))
+	}
+
+	switch t.Overlap {
+	case "":
+		t.Overlap = SkipOverlap
+	case SkipOverlap, QueueOverlap, AllowOverlap:
+	default:
+		return errors.New(fmt.Sprintf("trigger %s: unknown overlap policy %s", t.Id, t.Overlap))
+	}
+
+	switch t.CatchUp {
+	case "":
+		t.CatchUp = CatchUpOnce
+	case CatchUpNone, CatchUpOnce, CatchUpAll:
+	default:
+		return errors.New(fmt.Sprintf("trigger %s: unknown catch-up policy %s", t.Id, t.CatchUp))
+	}
+
+	return nil
+}
+
+// Unschedule remove the trigger, the started executions go on and the persisted run times are kept
+func (s *scheduler) Unschedule(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	st := s.triggers[id]
+	if st == nil {
+		return errors.New(fmt.Sprintf("trigger %s not found", id))
+	}
+
+	st.queue = nil
+	delete(s.triggers, id)
+	return nil
+}
+
+// Triggers return the scheduled triggers sorted by id
+func (s *scheduler) Triggers() []*TriggerInfo {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	result := make([]*TriggerInfo, 0, len(s.triggers))
+	for _, st := range s.triggers {
+		result = append(result, st.info())
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Id < result[j].Id
+	})
+
+	return result
+}
+
+// Start check the due triggers every interval until the scheduler is stopped
+func (s *scheduler) Start(interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New("scheduler interval must be positive")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.stop != nil {
+		return errors.New("scheduler is already started")
+	}
+
+	s.stop = make(chan struct{})
+
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			s.RunDue()
+
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}(s.stop)
+
+	return nil
+}
+
+// Stop stop checking the triggers and wait for the started and queued executions
+func (s *scheduler) Stop() {
+	s.lock.Lock()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+	s.lock.Unlock()
+
+	s.runs.Wait()
+}
+
+// RunDue start the runs of the triggers which next run time is passed
+func (s *scheduler) RunDue() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.o.clock.Now()
+	for _, st := range s.triggers {
+		if st.nextRun.IsZero() || st.nextRun.After(now) {
+			continue
+		}
+
+		for !st.nextRun.IsZero() && !st.nextRun.After(now) {
+			s.fire(st, st.nextRun)
+			st.lastRun = st.nextRun
+
+			if st.CatchUp == CatchUpAll {
+				st.nextRun = st.Schedule.Next(st.nextRun)
+				continue
+			}
+
+			st.nextRun = st.Schedule.Next(now)
+		}
+
+		if err := s.persist(st); err != nil {
+			st.lastError = err.Error()
+		}
+	}
+}
+
+// fire start the run according to the overlap policy
+func (s *scheduler) fire(st *scheduledTrigger, scheduled time.Time) {
+	if st.running > 0 {
+		switch st.Overlap {
+		case SkipOverlap:
+			return
+		case QueueOverlap:
+			st.queue = append(st.queue, scheduled)
+			return
+		}
+	}
+
+	st.running++
+	s.runs.Add(1)
+	go s.run(st, scheduled)
+}
+
+// run execute the run and the runs queued meanwhile
+func (s *scheduler) run(st *scheduledTrigger, scheduled time.Time) {
+	defer s.runs.Done()
+
+	for {
+		result, err := s.exec(st, scheduled)
+
+		s.lock.Lock()
+		st.running--
+		st.lastError = ""
+		if err != nil {
+			st.lastError = err.Error()
+		}
+
+		if result != nil {
+			st.lastGid = result.Gid
+			st.lastStatus = result.Status
+			if rErr := result.Err(); rErr != nil {
+				st.lastError = rErr.Error()
+			}
+		}
+
+		if len(st.queue) == 0 {
+			s.lock.Unlock()
+			return
+		}
+
+		scheduled = st.queue[0]
+		st.queue = st.queue[1:]
+		st.running++
+		s.lock.Unlock()
+	}
+}
+
+func (s *scheduler) exec(st *scheduledTrigger, scheduled time.Time) (*ExecutionResult, error) {
+	var ctx *context
+	var err error
+	if st.Context != nil {
+		ctx, err = st.Context(scheduled)
+	} else {
+		ctx, err = NewContext()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ctx.SetVariable(ScheduledTimeHeaderKey, scheduled); err != nil {
+		return nil, err
+	}
+
+	return s.o.Exec(st.RouteId, ctx)
+}
+
+func (s *scheduler) restore(st *scheduledTrigger) error {
+	if s.caretaker == nil {
+		return nil
+	}
+
+	data, err := s.caretaker.get(triggerIdPrefix + st.Id)
+	if err != nil || data == "" {
+		return err
+	}
+
+	var tm triggerMemento
+	if err := json.Unmarshal([]byte(data), &tm); err != nil {
+		return errors.New(fmt.Sprintf("trigger %s: %v", st.Id, err))
+	}
+
+	if tm.LastRun != nil {
+		st.lastRun = *tm.LastRun
+	}
+
+	if tm.NextRun != nil {
+		st.nextRun = *tm.NextRun
+	}
+
+	return nil
+}
+
+func (s *scheduler) persist(st *scheduledTrigger) error {
+	if s.caretaker == nil {
+		return nil
+	}
+
+	info := st.info()
+	data, err := json.Marshal(triggerMemento{LastRun: info.LastRun, NextRun: info.NextRun})
+	if err != nil {
+		return err
+	}
+
+	return s.caretaker.persist(triggerIdPrefix+st.Id, string(data))
+}
+
+func (st *scheduledTrigger) info() *TriggerInfo {
+	info := &TriggerInfo{
+		Id:         st.Id,
+		RouteId:    st.RouteId,
+		Running:    st.running,
+		Queued:     len(st.queue),
+		LastGid:    st.lastGid,
+		LastStatus: st.lastStatus,
+		LastError:  st.lastError,
+	}
+
+	if !st.lastRun.IsZero() {
+		lastRun := st.lastRun
+		info.LastRun = &lastRun
+	}
+
+	if !st.nextRun.IsZero() {
+		nextRun := st.nextRun
+		info.NextRun = &nextRun
+	}
+
+	return info
+}
+
+// isTriggerId tell the ids of the trigger records, they are skipped where the executions are listed
+func isTriggerId(id string) bool {
+	return strings.HasPrefix(id, triggerIdPrefix)
+}
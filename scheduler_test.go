@@ -0,0 +1,228 @@
+package orchestrator
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+// scheduledRuns record the scheduled times of the route A executions, the executions block until release is closed
+type scheduledRuns struct {
+	lock    sync.Mutex
+	times   []time.Time
+	release chan struct{}
+}
+
+func (sr *scheduledRuns) route() *NonTransactionalRoute {
+	return NewNonTransactionalRoute("A").
+		AddNextStep("1", func(ctx *context) error {
+			sr.lock.Lock()
+			sr.times = append(sr.times, ctx.GetVariable(ScheduledTimeHeaderKey).(time.Time))
+			sr.lock.Unlock()
+
+			if sr.release != nil {
+				<-sr.release
+			}
+
+			return nil
+		})
+}
+
+func (sr *scheduledRuns) count() int {
+	sr.lock.Lock()
+	defer sr.lock.Unlock()
+
+	return len(sr.times)
+}
+
+func newSchedulerOrchestrator(clock Clock, route Route) *orchestrator {
+	orch := NewOrchestrator()
+	orch.SetClock(clock)
+	_ = orch.Register(route)
+	_ = orch.Initialization(nil)
+
+	return orch
+}
+
+func TestScheduler_RunDue(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := &testClock{now: start}
+	runs := &scheduledRuns{}
+	orch := newSchedulerOrchestrator(clock, runs.route())
+
+	schedule, _ := ParseCron("0 * * * *")
+	s := NewScheduler(orch, nil)
+	err := s.Schedule(Trigger{
+		Id:       "hourly",
+		RouteId:  "A",
+		Schedule: schedule,
+		Context: func(scheduled time.Time) (*context, error) {
+			return NewContextWithGid("A-" + scheduled.Format(time.RFC3339))
+		},
+	})
+	assert.Nil(t, err)
+
+	s.RunDue()
+	s.Stop()
+	assert.Equal(t, 0, runs.count())
+
+	clock.add(time.Hour + time.Minute)
+	s.RunDue()
+	s.Stop()
+	assert.Equal(t, []time.Time{start.Add(time.Hour)}, runs.times)
+
+	info := s.Triggers()[0]
+	assert.Equal(t, start.Add(time.Hour), *info.LastRun)
+	assert.Equal(t, start.Add(2*time.Hour), *info.NextRun)
+	assert.Equal(t, "A-2020-01-01T01:00:00Z", info.LastGid)
+	assert.Equal(t, Completed, info.LastStatus)
+	assert.Equal(t, 0, info.Running)
+}
+
+func TestScheduler_Overlap(t *testing.T) {
+	tests := []struct {
+		overlap  OverlapPolicy
+		running  int
+		queued   int
+		executed int
+	}{
+		{SkipOverlap, 1, 0, 1},
+		{QueueOverlap, 1, 1, 2},
+		{AllowOverlap, 2, 0, 2},
+	}
+
+	for _, test := range tests {
+		clock := &testClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+		runs := &scheduledRuns{release: make(chan struct{})}
+		orch := newSchedulerOrchestrator(clock, runs.route())
+
+		schedule, _ := Every(time.Minute)
+		s := NewScheduler(orch, nil)
+		assert.Nil(t, s.Schedule(Trigger{Id: "T", RouteId: "A", Schedule: schedule, Overlap: test.overlap}))
+
+		clock.add(time.Minute)
+		s.RunDue()
+		clock.add(time.Minute)
+		s.RunDue()
+
+		info := s.Triggers()[0]
+		assert.Equal(t, test.running, info.Running, test.overlap)
+		assert.Equal(t, test.queued, info.Queued, test.overlap)
+
+		close(runs.release)
+		for s.Triggers()[0].Running > 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		s.Stop()
+		assert.Equal(t, test.executed, runs.count(), test.overlap)
+	}
+}
+
+func TestScheduler_CatchUp(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	down := 3*time.Hour + 30*time.Minute
+
+	tests := []struct {
+		catchUp CatchUpPolicy
+		times   []time.Time
+		nextRun time.Time
+	}{
+		{CatchUpNone, nil, start.Add(down + time.Hour)},
+		{CatchUpOnce, []time.Time{start.Add(time.Hour)}, start.Add(down + time.Hour)},
+		{CatchUpAll, []time.Time{start.Add(time.Hour), start.Add(2 * time.Hour), start.Add(3 * time.Hour)},
+			start.Add(4 * time.Hour)},
+	}
+
+	for _, test := range tests {
+		journal := NewMemoryCaretaker()
+		clock := &testClock{now: start}
+		runs := &scheduledRuns{}
+		schedule, _ := Every(time.Hour)
+		trigger := Trigger{Id: "T", RouteId: "A", Schedule: schedule, Overlap: QueueOverlap, CatchUp: test.catchUp}
+
+		s := NewScheduler(newSchedulerOrchestrator(clock, runs.route()), journal)
+		assert.Nil(t, s.Schedule(trigger))
+
+		// restart after the downtime
+		clock.add(down)
+		s = NewScheduler(newSchedulerOrchestrator(clock, runs.route()), journal)
+		assert.Nil(t, s.Schedule(trigger))
+
+		s.RunDue()
+		s.Stop()
+
+		assert.Equal(t, test.times, runs.times, test.catchUp)
+		assert.Equal(t, test.nextRun, *s.Triggers()[0].NextRun, test.catchUp)
+	}
+}
+
+func TestScheduler_SharedCaretaker(t *testing.T) {
+	journal := NewMemoryCaretaker()
+	clock := &testClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	runs := &scheduledRuns{}
+
+	orch := NewOrchestrator()
+	orch.SetClock(clock)
+	orch.SetCaretaker(journal)
+	_ = orch.Register(runs.route())
+	_ = orch.Initialization(nil)
+
+	schedule, _ := Every(time.Hour)
+	s := NewScheduler(orch, journal)
+	assert.Nil(t, s.Schedule(Trigger{Id: "T", RouteId: "A", Schedule: schedule}))
+
+	clock.add(time.Hour)
+	s.RunDue()
+	s.Stop()
+
+	// the trigger record isn't listed with the executions
+	infos, err := orch.Executions("")
+	assert.Nil(t, err)
+	assert.Len(t, infos, 1)
+	assert.Equal(t, "A", infos[0].RouteId)
+
+	_, err = orch.Execution("trigger/T")
+	assert.True(t, errors.Is(err, ErrExecutionNotFound))
+
+	ctx, _ := NewContextWithGid("trigger/T")
+	_, err = orch.Exec("A", ctx)
+	assert.Equal(t, "gid trigger/T is reserved for the trigger records", err.Error())
+
+	// the run times are restored from the shared caretaker
+	s = NewScheduler(orch, journal)
+	assert.Nil(t, s.Schedule(Trigger{Id: "T", RouteId: "A", Schedule: schedule}))
+	assert.Equal(t, clock.Now(), *s.Triggers()[0].LastRun)
+}
+
+func TestScheduler_Schedule(t *testing.T) {
+	clock := &testClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	orch := newSchedulerOrchestrator(clock, (&scheduledRuns{}).route())
+	schedule, _ := Every(time.Hour)
+
+	s := NewScheduler(orch, nil)
+	assert.Nil(t, s.Schedule(Trigger{Id: "T", RouteId: "A", Schedule: schedule}))
+
+	tests := []struct {
+		trigger  Trigger
+		expected string
+	}{
+		{Trigger{RouteId: "A", Schedule: schedule}, "trigger id is empty"},
+		{Trigger{Id: "U", RouteId: "A"}, "trigger U: schedule is not defined"},
+		{Trigger{Id: "U", RouteId: "B", Schedule: schedule}, "trigger U: route B not found"},
+		{Trigger{Id: "U", RouteId: "A", Schedule: schedule, Overlap: "NEVER"}, "trigger U: unknown overlap policy NEVER"},
+		{Trigger{Id: "U", RouteId: "A", Schedule: schedule, CatchUp: "SOME"}, "trigger U: unknown catch-up policy SOME"},
+		{Trigger{Id: "T", RouteId: "A", Schedule: schedule}, "trigger T is already scheduled"},
+	}
+
+	for _, test := range tests {
+		err := s.Schedule(test.trigger)
+		assert.EqualError(t, err, test.expected)
+	}
+
+	assert.Nil(t, s.Unschedule("T"))
+	assert.EqualError(t, s.Unschedule("T"), "trigger T not found")
+	assert.Empty(t, s.Triggers())
+}
@@ -0,0 +1,130 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+type (
+	// sideEffect is the recorded outcome of a step action, the context changes and the failure
+	sideEffect struct {
+		Variables map[string]variableMemento `json:"variables,omitempty"`
+		Removed   []string                   `json:"removed,omitempty"`
+		Error     string                     `json:"error,omitempty"`
+	}
+
+	// effectStore keep the recorded side effects of the unfinished executions apart from their mementos, they're
+	// forgotten once the execution is finished
+	effectStore interface {
+		record(gid string, key string, effect string) error
+
+		// recorded return an empty effect when the attempt isn't recorded
+		recorded(gid string, key string) (string, error)
+
+		forget(gid string) error
+	}
+)
+
+// IdempotencyKey return the key of the step attempt in progress, it's the same when the attempt runs again after
+// a resume; the downstream services can deduplicate their calls with it. It's empty outside a step
+func (ctx *context) IdempotencyKey() string {
+	ctx.lock.Lock()
+	defer ctx.lock.Unlock()
+
+	return ctx.idempotencyKey
+}
+
+func (ctx *context) setIdempotencyKey(key string) {
+	ctx.lock.Lock()
+	defer ctx.lock.Unlock()
+
+	ctx.idempotencyKey = key
+}
+
+func idempotencyKey(gid string, state string, attempt int) string {
+	return fmt.Sprintf("%s/%s/%d", gid, state, attempt)
+}
+
+// executeRecorded apply the recorded outcome of the step attempt, the action is executed and its outcome recorded
+// when there is none. A recorded failure keeps its message only, it's applied as a plain error which doesn't match
+// the failure type nor the errors it wrapped. A timed out action is not recorded since it may still be running
+func (rr *routeRunner) executeRecorded(ctx *context, key string) error {
+	effects := rr.caretaker.effects()
+
+	data, err := effects.recorded(rr.gid, key)
+	if err != nil {
+		return err
+	}
+
+	if data != "" {
+		se := &sideEffect{}
+		if err := json.Unmarshal([]byte(data), se); err != nil {
+			return err
+		}
+
+		return se.apply(ctx)
+	}
+
+	before := newContextMemento(ctx)
+	err = rr.statemachine.execute()
+	if err == errWaiting || errors.Is(err, ErrStepTimeout) {
+		return err
+	}
+
+	record, mErr := json.Marshal(newSideEffect(before, newContextMemento(ctx), err))
+	if mErr == nil {
+		mErr = effects.record(rr.gid, key, string(record))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return mErr
+}
+
+func newSideEffect(before contextMemento, after contextMemento, err error) *sideEffect {
+	se := &sideEffect{Variables: make(map[string]variableMemento)}
+	for k, v := range after.Variables {
+		if b, ok := before.Variables[k]; !ok || !reflect.DeepEqual(b, v) {
+			se.Variables[k] = v
+		}
+	}
+
+	for k := range before.Variables {
+		if _, ok := after.Variables[k]; !ok {
+			se.Removed = append(se.Removed, k)
+		}
+	}
+
+	if err != nil {
+		se.Error = err.Error()
+	}
+
+	return se
+}
+
+// apply the context changes through the context setters so they're written through the grid
+func (se *sideEffect) apply(ctx *context) error {
+	for k, v := range se.Variables {
+		ctx.lock.Lock()
+		last := ctx.variables[k].version
+		ctx.lock.Unlock()
+
+		if err := ctx.SetVariableWithVersion(k, last, v.Version, v.Value); err != nil {
+			return err
+		}
+	}
+
+	for _, k := range se.Removed {
+		ctx.removeVariable(k)
+	}
+
+	if se.Error != "" {
+		return errors.New(se.Error)
+	}
+
+	return nil
+}
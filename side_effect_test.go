@@ -0,0 +1,115 @@
+package orchestrator
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// crashingCaretaker stop persisting the mementos once it crashed, the side effects are still recorded
+type crashingCaretaker struct {
+	caretaker
+	crashed bool
+}
+
+func (cc *crashingCaretaker) persist(id string, memento string) error {
+	if cc.crashed {
+		return errors.New("crashed")
+	}
+
+	return cc.caretaker.persist(id, memento)
+}
+
+func TestRecordedStep_Resume(t *testing.T) {
+	journal := NewMemoryCaretaker()
+	crashing := &crashingCaretaker{caretaker: journal}
+
+	var charges []string
+	route := func() *TransactionalRoute {
+		return NewTransactionalRoute("A").
+			AddNextStep("1", appendStep("1"), nil).
+			AddNextStep("charge", func(ctx *context) error {
+				charges = append(charges, ctx.IdempotencyKey())
+				crashing.crashed = true
+
+				ctx.removeVariable("STEPS")
+				return ctx.SetVariable("charge_id", ctx.IdempotencyKey())
+			}, nil).Recorded().
+			AddNextStep("3", appendStep("3"), nil)
+	}
+
+	orch := NewOrchestrator()
+	orch.SetCaretaker(crashing)
+	_ = orch.Register(route())
+	_ = orch.Initialization(nil)
+
+	ctx, _ := NewContextWithGid("gid")
+	result, _ := orch.Exec("A", ctx)
+	assert.Equal(t, Aborted, result.Status)
+
+	// the execution is resumed from the charge step after a restart
+	orch = NewOrchestrator()
+	orch.SetCaretaker(journal)
+	_ = orch.Register(route())
+	_ = orch.Initialization(nil)
+
+	info, _ := orch.Execution("gid")
+	assert.Equal(t, Running, info.Status)
+	assert.Equal(t, "A_charge", info.State)
+
+	result, err := orch.Resume("gid")
+	assert.Nil(t, err)
+	assert.Equal(t, Completed, result.Status)
+	assert.Equal(t, []string{"gid/A_charge/1"}, charges)
+
+	info, _ = orch.Execution("gid")
+	assert.Equal(t, "gid/A_charge/1", info.Variables["charge_id"])
+	assert.Equal(t, "3;", info.Variables["STEPS"])
+
+	executions, _ := orch.Executions("")
+	assert.Len(t, executions, 1)
+
+	// the side effects are forgotten once the execution is finished
+	data, _ := journal.effects().recorded("gid", "gid/A_charge/1")
+	assert.Equal(t, "", data)
+}
+
+func TestRecordedStep_Retry(t *testing.T) {
+	journal := NewMemoryCaretaker()
+
+	attempts := 0
+	orch := NewOrchestrator()
+	orch.SetCaretaker(journal)
+	_ = orch.Register(NewNonTransactionalRoute("A").
+		AddNextStep("call", func(ctx *context) error {
+			attempts++
+			if attempts == 1 {
+				return errors.New("unavailable")
+			}
+
+			return ctx.SetVariable("key", ctx.IdempotencyKey())
+		}).Recorded().Retry(RetryPolicy{MaxAttempts: 2, Interval: time.Millisecond}))
+	_ = orch.Initialization(nil)
+
+	ctx, _ := NewContextWithGid("gid")
+	result, _ := orch.Exec("A", ctx)
+	assert.Equal(t, Completed, result.Status)
+	assert.Equal(t, "gid/A_call/2", ctx.GetVariable("key"))
+	assert.Equal(t, "", ctx.IdempotencyKey())
+
+	ids, _ := journal.ids()
+	assert.Equal(t, []string{"gid"}, ids)
+
+	// the recorded outcomes are applied in turn
+	_ = journal.effects().record("gid", "gid/A_call/1", `{"error":"unavailable"}`)
+	_ = journal.effects().record("gid", "gid/A_call/2", `{"variables":{"key":{"version":"v1","value":"gid/A_call/2"}}}`)
+
+	rr, _ := orch.newRunner("A", nil)
+	rr.caretaker = journal
+	ctx, _ = NewContextWithGid("gid")
+	result = rr.run(ctx)
+	assert.Equal(t, Completed, result.Status)
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, "gid/A_call/2", ctx.GetVariable("key"))
+}
@@ -0,0 +1,195 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Waiting the execution is parked on a signal or a timer step, it's resumed when the signal arrives or its
+// deadline passes
+const Waiting ExecutionStatus = "WAITING"
+
+// SignalTimeoutHeaderKey keep the name of the signal which timed out on a step continuing on timeout
+const SignalTimeoutHeaderKey = "SIGNAL_TIMEOUT"
+
+const (
+	// signalHeaderKey delivery of the signal the state waits for, it's consumed by the waiting step
+	signalHeaderKey = "SIGNAL_DELIVERY"
+
+	signalReceived = "RECEIVED"
+	signalTimedOut = "TIMED_OUT"
+)
+
+var (
+	// ErrSignalTimeout is returned by a signal step when the signal didn't arrive before its timeout
+	ErrSignalTimeout = errors.New("signal timeout")
+
+	// errWaiting park the execution, nothing is delivered yet
+	errWaiting = errors.New("waiting")
+)
+
+// stepWait park the execution on a step until a signal arrives or a deadline passes
+type stepWait struct {
+	// signal the step waits for, empty on a timer step which only waits for its deadline
+	signal string
+
+	// timeout of the signal or duration of the timer, zero means the signal step waits until the signal arrives
+	timeout time.Duration
+
+	// until context variable keeping the wake-up time of the timer
+	until string
+
+	// continueOnTimeout take the next step on timeout instead of failing
+	continueOnTimeout bool
+}
+
+// action consume the delivery, the execution is parked as long as nothing is delivered
+func (sw *stepWait) action(ctx *context) error {
+	delivery := ctx.GetVariable(signalHeaderKey)
+	if delivery == nil {
+		return errWaiting
+	}
+
+	ctx.removeVariable(signalHeaderKey)
+
+	// a timer is done when its deadline passes
+	if sw.signal == "" {
+		return nil
+	}
+
+	if delivery != signalTimedOut {
+		if ctx.GetVariable(SignalTimeoutHeaderKey) == sw.signal {
+			ctx.removeVariable(SignalTimeoutHeaderKey)
+		}
+
+		return nil
+	}
+
+	if !sw.continueOnTimeout {
+		return fmt.Errorf("signal %s: %w", sw.signal, ErrSignalTimeout)
+	}
+
+	return ctx.SetVariable(SignalTimeoutHeaderKey, sw.signal)
+}
+
+// deadline of the wait, zero when the step waits without timeout
+func (sw *stepWait) deadline(ctx *context, now time.Time) (time.Time, error) {
+	if sw.until == "" {
+		if sw.timeout <= 0 {
+			return time.Time{}, nil
+		}
+
+		return now.Add(sw.timeout), nil
+	}
+
+	switch v := ctx.GetVariable(sw.until).(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		// the time is persisted as a string
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, errors.New(fmt.Sprintf("variable %s is not a time", sw.until))
+}
+
+// SignalTimedOut is true after a step continuing on timeout didn't receive the signal
+func SignalTimedOut(name string) func(ctx context) bool {
+	return func(ctx context) bool {
+		return ctx.GetVariable(SignalTimeoutHeaderKey) == name
+	}
+}
+
+// Signal deliver a signal to an execution waiting for it, the payload is merged into the waiting step context
+// and the execution is resumed until it finishes or waits again
+func (o *orchestrator) Signal(gid string, name string, payload map[string]interface{}) (*ExecutionResult, error) {
+	if name == "" {
+		return nil, errors.New("signal name is empty")
+	}
+
+	rr, err := o.prepareDelivery(gid, name, signalReceived, nil, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return o.resumeRunner(rr)
+}
+
+// prepareDelivery create the runner of an execution waiting for the signal, the empty signal of a timer.
+// A timeout is only delivered when the execution still waits on the deadline it's scheduled for
+func (o *orchestrator) prepareDelivery(gid string, signal string, delivery string, deadline *time.Time,
+	payload map[string]interface{}) (*routeRunner, error) {
+	o.timersLock.Lock()
+	defer o.timersLock.Unlock()
+
+	m, err := o.loadMemento(gid)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.Status != Waiting || m.Signal != signal {
+		return nil, errors.New(fmt.Sprintf("execution %s is not waiting for signal %s", gid, signal))
+	}
+
+	if deadline != nil && (m.Deadline == nil || !m.Deadline.Equal(*deadline)) {
+		return nil, errors.New(fmt.Sprintf("execution %s waits on another deadline", gid))
+	}
+
+	rr, err := o.runnerFromMemento(m)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := rr.statemachine.context
+	for k, v := range payload {
+		if err := ctx.SetVariable(k, v); err != nil {
+			return nil, err
+		}
+	}
+
+	_ = ctx.SetVariable(signalHeaderKey, delivery)
+
+	if wt := o.timers[gid]; wt != nil {
+		wt.stop()
+		delete(o.timers, gid)
+	}
+
+	if err := o.track(rr, rr.rootContext()); err != nil {
+		return nil, err
+	}
+
+	return rr, nil
+}
+
+// wait park the execution on its waiting step, the goroutine is released and the caretaker keeps the execution.
+// False when a timer is already due and the execution goes on
+func (rr *routeRunner) wait(result *ExecutionResult, ctx *context, state *State) (bool, error) {
+	sw := state.wait
+	now := rr.clock.Now()
+
+	deadline, err := sw.deadline(ctx, now)
+	if err != nil {
+		return false, err
+	}
+
+	if sw.signal == "" && !deadline.After(now) {
+		return false, nil
+	}
+
+	if rr.caretaker == nil {
+		return false, errors.New("waiting step needs a caretaker")
+	}
+
+	rr.deadline = deadline
+	result.Status = Waiting
+	rr.finish(result)
+
+	if !deadline.IsZero() && rr.onWait != nil {
+		rr.onWait(rr.gid, sw.signal, deadline)
+	}
+
+	return true, nil
+}
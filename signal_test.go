@@ -0,0 +1,147 @@
+package orchestrator
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func approvalRoute(timeout time.Duration) *NonTransactionalRoute {
+	return NewNonTransactionalRoute("A").
+		AddNextStep("1", appendStep("1")).
+		WaitForSignal("approval", timeout).
+		AddNextStep("3", func(ctx *context) error {
+			if ctx.GetVariable("approved") != true {
+				return errors.New("not approved")
+			}
+
+			return appendStep("3")(ctx)
+		})
+}
+
+func TestOrchestrator_Signal(t *testing.T) {
+	journal := NewMemoryCaretaker()
+
+	orch := NewOrchestrator()
+	orch.SetCaretaker(journal)
+	_ = orch.Register(approvalRoute(0))
+	_ = orch.Initialization(nil)
+
+	ctx, _ := NewContextWithGid("gid")
+	result, err := orch.Exec("A", ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, Waiting, result.Status)
+	assert.Equal(t, "A_approval", result.State)
+
+	info, err := orch.Execution("gid")
+	assert.Nil(t, err)
+	assert.Equal(t, Waiting, info.Status)
+	assert.Equal(t, "approval", info.Signal)
+	assert.Nil(t, info.Deadline)
+
+	_, err = orch.Signal("gid", "payment", nil)
+	assert.NotNil(t, err)
+
+	// the waiting execution is resumed by another orchestrator on the same journal
+	restarted := NewOrchestrator()
+	restarted.SetCaretaker(journal)
+	_ = restarted.Register(approvalRoute(0))
+	_ = restarted.Initialization(nil)
+
+	result, err = restarted.Signal("gid", "approval", map[string]interface{}{"approved": true})
+	assert.Nil(t, err)
+	assert.Equal(t, Completed, result.Status)
+
+	info, _ = restarted.Execution("gid")
+	assert.Equal(t, "1;3;", info.Variables["STEPS"])
+	assert.Nil(t, info.Variables[signalHeaderKey])
+
+	// the signal is delivered once
+	_, err = restarted.Signal("gid", "approval", nil)
+	assert.NotNil(t, err)
+}
+
+func TestOrchestrator_SignalTimeout(t *testing.T) {
+	tests := []struct {
+		name   string
+		route  Route
+		status ExecutionStatus
+		steps  string
+	}{
+		{"failure", approvalRoute(10 * time.Millisecond), Aborted, "1;"},
+		{"rollback", NewTransactionalRoute("A").
+			AddNextStep("1", appendStep("1"), func(ctx context) error { return nil }).
+			WaitForSignal("approval", 10*time.Millisecond).
+			AddNextStep("3", appendStep("3"), nil), RolledBack, "1;"},
+		{"branch", NewNonTransactionalRoute("A").
+			AddNextStep("1", appendStep("1")).
+			WaitForSignal("approval", 10*time.Millisecond).ContinueOnTimeout().
+			When(SignalTimedOut("approval")).
+			AddNextStep("reminder", appendStep("reminder")).
+			End().
+			AddNextStep("3", appendStep("3")), Completed, "1;reminder;3;"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			orch := NewOrchestrator()
+			orch.SetCaretaker(NewMemoryCaretaker())
+			_ = orch.Register(tc.route)
+			_ = orch.Initialization(nil)
+
+			ctx, _ := NewContextWithGid("gid")
+			result, _ := orch.Exec("A", ctx)
+			assert.Equal(t, Waiting, result.Status)
+
+			info, _ := orch.Execution("gid")
+			assert.NotNil(t, info.Deadline)
+
+			var last *ExecutionInfo
+			for i := 0; i < 200; i++ {
+				if last, _ = orch.Execution("gid"); last.Status != Waiting && last.Status != Running {
+					break
+				}
+
+				time.Sleep(5 * time.Millisecond)
+			}
+
+			assert.Equal(t, tc.status, last.Status)
+			assert.Equal(t, tc.steps, last.Variables["STEPS"])
+			if tc.status != Completed {
+				assert.True(t, strings.Contains(last.Errors[0], ErrSignalTimeout.Error()), last.Errors)
+			}
+		})
+	}
+}
+
+func TestWaitForSignal_NoCaretaker(t *testing.T) {
+	orch := NewOrchestrator()
+	_ = orch.Register(approvalRoute(0))
+	_ = orch.Initialization(nil)
+
+	ctx, _ := NewContext()
+	result, _ := orch.Exec("A", ctx)
+
+	assert.Equal(t, Aborted, result.Status)
+	assert.Equal(t, "state A_approval: waiting step needs a caretaker (ABORT)", result.Errors[0].Error())
+}
+
+func TestWaitForSignal_Definition(t *testing.T) {
+	route := NewTransactionalRoute("A").
+		AddNextStep("1", doActionTest, undoActionTest).
+		WaitForSignal("approval", time.Hour).ContinueOnTimeout()
+
+	rd, err := NewRouteDefinition(route, testRegistry())
+	assert.Nil(t, err)
+	assert.Equal(t, StepDefinition{Signal: "approval", Timeout: "1h0m0s", ContinueOnTimeout: true}, rd.Steps[1])
+
+	built, err := rd.Build(testRegistry())
+	assert.Nil(t, err)
+	signal := built.(*TransactionalRoute).lastState.wait
+	assert.Equal(t, &stepWait{signal: "approval", timeout: time.Hour, continueOnTimeout: true}, signal)
+
+	g, _ := NewRouteGraph(built)
+	assert.Equal(t, GraphNode{Id: "n2", Label: "approval", Kind: SignalNodeKind}, g.Nodes[2])
+}
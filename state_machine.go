@@ -1,14 +1,46 @@
 package orchestrator
 
 import (
+	"errors"
+	"fmt"
 	"sort"
 	"time"
 )
 
+// ErrStepTimeout is returned when a state action takes longer than the state timeout,
+// the action keeps running in background
+var ErrStepTimeout = errors.New("step timeout")
+
+// ErrStepPanic is returned when a state action panics, the panic is a failure of the step
+var ErrStepPanic = errors.New("step panic")
+
+type stepKind int
+
+const (
+	// compensatable step is undone on rollback
+	compensatable stepKind = iota
+	// pivot step is the point of no return, no rollback goes back beyond it
+	pivot
+	// retriable step is retried forward and never compensated
+	retriable
+)
+
 type (
 	statemachine struct {
 		state   *State
 		context *context
+
+		// visited tells whether a state was executed, a rollback goes back along the branch taken at a merge and
+		// stops when the branch has no rollback transition; nil means the first transition which comply with the
+		// context is taken
+		visited func(s *State) bool
+
+		// recorded return the state a replayed execution took next, it's taken when a condition isn't replayable;
+		// nil means the replay fails on it like on any condition error
+		recorded func() string
+
+		// timeout times the action timeouts, nil means they're timed in real time
+		timeout func(d time.Duration) (<-chan time.Time, func())
 	}
 
 	State struct {
@@ -16,12 +48,33 @@ type (
 		transitions   []Transition
 		action        func(ctx *context) error
 		actionTimeout time.Duration
+
+		// transactional state rolls back by calling its undo action
+		transactional bool
+
+		// kind of the transactional step
+		kind stepKind
+
+		// retryPolicy the failed action is executed again according to the policy, nil means no retry
+		retryPolicy *RetryPolicy
+
+		// recorded the action outcome is kept in the caretaker and applied instead of the action when the
+		// attempt runs again
+		recorded bool
+
+		// calls routes which are called in order after the action
+		calls []*Endpoint
+
+		// wait parks the execution on the state until a signal or a deadline, nil when the state is a step
+		wait *stepWait
 	}
 
 	Transition struct {
-		to                   *State
-		priority             int
-		shouldTakeTransition func(ctx context) bool
+		to       *State
+		priority int
+
+		// shouldTakeTransition a condition which can't be evaluated returns an error, it fails the state
+		shouldTakeTransition func(ctx context) (bool, error)
 	}
 )
 
@@ -31,8 +84,57 @@ func (sm *statemachine) init(startState *State, ctx *context) {
 }
 
 func (sm *statemachine) doAction() (bool, error) {
-	err := sm.state.action(sm.context)
+	err := sm.execute()
+	next, nErr := sm.next()
+	if err == nil {
+		err = nErr
+	}
+
+	return next, err
+}
+
+// execute call the current state action
+func (sm *statemachine) execute() error {
+	if sm.state.actionTimeout <= 0 {
+		return recoverPanic(sm.state.name, func() error { return sm.state.action(sm.context) })
+	}
+
+	// the timeout is timed before the action starts so a fake clock moved by the action times it out
+	timeout := sm.timeout
+	if timeout == nil {
+		timeout = func(d time.Duration) (<-chan time.Time, func()) { return after(systemClock{}, d) }
+	}
+
+	expired, stop := timeout(sm.state.actionTimeout)
+	defer stop()
+
+	done := make(chan error, 1)
+	go func(s *State, ctx *context) {
+		done <- recoverPanic(s.name, func() error { return s.action(ctx) })
+	}(sm.state, sm.context)
+
+	select {
+	case err := <-done:
+		return err
+	case <-expired:
+		return fmt.Errorf("state %s: %w", sm.state.name, ErrStepTimeout)
+	}
+}
 
+// recoverPanic call the action of the state, a panic is returned as an ErrStepPanic failure
+func recoverPanic(state string, action func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("state %s: %w: %v", state, ErrStepPanic, r)
+		}
+	}()
+
+	return action()
+}
+
+// next move to the first transition which comply with the context, return false when there is no transition to take;
+// a condition which can't be evaluated is returned as an error and the state is left unchanged
+func (sm *statemachine) next() (bool, error) {
 	// TODO: <Decision making> the priority can be dynamic according to the context values or static and cache it for performance improvement
 	// sort based on priority
 	sort.Slice(sm.state.transitions[:], func(i, j int) bool {
@@ -40,13 +142,46 @@ func (sm *statemachine) doAction() (bool, error) {
 	})
 
 	for _, ts := range sm.state.transitions {
-		if ts.shouldTakeTransition(*sm.context) {
-			sm.state = ts.to
-			return true, err
+		ok, err := ts.shouldTakeTransition(*sm.context)
+		if err != nil {
+			if to := sm.recordedTransition(err); to != nil {
+				sm.state = to
+				return true, nil
+			}
+
+			return false, err
+		}
+
+		if !ok {
+			continue
+		}
+
+		if sm.visited != nil && rollingBack(sm.context) && !sm.visited(ts.to) {
+			continue
+		}
+
+		sm.state = ts.to
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// recordedTransition the target of the transition the replayed execution took, nil unless the condition isn't
+// replayable and the target is a transition of the state
+func (sm *statemachine) recordedTransition(err error) *State {
+	if sm.recorded == nil || !errors.Is(err, ErrNotReplayable) {
+		return nil
+	}
+
+	name := sm.recorded()
+	for _, ts := range sm.state.transitions {
+		if ts.to.name == name {
+			return ts.to
 		}
 	}
 
-	return false, err
+	return nil
 }
 
 func (sm *statemachine) getMemento() (*State, context) {
@@ -54,9 +189,28 @@ func (sm *statemachine) getMemento() (*State, context) {
 }
 
 func (s *State) createTransition(to *State, priority int, shouldTakeTransition func(ctx context) bool) {
+	s.createConditionTransition(to, priority, predicateCondition(shouldTakeTransition))
+}
+
+func (s *State) createConditionTransition(to *State, priority int, condition func(ctx context) (bool, error)) {
 	s.transitions = append(s.transitions, Transition{
 		to:                   to,
 		priority:             priority,
-		shouldTakeTransition: shouldTakeTransition,
+		shouldTakeTransition: condition,
 	})
 }
+
+// predicateCondition a condition of a predicate, it never fails
+func predicateCondition(predicate func(ctx context) bool) func(ctx context) (bool, error) {
+	return func(ctx context) (bool, error) {
+		return predicate(ctx), nil
+	}
+}
+
+// notCondition a condition negating another one, the failure is kept
+func notCondition(condition func(ctx context) (bool, error)) func(ctx context) (bool, error) {
+	return func(ctx context) (bool, error) {
+		ok, err := condition(ctx)
+		return !ok, err
+	}
+}
@@ -0,0 +1,258 @@
+package orchestrator
+
+import (
+	"errors"
+	"time"
+)
+
+// wakeUpHorizon bound the deadlines which are timed in memory while the timer service isn't started, the later
+// ones are resumed by ResumeDue or by the timer service once it's started
+const wakeUpHorizon = time.Minute
+
+type (
+	// Clock tell the time to the waiting steps and the timer service
+	Clock interface {
+		Now() time.Time
+	}
+
+	// Sleeper is a clock the retry intervals and the backoffs wait on, they wait in real time on other clocks
+	Sleeper interface {
+		Sleep(d time.Duration)
+	}
+
+	// Timer is a clock the step timeouts are timed on, they're timed in real time on other clocks
+	Timer interface {
+		After(d time.Duration) <-chan time.Time
+	}
+
+	systemClock struct{}
+
+	// wakeUpTimer resume a waiting execution at its deadline, it's kept in memory until then
+	wakeUpTimer struct {
+		deadline time.Time
+		stopped  chan struct{}
+		release  func()
+	}
+)
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// sleep wait the duration on the clock
+func sleep(c Clock, d time.Duration) {
+	if s, ok := c.(Sleeper); ok {
+		s.Sleep(d)
+		return
+	}
+
+	time.Sleep(d)
+}
+
+// after return the channel receiving the time once the duration is passed on the clock and the function stopping it
+func after(c Clock, d time.Duration) (<-chan time.Time, func()) {
+	if t, ok := c.(Timer); ok {
+		return t.After(d), func() {}
+	}
+
+	timer := time.NewTimer(d)
+	return timer.C, func() { timer.Stop() }
+}
+
+// SetClock replace the system clock of the waiting steps, the step timeouts and the timer service
+func (o *orchestrator) SetClock(c Clock) {
+	o.clock = c
+}
+
+// StartTimers start the timer service, the caretaker is scanned every interval to resume the waiting executions
+// which deadline is passed and only the ones due within the interval are timed in memory. The waits survive a
+// restart as long as the service is started again on the same caretaker
+func (o *orchestrator) StartTimers(interval time.Duration) error {
+	if o.caretaker == nil {
+		return errors.New("caretaker is not defined")
+	}
+
+	if interval <= 0 {
+		return errors.New("timer interval must be positive")
+	}
+
+	o.timersLock.Lock()
+	defer o.timersLock.Unlock()
+
+	if o.timersStop != nil {
+		return errors.New("timers are already started")
+	}
+
+	o.timersInterval = interval
+	o.timersStop = make(chan struct{})
+
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			o.scanTimers()
+
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}(o.timersStop)
+
+	return nil
+}
+
+// StopTimers stop the timer service and the in memory timers, the waiting executions stay in the caretaker
+func (o *orchestrator) StopTimers() {
+	o.timersLock.Lock()
+	defer o.timersLock.Unlock()
+
+	if o.timersStop != nil {
+		close(o.timersStop)
+		o.timersStop = nil
+	}
+
+	o.timersInterval = 0
+	for gid, wt := range o.timers {
+		wt.stop()
+		delete(o.timers, gid)
+	}
+}
+
+// ResumeDue resume the waiting executions which deadline is passed one after another and return their outcome,
+// the first execution which isn't admitted by the worker pool is returned as an error and stays waiting
+func (o *orchestrator) ResumeDue() ([]*ExecutionResult, error) {
+	due, _, err := o.dueRunners()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*ExecutionResult
+	var failed error
+	for _, rr := range due {
+		r, err := o.resumeRunner(rr)
+		if err != nil {
+			if failed == nil {
+				failed = err
+			}
+
+			continue
+		}
+
+		result = append(result, r)
+	}
+
+	return result, failed
+}
+
+// scanTimers resume the due executions in background and time the ones due within the interval
+func (o *orchestrator) scanTimers() {
+	due, pending, err := o.dueRunners()
+	if err != nil {
+		return
+	}
+
+	// an execution which isn't admitted by the worker pool is resumed by a later scan
+	for _, rr := range due {
+		_, _ = o.submitResume(rr)
+	}
+
+	for _, m := range pending {
+		o.scheduleWakeUp(m.Gid, m.Signal, *m.Deadline)
+	}
+}
+
+// dueRunners prepare the runners of the waiting executions which deadline is passed, the mementos of the
+// executions which are not due yet are returned as well
+func (o *orchestrator) dueRunners() ([]*routeRunner, []*memento, error) {
+	if o.caretaker == nil {
+		return nil, nil, errors.New("caretaker is not defined")
+	}
+
+	logs, err := o.caretaker.latest()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := o.clock.Now()
+
+	var due []*routeRunner
+	var pending []*memento
+	for _, log := range logs {
+		if isTriggerId(log.Id) {
+			continue
+		}
+
+		m, err := unmarshalMemento(log.Data)
+		if err != nil || m.Status != Waiting || m.Deadline == nil {
+			continue
+		}
+
+		if m.Deadline.After(now) {
+			pending = append(pending, m)
+			continue
+		}
+
+		// the execution may be resumed meanwhile
+		if rr, err := o.prepareDelivery(m.Gid, m.Signal, signalTimedOut, m.Deadline, nil); err == nil {
+			due = append(due, rr)
+		}
+	}
+
+	return due, pending, nil
+}
+
+// scheduleWakeUp resume the execution at the deadline on the clock, the deadlines beyond the timer service interval,
+// or beyond the wake up horizon when the service isn't started, are left to the caretaker scan
+func (o *orchestrator) scheduleWakeUp(gid string, signal string, deadline time.Time) {
+	o.timersLock.Lock()
+	defer o.timersLock.Unlock()
+
+	horizon := o.timersInterval
+	if horizon <= 0 {
+		horizon = wakeUpHorizon
+	}
+
+	wait := deadline.Sub(o.clock.Now())
+	if wait > horizon {
+		return
+	}
+
+	if wt := o.timers[gid]; wt != nil {
+		if wt.deadline.Equal(deadline) {
+			return
+		}
+
+		wt.stop()
+	}
+
+	expired, release := after(o.clock, wait)
+	wt := &wakeUpTimer{deadline: deadline, stopped: make(chan struct{}), release: release}
+	o.timers[gid] = wt
+
+	go func() {
+		select {
+		case <-expired:
+		case <-wt.stopped:
+			return
+		}
+
+		o.timersLock.Lock()
+		if o.timers[gid] == wt {
+			delete(o.timers, gid)
+		}
+		o.timersLock.Unlock()
+
+		if rr, err := o.prepareDelivery(gid, signal, signalTimedOut, &deadline, nil); err == nil {
+			_, _ = o.submitResume(rr)
+		}
+	}()
+}
+
+// stop the timer, the execution isn't resumed by it
+func (wt *wakeUpTimer) stop() {
+	close(wt.stopped)
+	wt.release()
+}
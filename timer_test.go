@@ -0,0 +1,275 @@
+package orchestrator
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testClock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+func (tc *testClock) Now() time.Time {
+	tc.lock.Lock()
+	defer tc.lock.Unlock()
+
+	return tc.now
+}
+
+func (tc *testClock) add(d time.Duration) {
+	tc.lock.Lock()
+	defer tc.lock.Unlock()
+
+	tc.now = tc.now.Add(d)
+}
+
+func reminderRoute(d time.Duration) *NonTransactionalRoute {
+	return NewNonTransactionalRoute("A").
+		AddNextStep("1", appendStep("1")).
+		Sleep("delay", d).
+		AddNextStep("reminder", appendStep("reminder"))
+}
+
+func newTimerOrchestrator(journal caretaker, clock Clock, route Route) *orchestrator {
+	orch := NewOrchestrator()
+	orch.SetCaretaker(journal)
+	orch.SetClock(clock)
+	_ = orch.Register(route)
+	_ = orch.Initialization(nil)
+
+	return orch
+}
+
+func TestOrchestrator_ResumeDue(t *testing.T) {
+	journal := NewMemoryCaretaker()
+	clock := &testClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	orch := newTimerOrchestrator(journal, clock, reminderRoute(72*time.Hour))
+
+	ctx, _ := NewContextWithGid("gid")
+	result, _ := orch.Exec("A", ctx)
+	assert.Equal(t, Waiting, result.Status)
+
+	info, _ := orch.Execution("gid")
+	assert.Equal(t, "", info.Signal)
+	assert.Equal(t, clock.now.Add(72*time.Hour), *info.Deadline)
+
+	due, err := orch.ResumeDue()
+	assert.Nil(t, err)
+	assert.Len(t, due, 0)
+
+	// the deadline passes while the process is down
+	orch.StopTimers()
+	clock.add(72 * time.Hour)
+	restarted := newTimerOrchestrator(journal, clock, reminderRoute(72*time.Hour))
+
+	_, err = restarted.Signal("gid", "", nil)
+	assert.NotNil(t, err)
+
+	due, err = restarted.ResumeDue()
+	assert.Nil(t, err)
+	assert.Len(t, due, 1)
+	assert.Equal(t, Completed, due[0].Status)
+
+	info, _ = restarted.Execution("gid")
+	assert.Equal(t, "1;reminder;", info.Variables["STEPS"])
+
+	due, _ = restarted.ResumeDue()
+	assert.Len(t, due, 0)
+}
+
+func TestWaitUntil(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		until    interface{}
+		status   ExecutionStatus
+		deadline time.Time
+	}{
+		{"future", now.Add(time.Hour), Waiting, now.Add(time.Hour)},
+		{"persisted future", now.Add(time.Hour).Format(time.RFC3339), Waiting, now.Add(time.Hour)},
+		{"past", now.Add(-time.Hour), Completed, time.Time{}},
+		{"not a time", 10, RolledBack, time.Time{}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			orch := newTimerOrchestrator(NewMemoryCaretaker(), &testClock{now: now}, NewTransactionalRoute("A").
+				AddNextStep("1", appendStep("1"), nil).
+				WaitUntil("remind", "remind_at").
+				AddNextStep("reminder", appendStep("reminder"), nil))
+
+			ctx, _ := NewContextWithGid("gid")
+			_ = ctx.SetVariable("remind_at", tc.until)
+			result, _ := orch.Exec("A", ctx)
+			assert.Equal(t, tc.status, result.Status)
+
+			info, _ := orch.Execution("gid")
+			if tc.deadline.IsZero() {
+				assert.Nil(t, info.Deadline)
+			} else {
+				assert.True(t, tc.deadline.Equal(*info.Deadline))
+			}
+		})
+	}
+}
+
+func TestOrchestrator_StartTimers(t *testing.T) {
+	journal := NewMemoryCaretaker()
+
+	orch := newTimerOrchestrator(journal, systemClock{}, reminderRoute(30*time.Millisecond))
+	ctx, _ := NewContextWithGid("gid")
+	_, _ = orch.Exec("A", ctx)
+
+	// the process stops before the wake-up
+	orch.StopTimers()
+
+	restarted := newTimerOrchestrator(journal, systemClock{}, reminderRoute(30*time.Millisecond))
+	assert.Nil(t, restarted.StartTimers(10*time.Millisecond))
+	assert.NotNil(t, restarted.StartTimers(10*time.Millisecond))
+	defer restarted.StopTimers()
+
+	var info *ExecutionInfo
+	for i := 0; i < 200; i++ {
+		if info, _ = restarted.Execution("gid"); info.Status == Completed {
+			break
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	assert.Equal(t, Completed, info.Status)
+	assert.Equal(t, "1;reminder;", info.Variables["STEPS"])
+
+	assert.NotNil(t, NewOrchestrator().StartTimers(time.Second))
+}
+
+func TestOrchestrator_StartTimers_LongWait(t *testing.T) {
+	orch := newTimerOrchestrator(NewMemoryCaretaker(), systemClock{}, reminderRoute(72*time.Hour))
+	assert.Nil(t, orch.StartTimers(time.Minute))
+	defer orch.StopTimers()
+
+	ctx, _ := NewContextWithGid("gid")
+	result, _ := orch.Exec("A", ctx)
+	assert.Equal(t, Waiting, result.Status)
+
+	// only the timer service remembers the long waits
+	orch.timersLock.Lock()
+	assert.Len(t, orch.timers, 0)
+	orch.timersLock.Unlock()
+
+	orch.executionsLock.Lock()
+	assert.Len(t, orch.executions, 0)
+	orch.executionsLock.Unlock()
+}
+
+// timingClock time the timers on the test clock, they expire when the clock is moved beyond their deadline
+type timingClock struct {
+	testClock
+	timers map[time.Time]chan time.Time
+}
+
+func (tc *timingClock) After(d time.Duration) <-chan time.Time {
+	tc.lock.Lock()
+	defer tc.lock.Unlock()
+
+	c := make(chan time.Time, 1)
+	tc.timers[tc.now.Add(d)] = c
+	return c
+}
+
+// armed wait until a timer is armed on the clock
+func (tc *timingClock) armed(t *testing.T) {
+	for i := 0; i < 200; i++ {
+		tc.lock.Lock()
+		n := len(tc.timers)
+		tc.lock.Unlock()
+
+		if n > 0 {
+			return
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	assert.Fail(t, "no timer is armed")
+}
+
+func newTimingClock() *timingClock {
+	return &timingClock{
+		testClock: testClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+		timers:    make(map[time.Time]chan time.Time),
+	}
+}
+
+func (tc *timingClock) advance(d time.Duration) {
+	tc.lock.Lock()
+	defer tc.lock.Unlock()
+
+	tc.now = tc.now.Add(d)
+	for deadline, c := range tc.timers {
+		if !deadline.After(tc.now) {
+			c <- tc.now
+			delete(tc.timers, deadline)
+		}
+	}
+}
+
+func TestOrchestrator_WakeUpOnClock(t *testing.T) {
+	clock := newTimingClock()
+
+	// the long waits are left to the caretaker scan while the timer service isn't started
+	orch := newTimerOrchestrator(NewMemoryCaretaker(), clock, reminderRoute(72*time.Hour))
+	ctx, _ := NewContextWithGid("long")
+	_, _ = orch.Exec("A", ctx)
+
+	orch.timersLock.Lock()
+	assert.Len(t, orch.timers, 0)
+	orch.timersLock.Unlock()
+
+	// the short ones are timed on the clock
+	orch = newTimerOrchestrator(NewMemoryCaretaker(), clock, reminderRoute(30*time.Second))
+	ctx, _ = NewContextWithGid("short")
+	_, _ = orch.Exec("A", ctx)
+
+	orch.timersLock.Lock()
+	assert.Len(t, orch.timers, 1)
+	orch.timersLock.Unlock()
+
+	clock.advance(30 * time.Second)
+
+	var info *ExecutionInfo
+	for i := 0; i < 200; i++ {
+		if info, _ = orch.Execution("short"); info.Status == Completed {
+			break
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	assert.Equal(t, Completed, info.Status)
+	assert.Equal(t, "1;reminder;", info.Variables["STEPS"])
+}
+
+func TestTimerStep_Definition(t *testing.T) {
+	route := NewNonTransactionalRoute("A").
+		AddNextStep("1", doActionTest).
+		Sleep("delay", 72*time.Hour).
+		WaitUntil("remind", "remind_at").To("B")
+
+	rd, err := NewRouteDefinition(route, testRegistry())
+	assert.Nil(t, err)
+	assert.Equal(t, StepDefinition{Name: "delay", Sleep: "72h0m0s"}, rd.Steps[1])
+	assert.Equal(t, StepDefinition{Name: "remind", Until: "remind_at", To: []EndpointDefinition{{Route: "B"}}}, rd.Steps[2])
+
+	built, err := rd.Build(testRegistry())
+	assert.Nil(t, err)
+	assert.Equal(t, &stepWait{until: "remind_at"}, built.(*NonTransactionalRoute).lastState.wait)
+
+	g := rd.Graph()
+	assert.Equal(t, TimerNodeKind, g.Nodes[2].Kind)
+	assert.Equal(t, "remind", g.Nodes[3].Label)
+}
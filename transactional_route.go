@@ -1,10 +1,16 @@
 package orchestrator
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 const (
 	transactionalRouteStatusHeaderKey = "TRANSACTIONAL_ROUTE_STATUS"
 	transactionalRouteStatusRollback  = "ROLLBACK"
+
+	// transactionalRoutePivotHeaderKey keep the name of the passed pivot state
+	transactionalRoutePivotHeaderKey = "TRANSACTIONAL_ROUTE_PIVOT"
 )
 
 type (
@@ -26,11 +32,22 @@ type (
 
 		// endpoint list
 		endpoints []*Endpoint
+
+		// sources consumer URIs starting the route executions
+		sources []string
+
+		// recorder keep the builder calls for the route definition
+		recorder routeRecorder
 	}
 
-	// force to present AddNextStep method only
+	// force to present AddNextStep methods only
 	onlyTRAddNextStep interface {
 		AddNextStep(name string, doAction func(ctx *context) error, undoAction func(ctx context) error) *TransactionalRoute
+		AddPivotStep(name string, doAction func(ctx *context) error) *TransactionalRoute
+		AddRetriableStep(name string, doAction func(ctx *context) error, retryPolicy RetryPolicy) *TransactionalRoute
+		WaitForSignal(name string, timeout time.Duration) *TransactionalRoute
+		Sleep(name string, duration time.Duration) *TransactionalRoute
+		WaitUntil(name string, key string) *TransactionalRoute
 	}
 )
 
@@ -42,13 +59,77 @@ func NewTransactionalRoute(id string) *TransactionalRoute {
 	}
 }
 
-// AddNextStep add new step to TransactionalRoute
+// AddNextStep add new compensatable step to TransactionalRoute
 func (tr *TransactionalRoute) AddNextStep(name string, doAction func(ctx *context) error, undoAction func(ctx context) error) *TransactionalRoute {
-	s := &State{
-		name:   fmt.Sprintf("%s_%s", tr.id, name),
-		action: tr.defineAction(doAction, undoAction),
-	}
+	tr.recorder.step(&recordedStep{name: name, kind: compensatable, action: doAction, undoAction: undoAction})
+
+	return tr.addStep(&State{
+		name:          fmt.Sprintf("%s_%s", tr.id, name),
+		action:        tr.defineAction(doAction, undoAction),
+		transactional: true,
+		kind:          compensatable,
+	})
+}
+
+// AddPivotStep add the point of no return to TransactionalRoute, a failed pivot step rolls back the previous steps
+// but once it's done no failure rolls back beyond it
+func (tr *TransactionalRoute) AddPivotStep(name string, doAction func(ctx *context) error) *TransactionalRoute {
+	tr.recorder.step(&recordedStep{name: name, kind: pivot, action: doAction})
+
+	return tr.addStep(&State{
+		name:          fmt.Sprintf("%s_%s", tr.id, name),
+		action:        tr.defineAction(doAction, nil),
+		transactional: true,
+		kind:          pivot,
+	})
+}
+
+// AddRetriableStep add a step which is retried forward according to the retry policy and never compensated,
+// the execution is aborted when the attempts are exhausted
+func (tr *TransactionalRoute) AddRetriableStep(name string, doAction func(ctx *context) error, retryPolicy RetryPolicy) *TransactionalRoute {
+	tr.recorder.step(&recordedStep{name: name, kind: retriable, action: doAction, retryPolicy: &retryPolicy})
+
+	return tr.addStep(&State{
+		name:          fmt.Sprintf("%s_%s", tr.id, name),
+		action:        tr.defineAction(doAction, nil),
+		transactional: true,
+		kind:          retriable,
+		retryPolicy:   &retryPolicy,
+	})
+}
+
+// WaitForSignal add a step parking the execution until the signal is delivered by the orchestrator Signal, the
+// signal payload is merged into the context. The step fails with ErrSignalTimeout when the timeout expires unless
+// it continues on timeout, zero means no timeout
+func (tr *TransactionalRoute) WaitForSignal(name string, timeout time.Duration) *TransactionalRoute {
+	return tr.addWaitStep(name, &stepWait{signal: name, timeout: timeout})
+}
+
+// Sleep add a step parking the execution for the duration, the timer service resumes it
+func (tr *TransactionalRoute) Sleep(name string, duration time.Duration) *TransactionalRoute {
+	return tr.addWaitStep(name, &stepWait{timeout: duration})
+}
+
+// WaitUntil add a step parking the execution until the time kept in the context variable, the step fails when
+// the variable isn't a time
+func (tr *TransactionalRoute) WaitUntil(name string, key string) *TransactionalRoute {
+	return tr.addWaitStep(name, &stepWait{until: key})
+}
+
+// addWaitStep there is nothing to undo on a waiting step
+func (tr *TransactionalRoute) addWaitStep(name string, sw *stepWait) *TransactionalRoute {
+	tr.recorder.step(&recordedStep{name: name, kind: compensatable, wait: sw})
 
+	return tr.addStep(&State{
+		name:          fmt.Sprintf("%s_%s", tr.id, name),
+		action:        tr.defineAction(sw.action, nil),
+		transactional: true,
+		kind:          compensatable,
+		wait:          sw,
+	})
+}
+
+func (tr *TransactionalRoute) addStep(s *State) *TransactionalRoute {
 	switch tr.routeState {
 	case When:
 		tr.addNextStepAfterWhen(s)
@@ -66,9 +147,9 @@ func (tr *TransactionalRoute) AddNextStep(name string, doAction func(ctx *contex
 			break
 		}
 
-		tr.defineTwoWayTransition(tr.lastState, Default, func(ctx context) bool {
+		tr.defineTwoWayTransition(tr.lastState, Default, predicateCondition(func(ctx context) bool {
 			return ctx.GetVariable(transactionalRouteStatusHeaderKey) != transactionalRouteStatusRollback
-		}, s)
+		}), s)
 	}
 
 	// update last State
@@ -78,15 +159,13 @@ func (tr *TransactionalRoute) AddNextStep(name string, doAction func(ctx *contex
 }
 
 func (tr *TransactionalRoute) addNextStepAfterWhen(s *State) {
-	tr.defineTwoWayTransition(tr.lastState, Condition, tr.predicateStateStack.getLast().predicate, s)
+	tr.defineTwoWayTransition(tr.lastState, Condition, tr.predicateStateStack.getLast().condition, s)
 }
 
 func (tr *TransactionalRoute) addNextStepAfterOtherwise(s *State) {
 	ps := tr.predicateStateStack.getLast()
 
-	tr.defineTwoWayTransition(ps.state, Condition, func(ctx context) bool {
-		return !ps.predicate(ctx)
-	}, s)
+	tr.defineTwoWayTransition(ps.state, Condition, notCondition(ps.condition), s)
 }
 
 //        condition       condition
@@ -97,33 +176,60 @@ func (tr *TransactionalRoute) addNextStepAfterOtherwise(s *State) {
 //        End State       End State
 func (tr *TransactionalRoute) addNextStepAfterEnd(s *State) {
 	cs := tr.predicateStateStack.pop().state
-	predicate := func(ctx context) bool {
+	condition := predicateCondition(func(ctx context) bool {
 		return true
-	}
+	})
 
 	// define Transition from last State of each condition State
 	states := tr.getEachTransitionLatestState(cs)
 	for _, es := range states {
-		tr.defineTwoWayTransition(es, Default, predicate, s)
+		tr.defineTwoWayTransition(es, Default, condition, s)
 	}
 
 	// Otherwise doesn't define
 	if len(states) < 2 {
 		// define a Transition from latest state with a conditional transition
-		tr.defineTwoWayTransition(cs, Default, predicate, s)
+		tr.defineTwoWayTransition(cs, Default, condition, s)
 	}
 }
 
 // When to define a condition
 func (tr *TransactionalRoute) When(predicate func(ctx context) bool) onlyTRAddNextStep {
+	return tr.when(predicate, predicateCondition(predicate))
+}
+
+// WhenCondition define a condition which can fail, the failure fails the step the condition follows
+func (tr *TransactionalRoute) WhenCondition(condition func(ctx context) (bool, error)) onlyTRAddNextStep {
+	return tr.when(condition, condition)
+}
+
+// when fn is the function the route definition names
+func (tr *TransactionalRoute) when(fn interface{}, condition func(ctx context) (bool, error)) onlyTRAddNextStep {
+	if !tr.recorder.stepped("When") {
+		return tr
+	}
+
+	tr.recorder.when(fn)
 	tr.routeState = When
-	tr.predicateStateStack.push(predicate, tr.lastState)
+	tr.predicateStateStack.push(condition, tr.lastState)
+
+	return tr
+}
+
+// WhenExpression condition with a compiled expression, unlike a closure the expression is written back in the route definition
+func (tr *TransactionalRoute) WhenExpression(e *Expression) onlyTRAddNextStep {
+	tr.WhenCondition(e.Condition())
+	tr.recorder.lastCondition().expression = e.String()
 
 	return tr
 }
 
 // Otherwise When condition
 func (tr *TransactionalRoute) Otherwise() onlyTRAddNextStep {
+	if !tr.recorder.otherwise() {
+		return tr
+	}
+
 	tr.routeState = Else
 
 	return tr
@@ -131,16 +237,106 @@ func (tr *TransactionalRoute) Otherwise() onlyTRAddNextStep {
 
 // End of condition
 func (tr *TransactionalRoute) End() onlyTRAddNextStep {
+	if !tr.recorder.end() {
+		return tr
+	}
+
 	tr.routeState = End
 
 	return tr
 }
 
+// From declare a consumer URI, each consumed message starts an execution once the orchestrator consumers are started
+func (tr *TransactionalRoute) From(uri string) *TransactionalRoute {
+	tr.sources = append(tr.sources, uri)
+
+	return tr
+}
+
+// To call the route or the component URI after the latest added step, the route continues once the call is finished
 func (tr *TransactionalRoute) To(id string) *TransactionalRoute {
-	tr.endpoints = append(tr.endpoints, &Endpoint{
-		To:    id,
+	if !tr.recorder.stepped("To " + id) {
+		return tr
+	}
+
+	e := &Endpoint{
+		To:    routeIdOf(id),
 		State: tr.lastState,
-	})
+	}
+
+	tr.endpoints = append(tr.endpoints, e)
+	tr.recorder.last.endpoints = append(tr.recorder.last.endpoints, e)
+	return tr
+}
+
+// ToIsolated call the route against an isolated context, the inputs are copied to the called route context
+// before the call and the outputs are copied back when it's finished
+func (tr *TransactionalRoute) ToIsolated(id string, inputs map[string]string, outputs map[string]string) *TransactionalRoute {
+	if !tr.recorder.stepped("ToIsolated " + id) {
+		return tr
+	}
+
+	e := &Endpoint{
+		To:       routeIdOf(id),
+		State:    tr.lastState,
+		Isolated: true,
+		Inputs:   inputs,
+		Outputs:  outputs,
+	}
+
+	tr.endpoints = append(tr.endpoints, e)
+	tr.recorder.last.endpoints = append(tr.recorder.last.endpoints, e)
+	return tr
+}
+
+// Timeout fail the latest added step when its action takes longer than the timeout
+func (tr *TransactionalRoute) Timeout(timeout time.Duration) *TransactionalRoute {
+	if !tr.recorder.stepped("Timeout") {
+		return tr
+	}
+
+	tr.lastState.actionTimeout = timeout
+	tr.recorder.last.timeout = timeout
+
+	return tr
+}
+
+// ContinueOnTimeout take the next step when the latest added signal step times out instead of failing,
+// SignalTimedOut tells whether the signal arrived
+func (tr *TransactionalRoute) ContinueOnTimeout() *TransactionalRoute {
+	if !tr.recorder.stepped("ContinueOnTimeout") {
+		return tr
+	}
+
+	if tr.lastState.wait != nil {
+		tr.lastState.wait.continueOnTimeout = true
+	}
+
+	return tr
+}
+
+// Retry execute the latest added step action again according to the retry policy when it fails
+func (tr *TransactionalRoute) Retry(retryPolicy RetryPolicy) *TransactionalRoute {
+	if !tr.recorder.stepped("Retry") {
+		return tr
+	}
+
+	tr.lastState.retryPolicy = &retryPolicy
+	tr.recorder.last.retryPolicy = &retryPolicy
+
+	return tr
+}
+
+// Recorded record the outcome of the latest added step in the caretaker, the context changes and the failure of an
+// attempt are applied instead of running the action again when the execution is resumed. A recorded failure keeps
+// its message only and the records are deleted once the execution is finished
+func (tr *TransactionalRoute) Recorded() *TransactionalRoute {
+	if !tr.recorder.stepped("Recorded") {
+		return tr
+	}
+
+	tr.lastState.recorded = true
+	tr.recorder.last.recorded = true
 
 	return tr
 }
@@ -157,9 +353,17 @@ func (tr *TransactionalRoute) GetEndpoints() []*Endpoint {
 	return tr.endpoints
 }
 
+func (tr *TransactionalRoute) GetSources() []string {
+	return tr.sources
+}
+
 func (tr *TransactionalRoute) defineAction(doAction func(ctx *context) error, undoAction func(ctx context) error) func(ctx *context) error {
 	return func(ctx *context) error {
 		if ctx.GetVariable(transactionalRouteStatusHeaderKey) == transactionalRouteStatusRollback {
+			if undoAction == nil {
+				return nil
+			}
+
 			return undoAction(*ctx)
 		}
 
@@ -167,13 +371,22 @@ func (tr *TransactionalRoute) defineAction(doAction func(ctx *context) error, un
 	}
 }
 
-func (tr *TransactionalRoute) defineTwoWayTransition(src *State, priority int, predicate func(context) bool, dst *State) {
+func (tr *TransactionalRoute) defineTwoWayTransition(src *State, priority int, condition func(context) (bool, error), dst *State) {
 	// define a Transition form src State to dst State
-	src.createTransition(dst, priority,
-		func(ctx context) bool {
-			return predicate(ctx) && ctx.GetVariable(transactionalRouteStatusHeaderKey) != transactionalRouteStatusRollback
+	src.createConditionTransition(dst, priority,
+		func(ctx context) (bool, error) {
+			if ctx.GetVariable(transactionalRouteStatusHeaderKey) == transactionalRouteStatusRollback {
+				return false, nil
+			}
+
+			return condition(ctx)
 		})
 
+	// there is no rollback into a pivot, the steps after it are compensated back to it
+	if src.kind == pivot {
+		return
+	}
+
 	// define a Transition from dst to src State for rollback
 	dst.createTransition(src, Default,
 		func(ctx context) bool {
@@ -198,7 +411,7 @@ func (tr *TransactionalRoute) getLatestState(state *State) *State {
 		ctx, _ := NewContext()
 		ctx.SetVariable(transactionalRouteStatusHeaderKey, transactionalRouteStatusRollback)
 		// choose happy path transition
-		if st.priority == Default && !st.shouldTakeTransition(*ctx) {
+		if ok, _ := st.shouldTakeTransition(*ctx); st.priority == Default && !ok {
 			return tr.getLatestState(st.to)
 		}
 	}
@@ -1,8 +1,10 @@
 package orchestrator
 
 import (
+	"errors"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func doActionTest(ctx *context) error {
@@ -19,10 +21,10 @@ func undoActionTest(ctx context) error {
 }
 
 func execTestRoute(route *State) *routeRunner {
-	runner := newRouteRunner(route, nil)
+	runner := newRouteRunner(route, nil, nil)
 	ctx, _ := NewContext()
 
-	runner.run(ctx, nil)
+	runner.run(ctx)
 	return runner
 }
 
@@ -127,3 +129,204 @@ func TestDefineTransactionalRoute(t *testing.T) {
 
 	assert.Equal(t, 4, rh.statemachine.context.GetVariable("HK"))
 }
+
+func TestDefinePivotTransactionalRoute(t *testing.T) {
+	r := NewTransactionalRoute("TEST_ROUTE").
+		AddNextStep("1", doActionTest, undoActionTest).
+		AddPivotStep("pivot", doActionTest).
+		AddNextStep("2", doActionTest, undoActionTest).
+		AddRetriableStep("3", doActionTest, RetryPolicy{MaxAttempts: 3})
+
+	forward := func(s *State) *State {
+		ctx, _ := NewContext()
+		for _, ts := range s.transitions {
+			if ok, _ := ts.shouldTakeTransition(*ctx); ok {
+				return ts.to
+			}
+		}
+
+		return nil
+	}
+
+	s1 := r.GetStartState()
+	sp := forward(s1)
+	s2 := forward(sp)
+	s3 := forward(s2)
+
+	// there is no rollback transition into the pivot
+	assert.Len(t, sp.transitions, 2)
+	assert.Len(t, s2.transitions, 1)
+	assert.Len(t, s3.transitions, 1)
+	assert.Equal(t, 3, s3.retryPolicy.MaxAttempts)
+
+	rh := execTestRoute(s1)
+
+	assert.Equal(t, 4, rh.statemachine.context.GetVariable("HK"))
+	assert.Equal(t, "TEST_ROUTE_pivot", rh.statemachine.context.GetVariable(transactionalRoutePivotHeaderKey))
+}
+
+func TestPivotTransactionalRoute_Failure(t *testing.T) {
+	failUntil := func(name string, attempts int) func(ctx *context) error {
+		attempt := 0
+		return func(ctx *context) error {
+			attempt++
+			return traceDo(name, attempt <= attempts)(ctx)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		route  *TransactionalRoute
+		status ExecutionStatus
+		trace  []string
+	}{
+		{"failed pivot rolls back",
+			NewTransactionalRoute("TR").
+				AddNextStep("1", traceDo("1", false), traceUndo("1", false)).
+				AddPivotStep("pivot", traceDo("pivot", true)).
+				AddRetriableStep("2", traceDo("2", false), RetryPolicy{}),
+			RolledBack, []string{"do_1", "do_pivot", "undo_1"}},
+		{"retriable step is retried forward",
+			NewTransactionalRoute("TR").
+				AddNextStep("1", traceDo("1", false), traceUndo("1", false)).
+				AddPivotStep("pivot", traceDo("pivot", false)).
+				AddRetriableStep("2", failUntil("2", 2), RetryPolicy{MaxAttempts: 3}),
+			Completed, []string{"do_1", "do_pivot", "do_2", "do_2", "do_2"}},
+		{"exhausted retriable step aborts",
+			NewTransactionalRoute("TR").
+				AddNextStep("1", traceDo("1", false), traceUndo("1", false)).
+				AddPivotStep("pivot", traceDo("pivot", false)).
+				AddRetriableStep("2", traceDo("2", true), RetryPolicy{MaxAttempts: 2}),
+			Aborted, []string{"do_1", "do_pivot", "do_2", "do_2"}},
+		{"compensatable step after pivot rolls back to the pivot and aborts",
+			NewTransactionalRoute("TR").
+				AddNextStep("1", traceDo("1", false), traceUndo("1", false)).
+				AddPivotStep("pivot", traceDo("pivot", false)).
+				AddNextStep("2", traceDo("2", false), traceUndo("2", false)).
+				AddNextStep("3", traceDo("3", true), traceUndo("3", false)),
+			Aborted, []string{"do_1", "do_pivot", "do_2", "do_3", "undo_2"}},
+		{"merged step after a passed pivot rolls back to the pivot and aborts",
+			NewTransactionalRoute("TR").
+				AddNextStep("1", traceDo("1", false), traceUndo("1", false)).
+				When(func(ctx context) bool { return true }).
+				AddPivotStep("pivot", traceDo("pivot", false)).
+				Otherwise().
+				AddNextStep("2", traceDo("2", false), traceUndo("2", false)).
+				End().
+				AddNextStep("3", traceDo("3", true), traceUndo("3", false)),
+			Aborted, []string{"do_1", "do_pivot", "do_3"}},
+		{"merged step after a pivot not taken rolls back",
+			NewTransactionalRoute("TR").
+				AddNextStep("1", traceDo("1", false), traceUndo("1", false)).
+				When(func(ctx context) bool { return false }).
+				AddPivotStep("pivot", traceDo("pivot", false)).
+				Otherwise().
+				AddNextStep("2", traceDo("2", false), traceUndo("2", false)).
+				End().
+				AddNextStep("3", traceDo("3", true), traceUndo("3", false)),
+			RolledBack, []string{"do_1", "do_2", "do_3", "undo_2", "undo_1"}},
+		{"rollback goes back along the branch taken",
+			NewTransactionalRoute("TR").
+				AddNextStep("1", traceDo("1", false), traceUndo("1", false)).
+				When(func(ctx context) bool { return true }).
+				AddNextStep("2", traceDo("2", false), traceUndo("2", false)).
+				Otherwise().
+				AddNextStep("3", traceDo("3", false), traceUndo("3", false)).
+				End().
+				AddNextStep("4", traceDo("4", true), traceUndo("4", false)),
+			RolledBack, []string{"do_1", "do_2", "do_4", "undo_2", "undo_1"}},
+		{"pivot in a branch",
+			NewTransactionalRoute("TR").
+				AddNextStep("1", traceDo("1", false), traceUndo("1", false)).
+				When(func(ctx context) bool { return false }).
+				AddPivotStep("pivot", traceDo("pivot", false)).
+				Otherwise().
+				AddNextStep("2", traceDo("2", true), traceUndo("2", false)),
+			RolledBack, []string{"do_1", "do_2", "undo_1"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, _ := NewContext()
+			result := newRouteRunner(tc.route.GetStartState(), nil, nil).run(ctx)
+
+			assert.Equal(t, tc.status, result.Status)
+			assert.Equal(t, tc.trace, ctx.GetVariable(traceKey))
+		})
+	}
+}
+
+func TestPivotTransactionalRoute_RecoveryStopsOnPivot(t *testing.T) {
+	r := NewTransactionalRoute("TR").
+		AddNextStep("1", traceDo("1", false), traceUndo("1", false)).
+		AddPivotStep("pivot", traceDo("pivot", false))
+
+	// a route handed over after the pivot rolls back to the caller pivot
+	callee := NewTransactionalRoute("CALLEE").
+		AddNextStep("1", traceDo("callee_1", true), traceUndo("callee_1", false))
+	r.lastState.createTransition(callee.GetStartState(), Default, func(ctx context) bool {
+		return true
+	})
+
+	recovery := NewNonTransactionalRoute(DefaultRecoveryRouteId).
+		AddNextStep("decide", func(ctx *context) error {
+			return ctx.SetVariable(RecoveryDecisionHeaderKey, Rollback)
+		})
+
+	ctx, _ := NewContext()
+	result := newRouteRunner(r.GetStartState(), recovery.GetStartState(), nil).run(ctx)
+
+	assert.Equal(t, Aborted, result.Status)
+	assert.Equal(t, Rollback, result.Errors[0].Decision)
+	assert.Equal(t, []string{"do_1", "do_pivot", "do_callee_1"}, ctx.GetVariable(traceKey))
+}
+
+func TestPivotTransactionalRoute_PivotInCalledRoute(t *testing.T) {
+	orch := NewOrchestrator()
+	orch.SetCaretaker(NewMemoryCaretaker())
+	_ = orch.Register(NewTransactionalRoute("A").
+		AddNextStep("1", traceDo("1", false), traceUndo("1", false)).
+		AddNextStep("2", traceDo("2", false), traceUndo("2", false)).To("B").
+		AddNextStep("3", traceDo("3", true), traceUndo("3", false)))
+	_ = orch.Register(NewTransactionalRoute("B").
+		AddPivotStep("pivot", traceDo("pivot", false)).
+		AddNextStep("1", traceDo("b1", false), traceUndo("b1", false)))
+	_ = orch.Initialization(nil)
+
+	ctx, _ := NewContextWithGid("gid")
+	result, err := orch.Exec("A", ctx)
+	assert.Nil(t, err)
+
+	// the called route is compensated back to its pivot, the caller steps before the call are not
+	assert.Equal(t, Aborted, result.Status)
+	assert.Equal(t, []string{"do_1", "do_2", "do_pivot", "do_b1", "do_3", "undo_b1"}, ctx.GetVariable(traceKey))
+
+	final, _ := orch.loadMemento("gid")
+	assert.Equal(t, Aborted, final.Status)
+	assert.Empty(t, final.Stack)
+}
+
+func TestRetriableStep_DefaultInterval(t *testing.T) {
+	clock := &sleepingClock{testClock: testClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}}
+
+	failures := 2
+	r := NewTransactionalRoute("TR").
+		AddRetriableStep("1", func(ctx *context) error {
+			if failures > 0 {
+				failures--
+				return errors.New("unavailable")
+			}
+
+			return nil
+		}, RetryPolicy{})
+
+	rr := newRouteRunner(r.GetStartState(), nil, nil)
+	rr.clock = clock
+
+	ctx, _ := NewContext()
+	result := rr.run(ctx)
+
+	// a step retried until it succeeds doesn't spin
+	assert.Equal(t, Completed, result.Status)
+	assert.Equal(t, []time.Duration{time.Second, time.Second}, clock.sleeps)
+}